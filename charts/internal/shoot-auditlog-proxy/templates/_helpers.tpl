@@ -36,13 +36,52 @@ Create chart name and version as used by the chart label.
 apiVersion: proxy.shoot-auditlog-service.extensions.config.gardener.cloud/v1alpha1
 kind: Configuration
 
+{{- if .Values.configuration.provider }}
 provider: {{ .Values.configuration.provider }}
 providerConfig: {{ toJson .Values.configuration.providerConfig }}
+{{- end }}
+{{- if .Values.configuration.outputs }}
+outputs: {{ toJson .Values.configuration.outputs }}
+{{- end }}
+{{- if .Values.configuration.rules }}
+rules: {{ toJson .Values.configuration.rules }}
+{{- end }}
+{{- if .Values.configuration.redactions }}
+redactions: {{ toJson .Values.configuration.redactions }}
+{{- end }}
+{{- if .Values.hashKey.secretName }}
+hashKeyFile: /etc/auditlog-proxy/hash-key/key
+{{- end }}
+{{- if .Values.configuration.shoot }}
+shoot: {{ toJson .Values.configuration.shoot }}
+{{- end }}
 webhookConfiguration:
   httpsPort: {{ .Values.configuration.serverPortHttps }}
   httpPort: {{ .Values.configuration.serverPortHttp }}
+  metricsPort: {{ .Values.configuration.serverPortMetrics }}
 
   tls:
     certFile: /etc/auditlog-proxy/tls/tls.crt
     keyFile: /etc/auditlog-proxy/tls/tls.key
+{{- if .Values.authentication.secretName }}
+  authentication:
+    tokenFile: /etc/auditlog-proxy/auth/tokens
+{{- end }}
+{{- if .Values.configuration.buffer.enabled }}
+buffer:
+  directory: /var/lib/auditlog-proxy/buffer
+  maxSize: {{ .Values.configuration.buffer.maxSize }}
+  syncPolicy: {{ .Values.configuration.buffer.syncPolicy }}
+{{- end }}
+shutdown:
+  gracePeriod: {{ .Values.configuration.shutdown.gracePeriod }}
+  readinessDelay: {{ .Values.configuration.shutdown.readinessDelay }}
+delivery:
+  maxRetries: {{ .Values.configuration.delivery.maxRetries }}
+  requestTimeout: {{ .Values.configuration.delivery.requestTimeout }}
+{{- if .Values.configuration.delivery.deadLetter.enabled }}
+  deadLetter:
+    file: /var/lib/auditlog-proxy/dead-letter/dead-letter.jsonl
+    maxFileSize: {{ .Values.configuration.delivery.deadLetter.maxFileSize }}
+{{- end }}
 {{- end }}
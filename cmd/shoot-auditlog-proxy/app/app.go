@@ -15,6 +15,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/logger"
 	proxyconf "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/config"
@@ -24,8 +25,9 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// NewServiceControllerCommand creates a new command that is used to start the Certificate Service controller.
-func NewProxyServerCommand() *cobra.Command {
+// NewProxyServerCommand creates a new command that is used to start the auditlog proxy.
+// The proxy is gracefully shut down when the given context is done.
+func NewProxyServerCommand(ctx context.Context) *cobra.Command {
 	proxyOptions := proxyconf.AuditlogProxyOptions{}
 
 	cmd := &cobra.Command{
@@ -44,7 +46,7 @@ func NewProxyServerCommand() *cobra.Command {
 				log.Error(err, "unable to parse configuration")
 				os.Exit(1)
 			}
-			if err := webhook.Run(log, proxyOptions.Completed()); err != nil {
+			if err := webhook.Run(ctx, log, proxyOptions.Completed()); err != nil {
 				log.Error(err, "unable to start webhook server")
 				os.Exit(1)
 			}
@@ -16,11 +16,13 @@ package main
 
 import (
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/cmd/shoot-auditlog-proxy/app"
+
+	"github.com/gardener/gardener-extensions/pkg/controller"
 	controllercmd "github.com/gardener/gardener-extensions/pkg/controller/cmd"
 )
 
 func main() {
-	cmd := app.NewProxyServerCommand()
+	cmd := app.NewProxyServerCommand(controller.SetupSignalHandlerContext())
 	if err := cmd.Execute(); err != nil {
 		controllercmd.LogErrAndExit(err, "error executing the main controller command")
 	}
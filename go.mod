@@ -3,6 +3,7 @@ module github.com/gardener/gardener-extension-shoot-auditlog-service
 go 1.13
 
 require (
+	github.com/Shopify/sarama v1.24.0
 	github.com/ahmetb/gen-crd-api-reference-docs v0.1.5
 	github.com/gardener/gardener v0.35.1-0.20200128130120-5b69a02f511a
 	github.com/gardener/gardener-extensions v1.3.0
@@ -10,20 +11,25 @@ require (
 	github.com/go-logr/zapr v0.1.1
 	github.com/gobuffalo/packr/v2 v2.1.0
 	github.com/golang/mock v1.3.1
+	github.com/golang/protobuf v1.3.2
+	github.com/golang/snappy v0.0.1
 	github.com/gorilla/mux v1.7.4
-	github.com/hashicorp/go-multierror v1.0.0
 	github.com/onsi/ginkgo v1.10.1
 	github.com/onsi/gomega v1.7.0
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v1.1.0
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
+	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c
 	go.uber.org/zap v1.10.0
+	golang.org/x/net v0.0.0-20191126235420-ef20fe5d7933
 	k8s.io/api v0.0.0-20191010143144-fbf594f18f80
 	k8s.io/apimachinery v0.0.0-20191016060620-86f2f1b9c076
 	k8s.io/apiserver v0.0.0-20191010014313-3893be10d307
 	k8s.io/client-go v11.0.1-0.20190409021438-1a26190bd76a+incompatible
 	k8s.io/code-generator v0.0.0-20190912054826-cd179ad6a269
 	k8s.io/component-base v0.0.0-20190918160511-547f6c5d7090
+	k8s.io/helm v2.14.2+incompatible
 	sigs.k8s.io/controller-runtime v0.4.0
 	sigs.k8s.io/yaml v1.1.0
 )
@@ -38,6 +38,19 @@ const AuditlogProxyServiceName = "shoot-auditlog-proxy"
 // AuditlogKubecfgSecretName is the name of the secret for the auditlog webhook kubeconfig
 const AuditlogKubecfgSecretName = "extension-shoot-auditlog-kubecfg"
 
+// AuditlogCASecretName is the name of the secret that contains the CA of the auditlog proxy serving certificate
+const AuditlogCASecretName = "extension-shoot-auditlog-ca"
+
+// AuditlogProxyTokenSecretName is the name of the secret that contains the tokens the auditlog proxy accepts
+const AuditlogProxyTokenSecretName = "extension-shoot-auditlog-proxy-token"
+
+// AuditlogProxyHashKeySecretName is the name of the secret that contains the key the auditlog proxy hashes redacted values with
+const AuditlogProxyHashKeySecretName = "extension-shoot-auditlog-proxy-hash-key"
+
+// AuditlogProxySecretsPath is the directory the backend provider secrets are mounted to in the auditlog proxy,
+// the secret of an output is mounted to the subdirectory with the name of the output
+const AuditlogProxySecretsPath = "/etc/auditlog-proxy/secrets"
+
 // AuditlogKubecfgSecretName is the name of the secret for the auditlog webhook kubeconfig
 const AuditlogPolicyConfigMapName = "extension-shoot-auditlog-policy"
 
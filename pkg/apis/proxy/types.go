@@ -16,6 +16,7 @@ package proxy
 
 import (
 	"encoding/json"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -25,23 +26,71 @@ import (
 type Configuration struct {
 	metav1.TypeMeta `json:",inline"`
 
-	// Provider is the storage provider to store the auditlogs
-	Provider string `json:"provider"`
+	// Provider is the storage provider to store the auditlogs.
+	// Provider and ProviderConfig are a shorthand for a single required output named "default".
+	// +optional
+	Provider string `json:"provider,omitempty"`
 
 	// ProviderConfig is the provider specific storage configuration
 	// +optional
-	ProviderConfig json.RawMessage `json:"providerConfig"`
+	ProviderConfig json.RawMessage `json:"providerConfig,omitempty"`
+
+	// Outputs are the named storage providers the auditlogs are sent to in addition to the Provider
+	// +optional
+	Outputs []Output `json:"outputs,omitempty"`
+
+	// Rules keep, drop or sample the audit events before they are sent to the outputs.
+	// The first rule that matches an event decides, events that match no rule are kept.
+	// +optional
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Redactions mask, hash or remove fields of the audit events before they are sent to the outputs.
+	// The data of secrets and the tokens of token reviews and token requests are always redacted.
+	// +optional
+	Redactions []Redaction `json:"redactions,omitempty"`
+
+	// HashKeyFile is the path to a file with the key of the HMAC that replaces the values of "Hash" redactions.
+	// It is required if a redaction uses the "Hash" action.
+	// +optional
+	HashKeyFile string `json:"hashKeyFile,omitempty"`
+
+	// Shoot identifies the shoot of the audit events.
+	// It is attached to every event as annotations that the providers map to their native metadata.
+	// +optional
+	Shoot *ShootMetadata `json:"shoot,omitempty"`
 
 	// WebhookConfiguration holds the webhook specific configuration
 	WebhookConfiguration WebhookConfiguration `json:"webhookConfiguration"`
+
+	// Buffer configures the on-disk write-ahead buffer between the webhook and the provider.
+	// Events are directly written to the provider if no buffer is configured.
+	// +optional
+	Buffer *BufferConfiguration `json:"buffer,omitempty"`
+
+	// Delivery configures the retries and the dead-letter handling of failed deliveries to the provider
+	// +optional
+	Delivery *DeliveryConfiguration `json:"delivery,omitempty"`
+
+	// Shutdown configures the graceful shutdown of the proxy
+	// +optional
+	Shutdown *ShutdownConfiguration `json:"shutdown,omitempty"`
 }
 
 // WebhookConfiguration contains information about the proxy webhook endpoint
 type WebhookConfiguration struct {
 	HTTPPort  int `json:"httpPort"`
 	HTTPSPort int `json:"httpsPort"`
+	// MetricsPort is the port of the server that exposes the prometheus metrics of the proxy.
+	// Metrics are not exposed if no port is defined.
+	// +optional
+	MetricsPort int `json:"metricsPort,omitempty"`
 
 	TLS TLSConfiguration `json:"tls"`
+
+	// Authentication configures how the kube-apiserver is authenticated.
+	// Requests are not authenticated if no authentication is configured.
+	// +optional
+	Authentication *AuthenticationConfiguration `json:"authentication,omitempty"`
 }
 
 // TLSConfiguration contains the cert and key for tls
@@ -49,3 +98,314 @@ type TLSConfiguration struct {
 	CertFile string `json:"certFile"`
 	KeyFile  string `json:"keyFile"`
 }
+
+// AuthenticationConfiguration contains information about the authentication of the webhook requests
+type AuthenticationConfiguration struct {
+	// TokenFile is the path to a file that contains the accepted bearer tokens, one per line.
+	// The file is reloaded when it changes so that tokens can be rotated without a restart.
+	TokenFile string `json:"tokenFile"`
+}
+
+// ShutdownConfiguration contains information about the graceful shutdown of the proxy
+type ShutdownConfiguration struct {
+	// GracePeriod is the maximum time to finish in-flight requests and to drain the buffer after a termination signal
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+
+	// ReadinessDelay is the time new requests are still accepted after the readiness check started failing
+	// so that the endpoints of the proxy can be updated before the servers are stopped
+	// +optional
+	ReadinessDelay *metav1.Duration `json:"readinessDelay,omitempty"`
+}
+
+// SyncPolicy defines when buffered data is flushed to disk
+type SyncPolicy string
+
+const (
+	// SyncPolicyAlways flushes every received event list to disk before the request is acknowledged
+	SyncPolicyAlways SyncPolicy = "always"
+	// SyncPolicyInterval flushes the buffer to disk periodically
+	SyncPolicyInterval SyncPolicy = "interval"
+	// SyncPolicyNever leaves flushing to the operating system
+	SyncPolicyNever SyncPolicy = "never"
+)
+
+// BufferConfiguration contains information about the on-disk write-ahead buffer
+type BufferConfiguration struct {
+	// Directory is the path where the buffer segments are stored
+	Directory string `json:"directory"`
+
+	// MaxSize is the maximum size of all buffer segments on disk.
+	// New event lists are rejected if the buffer is full.
+	// +optional
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+
+	// SegmentSize is the size after which a new segment file is started
+	// +optional
+	SegmentSize *resource.Quantity `json:"segmentSize,omitempty"`
+
+	// SyncPolicy defines when the buffer is flushed to disk.
+	// One of "always", "interval" or "never".
+	// +optional
+	SyncPolicy SyncPolicy `json:"syncPolicy,omitempty"`
+
+	// SyncInterval is the interval the buffer is flushed to disk with the "interval" sync policy
+	// +optional
+	SyncInterval *metav1.Duration `json:"syncInterval,omitempty"`
+}
+
+// DeliveryConfiguration contains information about how events are delivered to the provider
+type DeliveryConfiguration struct {
+	// MaxRetries is the maximum number of retries of transient failures
+	// before the events are written to the dead-letter sink.
+	// +optional
+	MaxRetries *int32 `json:"maxRetries,omitempty"`
+
+	// InitialBackoff is the time to wait before the first retry
+	// +optional
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+
+	// MaxBackoff is the maximum time to wait between two retries
+	// +optional
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+
+	// RequestTimeout is the maximum time the delivery of the events of a request including all retries may take
+	// if no buffer is configured. It has to be shorter than the timeout of the audit webhook of the kube-apiserver.
+	// Events that are not delivered within the timeout are written to the dead-letter sink.
+	// +optional
+	RequestTimeout *metav1.Duration `json:"requestTimeout,omitempty"`
+
+	// DeadLetter configures where events are stored that cannot be delivered to the provider.
+	// Events that cannot be delivered are retried until they succeed if no dead-letter sink is configured.
+	// +optional
+	DeadLetter *DeadLetterConfiguration `json:"deadLetter,omitempty"`
+}
+
+// DeadLetterConfiguration contains information about where undeliverable events are stored.
+// Exactly one of File or Provider has to be defined.
+type DeadLetterConfiguration struct {
+	// File is the path to a file where undeliverable events are appended as json lines
+	// +optional
+	File string `json:"file,omitempty"`
+
+	// MaxFileSize is the maximum size of the dead-letter file. The file is never rotated, events that would exceed the size
+	// are not acknowledged and retried until the file is moved away.
+	// +optional
+	MaxFileSize *resource.Quantity `json:"maxFileSize,omitempty"`
+
+	// Provider is the storage provider that receives undeliverable events
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// ProviderConfig is the provider specific configuration of the dead-letter provider
+	// +optional
+	ProviderConfig json.RawMessage `json:"providerConfig,omitempty"`
+}
+
+// DefaultOutputName is the name of the output that is defined by the Provider and ProviderConfig shorthand
+const DefaultOutputName = "default"
+
+// FailurePolicy defines how failed deliveries to an output are handled
+type FailurePolicy string
+
+const (
+	// FailurePolicyRequired fails the delivery of an event list if it cannot be delivered to the output
+	FailurePolicyRequired FailurePolicy = "Required"
+	// FailurePolicyBestEffort only logs failed deliveries to the output
+	FailurePolicyBestEffort FailurePolicy = "BestEffort"
+)
+
+// Output is a named storage provider the audit events are sent to
+type Output struct {
+	// Name is the unique name of the output
+	Name string `json:"name"`
+
+	// Provider is the storage provider of the output
+	Provider string `json:"provider"`
+
+	// ProviderConfig is the provider specific storage configuration
+	// +optional
+	ProviderConfig json.RawMessage `json:"providerConfig,omitempty"`
+
+	// SecretDir is the directory of a mounted secret with the credentials of the provider.
+	// The secret is injected into the provider and reloaded whenever it changes.
+	// +optional
+	SecretDir string `json:"secretDir,omitempty"`
+
+	// Filter selects the events that are sent to the output.
+	// All events are sent to the output if no filter is defined.
+	// +optional
+	Filter *OutputFilter `json:"filter,omitempty"`
+
+	// FailurePolicy defines how failed deliveries to the output are handled.
+	// One of "Required" or "BestEffort".
+	// +optional
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// OutputFilter selects the audit events that are sent to an output
+type OutputFilter struct {
+	// Include selects the events that match any of the matchers.
+	// All events are selected if no matcher is defined.
+	// +optional
+	Include []EventMatcher `json:"include,omitempty"`
+
+	// Exclude drops the selected events that match any of the matchers
+	// +optional
+	Exclude []EventMatcher `json:"exclude,omitempty"`
+}
+
+// EventMatcher matches audit events.
+// An event matches if it matches all defined fields and a field matches if it contains the value of the event.
+type EventMatcher struct {
+	// Verbs are the matched request verbs
+	// +optional
+	Verbs []string `json:"verbs,omitempty"`
+
+	// Users are the matched usernames
+	// +optional
+	Users []string `json:"users,omitempty"`
+
+	// UserGroups are the matched user groups. The event matches if the user is in one of the groups.
+	// +optional
+	UserGroups []string `json:"userGroups,omitempty"`
+
+	// Namespaces are the matched namespaces of the requested objects
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Resources are the matched resources of the requested objects
+	// +optional
+	Resources []GroupResources `json:"resources,omitempty"`
+
+	// Levels are the matched audit levels
+	// +optional
+	Levels []string `json:"levels,omitempty"`
+
+	// Stages are the matched audit stages
+	// +optional
+	Stages []string `json:"stages,omitempty"`
+
+	// ResponseCodes are the matched response codes. Events without a response status do not match.
+	// +optional
+	ResponseCodes []int32 `json:"responseCodes,omitempty"`
+
+	// UserAgents are prefixes of the matched user agents, e.g. "kubectl/"
+	// +optional
+	UserAgents []string `json:"userAgents,omitempty"`
+}
+
+// GroupResources are the resources of an api group
+type GroupResources struct {
+	// Group is the name of the api group. The empty string represents the core api group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Resources are the matched resources of the group.
+	// All resources of the group are matched if empty.
+	// +optional
+	Resources []string `json:"resources,omitempty"`
+}
+
+// RuleAction is the action that is applied to the audit events that match a rule
+type RuleAction string
+
+const (
+	// RuleActionKeep keeps the events
+	RuleActionKeep RuleAction = "Keep"
+	// RuleActionDrop drops the events
+	RuleActionDrop RuleAction = "Drop"
+	// RuleActionSample keeps a ratio of the events
+	RuleActionSample RuleAction = "Sample"
+)
+
+// Rule keeps, drops or samples the audit events that it matches
+type Rule struct {
+	// Name is the unique name of the rule
+	Name string `json:"name"`
+
+	// Match selects the events of the rule.
+	// All events are selected if no field is defined.
+	// +optional
+	Match EventMatcher `json:"match,omitempty"`
+
+	// Action is applied to the selected events.
+	// One of "Keep", "Drop" or "Sample".
+	Action RuleAction `json:"action"`
+
+	// SampleRatio is the ratio of the selected events that are kept by the "Sample" action, e.g. 0.01 keeps 1% of the events.
+	// The events are sampled by their audit id, so that all stages of a request are either kept or dropped.
+	// +optional
+	SampleRatio *float64 `json:"sampleRatio,omitempty"`
+}
+
+// RedactionAction is the action that is applied to the fields selected by a redaction
+type RedactionAction string
+
+const (
+	// RedactionActionMask replaces the values with "******"
+	RedactionActionMask RedactionAction = "Mask"
+	// RedactionActionHash replaces the values with their keyed HMAC-SHA256
+	RedactionActionHash RedactionAction = "Hash"
+	// RedactionActionRemove removes the fields
+	RedactionActionRemove RedactionAction = "Remove"
+)
+
+// Redaction masks, hashes or removes fields of the audit events that it matches
+type Redaction struct {
+	// Name is the unique name of the redaction
+	Name string `json:"name"`
+
+	// Match selects the events of the redaction.
+	// All events are selected if no field is defined.
+	// +optional
+	Match EventMatcher `json:"match,omitempty"`
+
+	// Paths select the redacted fields of the audit.k8s.io/v1 event, e.g. "requestObject.spec.containers[*].env[*].value".
+	// Fields are separated by dots, "*" selects all fields of an object, "[*]" selects all items of a list
+	// and "['name']" selects fields whose name contains dots, e.g. "annotations['example.com/token']".
+	// Paths have to start with one of "requestObject", "responseObject", "annotations", "user", "impersonatedUser",
+	// "sourceIPs", "userAgent" or "requestURI".
+	Paths []string `json:"paths"`
+
+	// Action is applied to the selected fields.
+	// Objects and lists are masked or hashed value by value so that their structure is preserved.
+	// One of "Mask", "Hash" or "Remove".
+	Action RedactionAction `json:"action"`
+
+	// Pattern is a regular expression that limits the "Mask" and "Hash" actions to the matching parts of string values,
+	// e.g. "(?i)bearer\\s+\\S+" to redact bearer tokens.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// ShootMetadata identifies the shoot whose audit events are handled by the proxy
+type ShootMetadata struct {
+	// Name is the name of the shoot
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// Project is the name of the project of the shoot
+	// +optional
+	Project string `json:"project,omitempty"`
+
+	// TechnicalID is the technical id of the shoot, i.e. the name of its namespace in the seed
+	// +optional
+	TechnicalID string `json:"technicalID,omitempty"`
+
+	// UID is the unique id of the shoot
+	// +optional
+	UID string `json:"uid,omitempty"`
+
+	// Seed is the name of the seed of the shoot
+	// +optional
+	Seed string `json:"seed,omitempty"`
+
+	// Region is the region of the shoot
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// ProviderType is the infrastructure provider type of the shoot, e.g. "aws"
+	// +optional
+	ProviderType string `json:"providerType,omitempty"`
+}
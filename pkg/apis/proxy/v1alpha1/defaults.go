@@ -14,8 +14,84 @@
 
 package v1alpha1
 
-import "k8s.io/apimachinery/pkg/runtime"
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
 
 func addDefaultingFuncs(scheme *runtime.Scheme) error {
 	return RegisterDefaults(scheme)
 }
+
+// SetDefaults_Configuration sets default values for Configuration objects.
+func SetDefaults_Configuration(obj *Configuration) {
+	if obj.Delivery == nil {
+		obj.Delivery = &DeliveryConfiguration{}
+	}
+	if obj.Shutdown == nil {
+		obj.Shutdown = &ShutdownConfiguration{}
+	}
+}
+
+// SetDefaults_BufferConfiguration sets default values for BufferConfiguration objects.
+func SetDefaults_BufferConfiguration(obj *BufferConfiguration) {
+	if obj.MaxSize == nil {
+		maxSize := resource.MustParse("1Gi")
+		obj.MaxSize = &maxSize
+	}
+	if obj.SegmentSize == nil {
+		segmentSize := resource.MustParse("8Mi")
+		obj.SegmentSize = &segmentSize
+	}
+	if len(obj.SyncPolicy) == 0 {
+		obj.SyncPolicy = SyncPolicyInterval
+	}
+	if obj.SyncInterval == nil {
+		obj.SyncInterval = &metav1.Duration{Duration: time.Second}
+	}
+}
+
+// SetDefaults_DeliveryConfiguration sets default values for DeliveryConfiguration objects.
+func SetDefaults_DeliveryConfiguration(obj *DeliveryConfiguration) {
+	if obj.MaxRetries == nil {
+		maxRetries := int32(5)
+		obj.MaxRetries = &maxRetries
+	}
+	if obj.InitialBackoff == nil {
+		obj.InitialBackoff = &metav1.Duration{Duration: time.Second}
+	}
+	if obj.MaxBackoff == nil {
+		obj.MaxBackoff = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if obj.RequestTimeout == nil {
+		obj.RequestTimeout = &metav1.Duration{Duration: 10 * time.Second}
+	}
+}
+
+// SetDefaults_DeadLetterConfiguration sets default values for DeadLetterConfiguration objects.
+func SetDefaults_DeadLetterConfiguration(obj *DeadLetterConfiguration) {
+	if obj.File != "" && obj.MaxFileSize == nil {
+		maxFileSize := resource.MustParse("64Mi")
+		obj.MaxFileSize = &maxFileSize
+	}
+}
+
+// SetDefaults_Output sets default values for Output objects.
+func SetDefaults_Output(obj *Output) {
+	if len(obj.FailurePolicy) == 0 {
+		obj.FailurePolicy = FailurePolicyRequired
+	}
+}
+
+// SetDefaults_ShutdownConfiguration sets default values for ShutdownConfiguration objects.
+func SetDefaults_ShutdownConfiguration(obj *ShutdownConfiguration) {
+	if obj.GracePeriod == nil {
+		obj.GracePeriod = &metav1.Duration{Duration: 30 * time.Second}
+	}
+	if obj.ReadinessDelay == nil {
+		obj.ReadinessDelay = &metav1.Duration{Duration: 5 * time.Second}
+	}
+}
@@ -25,6 +25,8 @@ import (
 	unsafe "unsafe"
 
 	proxy "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	resource "k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -36,6 +38,26 @@ func init() {
 // RegisterConversions adds conversion functions to the given scheme.
 // Public to allow building arbitrary schemes.
 func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*AuthenticationConfiguration)(nil), (*proxy.AuthenticationConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_AuthenticationConfiguration_To_proxy_AuthenticationConfiguration(a.(*AuthenticationConfiguration), b.(*proxy.AuthenticationConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.AuthenticationConfiguration)(nil), (*AuthenticationConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_AuthenticationConfiguration_To_v1alpha1_AuthenticationConfiguration(a.(*proxy.AuthenticationConfiguration), b.(*AuthenticationConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*BufferConfiguration)(nil), (*proxy.BufferConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_BufferConfiguration_To_proxy_BufferConfiguration(a.(*BufferConfiguration), b.(*proxy.BufferConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.BufferConfiguration)(nil), (*BufferConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_BufferConfiguration_To_v1alpha1_BufferConfiguration(a.(*proxy.BufferConfiguration), b.(*BufferConfiguration), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*Configuration)(nil), (*proxy.Configuration)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_Configuration_To_proxy_Configuration(a.(*Configuration), b.(*proxy.Configuration), scope)
 	}); err != nil {
@@ -46,6 +68,106 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*DeadLetterConfiguration)(nil), (*proxy.DeadLetterConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_DeadLetterConfiguration_To_proxy_DeadLetterConfiguration(a.(*DeadLetterConfiguration), b.(*proxy.DeadLetterConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.DeadLetterConfiguration)(nil), (*DeadLetterConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_DeadLetterConfiguration_To_v1alpha1_DeadLetterConfiguration(a.(*proxy.DeadLetterConfiguration), b.(*DeadLetterConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*DeliveryConfiguration)(nil), (*proxy.DeliveryConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_DeliveryConfiguration_To_proxy_DeliveryConfiguration(a.(*DeliveryConfiguration), b.(*proxy.DeliveryConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.DeliveryConfiguration)(nil), (*DeliveryConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_DeliveryConfiguration_To_v1alpha1_DeliveryConfiguration(a.(*proxy.DeliveryConfiguration), b.(*DeliveryConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*EventMatcher)(nil), (*proxy.EventMatcher)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_EventMatcher_To_proxy_EventMatcher(a.(*EventMatcher), b.(*proxy.EventMatcher), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.EventMatcher)(nil), (*EventMatcher)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_EventMatcher_To_v1alpha1_EventMatcher(a.(*proxy.EventMatcher), b.(*EventMatcher), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*GroupResources)(nil), (*proxy.GroupResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_GroupResources_To_proxy_GroupResources(a.(*GroupResources), b.(*proxy.GroupResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.GroupResources)(nil), (*GroupResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_GroupResources_To_v1alpha1_GroupResources(a.(*proxy.GroupResources), b.(*GroupResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Output)(nil), (*proxy.Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Output_To_proxy_Output(a.(*Output), b.(*proxy.Output), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.Output)(nil), (*Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_Output_To_v1alpha1_Output(a.(*proxy.Output), b.(*Output), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*OutputFilter)(nil), (*proxy.OutputFilter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OutputFilter_To_proxy_OutputFilter(a.(*OutputFilter), b.(*proxy.OutputFilter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.OutputFilter)(nil), (*OutputFilter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_OutputFilter_To_v1alpha1_OutputFilter(a.(*proxy.OutputFilter), b.(*OutputFilter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Redaction)(nil), (*proxy.Redaction)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Redaction_To_proxy_Redaction(a.(*Redaction), b.(*proxy.Redaction), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.Redaction)(nil), (*Redaction)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_Redaction_To_v1alpha1_Redaction(a.(*proxy.Redaction), b.(*Redaction), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Rule)(nil), (*proxy.Rule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Rule_To_proxy_Rule(a.(*Rule), b.(*proxy.Rule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.Rule)(nil), (*Rule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_Rule_To_v1alpha1_Rule(a.(*proxy.Rule), b.(*Rule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ShootMetadata)(nil), (*proxy.ShootMetadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ShootMetadata_To_proxy_ShootMetadata(a.(*ShootMetadata), b.(*proxy.ShootMetadata), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.ShootMetadata)(nil), (*ShootMetadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_ShootMetadata_To_v1alpha1_ShootMetadata(a.(*proxy.ShootMetadata), b.(*ShootMetadata), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*ShutdownConfiguration)(nil), (*proxy.ShutdownConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_ShutdownConfiguration_To_proxy_ShutdownConfiguration(a.(*ShutdownConfiguration), b.(*proxy.ShutdownConfiguration), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*proxy.ShutdownConfiguration)(nil), (*ShutdownConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_proxy_ShutdownConfiguration_To_v1alpha1_ShutdownConfiguration(a.(*proxy.ShutdownConfiguration), b.(*ShutdownConfiguration), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*TLSConfiguration)(nil), (*proxy.TLSConfiguration)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_TLSConfiguration_To_proxy_TLSConfiguration(a.(*TLSConfiguration), b.(*proxy.TLSConfiguration), scope)
 	}); err != nil {
@@ -69,12 +191,68 @@ func RegisterConversions(s *runtime.Scheme) error {
 	return nil
 }
 
+func autoConvert_v1alpha1_AuthenticationConfiguration_To_proxy_AuthenticationConfiguration(in *AuthenticationConfiguration, out *proxy.AuthenticationConfiguration, s conversion.Scope) error {
+	out.TokenFile = in.TokenFile
+	return nil
+}
+
+// Convert_v1alpha1_AuthenticationConfiguration_To_proxy_AuthenticationConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_AuthenticationConfiguration_To_proxy_AuthenticationConfiguration(in *AuthenticationConfiguration, out *proxy.AuthenticationConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_AuthenticationConfiguration_To_proxy_AuthenticationConfiguration(in, out, s)
+}
+
+func autoConvert_proxy_AuthenticationConfiguration_To_v1alpha1_AuthenticationConfiguration(in *proxy.AuthenticationConfiguration, out *AuthenticationConfiguration, s conversion.Scope) error {
+	out.TokenFile = in.TokenFile
+	return nil
+}
+
+// Convert_proxy_AuthenticationConfiguration_To_v1alpha1_AuthenticationConfiguration is an autogenerated conversion function.
+func Convert_proxy_AuthenticationConfiguration_To_v1alpha1_AuthenticationConfiguration(in *proxy.AuthenticationConfiguration, out *AuthenticationConfiguration, s conversion.Scope) error {
+	return autoConvert_proxy_AuthenticationConfiguration_To_v1alpha1_AuthenticationConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_BufferConfiguration_To_proxy_BufferConfiguration(in *BufferConfiguration, out *proxy.BufferConfiguration, s conversion.Scope) error {
+	out.Directory = in.Directory
+	out.MaxSize = (*resource.Quantity)(unsafe.Pointer(in.MaxSize))
+	out.SegmentSize = (*resource.Quantity)(unsafe.Pointer(in.SegmentSize))
+	out.SyncPolicy = proxy.SyncPolicy(in.SyncPolicy)
+	out.SyncInterval = (*v1.Duration)(unsafe.Pointer(in.SyncInterval))
+	return nil
+}
+
+// Convert_v1alpha1_BufferConfiguration_To_proxy_BufferConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_BufferConfiguration_To_proxy_BufferConfiguration(in *BufferConfiguration, out *proxy.BufferConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_BufferConfiguration_To_proxy_BufferConfiguration(in, out, s)
+}
+
+func autoConvert_proxy_BufferConfiguration_To_v1alpha1_BufferConfiguration(in *proxy.BufferConfiguration, out *BufferConfiguration, s conversion.Scope) error {
+	out.Directory = in.Directory
+	out.MaxSize = (*resource.Quantity)(unsafe.Pointer(in.MaxSize))
+	out.SegmentSize = (*resource.Quantity)(unsafe.Pointer(in.SegmentSize))
+	out.SyncPolicy = SyncPolicy(in.SyncPolicy)
+	out.SyncInterval = (*v1.Duration)(unsafe.Pointer(in.SyncInterval))
+	return nil
+}
+
+// Convert_proxy_BufferConfiguration_To_v1alpha1_BufferConfiguration is an autogenerated conversion function.
+func Convert_proxy_BufferConfiguration_To_v1alpha1_BufferConfiguration(in *proxy.BufferConfiguration, out *BufferConfiguration, s conversion.Scope) error {
+	return autoConvert_proxy_BufferConfiguration_To_v1alpha1_BufferConfiguration(in, out, s)
+}
+
 func autoConvert_v1alpha1_Configuration_To_proxy_Configuration(in *Configuration, out *proxy.Configuration, s conversion.Scope) error {
 	out.Provider = in.Provider
 	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	out.Outputs = *(*[]proxy.Output)(unsafe.Pointer(&in.Outputs))
+	out.Rules = *(*[]proxy.Rule)(unsafe.Pointer(&in.Rules))
+	out.Redactions = *(*[]proxy.Redaction)(unsafe.Pointer(&in.Redactions))
+	out.HashKeyFile = in.HashKeyFile
+	out.Shoot = (*proxy.ShootMetadata)(unsafe.Pointer(in.Shoot))
 	if err := Convert_v1alpha1_WebhookConfiguration_To_proxy_WebhookConfiguration(&in.WebhookConfiguration, &out.WebhookConfiguration, s); err != nil {
 		return err
 	}
+	out.Buffer = (*proxy.BufferConfiguration)(unsafe.Pointer(in.Buffer))
+	out.Delivery = (*proxy.DeliveryConfiguration)(unsafe.Pointer(in.Delivery))
+	out.Shutdown = (*proxy.ShutdownConfiguration)(unsafe.Pointer(in.Shutdown))
 	return nil
 }
 
@@ -86,9 +264,17 @@ func Convert_v1alpha1_Configuration_To_proxy_Configuration(in *Configuration, ou
 func autoConvert_proxy_Configuration_To_v1alpha1_Configuration(in *proxy.Configuration, out *Configuration, s conversion.Scope) error {
 	out.Provider = in.Provider
 	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	out.Outputs = *(*[]Output)(unsafe.Pointer(&in.Outputs))
+	out.Rules = *(*[]Rule)(unsafe.Pointer(&in.Rules))
+	out.Redactions = *(*[]Redaction)(unsafe.Pointer(&in.Redactions))
+	out.HashKeyFile = in.HashKeyFile
+	out.Shoot = (*ShootMetadata)(unsafe.Pointer(in.Shoot))
 	if err := Convert_proxy_WebhookConfiguration_To_v1alpha1_WebhookConfiguration(&in.WebhookConfiguration, &out.WebhookConfiguration, s); err != nil {
 		return err
 	}
+	out.Buffer = (*BufferConfiguration)(unsafe.Pointer(in.Buffer))
+	out.Delivery = (*DeliveryConfiguration)(unsafe.Pointer(in.Delivery))
+	out.Shutdown = (*ShutdownConfiguration)(unsafe.Pointer(in.Shutdown))
 	return nil
 }
 
@@ -97,6 +283,286 @@ func Convert_proxy_Configuration_To_v1alpha1_Configuration(in *proxy.Configurati
 	return autoConvert_proxy_Configuration_To_v1alpha1_Configuration(in, out, s)
 }
 
+func autoConvert_v1alpha1_DeadLetterConfiguration_To_proxy_DeadLetterConfiguration(in *DeadLetterConfiguration, out *proxy.DeadLetterConfiguration, s conversion.Scope) error {
+	out.File = in.File
+	out.MaxFileSize = (*resource.Quantity)(unsafe.Pointer(in.MaxFileSize))
+	out.Provider = in.Provider
+	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	return nil
+}
+
+// Convert_v1alpha1_DeadLetterConfiguration_To_proxy_DeadLetterConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_DeadLetterConfiguration_To_proxy_DeadLetterConfiguration(in *DeadLetterConfiguration, out *proxy.DeadLetterConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_DeadLetterConfiguration_To_proxy_DeadLetterConfiguration(in, out, s)
+}
+
+func autoConvert_proxy_DeadLetterConfiguration_To_v1alpha1_DeadLetterConfiguration(in *proxy.DeadLetterConfiguration, out *DeadLetterConfiguration, s conversion.Scope) error {
+	out.File = in.File
+	out.MaxFileSize = (*resource.Quantity)(unsafe.Pointer(in.MaxFileSize))
+	out.Provider = in.Provider
+	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	return nil
+}
+
+// Convert_proxy_DeadLetterConfiguration_To_v1alpha1_DeadLetterConfiguration is an autogenerated conversion function.
+func Convert_proxy_DeadLetterConfiguration_To_v1alpha1_DeadLetterConfiguration(in *proxy.DeadLetterConfiguration, out *DeadLetterConfiguration, s conversion.Scope) error {
+	return autoConvert_proxy_DeadLetterConfiguration_To_v1alpha1_DeadLetterConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_DeliveryConfiguration_To_proxy_DeliveryConfiguration(in *DeliveryConfiguration, out *proxy.DeliveryConfiguration, s conversion.Scope) error {
+	out.MaxRetries = (*int32)(unsafe.Pointer(in.MaxRetries))
+	out.InitialBackoff = (*v1.Duration)(unsafe.Pointer(in.InitialBackoff))
+	out.MaxBackoff = (*v1.Duration)(unsafe.Pointer(in.MaxBackoff))
+	out.RequestTimeout = (*v1.Duration)(unsafe.Pointer(in.RequestTimeout))
+	out.DeadLetter = (*proxy.DeadLetterConfiguration)(unsafe.Pointer(in.DeadLetter))
+	return nil
+}
+
+// Convert_v1alpha1_DeliveryConfiguration_To_proxy_DeliveryConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_DeliveryConfiguration_To_proxy_DeliveryConfiguration(in *DeliveryConfiguration, out *proxy.DeliveryConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_DeliveryConfiguration_To_proxy_DeliveryConfiguration(in, out, s)
+}
+
+func autoConvert_proxy_DeliveryConfiguration_To_v1alpha1_DeliveryConfiguration(in *proxy.DeliveryConfiguration, out *DeliveryConfiguration, s conversion.Scope) error {
+	out.MaxRetries = (*int32)(unsafe.Pointer(in.MaxRetries))
+	out.InitialBackoff = (*v1.Duration)(unsafe.Pointer(in.InitialBackoff))
+	out.MaxBackoff = (*v1.Duration)(unsafe.Pointer(in.MaxBackoff))
+	out.RequestTimeout = (*v1.Duration)(unsafe.Pointer(in.RequestTimeout))
+	out.DeadLetter = (*DeadLetterConfiguration)(unsafe.Pointer(in.DeadLetter))
+	return nil
+}
+
+// Convert_proxy_DeliveryConfiguration_To_v1alpha1_DeliveryConfiguration is an autogenerated conversion function.
+func Convert_proxy_DeliveryConfiguration_To_v1alpha1_DeliveryConfiguration(in *proxy.DeliveryConfiguration, out *DeliveryConfiguration, s conversion.Scope) error {
+	return autoConvert_proxy_DeliveryConfiguration_To_v1alpha1_DeliveryConfiguration(in, out, s)
+}
+
+func autoConvert_v1alpha1_EventMatcher_To_proxy_EventMatcher(in *EventMatcher, out *proxy.EventMatcher, s conversion.Scope) error {
+	out.Verbs = *(*[]string)(unsafe.Pointer(&in.Verbs))
+	out.Users = *(*[]string)(unsafe.Pointer(&in.Users))
+	out.UserGroups = *(*[]string)(unsafe.Pointer(&in.UserGroups))
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	out.Resources = *(*[]proxy.GroupResources)(unsafe.Pointer(&in.Resources))
+	out.Levels = *(*[]string)(unsafe.Pointer(&in.Levels))
+	out.Stages = *(*[]string)(unsafe.Pointer(&in.Stages))
+	out.ResponseCodes = *(*[]int32)(unsafe.Pointer(&in.ResponseCodes))
+	out.UserAgents = *(*[]string)(unsafe.Pointer(&in.UserAgents))
+	return nil
+}
+
+// Convert_v1alpha1_EventMatcher_To_proxy_EventMatcher is an autogenerated conversion function.
+func Convert_v1alpha1_EventMatcher_To_proxy_EventMatcher(in *EventMatcher, out *proxy.EventMatcher, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EventMatcher_To_proxy_EventMatcher(in, out, s)
+}
+
+func autoConvert_proxy_EventMatcher_To_v1alpha1_EventMatcher(in *proxy.EventMatcher, out *EventMatcher, s conversion.Scope) error {
+	out.Verbs = *(*[]string)(unsafe.Pointer(&in.Verbs))
+	out.Users = *(*[]string)(unsafe.Pointer(&in.Users))
+	out.UserGroups = *(*[]string)(unsafe.Pointer(&in.UserGroups))
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	out.Resources = *(*[]GroupResources)(unsafe.Pointer(&in.Resources))
+	out.Levels = *(*[]string)(unsafe.Pointer(&in.Levels))
+	out.Stages = *(*[]string)(unsafe.Pointer(&in.Stages))
+	out.ResponseCodes = *(*[]int32)(unsafe.Pointer(&in.ResponseCodes))
+	out.UserAgents = *(*[]string)(unsafe.Pointer(&in.UserAgents))
+	return nil
+}
+
+// Convert_proxy_EventMatcher_To_v1alpha1_EventMatcher is an autogenerated conversion function.
+func Convert_proxy_EventMatcher_To_v1alpha1_EventMatcher(in *proxy.EventMatcher, out *EventMatcher, s conversion.Scope) error {
+	return autoConvert_proxy_EventMatcher_To_v1alpha1_EventMatcher(in, out, s)
+}
+
+func autoConvert_v1alpha1_GroupResources_To_proxy_GroupResources(in *GroupResources, out *proxy.GroupResources, s conversion.Scope) error {
+	out.Group = in.Group
+	out.Resources = *(*[]string)(unsafe.Pointer(&in.Resources))
+	return nil
+}
+
+// Convert_v1alpha1_GroupResources_To_proxy_GroupResources is an autogenerated conversion function.
+func Convert_v1alpha1_GroupResources_To_proxy_GroupResources(in *GroupResources, out *proxy.GroupResources, s conversion.Scope) error {
+	return autoConvert_v1alpha1_GroupResources_To_proxy_GroupResources(in, out, s)
+}
+
+func autoConvert_proxy_GroupResources_To_v1alpha1_GroupResources(in *proxy.GroupResources, out *GroupResources, s conversion.Scope) error {
+	out.Group = in.Group
+	out.Resources = *(*[]string)(unsafe.Pointer(&in.Resources))
+	return nil
+}
+
+// Convert_proxy_GroupResources_To_v1alpha1_GroupResources is an autogenerated conversion function.
+func Convert_proxy_GroupResources_To_v1alpha1_GroupResources(in *proxy.GroupResources, out *GroupResources, s conversion.Scope) error {
+	return autoConvert_proxy_GroupResources_To_v1alpha1_GroupResources(in, out, s)
+}
+
+func autoConvert_v1alpha1_Output_To_proxy_Output(in *Output, out *proxy.Output, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Provider = in.Provider
+	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	out.SecretDir = in.SecretDir
+	out.Filter = (*proxy.OutputFilter)(unsafe.Pointer(in.Filter))
+	out.FailurePolicy = proxy.FailurePolicy(in.FailurePolicy)
+	return nil
+}
+
+// Convert_v1alpha1_Output_To_proxy_Output is an autogenerated conversion function.
+func Convert_v1alpha1_Output_To_proxy_Output(in *Output, out *proxy.Output, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Output_To_proxy_Output(in, out, s)
+}
+
+func autoConvert_proxy_Output_To_v1alpha1_Output(in *proxy.Output, out *Output, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Provider = in.Provider
+	out.ProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.ProviderConfig))
+	out.SecretDir = in.SecretDir
+	out.Filter = (*OutputFilter)(unsafe.Pointer(in.Filter))
+	out.FailurePolicy = FailurePolicy(in.FailurePolicy)
+	return nil
+}
+
+// Convert_proxy_Output_To_v1alpha1_Output is an autogenerated conversion function.
+func Convert_proxy_Output_To_v1alpha1_Output(in *proxy.Output, out *Output, s conversion.Scope) error {
+	return autoConvert_proxy_Output_To_v1alpha1_Output(in, out, s)
+}
+
+func autoConvert_v1alpha1_OutputFilter_To_proxy_OutputFilter(in *OutputFilter, out *proxy.OutputFilter, s conversion.Scope) error {
+	out.Include = *(*[]proxy.EventMatcher)(unsafe.Pointer(&in.Include))
+	out.Exclude = *(*[]proxy.EventMatcher)(unsafe.Pointer(&in.Exclude))
+	return nil
+}
+
+// Convert_v1alpha1_OutputFilter_To_proxy_OutputFilter is an autogenerated conversion function.
+func Convert_v1alpha1_OutputFilter_To_proxy_OutputFilter(in *OutputFilter, out *proxy.OutputFilter, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OutputFilter_To_proxy_OutputFilter(in, out, s)
+}
+
+func autoConvert_proxy_OutputFilter_To_v1alpha1_OutputFilter(in *proxy.OutputFilter, out *OutputFilter, s conversion.Scope) error {
+	out.Include = *(*[]EventMatcher)(unsafe.Pointer(&in.Include))
+	out.Exclude = *(*[]EventMatcher)(unsafe.Pointer(&in.Exclude))
+	return nil
+}
+
+// Convert_proxy_OutputFilter_To_v1alpha1_OutputFilter is an autogenerated conversion function.
+func Convert_proxy_OutputFilter_To_v1alpha1_OutputFilter(in *proxy.OutputFilter, out *OutputFilter, s conversion.Scope) error {
+	return autoConvert_proxy_OutputFilter_To_v1alpha1_OutputFilter(in, out, s)
+}
+
+func autoConvert_v1alpha1_Redaction_To_proxy_Redaction(in *Redaction, out *proxy.Redaction, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_v1alpha1_EventMatcher_To_proxy_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Paths = *(*[]string)(unsafe.Pointer(&in.Paths))
+	out.Action = proxy.RedactionAction(in.Action)
+	out.Pattern = in.Pattern
+	return nil
+}
+
+// Convert_v1alpha1_Redaction_To_proxy_Redaction is an autogenerated conversion function.
+func Convert_v1alpha1_Redaction_To_proxy_Redaction(in *Redaction, out *proxy.Redaction, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Redaction_To_proxy_Redaction(in, out, s)
+}
+
+func autoConvert_proxy_Redaction_To_v1alpha1_Redaction(in *proxy.Redaction, out *Redaction, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_proxy_EventMatcher_To_v1alpha1_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Paths = *(*[]string)(unsafe.Pointer(&in.Paths))
+	out.Action = RedactionAction(in.Action)
+	out.Pattern = in.Pattern
+	return nil
+}
+
+// Convert_proxy_Redaction_To_v1alpha1_Redaction is an autogenerated conversion function.
+func Convert_proxy_Redaction_To_v1alpha1_Redaction(in *proxy.Redaction, out *Redaction, s conversion.Scope) error {
+	return autoConvert_proxy_Redaction_To_v1alpha1_Redaction(in, out, s)
+}
+
+func autoConvert_v1alpha1_Rule_To_proxy_Rule(in *Rule, out *proxy.Rule, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_v1alpha1_EventMatcher_To_proxy_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Action = proxy.RuleAction(in.Action)
+	out.SampleRatio = (*float64)(unsafe.Pointer(in.SampleRatio))
+	return nil
+}
+
+// Convert_v1alpha1_Rule_To_proxy_Rule is an autogenerated conversion function.
+func Convert_v1alpha1_Rule_To_proxy_Rule(in *Rule, out *proxy.Rule, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Rule_To_proxy_Rule(in, out, s)
+}
+
+func autoConvert_proxy_Rule_To_v1alpha1_Rule(in *proxy.Rule, out *Rule, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_proxy_EventMatcher_To_v1alpha1_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Action = RuleAction(in.Action)
+	out.SampleRatio = (*float64)(unsafe.Pointer(in.SampleRatio))
+	return nil
+}
+
+// Convert_proxy_Rule_To_v1alpha1_Rule is an autogenerated conversion function.
+func Convert_proxy_Rule_To_v1alpha1_Rule(in *proxy.Rule, out *Rule, s conversion.Scope) error {
+	return autoConvert_proxy_Rule_To_v1alpha1_Rule(in, out, s)
+}
+
+func autoConvert_v1alpha1_ShootMetadata_To_proxy_ShootMetadata(in *ShootMetadata, out *proxy.ShootMetadata, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Project = in.Project
+	out.TechnicalID = in.TechnicalID
+	out.UID = in.UID
+	out.Seed = in.Seed
+	out.Region = in.Region
+	out.ProviderType = in.ProviderType
+	return nil
+}
+
+// Convert_v1alpha1_ShootMetadata_To_proxy_ShootMetadata is an autogenerated conversion function.
+func Convert_v1alpha1_ShootMetadata_To_proxy_ShootMetadata(in *ShootMetadata, out *proxy.ShootMetadata, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ShootMetadata_To_proxy_ShootMetadata(in, out, s)
+}
+
+func autoConvert_proxy_ShootMetadata_To_v1alpha1_ShootMetadata(in *proxy.ShootMetadata, out *ShootMetadata, s conversion.Scope) error {
+	out.Name = in.Name
+	out.Project = in.Project
+	out.TechnicalID = in.TechnicalID
+	out.UID = in.UID
+	out.Seed = in.Seed
+	out.Region = in.Region
+	out.ProviderType = in.ProviderType
+	return nil
+}
+
+// Convert_proxy_ShootMetadata_To_v1alpha1_ShootMetadata is an autogenerated conversion function.
+func Convert_proxy_ShootMetadata_To_v1alpha1_ShootMetadata(in *proxy.ShootMetadata, out *ShootMetadata, s conversion.Scope) error {
+	return autoConvert_proxy_ShootMetadata_To_v1alpha1_ShootMetadata(in, out, s)
+}
+
+func autoConvert_v1alpha1_ShutdownConfiguration_To_proxy_ShutdownConfiguration(in *ShutdownConfiguration, out *proxy.ShutdownConfiguration, s conversion.Scope) error {
+	out.GracePeriod = (*v1.Duration)(unsafe.Pointer(in.GracePeriod))
+	out.ReadinessDelay = (*v1.Duration)(unsafe.Pointer(in.ReadinessDelay))
+	return nil
+}
+
+// Convert_v1alpha1_ShutdownConfiguration_To_proxy_ShutdownConfiguration is an autogenerated conversion function.
+func Convert_v1alpha1_ShutdownConfiguration_To_proxy_ShutdownConfiguration(in *ShutdownConfiguration, out *proxy.ShutdownConfiguration, s conversion.Scope) error {
+	return autoConvert_v1alpha1_ShutdownConfiguration_To_proxy_ShutdownConfiguration(in, out, s)
+}
+
+func autoConvert_proxy_ShutdownConfiguration_To_v1alpha1_ShutdownConfiguration(in *proxy.ShutdownConfiguration, out *ShutdownConfiguration, s conversion.Scope) error {
+	out.GracePeriod = (*v1.Duration)(unsafe.Pointer(in.GracePeriod))
+	out.ReadinessDelay = (*v1.Duration)(unsafe.Pointer(in.ReadinessDelay))
+	return nil
+}
+
+// Convert_proxy_ShutdownConfiguration_To_v1alpha1_ShutdownConfiguration is an autogenerated conversion function.
+func Convert_proxy_ShutdownConfiguration_To_v1alpha1_ShutdownConfiguration(in *proxy.ShutdownConfiguration, out *ShutdownConfiguration, s conversion.Scope) error {
+	return autoConvert_proxy_ShutdownConfiguration_To_v1alpha1_ShutdownConfiguration(in, out, s)
+}
+
 func autoConvert_v1alpha1_TLSConfiguration_To_proxy_TLSConfiguration(in *TLSConfiguration, out *proxy.TLSConfiguration, s conversion.Scope) error {
 	out.CertFile = in.CertFile
 	out.KeyFile = in.KeyFile
@@ -122,9 +588,11 @@ func Convert_proxy_TLSConfiguration_To_v1alpha1_TLSConfiguration(in *proxy.TLSCo
 func autoConvert_v1alpha1_WebhookConfiguration_To_proxy_WebhookConfiguration(in *WebhookConfiguration, out *proxy.WebhookConfiguration, s conversion.Scope) error {
 	out.HTTPPort = in.HTTPPort
 	out.HTTPSPort = in.HTTPSPort
+	out.MetricsPort = in.MetricsPort
 	if err := Convert_v1alpha1_TLSConfiguration_To_proxy_TLSConfiguration(&in.TLS, &out.TLS, s); err != nil {
 		return err
 	}
+	out.Authentication = (*proxy.AuthenticationConfiguration)(unsafe.Pointer(in.Authentication))
 	return nil
 }
 
@@ -136,9 +604,11 @@ func Convert_v1alpha1_WebhookConfiguration_To_proxy_WebhookConfiguration(in *Web
 func autoConvert_proxy_WebhookConfiguration_To_v1alpha1_WebhookConfiguration(in *proxy.WebhookConfiguration, out *WebhookConfiguration, s conversion.Scope) error {
 	out.HTTPPort = in.HTTPPort
 	out.HTTPSPort = in.HTTPSPort
+	out.MetricsPort = in.MetricsPort
 	if err := Convert_proxy_TLSConfiguration_To_v1alpha1_TLSConfiguration(&in.TLS, &out.TLS, s); err != nil {
 		return err
 	}
+	out.Authentication = (*AuthenticationConfiguration)(unsafe.Pointer(in.Authentication))
 	return nil
 }
 
@@ -28,5 +28,26 @@ import (
 // Public to allow building arbitrary schemes.
 // All generated defaulters are covering - they call all nested defaulters.
 func RegisterDefaults(scheme *runtime.Scheme) error {
+	scheme.AddTypeDefaultingFunc(&Configuration{}, func(obj interface{}) { SetObjectDefaults_Configuration(obj.(*Configuration)) })
 	return nil
 }
+
+func SetObjectDefaults_Configuration(in *Configuration) {
+	SetDefaults_Configuration(in)
+	for i := range in.Outputs {
+		a := &in.Outputs[i]
+		SetDefaults_Output(a)
+	}
+	if in.Buffer != nil {
+		SetDefaults_BufferConfiguration(in.Buffer)
+	}
+	if in.Delivery != nil {
+		SetDefaults_DeliveryConfiguration(in.Delivery)
+		if in.Delivery.DeadLetter != nil {
+			SetDefaults_DeadLetterConfiguration(in.Delivery.DeadLetter)
+		}
+	}
+	if in.Shutdown != nil {
+		SetDefaults_ShutdownConfiguration(in.Shutdown)
+	}
+}
@@ -16,8 +16,11 @@ package validation
 
 import (
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/redaction"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"regexp"
 )
 
 // ValidateConfiguration validates the passed configuration instance.
@@ -34,5 +37,229 @@ func ValidateConfiguration(config *proxy.Configuration) field.ErrorList {
 		}
 	}
 
+	if port := config.WebhookConfiguration.MetricsPort; port != 0 && (port == config.WebhookConfiguration.HTTPPort || port == config.WebhookConfiguration.HTTPSPort) {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("webhookConfiguration", "metricsPort"), port, "The metrics port must differ from the webhook ports"))
+	}
+
+	if authn := config.WebhookConfiguration.Authentication; authn != nil && authn.TokenFile == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("webhookConfiguration", "authentication", "tokenFile"), "A token file has to be defined for the authentication"))
+	}
+
+	if config.Provider == "" && len(config.Outputs) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("provider"), "A provider or at least one output has to be defined"))
+	}
+	allErrs = append(allErrs, validateOutputs(config.Outputs, config.Provider != "", field.NewPath("outputs"))...)
+	allErrs = append(allErrs, ValidateRules(config.Rules, field.NewPath("rules"))...)
+	allErrs = append(allErrs, ValidateRedactions(config.Redactions, field.NewPath("redactions"))...)
+	if config.HashKeyFile == "" {
+		for _, r := range config.Redactions {
+			if r.Action == proxy.RedactionActionHash {
+				allErrs = append(allErrs, field.Required(field.NewPath("hashKeyFile"), "A hash key file has to be defined for redactions with the Hash action"))
+				break
+			}
+		}
+	}
+
+	if config.Buffer != nil {
+		allErrs = append(allErrs, validateBufferConfiguration(config.Buffer, field.NewPath("buffer"))...)
+	}
+
+	if config.Delivery != nil {
+		allErrs = append(allErrs, validateDeliveryConfiguration(config.Delivery, field.NewPath("delivery"))...)
+	}
+
+	if config.Shutdown != nil {
+		allErrs = append(allErrs, validateShutdownConfiguration(config.Shutdown, field.NewPath("shutdown"))...)
+	}
+
+	return allErrs
+}
+
+func validateShutdownConfiguration(shutdown *proxy.ShutdownConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if shutdown.GracePeriod != nil && shutdown.GracePeriod.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("gracePeriod"), shutdown.GracePeriod.Duration.String(), "The grace period has to be positive"))
+	}
+	if shutdown.ReadinessDelay != nil && shutdown.ReadinessDelay.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("readinessDelay"), shutdown.ReadinessDelay.Duration.String(), "The readiness delay must not be negative"))
+	}
+	if shutdown.GracePeriod != nil && shutdown.ReadinessDelay != nil && shutdown.ReadinessDelay.Duration >= shutdown.GracePeriod.Duration {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("readinessDelay"), shutdown.ReadinessDelay.Duration.String(), "The readiness delay has to be shorter than the grace period"))
+	}
+
+	return allErrs
+}
+
+func validateOutputs(outputs []proxy.Output, hasDefault bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	names := sets.NewString()
+	if hasDefault {
+		names.Insert(proxy.DefaultOutputName)
+	}
+	for i, output := range outputs {
+		idxPath := fldPath.Index(i)
+		if output.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "A name has to be defined for the output"))
+		} else if names.Has(output.Name) {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), output.Name))
+		}
+		names.Insert(output.Name)
+
+		if output.Provider == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("provider"), "A provider has to be defined for the output"))
+		}
+
+		switch output.FailurePolicy {
+		case proxy.FailurePolicyRequired, proxy.FailurePolicyBestEffort:
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("failurePolicy"), output.FailurePolicy,
+				[]string{string(proxy.FailurePolicyRequired), string(proxy.FailurePolicyBestEffort)}))
+		}
+	}
+
+	return allErrs
+}
+
+func validateDeliveryConfiguration(delivery *proxy.DeliveryConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if delivery.MaxRetries != nil && *delivery.MaxRetries < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxRetries"), *delivery.MaxRetries, "The number of retries must not be negative"))
+	}
+	if delivery.InitialBackoff != nil && delivery.InitialBackoff.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("initialBackoff"), delivery.InitialBackoff.Duration.String(), "The backoff has to be positive"))
+	}
+	if delivery.InitialBackoff != nil && delivery.MaxBackoff != nil && delivery.MaxBackoff.Duration < delivery.InitialBackoff.Duration {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxBackoff"), delivery.MaxBackoff.Duration.String(), "The maximum backoff has to be at least the initial backoff"))
+	}
+	if delivery.RequestTimeout != nil && delivery.RequestTimeout.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("requestTimeout"), delivery.RequestTimeout.Duration.String(), "The request timeout has to be positive"))
+	}
+
+	if deadLetter := delivery.DeadLetter; deadLetter != nil {
+		deadLetterPath := fldPath.Child("deadLetter")
+		if deadLetter.File == "" && deadLetter.Provider == "" {
+			allErrs = append(allErrs, field.Required(deadLetterPath, "Either a file or a provider has to be defined for the dead-letter sink"))
+		}
+		if deadLetter.File != "" && deadLetter.Provider != "" {
+			allErrs = append(allErrs, field.Forbidden(deadLetterPath.Child("provider"), "Only one of file or provider can be defined for the dead-letter sink"))
+		}
+		if deadLetter.MaxFileSize != nil && deadLetter.MaxFileSize.Sign() <= 0 {
+			allErrs = append(allErrs, field.Invalid(deadLetterPath.Child("maxFileSize"), deadLetter.MaxFileSize.String(), "The maximum file size has to be positive"))
+		}
+	}
+
+	return allErrs
+}
+
+func validateBufferConfiguration(buffer *proxy.BufferConfiguration, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if buffer.Directory == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("directory"), "A directory has to be defined for the buffer"))
+	}
+	if buffer.SegmentSize != nil && buffer.SegmentSize.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("segmentSize"), buffer.SegmentSize.String(), "The segment size has to be positive"))
+	}
+	if buffer.MaxSize != nil && buffer.SegmentSize != nil && buffer.MaxSize.Cmp(*buffer.SegmentSize) < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("maxSize"), buffer.MaxSize.String(), "The maximum size has to be at least the segment size"))
+	}
+
+	switch buffer.SyncPolicy {
+	case proxy.SyncPolicyAlways, proxy.SyncPolicyNever:
+	case proxy.SyncPolicyInterval:
+		if buffer.SyncInterval == nil || buffer.SyncInterval.Duration <= 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("syncInterval"), "A positive sync interval has to be defined for the interval sync policy"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("syncPolicy"), buffer.SyncPolicy,
+			[]string{string(proxy.SyncPolicyAlways), string(proxy.SyncPolicyInterval), string(proxy.SyncPolicyNever)}))
+	}
+
+	return allErrs
+}
+
+// ValidateRules validates the rules of the proxy. It is also used for the rules of the service configuration.
+func ValidateRules(rules []proxy.Rule, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	names := sets.NewString()
+	for i, rule := range rules {
+		idxPath := fldPath.Index(i)
+		if rule.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "A name has to be defined for the rule"))
+		} else if names.Has(rule.Name) {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), rule.Name))
+		}
+		names.Insert(rule.Name)
+
+		switch rule.Action {
+		case proxy.RuleActionKeep, proxy.RuleActionDrop:
+			if rule.SampleRatio != nil {
+				allErrs = append(allErrs, field.Forbidden(idxPath.Child("sampleRatio"), "A sample ratio can only be defined for the Sample action"))
+			}
+		case proxy.RuleActionSample:
+			if rule.SampleRatio == nil {
+				allErrs = append(allErrs, field.Required(idxPath.Child("sampleRatio"), "A sample ratio has to be defined for the Sample action"))
+			} else if *rule.SampleRatio < 0 || *rule.SampleRatio > 1 {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("sampleRatio"), *rule.SampleRatio, "The sample ratio has to be between 0 and 1"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("action"), rule.Action,
+				[]string{string(proxy.RuleActionKeep), string(proxy.RuleActionDrop), string(proxy.RuleActionSample)}))
+		}
+
+		for j, code := range rule.Match.ResponseCodes {
+			if code < 100 || code > 599 {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("match", "responseCodes").Index(j), code, "The response code has to be between 100 and 599"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateRedactions validates the redactions of the proxy. It is also used for the redactions of the service configuration.
+func ValidateRedactions(redactions []proxy.Redaction, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	names := sets.NewString()
+	for i, r := range redactions {
+		idxPath := fldPath.Index(i)
+		if r.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "A name has to be defined for the redaction"))
+		} else if names.Has(r.Name) {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), r.Name))
+		}
+		names.Insert(r.Name)
+
+		if len(r.Paths) == 0 {
+			allErrs = append(allErrs, field.Required(idxPath.Child("paths"), "At least one path has to be defined for the redaction"))
+		}
+		for j, path := range r.Paths {
+			if _, err := redaction.ParsePath(path); err != nil {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("paths").Index(j), path, err.Error()))
+			}
+		}
+
+		switch r.Action {
+		case proxy.RedactionActionMask, proxy.RedactionActionHash:
+			if r.Pattern != "" {
+				if _, err := regexp.Compile(r.Pattern); err != nil {
+					allErrs = append(allErrs, field.Invalid(idxPath.Child("pattern"), r.Pattern, err.Error()))
+				}
+			}
+		case proxy.RedactionActionRemove:
+			if r.Pattern != "" {
+				allErrs = append(allErrs, field.Forbidden(idxPath.Child("pattern"), "A pattern can only be defined for the Mask and Hash actions"))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("action"), r.Action,
+				[]string{string(proxy.RedactionActionMask), string(proxy.RedactionActionHash), string(proxy.RedactionActionRemove)}))
+		}
+	}
+
 	return allErrs
 }
@@ -15,8 +15,16 @@
 package validation_test
 
 import (
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy/validation"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 var _ = Describe("test", func() {
@@ -24,3 +32,173 @@ var _ = Describe("test", func() {
 		Expect(true).To(Equal(true))
 	})
 })
+
+var _ = Describe("ValidateConfiguration", func() {
+	var config *proxy.Configuration
+
+	BeforeEach(func() {
+		maxSize := resource.MustParse("1Gi")
+		segmentSize := resource.MustParse("8Mi")
+		config = &proxy.Configuration{
+			Provider: "standard",
+			WebhookConfiguration: proxy.WebhookConfiguration{
+				HTTPPort: 8080,
+			},
+			Buffer: &proxy.BufferConfiguration{
+				Directory:    "/var/lib/auditlog-proxy/buffer",
+				MaxSize:      &maxSize,
+				SegmentSize:  &segmentSize,
+				SyncPolicy:   proxy.SyncPolicyInterval,
+				SyncInterval: &metav1.Duration{Duration: time.Second},
+			},
+		}
+	})
+
+	It("should accept a valid buffer configuration", func() {
+		Expect(validation.ValidateConfiguration(config)).To(BeEmpty())
+	})
+
+	It("should require a buffer directory", func() {
+		config.Buffer.Directory = ""
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("buffer.directory"))
+	})
+
+	It("should reject a maximum size that is smaller than the segment size", func() {
+		maxSize := resource.MustParse("1Mi")
+		config.Buffer.MaxSize = &maxSize
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("buffer.maxSize"))
+	})
+
+	It("should reject an unknown sync policy", func() {
+		config.Buffer.SyncPolicy = "sometimes"
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("buffer.syncPolicy"))
+	})
+
+	It("should reject a metrics port that is used by the webhook", func() {
+		config.WebhookConfiguration.MetricsPort = 8080
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("webhookConfiguration.metricsPort"))
+	})
+
+	It("should require a provider or an output", func() {
+		config.Provider = ""
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("provider"))
+	})
+
+	It("should accept outputs without a provider", func() {
+		config.Provider = ""
+		config.Outputs = []proxy.Output{
+			{Name: "seed", Provider: "elasticsearch", FailurePolicy: proxy.FailurePolicyRequired},
+			{Name: "siem", Provider: "standard", FailurePolicy: proxy.FailurePolicyBestEffort},
+		}
+		Expect(validation.ValidateConfiguration(config)).To(BeEmpty())
+	})
+
+	It("should reject outputs with the name of the default output", func() {
+		config.Outputs = []proxy.Output{
+			{Name: proxy.DefaultOutputName, Provider: "standard", FailurePolicy: proxy.FailurePolicyRequired},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeDuplicate))
+		Expect(errs[0].Field).To(Equal("outputs[0].name"))
+	})
+
+	It("should reject an unknown failure policy of an output", func() {
+		config.Outputs = []proxy.Output{
+			{Name: "siem", Provider: "standard", FailurePolicy: "Sometimes"},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("outputs[0].failurePolicy"))
+	})
+	It("should accept valid rules", func() {
+		ratio := 0.01
+		config.Rules = []proxy.Rule{
+			{Name: "keep-secrets", Match: proxy.EventMatcher{Resources: []proxy.GroupResources{{Resources: []string{"secrets"}}}}, Action: proxy.RuleActionKeep},
+			{Name: "sample-lists", Match: proxy.EventMatcher{Verbs: []string{"list"}}, Action: proxy.RuleActionSample, SampleRatio: &ratio},
+			{Name: "drop-errors", Match: proxy.EventMatcher{ResponseCodes: []int32{500}}, Action: proxy.RuleActionDrop},
+		}
+		Expect(validation.ValidateConfiguration(config)).To(BeEmpty())
+	})
+
+	It("should reject invalid rules", func() {
+		ratio := 1.5
+		config.Rules = []proxy.Rule{
+			{Name: "drop", Action: proxy.RuleActionDrop},
+			{Name: "drop", Action: "Ignore"},
+			{Name: "sample", Action: proxy.RuleActionSample},
+			{Name: "sample-all", Action: proxy.RuleActionSample, SampleRatio: &ratio},
+			{Name: "keep", Action: proxy.RuleActionKeep, SampleRatio: &ratio, Match: proxy.EventMatcher{ResponseCodes: []int32{42}}},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(6))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeDuplicate))
+		Expect(errs[0].Field).To(Equal("rules[1].name"))
+		Expect(errs[1].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[1].Field).To(Equal("rules[1].action"))
+		Expect(errs[2].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[2].Field).To(Equal("rules[2].sampleRatio"))
+		Expect(errs[3].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[3].Field).To(Equal("rules[3].sampleRatio"))
+		Expect(errs[4].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[4].Field).To(Equal("rules[4].sampleRatio"))
+		Expect(errs[5].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[5].Field).To(Equal("rules[4].match.responseCodes[0]"))
+	})
+
+	It("should accept valid redactions", func() {
+		config.Redactions = []proxy.Redaction{
+			{Name: "env", Paths: []string{"requestObject.spec.containers[*].env[*].value", "responseObject.spec.containers[*].env[*].value"}, Action: proxy.RedactionActionMask},
+			{Name: "extra", Paths: []string{"user.extra.*"}, Action: proxy.RedactionActionHash},
+			{Name: "tokens", Paths: []string{"annotations['example.com/token']"}, Action: proxy.RedactionActionMask, Pattern: `(?i)bearer\s+\S+`},
+			{Name: "configmaps", Match: proxy.EventMatcher{Resources: []proxy.GroupResources{{Resources: []string{"configmaps"}}}}, Paths: []string{"requestObject.data"}, Action: proxy.RedactionActionRemove},
+		}
+		config.HashKeyFile = "/etc/auditlog-proxy/hash-key/key"
+		Expect(validation.ValidateConfiguration(config)).To(BeEmpty())
+	})
+
+	It("should reject invalid redactions", func() {
+		config.Redactions = []proxy.Redaction{
+			{Name: "env", Action: proxy.RedactionActionMask},
+			{Name: "env", Paths: []string{"level", "requestObject..data", "annotations['example.com/token"}, Action: "Encrypt"},
+			{Name: "pattern", Paths: []string{"userAgent"}, Action: proxy.RedactionActionHash, Pattern: "("},
+			{Name: "remove", Paths: []string{"userAgent"}, Action: proxy.RedactionActionRemove, Pattern: "kubectl"},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(9))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("redactions[0].paths"))
+		Expect(errs[1].Type).To(Equal(field.ErrorTypeDuplicate))
+		Expect(errs[1].Field).To(Equal("redactions[1].name"))
+		Expect(errs[2].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[2].Field).To(Equal("redactions[1].paths[0]"))
+		Expect(errs[3].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[3].Field).To(Equal("redactions[1].paths[1]"))
+		Expect(errs[4].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[4].Field).To(Equal("redactions[1].paths[2]"))
+		Expect(errs[5].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[5].Field).To(Equal("redactions[1].action"))
+		Expect(errs[6].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[6].Field).To(Equal("redactions[2].pattern"))
+		Expect(errs[7].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[7].Field).To(Equal("redactions[3].pattern"))
+		Expect(errs[8].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[8].Field).To(Equal("hashKeyFile"))
+	})
+})
@@ -16,6 +16,7 @@ package service
 
 import (
 	"encoding/json"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -26,13 +27,213 @@ import (
 type Configuration struct {
 	metav1.TypeMeta `json:",inline"`
 
-	// BackendProvider specifies the provider for the audit log proxy where the logs are persisted
-	BackendProvider string `json:"backendProvider"`
+	// BackendProvider specifies the provider for the audit log proxy where the logs are persisted.
+	// BackendProvider and BackendProviderConfig are a shorthand for a single required output named "default".
+	// +optional
+	BackendProvider string `json:"backendProvider,omitempty"`
 
 	// BackendProviderConfig is the backend provider specific configuration
-	BackendProviderConfig json.RawMessage `json:"backendProviderConfig"`
+	// +optional
+	BackendProviderConfig json.RawMessage `json:"backendProviderConfig,omitempty"`
+
+	// BackendProviderSecretRef references a secret with the credentials of the backend provider.
+	// The secret is mounted into the audit log proxy and reloaded on changes, so that the credentials
+	// are not part of the backend provider configuration. The secret has to be in the namespace of the shoot.
+	// +optional
+	BackendProviderSecretRef *corev1.SecretReference `json:"backendProviderSecretRef,omitempty"`
+
+	// Outputs are the named backend providers the audit logs are sent to in addition to the BackendProvider
+	// +optional
+	Outputs []Output `json:"outputs,omitempty"`
+
+	// Rules keep, drop or sample the audit events before they are sent to the outputs by the audit log proxy.
+	// The first rule that matches an event decides, events that match no rule are kept.
+	// +optional
+	Rules []Rule `json:"rules,omitempty"`
+
+	// Redactions mask, hash or remove fields of the audit events before they are sent to the outputs.
+	// The data of secrets and the tokens of token reviews and token requests are always redacted.
+	// +optional
+	Redactions []Redaction `json:"redactions,omitempty"`
 
 	// Policy is the raw audit log policy.
 	// Be aware that k8s clusters <=1.11 do not support "audit.k8s.io/v1"
 	Policy runtime.RawExtension `json:"policy"`
 }
+
+// DefaultOutputName is the name of the output that is defined by the BackendProvider and BackendProviderConfig shorthand
+const DefaultOutputName = "default"
+
+// FailurePolicy defines how failed deliveries to an output are handled
+type FailurePolicy string
+
+const (
+	// FailurePolicyRequired fails the delivery of an event list if it cannot be delivered to the output
+	FailurePolicyRequired FailurePolicy = "Required"
+	// FailurePolicyBestEffort only logs failed deliveries to the output
+	FailurePolicyBestEffort FailurePolicy = "BestEffort"
+)
+
+// Output is a named backend provider the audit events are sent to
+type Output struct {
+	// Name is the unique name of the output
+	Name string `json:"name"`
+
+	// BackendProvider specifies the provider of the output
+	BackendProvider string `json:"backendProvider"`
+
+	// BackendProviderConfig is the backend provider specific configuration
+	// +optional
+	BackendProviderConfig json.RawMessage `json:"backendProviderConfig,omitempty"`
+
+	// BackendProviderSecretRef references a secret with the credentials of the backend provider.
+	// The secret has to be in the namespace of the shoot.
+	// +optional
+	BackendProviderSecretRef *corev1.SecretReference `json:"backendProviderSecretRef,omitempty"`
+
+	// Filter selects the events that are sent to the output.
+	// All events are sent to the output if no filter is defined.
+	// +optional
+	Filter *OutputFilter `json:"filter,omitempty"`
+
+	// FailurePolicy defines how failed deliveries to the output are handled.
+	// One of "Required" or "BestEffort".
+	// +optional
+	FailurePolicy FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// OutputFilter selects the audit events that are sent to an output
+type OutputFilter struct {
+	// Include selects the events that match any of the matchers.
+	// All events are selected if no matcher is defined.
+	// +optional
+	Include []EventMatcher `json:"include,omitempty"`
+
+	// Exclude drops the selected events that match any of the matchers
+	// +optional
+	Exclude []EventMatcher `json:"exclude,omitempty"`
+}
+
+// EventMatcher matches audit events.
+// An event matches if it matches all defined fields and a field matches if it contains the value of the event.
+type EventMatcher struct {
+	// Verbs are the matched request verbs
+	// +optional
+	Verbs []string `json:"verbs,omitempty"`
+
+	// Users are the matched usernames
+	// +optional
+	Users []string `json:"users,omitempty"`
+
+	// UserGroups are the matched user groups. The event matches if the user is in one of the groups.
+	// +optional
+	UserGroups []string `json:"userGroups,omitempty"`
+
+	// Namespaces are the matched namespaces of the requested objects
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+
+	// Resources are the matched resources of the requested objects
+	// +optional
+	Resources []GroupResources `json:"resources,omitempty"`
+
+	// Levels are the matched audit levels
+	// +optional
+	Levels []string `json:"levels,omitempty"`
+
+	// Stages are the matched audit stages
+	// +optional
+	Stages []string `json:"stages,omitempty"`
+
+	// ResponseCodes are the matched response codes. Events without a response status do not match.
+	// +optional
+	ResponseCodes []int32 `json:"responseCodes,omitempty"`
+
+	// UserAgents are prefixes of the matched user agents, e.g. "kubectl/"
+	// +optional
+	UserAgents []string `json:"userAgents,omitempty"`
+}
+
+// GroupResources are the resources of an api group
+type GroupResources struct {
+	// Group is the name of the api group. The empty string represents the core api group.
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// Resources are the matched resources of the group.
+	// All resources of the group are matched if empty.
+	// +optional
+	Resources []string `json:"resources,omitempty"`
+}
+
+// RuleAction is the action that is applied to the audit events that match a rule
+type RuleAction string
+
+const (
+	// RuleActionKeep keeps the events
+	RuleActionKeep RuleAction = "Keep"
+	// RuleActionDrop drops the events
+	RuleActionDrop RuleAction = "Drop"
+	// RuleActionSample keeps a ratio of the events
+	RuleActionSample RuleAction = "Sample"
+)
+
+// Rule keeps, drops or samples the audit events that it matches
+type Rule struct {
+	// Name is the unique name of the rule
+	Name string `json:"name"`
+
+	// Match selects the events of the rule.
+	// All events are selected if no field is defined.
+	// +optional
+	Match EventMatcher `json:"match,omitempty"`
+
+	// Action is applied to the selected events.
+	// One of "Keep", "Drop" or "Sample".
+	Action RuleAction `json:"action"`
+
+	// SampleRatio is the ratio of the selected events that are kept by the "Sample" action, e.g. 0.01 keeps 1% of the events.
+	// The events are sampled by their audit id, so that all stages of a request are either kept or dropped.
+	// +optional
+	SampleRatio *float64 `json:"sampleRatio,omitempty"`
+}
+
+// RedactionAction is the action that is applied to the fields selected by a redaction
+type RedactionAction string
+
+const (
+	// RedactionActionMask replaces the values with "******"
+	RedactionActionMask RedactionAction = "Mask"
+	// RedactionActionHash replaces the values with their HMAC-SHA256 that is keyed per shoot
+	RedactionActionHash RedactionAction = "Hash"
+	// RedactionActionRemove removes the fields
+	RedactionActionRemove RedactionAction = "Remove"
+)
+
+// Redaction masks, hashes or removes fields of the audit events that it matches
+type Redaction struct {
+	// Name is the unique name of the redaction
+	Name string `json:"name"`
+
+	// Match selects the events of the redaction.
+	// All events are selected if no field is defined.
+	// +optional
+	Match EventMatcher `json:"match,omitempty"`
+
+	// Paths select the redacted fields of the audit.k8s.io/v1 event, e.g. "requestObject.spec.containers[*].env[*].value".
+	// Fields are separated by dots, "*" selects all fields of an object, "[*]" selects all items of a list
+	// and "['name']" selects fields whose name contains dots, e.g. "annotations['example.com/token']".
+	// Paths have to start with one of "requestObject", "responseObject", "annotations", "user", "impersonatedUser",
+	// "sourceIPs", "userAgent" or "requestURI".
+	Paths []string `json:"paths"`
+
+	// Action is applied to the selected fields.
+	// Objects and lists are masked or hashed value by value so that their structure is preserved.
+	// One of "Mask", "Hash" or "Remove".
+	Action RedactionAction `json:"action"`
+
+	// Pattern is a regular expression that limits the "Mask" and "Hash" actions to the matching parts of string values,
+	// e.g. "(?i)bearer\\s+\\S+" to redact bearer tokens.
+	// +optional
+	Pattern string `json:"pattern,omitempty"`
+}
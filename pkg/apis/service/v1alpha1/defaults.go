@@ -22,7 +22,14 @@ func addDefaultingFuncs(scheme *runtime.Scheme) error {
 
 // SetDefaults_Configuration sets default values for Configuration objects.
 func SetDefaults_Configuration(obj *Configuration) {
-	if len(obj.BackendProvider) == 0 {
+	if len(obj.BackendProvider) == 0 && len(obj.Outputs) == 0 {
 		obj.BackendProvider = "standard"
 	}
 }
+
+// SetDefaults_Output sets default values for Output objects.
+func SetDefaults_Output(obj *Output) {
+	if len(obj.FailurePolicy) == 0 {
+		obj.FailurePolicy = FailurePolicyRequired
+	}
+}
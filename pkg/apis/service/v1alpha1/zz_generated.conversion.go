@@ -25,6 +25,7 @@ import (
 	unsafe "unsafe"
 
 	service "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
+	v1 "k8s.io/api/core/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -46,12 +47,76 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*EventMatcher)(nil), (*service.EventMatcher)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_EventMatcher_To_service_EventMatcher(a.(*EventMatcher), b.(*service.EventMatcher), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.EventMatcher)(nil), (*EventMatcher)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_EventMatcher_To_v1alpha1_EventMatcher(a.(*service.EventMatcher), b.(*EventMatcher), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*GroupResources)(nil), (*service.GroupResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_GroupResources_To_service_GroupResources(a.(*GroupResources), b.(*service.GroupResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.GroupResources)(nil), (*GroupResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_GroupResources_To_v1alpha1_GroupResources(a.(*service.GroupResources), b.(*GroupResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Output)(nil), (*service.Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Output_To_service_Output(a.(*Output), b.(*service.Output), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.Output)(nil), (*Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_Output_To_v1alpha1_Output(a.(*service.Output), b.(*Output), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*OutputFilter)(nil), (*service.OutputFilter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_OutputFilter_To_service_OutputFilter(a.(*OutputFilter), b.(*service.OutputFilter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.OutputFilter)(nil), (*OutputFilter)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_OutputFilter_To_v1alpha1_OutputFilter(a.(*service.OutputFilter), b.(*OutputFilter), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Redaction)(nil), (*service.Redaction)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Redaction_To_service_Redaction(a.(*Redaction), b.(*service.Redaction), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.Redaction)(nil), (*Redaction)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_Redaction_To_v1alpha1_Redaction(a.(*service.Redaction), b.(*Redaction), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*Rule)(nil), (*service.Rule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Rule_To_service_Rule(a.(*Rule), b.(*service.Rule), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*service.Rule)(nil), (*Rule)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_service_Rule_To_v1alpha1_Rule(a.(*service.Rule), b.(*Rule), scope)
+	}); err != nil {
+		return err
+	}
 	return nil
 }
 
 func autoConvert_v1alpha1_Configuration_To_service_Configuration(in *Configuration, out *service.Configuration, s conversion.Scope) error {
 	out.BackendProvider = in.BackendProvider
 	out.BackendProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.BackendProviderConfig))
+	out.BackendProviderSecretRef = (*v1.SecretReference)(unsafe.Pointer(in.BackendProviderSecretRef))
+	out.Outputs = *(*[]service.Output)(unsafe.Pointer(&in.Outputs))
+	out.Rules = *(*[]service.Rule)(unsafe.Pointer(&in.Rules))
+	out.Redactions = *(*[]service.Redaction)(unsafe.Pointer(&in.Redactions))
 	out.Policy = in.Policy
 	return nil
 }
@@ -64,6 +129,10 @@ func Convert_v1alpha1_Configuration_To_service_Configuration(in *Configuration,
 func autoConvert_service_Configuration_To_v1alpha1_Configuration(in *service.Configuration, out *Configuration, s conversion.Scope) error {
 	out.BackendProvider = in.BackendProvider
 	out.BackendProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.BackendProviderConfig))
+	out.BackendProviderSecretRef = (*v1.SecretReference)(unsafe.Pointer(in.BackendProviderSecretRef))
+	out.Outputs = *(*[]Output)(unsafe.Pointer(&in.Outputs))
+	out.Rules = *(*[]Rule)(unsafe.Pointer(&in.Rules))
+	out.Redactions = *(*[]Redaction)(unsafe.Pointer(&in.Redactions))
 	out.Policy = in.Policy
 	return nil
 }
@@ -72,3 +141,175 @@ func autoConvert_service_Configuration_To_v1alpha1_Configuration(in *service.Con
 func Convert_service_Configuration_To_v1alpha1_Configuration(in *service.Configuration, out *Configuration, s conversion.Scope) error {
 	return autoConvert_service_Configuration_To_v1alpha1_Configuration(in, out, s)
 }
+
+func autoConvert_v1alpha1_EventMatcher_To_service_EventMatcher(in *EventMatcher, out *service.EventMatcher, s conversion.Scope) error {
+	out.Verbs = *(*[]string)(unsafe.Pointer(&in.Verbs))
+	out.Users = *(*[]string)(unsafe.Pointer(&in.Users))
+	out.UserGroups = *(*[]string)(unsafe.Pointer(&in.UserGroups))
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	out.Resources = *(*[]service.GroupResources)(unsafe.Pointer(&in.Resources))
+	out.Levels = *(*[]string)(unsafe.Pointer(&in.Levels))
+	out.Stages = *(*[]string)(unsafe.Pointer(&in.Stages))
+	out.ResponseCodes = *(*[]int32)(unsafe.Pointer(&in.ResponseCodes))
+	out.UserAgents = *(*[]string)(unsafe.Pointer(&in.UserAgents))
+	return nil
+}
+
+// Convert_v1alpha1_EventMatcher_To_service_EventMatcher is an autogenerated conversion function.
+func Convert_v1alpha1_EventMatcher_To_service_EventMatcher(in *EventMatcher, out *service.EventMatcher, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EventMatcher_To_service_EventMatcher(in, out, s)
+}
+
+func autoConvert_service_EventMatcher_To_v1alpha1_EventMatcher(in *service.EventMatcher, out *EventMatcher, s conversion.Scope) error {
+	out.Verbs = *(*[]string)(unsafe.Pointer(&in.Verbs))
+	out.Users = *(*[]string)(unsafe.Pointer(&in.Users))
+	out.UserGroups = *(*[]string)(unsafe.Pointer(&in.UserGroups))
+	out.Namespaces = *(*[]string)(unsafe.Pointer(&in.Namespaces))
+	out.Resources = *(*[]GroupResources)(unsafe.Pointer(&in.Resources))
+	out.Levels = *(*[]string)(unsafe.Pointer(&in.Levels))
+	out.Stages = *(*[]string)(unsafe.Pointer(&in.Stages))
+	out.ResponseCodes = *(*[]int32)(unsafe.Pointer(&in.ResponseCodes))
+	out.UserAgents = *(*[]string)(unsafe.Pointer(&in.UserAgents))
+	return nil
+}
+
+// Convert_service_EventMatcher_To_v1alpha1_EventMatcher is an autogenerated conversion function.
+func Convert_service_EventMatcher_To_v1alpha1_EventMatcher(in *service.EventMatcher, out *EventMatcher, s conversion.Scope) error {
+	return autoConvert_service_EventMatcher_To_v1alpha1_EventMatcher(in, out, s)
+}
+
+func autoConvert_v1alpha1_GroupResources_To_service_GroupResources(in *GroupResources, out *service.GroupResources, s conversion.Scope) error {
+	out.Group = in.Group
+	out.Resources = *(*[]string)(unsafe.Pointer(&in.Resources))
+	return nil
+}
+
+// Convert_v1alpha1_GroupResources_To_service_GroupResources is an autogenerated conversion function.
+func Convert_v1alpha1_GroupResources_To_service_GroupResources(in *GroupResources, out *service.GroupResources, s conversion.Scope) error {
+	return autoConvert_v1alpha1_GroupResources_To_service_GroupResources(in, out, s)
+}
+
+func autoConvert_service_GroupResources_To_v1alpha1_GroupResources(in *service.GroupResources, out *GroupResources, s conversion.Scope) error {
+	out.Group = in.Group
+	out.Resources = *(*[]string)(unsafe.Pointer(&in.Resources))
+	return nil
+}
+
+// Convert_service_GroupResources_To_v1alpha1_GroupResources is an autogenerated conversion function.
+func Convert_service_GroupResources_To_v1alpha1_GroupResources(in *service.GroupResources, out *GroupResources, s conversion.Scope) error {
+	return autoConvert_service_GroupResources_To_v1alpha1_GroupResources(in, out, s)
+}
+
+func autoConvert_v1alpha1_Output_To_service_Output(in *Output, out *service.Output, s conversion.Scope) error {
+	out.Name = in.Name
+	out.BackendProvider = in.BackendProvider
+	out.BackendProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.BackendProviderConfig))
+	out.BackendProviderSecretRef = (*v1.SecretReference)(unsafe.Pointer(in.BackendProviderSecretRef))
+	out.Filter = (*service.OutputFilter)(unsafe.Pointer(in.Filter))
+	out.FailurePolicy = service.FailurePolicy(in.FailurePolicy)
+	return nil
+}
+
+// Convert_v1alpha1_Output_To_service_Output is an autogenerated conversion function.
+func Convert_v1alpha1_Output_To_service_Output(in *Output, out *service.Output, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Output_To_service_Output(in, out, s)
+}
+
+func autoConvert_service_Output_To_v1alpha1_Output(in *service.Output, out *Output, s conversion.Scope) error {
+	out.Name = in.Name
+	out.BackendProvider = in.BackendProvider
+	out.BackendProviderConfig = *(*json.RawMessage)(unsafe.Pointer(&in.BackendProviderConfig))
+	out.BackendProviderSecretRef = (*v1.SecretReference)(unsafe.Pointer(in.BackendProviderSecretRef))
+	out.Filter = (*OutputFilter)(unsafe.Pointer(in.Filter))
+	out.FailurePolicy = FailurePolicy(in.FailurePolicy)
+	return nil
+}
+
+// Convert_service_Output_To_v1alpha1_Output is an autogenerated conversion function.
+func Convert_service_Output_To_v1alpha1_Output(in *service.Output, out *Output, s conversion.Scope) error {
+	return autoConvert_service_Output_To_v1alpha1_Output(in, out, s)
+}
+
+func autoConvert_v1alpha1_OutputFilter_To_service_OutputFilter(in *OutputFilter, out *service.OutputFilter, s conversion.Scope) error {
+	out.Include = *(*[]service.EventMatcher)(unsafe.Pointer(&in.Include))
+	out.Exclude = *(*[]service.EventMatcher)(unsafe.Pointer(&in.Exclude))
+	return nil
+}
+
+// Convert_v1alpha1_OutputFilter_To_service_OutputFilter is an autogenerated conversion function.
+func Convert_v1alpha1_OutputFilter_To_service_OutputFilter(in *OutputFilter, out *service.OutputFilter, s conversion.Scope) error {
+	return autoConvert_v1alpha1_OutputFilter_To_service_OutputFilter(in, out, s)
+}
+
+func autoConvert_service_OutputFilter_To_v1alpha1_OutputFilter(in *service.OutputFilter, out *OutputFilter, s conversion.Scope) error {
+	out.Include = *(*[]EventMatcher)(unsafe.Pointer(&in.Include))
+	out.Exclude = *(*[]EventMatcher)(unsafe.Pointer(&in.Exclude))
+	return nil
+}
+
+// Convert_service_OutputFilter_To_v1alpha1_OutputFilter is an autogenerated conversion function.
+func Convert_service_OutputFilter_To_v1alpha1_OutputFilter(in *service.OutputFilter, out *OutputFilter, s conversion.Scope) error {
+	return autoConvert_service_OutputFilter_To_v1alpha1_OutputFilter(in, out, s)
+}
+
+func autoConvert_v1alpha1_Redaction_To_service_Redaction(in *Redaction, out *service.Redaction, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_v1alpha1_EventMatcher_To_service_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Paths = *(*[]string)(unsafe.Pointer(&in.Paths))
+	out.Action = service.RedactionAction(in.Action)
+	out.Pattern = in.Pattern
+	return nil
+}
+
+// Convert_v1alpha1_Redaction_To_service_Redaction is an autogenerated conversion function.
+func Convert_v1alpha1_Redaction_To_service_Redaction(in *Redaction, out *service.Redaction, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Redaction_To_service_Redaction(in, out, s)
+}
+
+func autoConvert_service_Redaction_To_v1alpha1_Redaction(in *service.Redaction, out *Redaction, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_service_EventMatcher_To_v1alpha1_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Paths = *(*[]string)(unsafe.Pointer(&in.Paths))
+	out.Action = RedactionAction(in.Action)
+	out.Pattern = in.Pattern
+	return nil
+}
+
+// Convert_service_Redaction_To_v1alpha1_Redaction is an autogenerated conversion function.
+func Convert_service_Redaction_To_v1alpha1_Redaction(in *service.Redaction, out *Redaction, s conversion.Scope) error {
+	return autoConvert_service_Redaction_To_v1alpha1_Redaction(in, out, s)
+}
+
+func autoConvert_v1alpha1_Rule_To_service_Rule(in *Rule, out *service.Rule, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_v1alpha1_EventMatcher_To_service_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Action = service.RuleAction(in.Action)
+	out.SampleRatio = (*float64)(unsafe.Pointer(in.SampleRatio))
+	return nil
+}
+
+// Convert_v1alpha1_Rule_To_service_Rule is an autogenerated conversion function.
+func Convert_v1alpha1_Rule_To_service_Rule(in *Rule, out *service.Rule, s conversion.Scope) error {
+	return autoConvert_v1alpha1_Rule_To_service_Rule(in, out, s)
+}
+
+func autoConvert_service_Rule_To_v1alpha1_Rule(in *service.Rule, out *Rule, s conversion.Scope) error {
+	out.Name = in.Name
+	if err := Convert_service_EventMatcher_To_v1alpha1_EventMatcher(&in.Match, &out.Match, s); err != nil {
+		return err
+	}
+	out.Action = RuleAction(in.Action)
+	out.SampleRatio = (*float64)(unsafe.Pointer(in.SampleRatio))
+	return nil
+}
+
+// Convert_service_Rule_To_v1alpha1_Rule is an autogenerated conversion function.
+func Convert_service_Rule_To_v1alpha1_Rule(in *service.Rule, out *Rule, s conversion.Scope) error {
+	return autoConvert_service_Rule_To_v1alpha1_Rule(in, out, s)
+}
@@ -34,4 +34,8 @@ func RegisterDefaults(scheme *runtime.Scheme) error {
 
 func SetObjectDefaults_Configuration(in *Configuration) {
 	SetDefaults_Configuration(in)
+	for i := range in.Outputs {
+		a := &in.Outputs[i]
+		SetDefaults_Output(a)
+	}
 }
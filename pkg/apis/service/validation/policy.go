@@ -0,0 +1,68 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validation
+
+import (
+	"encoding/json"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	auditvalidation "k8s.io/apiserver/pkg/apis/audit/validation"
+	"sigs.k8s.io/yaml"
+)
+
+// validatePolicy decodes the raw policy as audit.k8s.io/v1 policy and validates it with the validation of the kube-apiserver
+func validatePolicy(policy runtime.RawExtension, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if len(policy.Raw) == 0 {
+		return append(allErrs, field.Required(fldPath, "An audit policy has to be defined"))
+	}
+	typeMeta := &metav1.TypeMeta{}
+	if err := json.Unmarshal(policy.Raw, typeMeta); err != nil {
+		return append(allErrs, field.Invalid(fldPath, string(policy.Raw), err.Error()))
+	}
+	if typeMeta.APIVersion != auditv1.SchemeGroupVersion.String() {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("apiVersion"), typeMeta.APIVersion, []string{auditv1.SchemeGroupVersion.String()}))
+	}
+	if typeMeta.Kind != "Policy" {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("kind"), typeMeta.Kind, []string{"Policy"}))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+
+	auditPolicy := &auditv1.Policy{}
+	if err := yaml.UnmarshalStrict(policy.Raw, auditPolicy); err != nil {
+		return append(allErrs, field.Invalid(fldPath, string(policy.Raw), err.Error()))
+	}
+
+	if len(auditPolicy.Rules) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("rules"), "At least one rule has to be defined"))
+	}
+
+	internalPolicy := &audit.Policy{}
+	if err := auditv1.Convert_v1_Policy_To_audit_Policy(auditPolicy, internalPolicy, nil); err != nil {
+		return append(allErrs, field.Invalid(fldPath, string(policy.Raw), err.Error()))
+	}
+	// the upstream validation reports the fields relative to the policy
+	for _, err := range auditvalidation.ValidatePolicy(internalPolicy) {
+		err.Field = fldPath.String() + "." + err.Field
+		allErrs = append(allErrs, err)
+	}
+	return allErrs
+}
@@ -15,13 +15,158 @@
 package validation
 
 import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	proxyvalidation "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy/validation"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers"
 
+	"fmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	utilvalidation "k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 // ValidateConfiguration validates the passed configuration instance.
 func ValidateConfiguration(config *service.Configuration) field.ErrorList {
 	allErrs := field.ErrorList{}
+
+	if config.BackendProvider == "" && len(config.Outputs) == 0 {
+		allErrs = append(allErrs, field.Required(field.NewPath("backendProvider"), "A backend provider or at least one output has to be defined"))
+	}
+	if config.BackendProvider != "" {
+		allErrs = append(allErrs, validateBackendProvider(config.BackendProvider, config.BackendProviderConfig, config.BackendProviderSecretRef, nil)...)
+	}
+	allErrs = append(allErrs, validateSecretRef(config.BackendProviderSecretRef, field.NewPath("backendProviderSecretRef"))...)
+	allErrs = append(allErrs, validateOutputs(config.Outputs, config.BackendProvider != "", field.NewPath("outputs"))...)
+	allErrs = append(allErrs, proxyvalidation.ValidateRules(toProxyRules(config.Rules), field.NewPath("rules"))...)
+	allErrs = append(allErrs, proxyvalidation.ValidateRedactions(toProxyRedactions(config.Redactions), field.NewPath("redactions"))...)
+	allErrs = append(allErrs, validatePolicy(config.Policy, field.NewPath("policy"))...)
+
+	return allErrs
+}
+
+func validateOutputs(outputs []service.Output, hasDefault bool, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	names := sets.NewString()
+	if hasDefault {
+		names.Insert(service.DefaultOutputName)
+	}
+	for i, output := range outputs {
+		idxPath := fldPath.Index(i)
+		if output.Name == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("name"), "A name has to be defined for the output"))
+		} else if names.Has(output.Name) {
+			allErrs = append(allErrs, field.Duplicate(idxPath.Child("name"), output.Name))
+		} else {
+			// the name is part of the mount path of the secret
+			for _, msg := range utilvalidation.IsDNS1123Label(output.Name) {
+				allErrs = append(allErrs, field.Invalid(idxPath.Child("name"), output.Name, msg))
+			}
+		}
+		names.Insert(output.Name)
+
+		if output.BackendProvider == "" {
+			allErrs = append(allErrs, field.Required(idxPath.Child("backendProvider"), "A backend provider has to be defined for the output"))
+		} else {
+			allErrs = append(allErrs, validateBackendProvider(output.BackendProvider, output.BackendProviderConfig, output.BackendProviderSecretRef, idxPath)...)
+		}
+
+		allErrs = append(allErrs, validateSecretRef(output.BackendProviderSecretRef, idxPath.Child("backendProviderSecretRef"))...)
+
+		switch output.FailurePolicy {
+		case service.FailurePolicyRequired, service.FailurePolicyBestEffort:
+		default:
+			allErrs = append(allErrs, field.NotSupported(idxPath.Child("failurePolicy"), output.FailurePolicy,
+				[]string{string(service.FailurePolicyRequired), string(service.FailurePolicyBestEffort)}))
+		}
+	}
+
+	return allErrs
+}
+
+// validateBackendProvider validates that the provider is known and supports secrets if one is referenced
+// and lets it validate its configuration.
+// The fields of the provider are children of the given path, which is nil for the fields of the configuration.
+func validateBackendProvider(name string, config []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	p, err := providers.ProviderFactory.Get(name)
+	if err != nil {
+		return append(allErrs, field.NotSupported(fldPath.Child("backendProvider"), name, providers.ProviderFactory.Names()))
+	}
+	if _, ok := p.(provider.BackendSecret); secretRef != nil && !ok {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("backendProviderSecretRef"), fmt.Sprintf("The backend provider %s does not support secrets", name)))
+	}
+	return append(allErrs, p.ValidateBackendConfig(config, secretRef, fldPath.Child("backendProviderConfig"))...)
+}
+
+func validateSecretRef(ref *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if ref == nil {
+		return allErrs
+	}
+
+	if ref.Name == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("name"), "A name has to be defined for the secret reference"))
+	}
+	// secrets of other namespaces of the seed must not be readable by the owner of the shoot
+	if ref.Namespace != "" {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("namespace"), "Only secrets of the namespace of the shoot can be referenced"))
+	}
 	return allErrs
 }
+
+// toProxyRules converts the rules of the service configuration into the rules of the proxy configuration.
+func toProxyRules(rules []service.Rule) []proxy.Rule {
+	if rules == nil {
+		return nil
+	}
+	out := make([]proxy.Rule, 0, len(rules))
+	for _, rule := range rules {
+		out = append(out, proxy.Rule{
+			Name:        rule.Name,
+			Match:       toProxyEventMatcher(rule.Match),
+			Action:      proxy.RuleAction(rule.Action),
+			SampleRatio: rule.SampleRatio,
+		})
+	}
+	return out
+}
+
+func toProxyEventMatcher(match service.EventMatcher) proxy.EventMatcher {
+	out := proxy.EventMatcher{
+		Verbs:         match.Verbs,
+		Users:         match.Users,
+		UserGroups:    match.UserGroups,
+		Namespaces:    match.Namespaces,
+		Levels:        match.Levels,
+		Stages:        match.Stages,
+		ResponseCodes: match.ResponseCodes,
+		UserAgents:    match.UserAgents,
+	}
+	for _, gr := range match.Resources {
+		out.Resources = append(out.Resources, proxy.GroupResources{Group: gr.Group, Resources: gr.Resources})
+	}
+	return out
+}
+
+// toProxyRedactions converts the redactions of the service configuration into the redactions of the proxy configuration.
+func toProxyRedactions(redactions []service.Redaction) []proxy.Redaction {
+	if redactions == nil {
+		return nil
+	}
+	out := make([]proxy.Redaction, 0, len(redactions))
+	for _, r := range redactions {
+		out = append(out, proxy.Redaction{
+			Name:    r.Name,
+			Match:   toProxyEventMatcher(r.Match),
+			Paths:   r.Paths,
+			Action:  proxy.RedactionAction(r.Action),
+			Pattern: r.Pattern,
+		})
+	}
+	return out
+}
@@ -15,8 +15,14 @@
 package validation_test
 
 import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service/validation"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
 var _ = Describe("test", func() {
@@ -24,3 +30,150 @@ var _ = Describe("test", func() {
 		Expect(true).To(Equal(true))
 	})
 })
+
+var _ = Describe("ValidateConfiguration", func() {
+	var config *service.Configuration
+
+	BeforeEach(func() {
+		config = &service.Configuration{
+			BackendProvider: "elasticsearch",
+			Outputs: []service.Output{
+				{Name: "siem", BackendProvider: "standard", FailurePolicy: service.FailurePolicyBestEffort},
+			},
+			Policy: runtime.RawExtension{Raw: []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"Policy","omitStages":["RequestReceived"],"rules":[{"level":"Metadata"}]}`)},
+		}
+	})
+
+	It("should accept a backend provider with additional outputs", func() {
+		Expect(validation.ValidateConfiguration(config)).To(BeEmpty())
+	})
+
+	It("should require a backend provider or an output", func() {
+		config.BackendProvider = ""
+		config.Outputs = nil
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("backendProvider"))
+	})
+
+	It("should reject duplicate output names", func() {
+		config.Outputs = append(config.Outputs, service.Output{Name: "siem", BackendProvider: "standard", FailurePolicy: service.FailurePolicyRequired})
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeDuplicate))
+		Expect(errs[0].Field).To(Equal("outputs[1].name"))
+	})
+
+	It("should reject output names that are no DNS labels", func() {
+		config.Outputs[0].Name = "SIEM_Output"
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("outputs[0].name"))
+	})
+
+	It("should require the name of a backend provider secret", func() {
+		config.BackendProviderSecretRef = &corev1.SecretReference{}
+		config.Outputs[0].BackendProvider = "elasticsearch"
+		config.Outputs[0].BackendProviderSecretRef = &corev1.SecretReference{Name: "siem-credentials"}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("backendProviderSecretRef.name"))
+	})
+
+	It("should forbid backend provider secrets of other namespaces", func() {
+		config.BackendProviderSecretRef = &corev1.SecretReference{Name: "es-credentials", Namespace: "garden"}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[0].Field).To(Equal("backendProviderSecretRef.namespace"))
+	})
+
+	It("should forbid backend provider secrets for providers that do not support secrets", func() {
+		config.Outputs[0].BackendProviderSecretRef = &corev1.SecretReference{Name: "siem-credentials"}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[0].Field).To(Equal("outputs[0].backendProviderSecretRef"))
+	})
+
+	It("should reject unknown backend providers", func() {
+		config.Outputs[0].BackendProvider = "elasticsaerch"
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("outputs[0].backendProvider"))
+	})
+
+	It("should let the backend providers validate their configuration", func() {
+		config.BackendProviderConfig = []byte(`{"endpoint":"elasticsearch:9200","index":"Auditlog-{shoot}"}`)
+		config.Outputs[0].BackendProvider = "splunk"
+		config.Outputs[0].BackendProviderConfig = []byte(`{"endpoint":"https://splunk:8088"}`)
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.endpoint.scheme"))
+		Expect(errs[1].Field).To(Equal("backendProviderConfig.index"))
+		Expect(errs[2].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[2].Field).To(Equal("outputs[0].backendProviderConfig.token"))
+	})
+
+	It("should require an audit.k8s.io/v1 policy", func() {
+		config.Policy = runtime.RawExtension{}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+
+		config.Policy.Raw = []byte(`{"apiVersion":"audit.k8s.io/v1beta1","kind":"Policy","rules":[{"level":"Metadata"}]}`)
+		errs = validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("policy.apiVersion"))
+
+		config.Policy.Raw = []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"Policy","rules":[{"level":"Metadata","verb":["get"]}]}`)
+		errs = validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("policy"))
+	})
+
+	It("should validate the rules of the policy", func() {
+		config.Policy.Raw = []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"Policy","rules":[` +
+			`{"level":"Everything"},{"level":"None","omitStages":["ResponseSent"]},{"level":"Metadata","nonResourceURLs":["healthz"]}]}`)
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(3))
+		Expect(errs[0].Field).To(Equal("policy.rules[0].level"))
+		Expect(errs[1].Field).To(Equal("policy.rules[1].omitStages[0]"))
+		Expect(errs[2].Field).To(Equal("policy.rules[2].nonResourceURLs[0]"))
+	})
+
+	It("should validate the resources of the policy rules", func() {
+		config.Policy.Raw = []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"Policy","rules":[` +
+			`{"level":"Metadata","resources":[{"group":"rbac.authorization.k8s.io/v1","resources":["roles"]},{"resourceNames":["admin"]}]}]}`)
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0].Field).To(Equal("policy.rules[0].resources.group"))
+		Expect(errs[1].Field).To(Equal("policy.rules[0].resources.resourceNames"))
+	})
+
+	It("should reject a sample rule without a sample ratio", func() {
+		config.Rules = []service.Rule{
+			{Name: "sample-lists", Match: service.EventMatcher{Verbs: []string{"list"}}, Action: service.RuleActionSample},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("rules[0].sampleRatio"))
+	})
+
+	It("should reject a redaction path outside of the redactable fields", func() {
+		config.Redactions = []service.Redaction{
+			{Name: "audit-id", Paths: []string{"auditID"}, Action: service.RedactionActionHash},
+		}
+		errs := validation.ValidateConfiguration(config)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("redactions[0].paths[0]"))
+	})
+})
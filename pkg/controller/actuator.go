@@ -16,11 +16,13 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service/validation"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/imagevector"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/webhook/controlplane"
 	"github.com/gardener/gardener-extensions/pkg/controller"
@@ -40,14 +42,13 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/serializer"
 	"k8s.io/client-go/rest"
 	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"path"
 	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
 	"sigs.k8s.io/yaml"
-	"strings"
-	"time"
 )
 
 // ActuatorName is the name of the Certificate Service actuator.
@@ -129,35 +130,53 @@ func (a *actuator) createSeedResources(ctx context.Context, ex *extensionsv1alph
 		return err
 	}
 
-	if err := a.ensureWebhookKubeconfig(ctx, ex.GetNamespace(), checksums); err != nil {
+	token, err := a.ensureProxyToken(ctx, ex.GetNamespace())
+	if err != nil {
 		return err
 	}
 
-	if err := a.ensureBackendProvider(ctx, auditConfig, ex); err != nil {
+	if err := a.ensureWebhookKubeconfig(ctx, ex.GetNamespace(), token); err != nil {
 		return err
 	}
 
-	if _, _, err := a.decoder.Decode(ex.Spec.ProviderConfig.Raw, nil, auditConfig); err != nil {
-		return fmt.Errorf("failed to decode provider config: %+v", err)
+	if err := a.ensureProxyHashKey(ctx, ex.GetNamespace()); err != nil {
+		return err
 	}
-	if errs := validation.ValidateConfiguration(auditConfig); len(errs) > 0 {
-		return errs.ToAggregate()
+
+	outputs, outputSecrets, err := a.ensureBackendProviders(ctx, auditConfig, ex)
+	if err != nil {
+		return err
+	}
+
+	configuration := map[string]interface{}{
+		"serverPortHttps": 443,
+		"outputs":         outputs,
+		"shoot":           shootMetadata(cluster, namespace),
+	}
+	if len(auditConfig.Rules) != 0 {
+		configuration["rules"] = auditConfig.Rules
+	}
+	if len(auditConfig.Redactions) != 0 {
+		configuration["redactions"] = auditConfig.Redactions
 	}
 
 	auditlogProxyValues := map[string]interface{}{
-		"replicaCount": 1,
-		"configuration": map[string]interface{}{
-			"serverPortHttps": 443,
-			"provider":        auditConfig.BackendProvider,
-			"providerConfig":  auditConfig.BackendProviderConfig,
-		},
+		"replicaCount":  1,
+		"configuration": configuration,
 		"svc": map[string]interface{}{
 			"name": config.AuditlogProxyServiceName,
 		},
 		"tls": map[string]interface{}{
 			"secretName": config.AuditlogKubecfgSecretName,
 		},
+		"authentication": map[string]interface{}{
+			"secretName": config.AuditlogProxyTokenSecretName,
+		},
+		"hashKey": map[string]interface{}{
+			"secretName": config.AuditlogProxyHashKeySecretName,
+		},
 		"podAnnotations": checksums,
+		"outputSecrets":  outputSecrets,
 		"additionalConfiguration": []string{
 			"-v=5",
 		},
@@ -185,27 +204,96 @@ func (a *actuator) createSeedResources(ctx context.Context, ex *extensionsv1alph
 	return a.ensureKubeAPIServerDeployment(ctx, ex.GetNamespace())
 }
 
-func (a *actuator) ensureBackendProvider(ctx context.Context, auditConfig *service.Configuration, ex *extensionsv1alpha1.Extension) error {
-	a.logger.Info("Ensuring backend provider", "namespace", ex.GetNamespace(), "provider", auditConfig.BackendProvider)
+// ensureBackendProviders reconciles the backend providers of all outputs and returns the proxy outputs
+// with the backend configurations that are completed by the providers and the secrets that are mounted for the outputs.
+// The credentials of the secrets are never part of the backend configurations.
+func (a *actuator) ensureBackendProviders(ctx context.Context, auditConfig *service.Configuration, ex *extensionsv1alpha1.Extension) ([]map[string]interface{}, []map[string]interface{}, error) {
+	var (
+		values        = make([]map[string]interface{}, 0)
+		secretsValues = make([]map[string]interface{}, 0)
+	)
+	for _, output := range getOutputs(auditConfig) {
+		backendConfig, secretRef, err := a.ensureBackendProvider(ctx, output, ex)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to reconcile backend provider of output %s", output.Name)
+		}
+
+		outputValues := map[string]interface{}{
+			"name":           output.Name,
+			"provider":       output.BackendProvider,
+			"providerConfig": json.RawMessage(backendConfig),
+			"failurePolicy":  output.FailurePolicy,
+		}
+		if output.Filter != nil {
+			outputValues["filter"] = output.Filter
+		}
+		// the secret of the shoot namespace is mounted directly so that the proxy reloads it on changes
+		if secretRef != nil {
+			outputValues["secretDir"] = path.Join(config.AuditlogProxySecretsPath, output.Name)
+			secretsValues = append(secretsValues, map[string]interface{}{
+				"name":       output.Name,
+				"secretName": secretRef.Name,
+			})
+		}
+		values = append(values, outputValues)
+	}
+	return values, secretsValues, nil
+}
+
+// ensureBackendProvider reconciles the backend provider of the output and returns its completed backend configuration
+// and the reference to the secret with its credentials, if any.
+func (a *actuator) ensureBackendProvider(ctx context.Context, output service.Output, ex *extensionsv1alpha1.Extension) ([]byte, *corev1.SecretReference, error) {
+	a.logger.Info("Ensuring backend provider", "namespace", ex.GetNamespace(), "output", output.Name, "provider", output.BackendProvider)
 
-	p, err := providers.ProviderFactory.Get(auditConfig.BackendProvider)
+	p, err := providers.ProviderFactory.Get(output.BackendProvider)
 	if err != nil {
-		return nil
+		return nil, nil, err
+	}
+	if _, err := provider.BackendConfigInto(output.BackendProviderConfig, p); err != nil {
+		return nil, nil, err
+	}
+	if output.BackendProviderSecretRef != nil {
+		if err := a.injectBackendSecret(ctx, p, output.BackendProviderSecretRef, ex.GetNamespace()); err != nil {
+			return nil, nil, err
+		}
 	}
 	if _, err := inject.ClientInto(a.client, p); err != nil {
-		return err
+		return nil, nil, err
 	}
 	if _, err := inject.ConfigInto(a.config, p); err != nil {
-		return err
+		return nil, nil, err
 	}
 	if _, err := inject.SchemeInto(a.scheme, p); err != nil {
-		return err
+		return nil, nil, err
 	}
 	if _, err := inject.LoggerInto(a.logger, p); err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	if err := p.Reconcile(ctx, ex); err != nil {
+		return nil, nil, err
+	}
+	backendConfig, err := provider.BackendConfigFrom(p, output.BackendProviderConfig)
+	if err != nil {
+		return nil, nil, err
 	}
+	return backendConfig, provider.BackendSecretRefFrom(p, output.BackendProviderSecretRef), nil
+}
 
-	return p.Reconcile(ctx, ex)
+// getOutputs returns all outputs of the configuration.
+// The backend provider is added as required output with the default output name.
+func getOutputs(auditConfig *service.Configuration) []service.Output {
+	outputs := make([]service.Output, 0, len(auditConfig.Outputs)+1)
+	if auditConfig.BackendProvider != "" {
+		outputs = append(outputs, service.Output{
+			Name:                     service.DefaultOutputName,
+			BackendProvider:          auditConfig.BackendProvider,
+			BackendProviderConfig:    auditConfig.BackendProviderConfig,
+			BackendProviderSecretRef: auditConfig.BackendProviderSecretRef,
+			FailurePolicy:            service.FailurePolicyRequired,
+		})
+	}
+	return append(outputs, auditConfig.Outputs...)
 }
 
 func (a *actuator) createManagedResource(ctx context.Context, namespace, name string, renderer chartrenderer.Interface, chartName string, chartValues map[string]interface{}, injectedLabels map[string]string) error {
@@ -260,21 +348,23 @@ func (a *actuator) ensureAuditPolicyConfig(ctx context.Context, namespace string
 	return err
 }
 
-func (a *actuator) ensureWebhookKubeconfig(ctx context.Context, namespace string, checksums map[string]string) error {
+// ensureWebhookKubeconfig ensures the kubeconfig of the kube-apiserver audit webhook and the serving certificate of the proxy.
+// The serving certificate is not part of the proxy checksums as the proxy reloads it on changes.
+func (a *actuator) ensureWebhookKubeconfig(ctx context.Context, namespace, token string) error {
 	a.logger.Info("Ensuring webhook kubernetes config", "namespace", namespace)
 	secret := &corev1.Secret{}
 	secret.SetName(config.AuditlogKubecfgSecretName)
 	secret.SetNamespace(namespace)
 	err := a.client.Get(ctx, client.ObjectKey{Name: config.AuditlogKubecfgSecretName, Namespace: namespace}, secret)
-	if err == nil {
-		return nil
-	}
-	if !apierrors.IsNotFound(err) {
+	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
 
-	a.logger.Info("Generating new certificate for webhook kubeconfig", "namespace", namespace)
-	cert, err := a.generateCertificate(config.AuditlogProxyServiceName, namespace)
+	ca, err := a.ensureCA(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	cert, caBundle, err := a.ensureServingCertificate(namespace, ca, &Certificate{Cert: secret.Data["tls.crt"], Key: secret.Data["tls.key"]})
 	if err != nil {
 		return err
 	}
@@ -296,7 +386,7 @@ func (a *actuator) ensureWebhookKubeconfig(ctx context.Context, namespace string
 				Cluster: clientcmdv1.Cluster{
 					Server:                   fmt.Sprintf("https://%s.%s:%d", config.AuditlogProxyServiceName, namespace, 443),
 					InsecureSkipTLSVerify:    false,
-					CertificateAuthorityData: cert.Cert,
+					CertificateAuthorityData: caBundle,
 				},
 			},
 		},
@@ -304,7 +394,7 @@ func (a *actuator) ensureWebhookKubeconfig(ctx context.Context, namespace string
 			{
 				Name: "auditlog-proxy-auth",
 				AuthInfo: clientcmdv1.AuthInfo{
-					Token: "abc",
+					Token: token,
 				},
 			},
 		},
@@ -315,14 +405,15 @@ func (a *actuator) ensureWebhookKubeconfig(ctx context.Context, namespace string
 		return err
 	}
 
-	secret.Data = map[string][]byte{
-		"kubeconfig": rawKubeconfig,
-		"tls.crt":    cert.Cert,
-		"tls.key":    cert.Key,
-	}
-
-	checksums[fmt.Sprintf("checksum/configmap-%s", config.AuditlogKubecfgSecretName)] = extensionutil.ComputeChecksum(secret.Data)
-	return a.client.Create(ctx, secret)
+	_, err = controllerutil.CreateOrUpdate(ctx, a.client, secret, func() error {
+		secret.Data = map[string][]byte{
+			"kubeconfig": rawKubeconfig,
+			"tls.crt":    cert.Cert,
+			"tls.key":    cert.Key,
+		}
+		return nil
+	})
+	return err
 }
 
 func (a *actuator) ensureKubeAPIServerDeployment(ctx context.Context, namespace string) error {
@@ -337,18 +428,3 @@ func (a *actuator) ensureKubeAPIServerDeployment(ctx context.Context, namespace
 
 	return a.client.Update(ctx, dep)
 }
-
-func (a *actuator) generateCertificate(svcName, namespace string) (*Certificate, error) {
-	validFor := 5 * 12 * 30 * 24 * time.Hour // ~5 years
-
-	// generate all possible dns hostnames
-	dnsSvcSuffix := fmt.Sprintf("%s.%s.svc.cluster.local", svcName, namespace)
-	hosts := make([]string, 0)
-	host := make([]string, 0)
-	for _, seg := range strings.Split(dnsSvcSuffix, ".") {
-		host = append(host, seg)
-		hosts = append(hosts, strings.Join(host, "."))
-	}
-
-	return GenerateRSACertificate(2048, "shoot-auditlog", hosts, time.Now().Add(validFor))
-}
@@ -0,0 +1,204 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+const (
+	// caValidity is the validity of a generated CA
+	caValidity = 5 * 365 * 24 * time.Hour
+	// caRenewBefore is the duration before the expiration of the CA when a new CA is generated.
+	// It has to be longer than the validity of the serving certificates.
+	caRenewBefore = 365 * 24 * time.Hour
+	// servingCertValidity is the validity of a generated serving certificate
+	servingCertValidity = 90 * 24 * time.Hour
+	// servingCertRenewBefore is the duration before the expiration of the serving certificate when it is renewed
+	servingCertRenewBefore = 30 * 24 * time.Hour
+	// caPropagationDelay is the minimum duration between the rotation of the CA and the first serving certificate
+	// that is signed by it so that the kube-apiserver trusts the new CA before the proxy serves the new certificate.
+	caPropagationDelay = 5 * time.Minute
+
+	// caRotatedAtAnnotation is the annotation that contains the time the current CA was generated
+	caRotatedAtAnnotation = "auditlog.extensions.gardener.cloud/ca-rotated-at"
+
+	caCertDataKey         = "ca.crt"
+	caKeyDataKey          = "ca.key"
+	previousCACertDataKey = "previous-ca.crt"
+)
+
+// certificateAuthority is the CA of the proxy serving certificate
+type certificateAuthority struct {
+	// current signs the serving certificates
+	current *Certificate
+	// bundle contains all PEM encoded CA certificates that have to be trusted by the kube-apiserver
+	bundle []byte
+	// rotatedAt is the time the current CA was generated
+	rotatedAt time.Time
+}
+
+// ensureCA ensures the CA secret of the proxy serving certificate.
+// The CA is rotated before it expires and the previous CA is kept in the bundle until it expires.
+func (a *actuator) ensureCA(ctx context.Context, namespace string) (*certificateAuthority, error) {
+	secret := &corev1.Secret{}
+	if err := a.client.Get(ctx, client.ObjectKey{Name: config.AuditlogCASecretName, Namespace: namespace}, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		secret.SetName(config.AuditlogCASecretName)
+		secret.SetNamespace(namespace)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+
+	var (
+		now     = time.Now()
+		changed = false
+		ca      = &Certificate{Cert: secret.Data[caCertDataKey], Key: secret.Data[caKeyDataKey]}
+	)
+
+	caCert, _, err := ParseCertificate(ca)
+	switch {
+	case err != nil:
+		a.logger.Info("Generating new auditlog proxy CA", "namespace", namespace, "reason", err.Error())
+		changed = true
+	case now.Add(caRenewBefore).After(caCert.NotAfter):
+		a.logger.Info("Rotating auditlog proxy CA", "namespace", namespace, "expiration", caCert.NotAfter)
+		secret.Data[previousCACertDataKey] = ca.Cert
+		changed = true
+	}
+	if changed {
+		ca, err = GenerateCACertificate(2048, "shoot-auditlog", now.Add(caValidity))
+		if err != nil {
+			return nil, err
+		}
+		secret.Data[caCertDataKey] = ca.Cert
+		secret.Data[caKeyDataKey] = ca.Key
+		secret.Annotations[caRotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	}
+
+	if previous := secret.Data[previousCACertDataKey]; len(previous) != 0 {
+		// all serving certificates that are signed by the previous CA are expired when the previous CA expires
+		if previousCert, err := ParseX509Certificate(previous); err != nil || now.After(previousCert.NotAfter) {
+			a.logger.Info("Removing expired previous auditlog proxy CA", "namespace", namespace)
+			delete(secret.Data, previousCACertDataKey)
+			changed = true
+		}
+	}
+
+	if changed {
+		if len(secret.ResourceVersion) == 0 {
+			err = a.client.Create(ctx, secret)
+		} else {
+			err = a.client.Update(ctx, secret)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &certificateAuthority{
+		current:   ca,
+		bundle:    joinPEM(secret.Data[caCertDataKey], secret.Data[previousCACertDataKey]),
+		rotatedAt: annotationTime(secret, caRotatedAtAnnotation),
+	}, nil
+}
+
+// ensureServingCertificate returns the serving certificate of the proxy and the CA bundle the kube-apiserver has to trust.
+// The existing certificate is renewed before it expires and after the CA was rotated.
+func (a *actuator) ensureServingCertificate(namespace string, ca *certificateAuthority, existing *Certificate) (*Certificate, []byte, error) {
+	var (
+		now            = time.Now()
+		caSettled      = now.Sub(ca.rotatedAt) > caPropagationDelay
+		renewReason    string
+		servingCert, _ = ParseX509Certificate(existing.Cert)
+		caCert, _      = ParseX509Certificate(ca.current.Cert)
+	)
+	switch {
+	case servingCert == nil || len(existing.Key) == 0:
+		renewReason = "missing"
+	case now.After(servingCert.NotAfter):
+		renewReason = "expired"
+	case servingCert.CheckSignatureFrom(caCert) != nil:
+		if caSettled {
+			renewReason = "not signed by current CA"
+		}
+	case now.Add(servingCertRenewBefore).After(servingCert.NotAfter):
+		renewReason = "expiring"
+	}
+
+	if renewReason == "" {
+		bundle := ca.bundle
+		// certificates that were generated before the CA was introduced are self-signed and have to be trusted
+		// until they are replaced by a certificate signed by the CA
+		if servingCert.CheckSignature(servingCert.SignatureAlgorithm, servingCert.RawTBSCertificate, servingCert.Signature) == nil {
+			bundle = joinPEM(bundle, existing.Cert)
+		}
+		return existing, bundle, nil
+	}
+
+	a.logger.Info("Generating new serving certificate for the auditlog proxy", "namespace", namespace, "reason", renewReason)
+	cert, err := a.generateCertificate(ca.current, config.AuditlogProxyServiceName, namespace, caCert)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, ca.bundle, nil
+}
+
+func (a *actuator) generateCertificate(ca *Certificate, svcName, namespace string, caCert *x509.Certificate) (*Certificate, error) {
+	// the serving certificate must not outlive its CA
+	expiration := time.Now().Add(servingCertValidity)
+	if caCert != nil && caCert.NotAfter.Before(expiration) {
+		expiration = caCert.NotAfter
+	}
+
+	// generate all possible dns hostnames
+	dnsSvcSuffix := fmt.Sprintf("%s.%s.svc.cluster.local", svcName, namespace)
+	hosts := make([]string, 0)
+	host := make([]string, 0)
+	for _, seg := range strings.Split(dnsSvcSuffix, ".") {
+		host = append(host, seg)
+		hosts = append(hosts, strings.Join(host, "."))
+	}
+
+	return GenerateSignedRSACertificate(ca, 2048, "shoot-auditlog", hosts, expiration)
+}
+
+// joinPEM concatenates the given PEM encoded data
+func joinPEM(data ...[]byte) []byte {
+	out := bytes.NewBuffer([]byte{})
+	for _, d := range data {
+		if len(d) == 0 {
+			continue
+		}
+		out.Write(bytes.TrimSpace(d))
+		out.WriteRune('\n')
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("ensureServingCertificate", func() {
+	var (
+		a  *actuator
+		ca *certificateAuthority
+	)
+
+	newCA := func(rotatedAt time.Time) *certificateAuthority {
+		cert, err := GenerateCACertificate(2048, "test", time.Now().Add(caValidity))
+		Expect(err).ToNot(HaveOccurred())
+		return &certificateAuthority{current: cert, bundle: cert.Cert, rotatedAt: rotatedAt}
+	}
+
+	verify := func(cert *Certificate, bundle []byte) error {
+		pool := x509.NewCertPool()
+		Expect(pool.AppendCertsFromPEM(bundle)).To(BeTrue())
+		x509Cert, err := ParseX509Certificate(cert.Cert)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = x509Cert.Verify(x509.VerifyOptions{
+			DNSName: "shoot-auditlog-proxy.shoot--foo--bar",
+			Roots:   pool,
+		})
+		return err
+	}
+
+	BeforeEach(func() {
+		a = &actuator{logger: log.NullLogger{}}
+		ca = newCA(time.Now().Add(-time.Hour))
+	})
+
+	It("should generate a short-lived serving certificate signed by the CA", func() {
+		cert, bundle, err := a.ensureServingCertificate("shoot--foo--bar", ca, &Certificate{})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(verify(cert, bundle)).To(Succeed())
+
+		x509Cert, err := ParseX509Certificate(cert.Cert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(x509Cert.NotAfter).To(BeTemporally("~", time.Now().Add(servingCertValidity), time.Minute))
+	})
+
+	It("should keep a valid serving certificate", func() {
+		cert, _, err := a.ensureServingCertificate("shoot--foo--bar", ca, &Certificate{})
+		Expect(err).ToNot(HaveOccurred())
+
+		renewed, _, err := a.ensureServingCertificate("shoot--foo--bar", ca, cert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(renewed).To(Equal(cert))
+	})
+
+	It("should renew a serving certificate that expires soon", func() {
+		cert, err := GenerateSignedRSACertificate(ca.current, 2048, "test", []string{"shoot-auditlog-proxy.shoot--foo--bar"}, time.Now().Add(servingCertRenewBefore/2))
+		Expect(err).ToNot(HaveOccurred())
+
+		renewed, _, err := a.ensureServingCertificate("shoot--foo--bar", ca, cert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(renewed).ToNot(Equal(cert))
+	})
+
+	It("should only use a rotated CA after the propagation delay", func() {
+		cert, _, err := a.ensureServingCertificate("shoot--foo--bar", ca, &Certificate{})
+		Expect(err).ToNot(HaveOccurred())
+
+		rotated := newCA(time.Now())
+		rotated.bundle = joinPEM(rotated.current.Cert, ca.current.Cert)
+
+		kept, bundle, err := a.ensureServingCertificate("shoot--foo--bar", rotated, cert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kept).To(Equal(cert))
+		Expect(verify(kept, bundle)).To(Succeed())
+
+		rotated.rotatedAt = time.Now().Add(-2 * caPropagationDelay)
+		renewed, bundle, err := a.ensureServingCertificate("shoot--foo--bar", rotated, cert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(renewed).ToNot(Equal(cert))
+		Expect(verify(renewed, bundle)).To(Succeed())
+		Expect(verify(renewed, rotated.current.Cert)).To(Succeed())
+	})
+
+	It("should trust a self-signed certificate until it is replaced", func() {
+		// serving certificates were self-signed before the CA was introduced
+		template, err := newCertificateTemplate("test", time.Now().Add(time.Hour))
+		Expect(err).ToNot(HaveOccurred())
+		template.DNSNames = []string{"shoot-auditlog-proxy.shoot--foo--bar"}
+		selfSigned, err := generateCertificate(2048, template, nil, nil)
+		Expect(err).ToNot(HaveOccurred())
+		ca.rotatedAt = time.Now()
+
+		kept, bundle, err := a.ensureServingCertificate("shoot--foo--bar", ca, selfSigned)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(kept).To(Equal(selfSigned))
+		Expect(verify(kept, bundle)).To(Succeed())
+	})
+})
@@ -16,11 +16,13 @@ package controller
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"github.com/pkg/errors"
 	"math/big"
 	"net"
 	"time"
@@ -32,44 +34,104 @@ type Certificate struct {
 	Key  []byte
 }
 
-// GenerateRSACertificate generates a RSA priv key and creates a certificate from it
-func GenerateRSACertificate(rsaBits int, org string, hosts []string, expirationDate time.Time) (*Certificate, error) {
+// GenerateCACertificate generates a RSA priv key and creates a self-signed CA certificate from it
+func GenerateCACertificate(rsaBits int, org string, expirationDate time.Time) (*Certificate, error) {
+	template, err := newCertificateTemplate(org, expirationDate)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
 
-	// generate the rsa priv and public key
-	priv, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	return generateCertificate(rsaBits, template, nil, nil)
+}
+
+// GenerateSignedRSACertificate generates a RSA priv key and creates a serving certificate for the given hosts
+// that is signed by the given CA
+func GenerateSignedRSACertificate(ca *Certificate, rsaBits int, org string, hosts []string, expirationDate time.Time) (*Certificate, error) {
+	caCert, caKey, err := ParseCertificate(ca)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse CA")
+	}
+
+	template, err := newCertificateTemplate(org, expirationDate)
 	if err != nil {
 		return nil, err
 	}
+	template.KeyUsage = x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
 
-	notBefore := time.Now()
+	return generateCertificate(rsaBits, template, caCert, caKey)
+}
 
+// ParseCertificate parses the PEM encoded certificate and its private key
+func ParseCertificate(cert *Certificate) (*x509.Certificate, crypto.Signer, error) {
+	x509Cert, err := ParseX509Certificate(cert.Cert)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyBlock, _ := pem.Decode(cert.Key)
+	if keyBlock == nil {
+		return nil, nil, errors.New("no PEM encoded private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("private key cannot be used for signing")
+	}
+	return x509Cert, signer, nil
+}
+
+// ParseX509Certificate parses the first certificate of the PEM encoded data
+func ParseX509Certificate(data []byte) (*x509.Certificate, error) {
+	certBlock, _ := pem.Decode(data)
+	if certBlock == nil {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return x509.ParseCertificate(certBlock.Bytes)
+}
+
+func newCertificateTemplate(org string, expirationDate time.Time) (*x509.Certificate, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
 		return nil, err
 	}
-	template := x509.Certificate{
+	return &x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{org},
 		},
-		NotBefore: notBefore,
-		NotAfter:  expirationDate,
-
-		KeyUsage:              x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		NotBefore:             time.Now(),
+		NotAfter:              expirationDate,
 		BasicConstraintsValid: true,
-	}
+	}, nil
+}
 
-	for _, h := range hosts {
-		if ip := net.ParseIP(h); ip != nil {
-			template.IPAddresses = append(template.IPAddresses, ip)
-		} else {
-			template.DNSNames = append(template.DNSNames, h)
-		}
+// generateCertificate generates a RSA priv key and creates a certificate from the template.
+// The certificate is self-signed if no parent is given.
+func generateCertificate(rsaBits int, template, parent *x509.Certificate, parentKey crypto.Signer) (*Certificate, error) {
+	// generate the rsa priv and public key
+	priv, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		parent, parentKey = template, priv
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, priv.Public(), priv)
+	derBytes, err := x509.CreateCertificate(rand.Reader, template, parent, priv.Public(), parentKey)
 	if err != nil {
 		return nil, err
 	}
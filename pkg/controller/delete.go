@@ -19,9 +19,11 @@ import (
 	"fmt"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers"
 	"github.com/gardener/gardener-extensions/pkg/controller"
 	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
@@ -46,6 +48,27 @@ func (a *actuator) deleteSeedResources(ctx context.Context, ex *extensionsv1alph
 		return err
 	}
 
+	caSecret := &corev1.Secret{}
+	caSecret.SetName(config.AuditlogCASecretName)
+	caSecret.SetNamespace(ex.GetNamespace())
+	if err := a.client.Delete(ctx, caSecret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
+	tokenSecret := &corev1.Secret{}
+	tokenSecret.SetName(config.AuditlogProxyTokenSecretName)
+	tokenSecret.SetNamespace(ex.GetNamespace())
+	if err := a.client.Delete(ctx, tokenSecret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
+	hashKeySecret := &corev1.Secret{}
+	hashKeySecret.SetName(config.AuditlogProxyHashKeySecretName)
+	hashKeySecret.SetNamespace(ex.GetNamespace())
+	if err := a.client.Delete(ctx, hashKeySecret); client.IgnoreNotFound(err) != nil {
+		return err
+	}
+
 	cm := &corev1.ConfigMap{}
 	cm.SetName(config.AuditlogPolicyConfigMapName)
 	cm.SetNamespace(ex.GetNamespace())
@@ -66,19 +89,45 @@ func (a *actuator) deleteSeedResources(ctx context.Context, ex *extensionsv1alph
 	if err := controller.WaitUntilManagedResourceDeleted(timeoutCtx, a.client, ex.GetNamespace(), config.AuditlogProxyResourceName); err != nil {
 		return err
 	}
-	return a.deleteBackendProvider(ctx, ex)
+
+	// the volume claims of the statefulset are not deleted together with it
+	if err := a.client.DeleteAllOf(ctx, &corev1.PersistentVolumeClaim{}, client.InNamespace(ex.GetNamespace()),
+		client.MatchingLabels{"app.kubernetes.io/name": config.AuditlogProxyChartName}); err != nil {
+		return err
+	}
+	return a.deleteBackendProviders(ctx, ex)
 }
 
-func (a *actuator) deleteBackendProvider(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+func (a *actuator) deleteBackendProviders(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
 	auditConfig := &service.Configuration{}
 	if _, _, err := a.decoder.Decode(ex.Spec.ProviderConfig.Raw, nil, auditConfig); err != nil {
 		return fmt.Errorf("failed to decode provider config: %+v", err)
 	}
 
-	p, err := providers.ProviderFactory.Get(auditConfig.BackendProvider)
+	for _, output := range getOutputs(auditConfig) {
+		if err := a.deleteBackendProvider(ctx, output, ex); err != nil {
+			return errors.Wrapf(err, "unable to delete backend provider of output %s", output.Name)
+		}
+	}
+	return nil
+}
+
+func (a *actuator) deleteBackendProvider(ctx context.Context, output service.Output, ex *extensionsv1alpha1.Extension) error {
+	// the deletion is not blocked by unknown providers, they have never been reconciled as the configuration is validated
+	p, err := providers.ProviderFactory.Get(output.BackendProvider)
 	if err != nil {
+		a.logger.Info("Skipping deletion of unknown backend provider", "namespace", ex.GetNamespace(), "output", output.Name, "provider", output.BackendProvider)
 		return nil
 	}
+	if _, err := provider.BackendConfigInto(output.BackendProviderConfig, p); err != nil {
+		return err
+	}
+	// the backend resources are deleted without the credentials if the secret is already gone
+	if output.BackendProviderSecretRef != nil {
+		if err := a.injectBackendSecret(ctx, p, output.BackendProviderSecretRef, ex.GetNamespace()); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
 	if _, err := inject.ClientInto(a.client, p); err != nil {
 		return err
 	}
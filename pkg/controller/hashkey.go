@@ -0,0 +1,60 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
+	"github.com/gardener/gardener/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// hashKeyLength is the length of the generated hash keys
+	hashKeyLength = 64
+	// hashKeyDataKey is the key of the hash key in the secret
+	hashKeyDataKey = "key"
+)
+
+// ensureProxyHashKey ensures the secret with the key the auditlog proxy hashes the values of Hash redactions with.
+// The key is never rotated as the hashes of equal values would no longer match.
+func (a *actuator) ensureProxyHashKey(ctx context.Context, namespace string) error {
+	secret := &corev1.Secret{}
+	err := a.client.Get(ctx, client.ObjectKey{Name: config.AuditlogProxyHashKeySecretName, Namespace: namespace}, secret)
+	if err == nil && len(secret.Data[hashKeyDataKey]) != 0 {
+		return nil
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	a.logger.Info("Generating new auditlog proxy hash key", "namespace", namespace)
+	key, err := utils.GenerateRandomString(hashKeyLength)
+	if err != nil {
+		return err
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[hashKeyDataKey] = []byte(key)
+	if secret.ResourceVersion != "" {
+		return a.client.Update(ctx, secret)
+	}
+	secret.SetName(config.AuditlogProxyHashKeySecretName)
+	secret.SetNamespace(namespace)
+	return a.client.Create(ctx, secret)
+}
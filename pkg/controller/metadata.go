@@ -0,0 +1,46 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extensions/pkg/controller"
+	"github.com/gardener/gardener/pkg/operation/common"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// shootMetadata returns the identity of the shoot that the proxy attaches to every audit event.
+// The technical id defaults to the namespace of the shoot in the seed.
+func shootMetadata(cluster *controller.Cluster, namespace string) *proxy.ShootMetadata {
+	metadata := &proxy.ShootMetadata{TechnicalID: namespace}
+	if shoot := cluster.Shoot; shoot != nil {
+		metadata.Name = shoot.Name
+		metadata.Project = common.ProjectNameForNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: shoot.Namespace}})
+		metadata.Region = shoot.Spec.Region
+		metadata.ProviderType = shoot.Spec.Provider.Type
+		metadata.UID = string(shoot.Status.UID)
+		if metadata.UID == "" {
+			metadata.UID = string(shoot.UID)
+		}
+		if shoot.Status.TechnicalID != "" {
+			metadata.TechnicalID = shoot.Status.TechnicalID
+		}
+	}
+	if seed := cluster.Seed; seed != nil {
+		metadata.Seed = seed.Name
+	}
+	return metadata
+}
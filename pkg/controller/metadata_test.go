@@ -0,0 +1,54 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+
+	"github.com/gardener/gardener-extensions/pkg/controller"
+	gardencorev1beta1 "github.com/gardener/gardener/pkg/apis/core/v1beta1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("shootMetadata", func() {
+	It("should return the identity of the shoot", func() {
+		cluster := &controller.Cluster{
+			Shoot: &gardencorev1beta1.Shoot{
+				ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "garden-foo", UID: "object-uid"},
+				Spec: gardencorev1beta1.ShootSpec{
+					Region:   "eu-west-1",
+					Provider: gardencorev1beta1.Provider{Type: "aws"},
+				},
+				Status: gardencorev1beta1.ShootStatus{TechnicalID: "shoot--foo--bar", UID: "cluster-uid"},
+			},
+			Seed: &gardencorev1beta1.Seed{ObjectMeta: metav1.ObjectMeta{Name: "aws-eu1"}},
+		}
+		Expect(shootMetadata(cluster, "shoot--foo--bar")).To(Equal(&proxy.ShootMetadata{
+			Name:         "bar",
+			Project:      "foo",
+			TechnicalID:  "shoot--foo--bar",
+			UID:          "cluster-uid",
+			Seed:         "aws-eu1",
+			Region:       "eu-west-1",
+			ProviderType: "aws",
+		}))
+	})
+
+	It("should default the technical id to the namespace", func() {
+		Expect(shootMetadata(&controller.Cluster{}, "shoot--foo--bar")).To(Equal(&proxy.ShootMetadata{TechnicalID: "shoot--foo--bar"}))
+	})
+})
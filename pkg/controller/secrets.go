@@ -0,0 +1,41 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// injectBackendSecret reads the referenced secret of the shoot namespace and injects its data into the provider.
+// The namespace of the reference is ignored, secrets of other namespaces of the seed are never read for the shoot.
+// The error of reading the secret is returned as is so that callers can ignore missing secrets.
+func (a *actuator) injectBackendSecret(ctx context.Context, p provider.Interface, ref *corev1.SecretReference, namespace string) error {
+	secret := &corev1.Secret{}
+	if err := a.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+		return err
+	}
+	ok, err := provider.BackendSecretInto(secret.Data, p)
+	if err != nil {
+		return errors.Wrapf(err, "unable to inject secret %s/%s", secret.Namespace, secret.Name)
+	}
+	if !ok {
+		return errors.Errorf("provider %s does not support secrets", p.Name())
+	}
+	return nil
+}
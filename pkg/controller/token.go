@@ -0,0 +1,153 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
+	"github.com/gardener/gardener/pkg/utils"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"strings"
+	"time"
+)
+
+const (
+	// tokenValidity is the duration after which the token of the kube-apiserver is rotated
+	tokenValidity = 30 * 24 * time.Hour
+	// tokenPropagationDelay is the minimum duration between two steps of a token rotation.
+	// It gives the kubelet the time to update the token file that is mounted into the auditlog proxy
+	// and the kube-apiserver the time to roll out the new kubeconfig.
+	tokenPropagationDelay = 5 * time.Minute
+	// tokenLength is the length of the generated tokens
+	tokenLength = 64
+
+	// tokenIssuedAtAnnotation is the annotation that contains the time the current token was issued
+	tokenIssuedAtAnnotation = "auditlog.extensions.gardener.cloud/token-issued-at"
+	// tokensUpdatedAtAnnotation is the annotation that contains the time the accepted tokens were last changed
+	tokensUpdatedAtAnnotation = "auditlog.extensions.gardener.cloud/tokens-updated-at"
+
+	// tokenDataKey is the key of the token that is used by the kube-apiserver
+	tokenDataKey = "token"
+	// nextTokenDataKey is the key of the token that is accepted by the proxy before the kube-apiserver uses it
+	nextTokenDataKey = "next-token"
+	// previousTokenDataKey is the key of the token that is still accepted by the proxy until the kube-apiserver uses the current token
+	previousTokenDataKey = "previous-token"
+	// tokensDataKey is the key of the newline separated tokens that are accepted by the proxy
+	tokensDataKey = "tokens"
+)
+
+// ensureProxyToken ensures the secret with the tokens the auditlog proxy accepts and returns the token
+// the kube-apiserver has to use.
+// A token is rotated in three steps that are at least the propagation delay apart so that no request is rejected:
+// the next token is accepted by the proxy, the kube-apiserver switches to the next token and finally
+// the previous token is no longer accepted.
+func (a *actuator) ensureProxyToken(ctx context.Context, namespace string) (string, error) {
+	secret := &corev1.Secret{}
+	if err := a.client.Get(ctx, client.ObjectKey{Name: config.AuditlogProxyTokenSecretName, Namespace: namespace}, secret); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return "", err
+		}
+
+		a.logger.Info("Generating new auditlog proxy token", "namespace", namespace)
+		token, err := utils.GenerateRandomString(tokenLength)
+		if err != nil {
+			return "", err
+		}
+		now := time.Now().UTC().Format(time.RFC3339)
+		secret.SetName(config.AuditlogProxyTokenSecretName)
+		secret.SetNamespace(namespace)
+		secret.SetAnnotations(map[string]string{
+			tokenIssuedAtAnnotation:   now,
+			tokensUpdatedAtAnnotation: now,
+		})
+		secret.Data = map[string][]byte{
+			tokenDataKey: []byte(token),
+		}
+		secret.Data[tokensDataKey] = acceptedTokens(secret.Data)
+		return token, a.client.Create(ctx, secret)
+	}
+
+	var (
+		now       = time.Now()
+		issuedAt  = annotationTime(secret, tokenIssuedAtAnnotation)
+		updatedAt = annotationTime(secret, tokensUpdatedAtAnnotation)
+		settled   = now.Sub(updatedAt) > tokenPropagationDelay
+		changed   = true
+	)
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+
+	switch {
+	case len(secret.Data[tokenDataKey]) == 0:
+		a.logger.Info("Generating missing auditlog proxy token", "namespace", namespace)
+		token, err := utils.GenerateRandomString(tokenLength)
+		if err != nil {
+			return "", err
+		}
+		secret.Data[tokenDataKey] = []byte(token)
+		secret.Annotations[tokenIssuedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	case len(secret.Data[previousTokenDataKey]) != 0 && settled:
+		a.logger.Info("Removing previous auditlog proxy token", "namespace", namespace)
+		delete(secret.Data, previousTokenDataKey)
+	case len(secret.Data[nextTokenDataKey]) != 0 && settled:
+		a.logger.Info("Activating next auditlog proxy token", "namespace", namespace)
+		secret.Data[previousTokenDataKey] = secret.Data[tokenDataKey]
+		secret.Data[tokenDataKey] = secret.Data[nextTokenDataKey]
+		delete(secret.Data, nextTokenDataKey)
+		secret.Annotations[tokenIssuedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	case len(secret.Data[nextTokenDataKey]) == 0 && len(secret.Data[previousTokenDataKey]) == 0 && now.Sub(issuedAt) > tokenValidity:
+		a.logger.Info("Generating next auditlog proxy token", "namespace", namespace)
+		token, err := utils.GenerateRandomString(tokenLength)
+		if err != nil {
+			return "", err
+		}
+		secret.Data[nextTokenDataKey] = []byte(token)
+	default:
+		changed = false
+	}
+
+	if !changed {
+		return string(secret.Data[tokenDataKey]), nil
+	}
+	secret.Annotations[tokensUpdatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	secret.Data[tokensDataKey] = acceptedTokens(secret.Data)
+	return string(secret.Data[tokenDataKey]), a.client.Update(ctx, secret)
+}
+
+// acceptedTokens returns all tokens of the secret data separated by newlines
+func acceptedTokens(data map[string][]byte) []byte {
+	tokens := make([]string, 0, 3)
+	for _, key := range []string{tokenDataKey, nextTokenDataKey, previousTokenDataKey} {
+		if token := data[key]; len(token) != 0 {
+			tokens = append(tokens, string(token))
+		}
+	}
+	return []byte(strings.Join(tokens, "\n") + "\n")
+}
+
+// annotationTime returns the time of the given annotation or the zero time if it is not set or invalid
+func annotationTime(secret *corev1.Secret, annotation string) time.Time {
+	t, err := time.Parse(time.RFC3339, secret.Annotations[annotation])
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/config"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("ensureProxyToken", func() {
+	const namespace = "shoot--foo--bar"
+
+	var (
+		ctx = context.TODO()
+		a   *actuator
+	)
+
+	newActuator := func(data map[string][]byte, issuedAt, updatedAt time.Time) *actuator {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      config.AuditlogProxyTokenSecretName,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					tokenIssuedAtAnnotation:   issuedAt.UTC().Format(time.RFC3339),
+					tokensUpdatedAtAnnotation: updatedAt.UTC().Format(time.RFC3339),
+				},
+			},
+			Data: data,
+		}
+		return &actuator{client: fake.NewFakeClientWithScheme(scheme.Scheme, secret), logger: log.NullLogger{}}
+	}
+
+	getSecret := func() *corev1.Secret {
+		secret := &corev1.Secret{}
+		Expect(a.client.Get(ctx, client.ObjectKey{Name: config.AuditlogProxyTokenSecretName, Namespace: namespace}, secret)).To(Succeed())
+		return secret
+	}
+
+	It("should create the secret with a new token", func() {
+		a = &actuator{client: fake.NewFakeClientWithScheme(scheme.Scheme), logger: log.NullLogger{}}
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(HaveLen(tokenLength))
+
+		secret := getSecret()
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			tokenDataKey:  []byte(token),
+			tokensDataKey: []byte(token + "\n"),
+		}))
+		Expect(annotationTime(secret, tokenIssuedAtAnnotation)).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(annotationTime(secret, tokensUpdatedAtAnnotation)).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should keep a token within the rotation period", func() {
+		data := map[string][]byte{tokenDataKey: []byte("current"), tokensDataKey: []byte("current\n")}
+		a = newActuator(data, time.Now().Add(-tokenValidity/2), time.Now().Add(-tokenValidity/2))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("current"))
+		Expect(getSecret().Data).To(Equal(data))
+	})
+
+	It("should generate a missing token", func() {
+		a = newActuator(map[string][]byte{}, time.Now(), time.Now())
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(HaveLen(tokenLength))
+		Expect(getSecret().Data[tokensDataKey]).To(Equal([]byte(token + "\n")))
+	})
+
+	It("should accept the next token after the rotation period without using it", func() {
+		a = newActuator(map[string][]byte{tokenDataKey: []byte("current")}, time.Now().Add(-tokenValidity-time.Hour), time.Now().Add(-tokenValidity-time.Hour))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("current"))
+
+		secret := getSecret()
+		next := string(secret.Data[nextTokenDataKey])
+		Expect(next).To(HaveLen(tokenLength))
+		Expect(secret.Data).ToNot(HaveKey(previousTokenDataKey))
+		Expect(secret.Data[tokensDataKey]).To(Equal([]byte("current\n" + next + "\n")))
+		Expect(annotationTime(secret, tokensUpdatedAtAnnotation)).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should not use the next token within the propagation delay", func() {
+		data := map[string][]byte{tokenDataKey: []byte("current"), nextTokenDataKey: []byte("next"), tokensDataKey: []byte("current\nnext\n")}
+		a = newActuator(data, time.Now().Add(-tokenValidity-time.Hour), time.Now().Add(-tokenPropagationDelay/2))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("current"))
+		Expect(getSecret().Data).To(Equal(data))
+	})
+
+	It("should promote the next token after the propagation delay", func() {
+		data := map[string][]byte{tokenDataKey: []byte("current"), nextTokenDataKey: []byte("next"), tokensDataKey: []byte("current\nnext\n")}
+		a = newActuator(data, time.Now().Add(-tokenValidity-time.Hour), time.Now().Add(-2*tokenPropagationDelay))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("next"))
+
+		secret := getSecret()
+		Expect(secret.Data).To(Equal(map[string][]byte{
+			tokenDataKey:         []byte("next"),
+			previousTokenDataKey: []byte("current"),
+			tokensDataKey:        []byte("next\ncurrent\n"),
+		}))
+		Expect(annotationTime(secret, tokenIssuedAtAnnotation)).To(BeTemporally("~", time.Now(), time.Minute))
+	})
+
+	It("should accept the previous token within the grace window", func() {
+		data := map[string][]byte{tokenDataKey: []byte("next"), previousTokenDataKey: []byte("current"), tokensDataKey: []byte("next\ncurrent\n")}
+		a = newActuator(data, time.Now().Add(-tokenPropagationDelay/2), time.Now().Add(-tokenPropagationDelay/2))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("next"))
+		Expect(getSecret().Data).To(Equal(data))
+	})
+
+	It("should remove the previous token after the grace window", func() {
+		data := map[string][]byte{tokenDataKey: []byte("next"), previousTokenDataKey: []byte("current"), tokensDataKey: []byte("next\ncurrent\n")}
+		a = newActuator(data, time.Now().Add(-2*tokenPropagationDelay), time.Now().Add(-2*tokenPropagationDelay))
+
+		token, err := a.ensureProxyToken(ctx, namespace)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token).To(Equal("next"))
+		Expect(getSecret().Data).To(Equal(map[string][]byte{
+			tokenDataKey:  []byte("next"),
+			tokensDataKey: []byte("next\n"),
+		}))
+	})
+})
+
+var _ = Describe("acceptedTokens", func() {
+	It("should accept the current token", func() {
+		Expect(acceptedTokens(map[string][]byte{tokenDataKey: []byte("current")})).To(Equal([]byte("current\n")))
+	})
+
+	It("should accept the current and the next token", func() {
+		Expect(acceptedTokens(map[string][]byte{
+			tokenDataKey:     []byte("current"),
+			nextTokenDataKey: []byte("next"),
+		})).To(Equal([]byte("current\nnext\n")))
+	})
+
+	It("should accept the current and the previous token", func() {
+		Expect(acceptedTokens(map[string][]byte{
+			tokenDataKey:         []byte("next"),
+			previousTokenDataKey: []byte("current"),
+		})).To(Equal([]byte("next\ncurrent\n")))
+	})
+
+	It("should ignore empty tokens and the accepted tokens themselves", func() {
+		Expect(acceptedTokens(map[string][]byte{
+			tokenDataKey:         []byte("current"),
+			nextTokenDataKey:     {},
+			previousTokenDataKey: {},
+			tokensDataKey:        []byte("stale\n"),
+		})).To(Equal([]byte("current\n")))
+	})
+})
@@ -0,0 +1,69 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/apiserver/pkg/apis/audit/install"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+var auditScheme = runtime.NewScheme()
+
+func init() {
+	install.Install(auditScheme)
+}
+
+// ConvertEventToV1 converts an internal audit event into its audit.k8s.io/v1 representation
+func ConvertEventToV1(event *audit.Event) (*auditv1.Event, error) {
+	out := &auditv1.Event{}
+	if err := auditScheme.Convert(event, out, nil); err != nil {
+		return nil, err
+	}
+	out.APIVersion = auditv1.SchemeGroupVersion.String()
+	out.Kind = "Event"
+	return out, nil
+}
+
+// ConvertEventFromV1 converts an audit.k8s.io/v1 event into its internal representation
+func ConvertEventFromV1(event *auditv1.Event) (*audit.Event, error) {
+	out := &audit.Event{}
+	if err := auditScheme.Convert(event, out, nil); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ConvertEventListToV1 converts an internal audit event list into its audit.k8s.io/v1 representation
+func ConvertEventListToV1(events *audit.EventList) (*auditv1.EventList, error) {
+	out := &auditv1.EventList{}
+	if err := auditScheme.Convert(events, out, nil); err != nil {
+		return nil, err
+	}
+	out.APIVersion = auditv1.SchemeGroupVersion.String()
+	out.Kind = "EventList"
+	return out, nil
+}
+
+// MarshalEventV1 serializes an internal audit event as audit.k8s.io/v1 json
+func MarshalEventV1(event *audit.Event) ([]byte, error) {
+	out, err := ConvertEventToV1(event)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(out)
+}
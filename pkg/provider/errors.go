@@ -0,0 +1,71 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// TransientError is an error that might be resolved by retrying the same request
+type TransientError struct {
+	Err error
+}
+
+var _ error = &TransientError{}
+
+// NewTransientError marks the given error as transient
+func NewTransientError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+// IsTransient returns true if the cause of the given error is a TransientError
+func IsTransient(err error) bool {
+	_, ok := errors.Cause(err).(*TransientError)
+	return ok
+}
+
+// EventError describes the failure to log a single event of an event list
+type EventError struct {
+	// Index is the index of the event in the logged event list
+	Index int
+	// Err is the reason why the event could not be logged
+	Err error
+	// Transient is true if the event might be successfully logged by a retry
+	Transient bool
+}
+
+// PartialError is returned by providers if only some events of an event list could not be logged
+type PartialError struct {
+	Errors []EventError
+}
+
+var _ error = &PartialError{}
+
+func (e *PartialError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, eventErr := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("event %d: %v", eventErr.Index, eventErr.Err))
+	}
+	return fmt.Sprintf("%d events could not be logged: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+// Annotations that identify the shoot of an audit event.
+// They are attached to every event by the proxy.
+const (
+	AnnotationShootName         = "shoot.gardener.cloud/name"
+	AnnotationShootProject      = "shoot.gardener.cloud/project"
+	AnnotationShootTechnicalID  = "shoot.gardener.cloud/technical-id"
+	AnnotationShootUID          = "shoot.gardener.cloud/uid"
+	AnnotationShootSeed         = "shoot.gardener.cloud/seed"
+	AnnotationShootRegion       = "shoot.gardener.cloud/region"
+	AnnotationShootProviderType = "shoot.gardener.cloud/provider-type"
+)
+
+// ShootMetadata identifies the shoot of an audit event
+type ShootMetadata struct {
+	Name         string `json:"name,omitempty"`
+	Project      string `json:"project,omitempty"`
+	TechnicalID  string `json:"technicalID,omitempty"`
+	UID          string `json:"uid,omitempty"`
+	Seed         string `json:"seed,omitempty"`
+	Region       string `json:"region,omitempty"`
+	ProviderType string `json:"providerType,omitempty"`
+}
+
+// ShootMetadataFrom returns the shoot metadata from the annotations of the event
+func ShootMetadataFrom(event *audit.Event) ShootMetadata {
+	return ShootMetadata{
+		Name:         event.Annotations[AnnotationShootName],
+		Project:      event.Annotations[AnnotationShootProject],
+		TechnicalID:  event.Annotations[AnnotationShootTechnicalID],
+		UID:          event.Annotations[AnnotationShootUID],
+		Seed:         event.Annotations[AnnotationShootSeed],
+		Region:       event.Annotations[AnnotationShootRegion],
+		ProviderType: event.Annotations[AnnotationShootProviderType],
+	}
+}
+
+// IsEmpty returns true if no field of the metadata is defined
+func (m ShootMetadata) IsEmpty() bool {
+	return m == ShootMetadata{}
+}
+
+// Annotations returns the non empty fields of the metadata as annotations
+func (m ShootMetadata) Annotations() map[string]string {
+	annotations := map[string]string{}
+	for key, value := range map[string]string{
+		AnnotationShootName:         m.Name,
+		AnnotationShootProject:      m.Project,
+		AnnotationShootTechnicalID:  m.TechnicalID,
+		AnnotationShootUID:          m.UID,
+		AnnotationShootSeed:         m.Seed,
+		AnnotationShootRegion:       m.Region,
+		AnnotationShootProviderType: m.ProviderType,
+	} {
+		if value != "" {
+			annotations[key] = value
+		}
+	}
+	return annotations
+}
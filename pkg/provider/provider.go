@@ -16,6 +16,8 @@ package provider
 
 import (
 	"github.com/gardener/gardener-extensions/pkg/controller/extension"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/apis/audit"
 )
 
@@ -26,6 +28,16 @@ type Interface interface {
 	Name() string
 	New() (Interface, error)
 	Log(events *audit.EventList) error
+
+	// ValidateBackendConfig validates the raw backend configuration of the provider.
+	// The secret reference is the backendProviderSecretRef of the output, if any, whose secret may contain the credentials
+	// instead of the configuration. The errors contain the paths of the invalid fields below the given path.
+	ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList
+}
+
+// Closer is implemented by providers that have to flush pending events or release resources before the proxy stops
+type Closer interface {
+	Close() error
 }
 
 // BackendConfig is used by the auditlog extension to inject backend Config
@@ -41,3 +53,50 @@ func BackendConfigInto(config []byte, i interface{}) (bool, error) {
 	}
 	return false, nil
 }
+
+// ResolvedBackendConfig is implemented by providers that complete their backend configuration during reconciliation,
+// e.g. by discovering the endpoint and credentials of a backend in the seed.
+type ResolvedBackendConfig interface {
+	BackendConfig() ([]byte, error)
+}
+
+// BackendConfigFrom returns the backend configuration of the provider if it completes its configuration
+// during reconciliation and the given default configuration otherwise.
+func BackendConfigFrom(i interface{}, defaultConfig []byte) ([]byte, error) {
+	if s, ok := i.(ResolvedBackendConfig); ok {
+		return s.BackendConfig()
+	}
+	return defaultConfig, nil
+}
+
+// BackendSecret is implemented by providers that read their credentials from a secret.
+// The data of the secret is injected after the backend configuration and again whenever the secret changes.
+type BackendSecret interface {
+	InjectBackendSecret(data map[string][]byte) error
+}
+
+// BackendSecretInto will set the secret data on i and return the result if it implements BackendSecret. Returns
+// false if i does not implement BackendSecret.
+func BackendSecretInto(data map[string][]byte, i interface{}) (bool, error) {
+	if s, ok := i.(BackendSecret); ok {
+		return true, s.InjectBackendSecret(data)
+	}
+	return false, nil
+}
+
+// ResolvedBackendSecretRef is implemented by providers that reference the secret with their credentials
+// in their backend configuration or discover it during reconciliation, e.g. the credentials of a backend in the seed.
+type ResolvedBackendSecretRef interface {
+	BackendSecretRef() *corev1.SecretReference
+}
+
+// BackendSecretRefFrom returns the secret reference of the provider if it references a secret
+// and the given default reference otherwise.
+func BackendSecretRefFrom(i interface{}, defaultRef *corev1.SecretReference) *corev1.SecretReference {
+	if s, ok := i.(ResolvedBackendSecretRef); ok {
+		if ref := s.BackendSecretRef(); ref != nil {
+			return ref
+		}
+	}
+	return defaultRef
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider
+
+import (
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"net"
+	"net/url"
+)
+
+// omittedValue replaces the value of invalid backend configurations in errors as they might contain credentials
+const omittedValue = "<omitted>"
+
+// InvalidBackendConfig returns an error for an invalid backend configuration that omits the configuration
+func InvalidBackendConfig(fldPath *field.Path, err error) *field.Error {
+	return field.Invalid(fldPath, omittedValue, err.Error())
+}
+
+// ValidateURL validates that the url is defined, absolute and uses one of the given schemes
+func ValidateURL(rawURL string, fldPath *field.Path, schemes ...string) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if rawURL == "" {
+		return append(allErrs, field.Required(fldPath, "An url has to be defined"))
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return append(allErrs, field.Invalid(fldPath, rawURL, err.Error()))
+	}
+	if !sets.NewString(schemes...).Has(u.Scheme) {
+		return append(allErrs, field.NotSupported(fldPath.Child("scheme"), u.Scheme, schemes))
+	}
+	if u.Host == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath, rawURL, "The url has to be absolute"))
+	}
+	return allErrs
+}
+
+// ValidateAddress validates that the address is defined and consists of a host and a port
+func ValidateAddress(address string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if address == "" {
+		return append(allErrs, field.Required(fldPath, "An address has to be defined"))
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath, address, err.Error()))
+	}
+	return allErrs
+}
+
+// ValidateBackendConfigInjection validates the settings of the backend configuration that are not covered by field validations
+// by injecting it into a new instance of the provider.
+func ValidateBackendConfigInjection(p Interface, rawConfig []byte, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	instance, err := p.New()
+	if err != nil {
+		return append(allErrs, field.InternalError(fldPath, err))
+	}
+	if _, err := BackendConfigInto(rawConfig, instance); err != nil {
+		allErrs = append(allErrs, InvalidBackendConfig(fldPath, err))
+	}
+	return allErrs
+}
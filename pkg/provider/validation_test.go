@@ -0,0 +1,129 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package provider_test
+
+import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("Validation", func() {
+	fldPath := field.NewPath("backendProviderConfig")
+
+	It("should validate urls", func() {
+		Expect(provider.ValidateURL("https://siem:8443/audit", fldPath, "http", "https")).To(BeEmpty())
+
+		errs := provider.ValidateURL("", fldPath, "https")
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+
+		errs = provider.ValidateURL("siem:8443", fldPath, "http", "https")
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.scheme"))
+
+		errs = provider.ValidateURL("https:///audit", fldPath, "https")
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+	})
+
+	It("should validate addresses", func() {
+		Expect(provider.ValidateAddress("fluentd:24224", fldPath)).To(BeEmpty())
+
+		errs := provider.ValidateAddress("", fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+
+		errs = provider.ValidateAddress("fluentd", fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+	})
+
+	Context("backend configurations", func() {
+		secretRef := &corev1.SecretReference{Name: "credentials"}
+
+		for _, c := range []struct {
+			description string
+			provider    string
+			config      string
+			secretRef   *corev1.SecretReference
+			errs        field.ErrorList
+		}{
+			{description: "should accept a valid configuration", provider: "file", config: `{"path":"/var/log/auditlog/audit.log"}`},
+			{description: "should accept a valid configuration", provider: "forward", config: `{"address":"fluentd:24224"}`},
+			{description: "should accept a valid configuration", provider: "kafka", config: `{"brokers":["kafka-0:9092","kafka-1:9092"]}`},
+			{description: "should accept a valid configuration", provider: "loki", config: `{"endpoint":"https://loki:3100","username":"admin","password":"secret"}`},
+			{description: "should accept a valid configuration", provider: "otlp", config: `{"endpoint":"https://otel-collector:4318"}`},
+			{description: "should accept a valid configuration", provider: "s3", config: `{"bucket":"auditlog","accessKeyID":"access","secretAccessKey":"secret"}`},
+			{description: "should accept a valid configuration", provider: "splunk", config: `{"endpoint":"https://splunk:8088","token":"token"}`},
+			{description: "should accept a valid configuration", provider: "syslog", config: `{"address":"syslog:6514","network":"tls"}`},
+			{description: "should accept a valid configuration", provider: "webhook", config: `{"endpoint":"https://siem:8443/audit","bearerToken":"token"}`},
+
+			{description: "should require the address", provider: "file", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("path"), "")}},
+			{description: "should require the address", provider: "forward", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("address"), "")}},
+			{description: "should require the address", provider: "kafka", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("brokers"), "")}},
+			{description: "should require the address", provider: "otlp", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("endpoint"), "")}},
+			{description: "should require the address", provider: "s3", config: `{}`, secretRef: secretRef, errs: field.ErrorList{field.Required(fldPath.Child("bucket"), "")}},
+			{description: "should require the address", provider: "splunk", config: `{"token":"token"}`, errs: field.ErrorList{field.Required(fldPath.Child("endpoint"), "")}},
+			{description: "should require the address", provider: "syslog", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("address"), "")}},
+			{description: "should require the address", provider: "webhook", config: `{}`, errs: field.ErrorList{field.Required(fldPath.Child("endpoint"), "")}},
+
+			{description: "should reject addresses without a port", provider: "forward", config: `{"address":"fluentd"}`, errs: field.ErrorList{field.Invalid(fldPath.Child("address"), nil, "")}},
+			{description: "should reject addresses without a port", provider: "kafka", config: `{"brokers":["kafka-0:9092","kafka-1"]}`, errs: field.ErrorList{field.Invalid(fldPath.Child("brokers").Index(1), nil, "")}},
+			{description: "should reject addresses without a port", provider: "syslog", config: `{"address":"syslog"}`, errs: field.ErrorList{field.Invalid(fldPath.Child("address"), nil, "")}},
+
+			{description: "should reject endpoints without a http or https scheme", provider: "loki", config: `{"endpoint":"loki:3100"}`, errs: field.ErrorList{field.NotSupported(fldPath.Child("endpoint", "scheme"), nil, nil)}},
+			{description: "should reject endpoints without a http or https scheme", provider: "otlp", config: `{"endpoint":"otel-collector:4317"}`, errs: field.ErrorList{field.NotSupported(fldPath.Child("endpoint", "scheme"), nil, nil)}},
+			{description: "should reject endpoints without a http or https scheme", provider: "s3", config: `{"bucket":"auditlog","endpoint":"minio:9000"}`, secretRef: secretRef, errs: field.ErrorList{field.NotSupported(fldPath.Child("endpoint", "scheme"), nil, nil)}},
+			{description: "should reject endpoints without a http or https scheme", provider: "splunk", config: `{"endpoint":"splunk:8088","token":"token"}`, errs: field.ErrorList{field.NotSupported(fldPath.Child("endpoint", "scheme"), nil, nil)}},
+
+			{description: "should reject settings that cannot be injected", provider: "file", config: `{"path":"/var/log/auditlog/audit.log","maxBackups":-1}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "forward", config: `{"address":"fluentd:24224","compression":"zstd"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "kafka", config: `{"brokers":["kafka:9092"],"compression":"zstd"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "loki", config: `{"encoding":"xml"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "otlp", config: `{"endpoint":"https://otel-collector:4318","protocol":"thrift"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "s3", config: `{"bucket":"auditlog","compression":"zstd"}`, secretRef: secretRef, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "syslog", config: `{"address":"syslog:514","network":"http"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+			{description: "should reject settings that cannot be injected", provider: "webhook", config: `{"kubeconfig":"invalid"}`, errs: field.ErrorList{field.Invalid(fldPath, nil, "")}},
+		} {
+			c := c
+			It(c.description+" of the "+c.provider+" provider", func() {
+				p, err := providers.ProviderFactory.Get(c.provider)
+				Expect(err).ToNot(HaveOccurred())
+
+				errs := p.ValidateBackendConfig([]byte(c.config), c.secretRef, fldPath)
+				Expect(errs).To(HaveLen(len(c.errs)))
+				for i := range c.errs {
+					Expect(errs[i].Type).To(Equal(c.errs[i].Type))
+					Expect(errs[i].Field).To(Equal(c.errs[i].Field))
+				}
+			})
+		}
+
+		It("should omit the configuration in the errors of settings that cannot be injected", func() {
+			p, err := providers.ProviderFactory.Get("webhook")
+			Expect(err).ToNot(HaveOccurred())
+
+			errs := provider.ValidateBackendConfigInjection(p, []byte(`{"endpoint":"https://siem:8443","bearerToken":"token","timeout":"invalid"}`), fldPath)
+			Expect(errs).To(HaveLen(1))
+			Expect(errs[0].BadValue).To(Equal("<omitted>"))
+			Expect(errs[0].Detail).ToNot(ContainSubstring("token"))
+		})
+	})
+})
@@ -16,9 +16,7 @@ package elasticsearch
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/service"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/imagevector"
 	"github.com/gardener/gardener-extensions/pkg/controller"
 	v1beta1constants "github.com/gardener/gardener/pkg/apis/core/v1beta1/constants"
@@ -30,44 +28,64 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/yaml"
 	"strings"
 	"time"
 )
 
 // Reconcile reconciles the auditlog extension for the elastic search provider
-// Default
+// The logging elastic search of the seed is used if no endpoint is configured.
 func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
-	auditConfig := &service.Configuration{}
-	if _, _, err := p.decoder.Decode(ex.Spec.ProviderConfig.Raw, nil, auditConfig); err != nil {
-		return fmt.Errorf("failed to decode provider providerConfig: %+v", err)
-	}
-	providerConfig := &Configuration{}
-	if err := yaml.Unmarshal(auditConfig.BackendProviderConfig, providerConfig); err != nil {
-		return err
+	if p.config == nil {
+		return errors.New("configuration is not defined")
 	}
 
 	// default index to auditlog
-	if providerConfig.Index == "" {
-		providerConfig.Index = "auditlog"
+	if p.config.Index == "" {
+		p.config.Index = "auditlog"
 	}
+	p.resolveShoot(ex.GetNamespace())
 
-	if providerConfig.Endpoint != "" {
-		return marshalExtension(ex, auditConfig, providerConfig)
+	// discover the elasticsearch of the seed if no endpoint is configured
+	discover := p.config.Endpoint == ""
+	if discover {
+		if err := p.ensureAuditlogConfig(ctx, ex, p.config); err != nil {
+			return err
+		}
 	}
-
-	if err := p.ensureAuditlogConfig(ctx, ex, auditConfig, providerConfig); err != nil {
+	if err := p.resolveSecretRef(ctx, ex.GetNamespace()); err != nil {
 		return err
 	}
-	return p.ensureGrafanaDashboard(ctx, ex, providerConfig)
+	if discover {
+		if err := p.ensureGrafanaDashboard(ctx, ex, p.config); err != nil {
+			return err
+		}
+	}
+	if err := p.ensureLifecyclePolicy(); err != nil {
+		return err
+	}
+	if err := p.ensureIndexTemplate(); err != nil {
+		return err
+	}
+	return p.ensureWriteAlias()
 }
 
-// Delete removes the possibly deployed managed resource
+// Delete removes the possibly deployed managed resource and the indices of the shoot if configured.
+// The indices of the elasticsearch of the seed are deleted together with the shoot namespace.
 func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config != nil && p.config.Endpoint != "" && p.config.Lifecycle != nil && p.config.Lifecycle.CleanupOnDelete {
+		p.resolveShoot(ex.GetNamespace())
+		if err := p.resolveSecretRef(ctx, ex.GetNamespace()); err != nil {
+			return err
+		}
+		if err := p.cleanup(); err != nil {
+			return err
+		}
+	}
+
 	secret := &corev1.Secret{}
 	secret.Name = GrafanaSecretName
 	secret.Namespace = ex.GetNamespace()
-	if err := p.k8sClient.Delete(ctx, secret); err != nil {
+	if err := p.k8sClient.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
 		return err
 	}
 
@@ -83,7 +101,7 @@ func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension)
 	return controller.WaitUntilManagedResourceDeleted(timeoutCtx, p.k8sClient, ex.GetNamespace(), GrafanaDeploymentName)
 }
 
-func (p *Provider) ensureAuditlogConfig(ctx context.Context, ex *extensionsv1alpha1.Extension, auditConfig *service.Configuration, providerConfig *Configuration) error {
+func (p *Provider) ensureAuditlogConfig(ctx context.Context, ex *extensionsv1alpha1.Extension, providerConfig *Configuration) error {
 	// try to use existing elasticsearch logging
 	esService := &corev1.Service{}
 	if err := p.k8sClient.Get(ctx, client.ObjectKey{Name: v1beta1constants.StatefulSetNameElasticSearch, Namespace: ex.GetNamespace()}, esService); err != nil {
@@ -96,14 +114,11 @@ func (p *Provider) ensureAuditlogConfig(ctx context.Context, ex *extensionsv1alp
 	}
 	providerConfig.Endpoint = fmt.Sprintf("http://%s.%s:%d", esService.GetName(), esService.GetNamespace(), port)
 
-	esSecret := &corev1.Secret{}
-	if err := p.k8sClient.Get(ctx, client.ObjectKey{Name: "logging-ingress-credentials", Namespace: ex.GetNamespace()}, esSecret); err != nil {
-		return errors.Wrapf(err, "unable to find elastic search secret")
+	// the credentials are referenced instead of copied so that they are not part of the configuration
+	if providerConfig.SecretRef == nil && !p.hasSecret {
+		providerConfig.SecretRef = &corev1.SecretReference{Name: LoggingCredentialsSecretName}
 	}
-	providerConfig.Username = string(esSecret.Data["username"])
-	providerConfig.Password = string(esSecret.Data["password"])
-
-	return marshalExtension(ex, auditConfig, providerConfig)
+	return nil
 }
 
 func (p *Provider) ensureGrafanaDashboard(ctx context.Context, ex *extensionsv1alpha1.Extension, providerConfig *Configuration) error {
@@ -132,6 +147,35 @@ func (p *Provider) ensureGrafanaDashboard(ctx context.Context, ex *extensionsv1a
 		}
 	}
 
+	// grafana reads the credentials of the secret of the shoot namespace from its environment
+	datasource := map[string]interface{}{
+		"name":      "Logging",
+		"type":      "elasticsearch",
+		"url":       providerConfig.Endpoint,
+		"access":    "proxy",
+		"isDefault": true,
+		"database":  p.indexPattern(),
+	}
+	credentials := map[string]interface{}{}
+	if ref := providerConfig.SecretRef; ref != nil {
+		credentials["secretName"] = ref.Name
+		datasource["basicAuth"] = true
+		datasource["basicAuthUser"] = "$ES_USERNAME"
+		datasource["basicAuthPassword"] = "$ES_PASSWORD"
+	}
+
+	// the logging elasticsearch of the seed might not be ready yet, it is a 6.x cluster so far
+	esVersion := 60
+	if err := p.ensureVersion(); err != nil {
+		p.log.Error(err, "Unable to determine the version of the elasticsearch for the grafana datasource", "namespace", ex.GetNamespace())
+	} else {
+		esVersion = p.version.grafanaVersion()
+	}
+	datasource["jsonData"] = map[string]interface{}{
+		"esVersion": esVersion,
+		"timeField": "RequestReceivedTimestamp",
+	}
+
 	values := map[string]interface{}{
 		"replicaCount": 1,
 		"admin": map[string]string{
@@ -145,24 +189,11 @@ func (p *Provider) ensureGrafanaDashboard(ctx context.Context, ex *extensionsv1a
 				},
 			},
 		},
+		"datasourceCredentials": credentials,
 		"datasources": map[string]interface{}{
 			"datasources.yaml": map[string]interface{}{
-				"apiVersion": 1,
-				"datasources": []map[string]interface{}{{
-					"name":              "Logging",
-					"type":              "elasticsearch",
-					"url":               providerConfig.Endpoint,
-					"basicAuth":         true,
-					"basicAuthUser":     providerConfig.Username,
-					"basicAuthPassword": providerConfig.Password,
-					"access":            "proxy",
-					"isDefault":         true,
-					"database":          providerConfig.Index,
-					"jsonData": map[string]interface{}{
-						"esVersion": 6,
-						"timeField": "RequestReceivedTimestamp",
-					},
-				}},
+				"apiVersion":  1,
+				"datasources": []map[string]interface{}{datasource},
 			},
 		},
 	}
@@ -195,17 +226,3 @@ func (p *Provider) ComputeIngressHost(prefix string, cluster *controller.Cluster
 	shortID := strings.Replace(cluster.Shoot.Status.TechnicalID, shoot.TechnicalIDPrefix, "", 1)
 	return fmt.Sprintf("%s-%s.%s", prefix, shortID, cluster.Seed.Spec.DNS.IngressDomain)
 }
-
-func marshalExtension(ex *extensionsv1alpha1.Extension, auditConfig *service.Configuration, providerConfig *Configuration) error {
-	providerData, err := json.Marshal(providerConfig)
-	if err != nil {
-		return errors.Wrap(err, "unable to marshal auditlog provider config")
-	}
-	auditConfig.BackendProviderConfig = json.RawMessage(providerData)
-	auditlogData, err := json.Marshal(auditConfig)
-	if err != nil {
-		return errors.Wrap(err, "unable to marshal auditlog config")
-	}
-	ex.Spec.ProviderConfig.Raw = auditlogData
-	return nil
-}
@@ -0,0 +1,252 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"time"
+)
+
+const (
+	defaultTimeout               = 30 * time.Second
+	defaultMaxIdleConnections    = 10
+	defaultIdleConnectionTimeout = 90 * time.Second
+)
+
+// Keys of the credentials in the secret that is referenced by the configuration
+const (
+	SecretKeyUsername    = "username"
+	SecretKeyPassword    = "password"
+	SecretKeyAPIKey      = "apiKey"
+	SecretKeyBearerToken = "bearerToken"
+	SecretKeyCA          = "ca.crt"
+	SecretKeyCert        = "tls.crt"
+	SecretKeyKey         = "tls.key"
+)
+
+// TLSConfiguration contains the PEM encoded certificates of the tls connection to elasticsearch
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificate of elasticsearch
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// ServerName overrides the name that is used to verify the certificate of elasticsearch
+	ServerName string `json:"serverName,omitempty"`
+	// InsecureSkipVerify disables the verification of the certificate of elasticsearch and has to be set explicitly
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+// PoolConfiguration configures the connection pool of the client
+type PoolConfiguration struct {
+	// MaxIdleConnections is the maximum number of idle connections that are kept open, defaults to 10
+	MaxIdleConnections int `json:"maxIdleConnections,omitempty"`
+	// MaxConnections limits the number of connections to elasticsearch, unlimited by default
+	MaxConnections int `json:"maxConnections,omitempty"`
+	// IdleConnectionTimeout is the time after which idle connections are closed, defaults to 90s
+	IdleConnectionTimeout *metav1.Duration `json:"idleConnectionTimeout,omitempty"`
+}
+
+// validateConnection validates and defaults the connection configuration
+func validateConnection(config *Configuration) error {
+	auth := 0
+	for _, credential := range []string{config.Username, config.APIKey, config.BearerToken} {
+		if credential != "" {
+			auth++
+		}
+	}
+	if auth > 1 {
+		return errors.New("only one of username, apiKey or bearerToken can be defined")
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+	if config.Pool == nil {
+		config.Pool = &PoolConfiguration{}
+	}
+	if config.Pool.MaxIdleConnections == 0 {
+		config.Pool.MaxIdleConnections = defaultMaxIdleConnections
+	}
+	if config.Pool.IdleConnectionTimeout == nil {
+		config.Pool.IdleConnectionTimeout = &metav1.Duration{Duration: defaultIdleConnectionTimeout}
+	}
+	if config.Timeout.Duration < 0 || config.Pool.MaxIdleConnections < 0 || config.Pool.MaxConnections < 0 {
+		return errors.New("timeout and pool settings must not be negative")
+	}
+	return nil
+}
+
+// newHTTPClient creates the client that connects to elasticsearch
+func newHTTPClient(config *Configuration) (*http.Client, error) {
+	tlsConfig, err := tlsConfigFor(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:     tlsConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConns:        config.Pool.MaxIdleConnections,
+		MaxIdleConnsPerHost: config.Pool.MaxIdleConnections,
+		MaxConnsPerHost:     config.Pool.MaxConnections,
+		IdleConnTimeout:     config.Pool.IdleConnectionTimeout.Duration,
+	}
+	return &http.Client{Transport: transport, Timeout: config.Timeout.Duration}, nil
+}
+
+func tlsConfigFor(config *TLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config == nil {
+		return tlsConfig, nil
+	}
+	tlsConfig.ServerName, tlsConfig.InsecureSkipVerify = config.ServerName, config.InsecureSkipVerify
+	if config.CA != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, errors.New("unable to parse CA bundle")
+		}
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(config.Cert), []byte(config.Key))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// connection is the client and the effective configuration with the credentials that are used to connect to elasticsearch.
+// The credentials of secrets are only part of the connection and never of the configuration of the provider.
+type connection struct {
+	client *http.Client
+	config *Configuration
+}
+
+// newConnection creates a connection with the credentials of the configuration that are overwritten by the given secret data
+func newConnection(config *Configuration, data map[string][]byte) (*connection, error) {
+	effective := *config
+	if config.TLS != nil {
+		tlsConfig := *config.TLS
+		effective.TLS = &tlsConfig
+	}
+	if err := applyCredentials(&effective, data); err != nil {
+		return nil, err
+	}
+	httpClient, err := newHTTPClient(&effective)
+	if err != nil {
+		return nil, err
+	}
+	return &connection{client: httpClient, config: &effective}, nil
+}
+
+// authorize adds the credentials of the connection to the request
+func (c *connection) authorize(req *http.Request) {
+	switch {
+	case c.config.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.config.APIKey)
+	case c.config.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.config.BearerToken)
+	case c.config.Username != "":
+		req.SetBasicAuth(c.config.Username, c.config.Password)
+	}
+}
+
+// InjectBackendSecret overwrites the credentials and certificates of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes, requests that are in flight finish with the previous credentials.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	conn, err := newConnection(p.config, data)
+	if err != nil {
+		return err
+	}
+	p.connMux.Lock()
+	defer p.connMux.Unlock()
+	p.conn = conn
+	p.hasSecret = true
+	return nil
+}
+
+// BackendSecretRef returns the referenced secret with the credentials.
+// The extension controller mounts it into the proxy instead of copying the credentials into the configuration.
+func (p *Provider) BackendSecretRef() *corev1.SecretReference {
+	if p.config == nil {
+		return nil
+	}
+	return p.config.SecretRef
+}
+
+// connection returns the current connection to elasticsearch
+func (p *Provider) connection() *connection {
+	p.connMux.RLock()
+	defer p.connMux.RUnlock()
+	return p.conn
+}
+
+// resolveSecretRef injects the credentials of the referenced secret of the given namespace of the shoot.
+// Secrets of other namespaces of the seed are never read, their credentials would be sent to an endpoint of the shoot owner.
+func (p *Provider) resolveSecretRef(ctx context.Context, namespace string) error {
+	ref := p.config.SecretRef
+	if ref == nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	if err := p.k8sClient.Get(ctx, client.ObjectKey{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+		return errors.Wrapf(err, "unable to get the credentials secret %s/%s", namespace, ref.Name)
+	}
+	return p.InjectBackendSecret(secret.Data)
+}
+
+// applyCredentials overwrites the credentials of the configuration with the credentials of the secret data
+func applyCredentials(config *Configuration, data map[string][]byte) error {
+	for key, field := range map[string]*string{
+		SecretKeyUsername:    &config.Username,
+		SecretKeyPassword:    &config.Password,
+		SecretKeyAPIKey:      &config.APIKey,
+		SecretKeyBearerToken: &config.BearerToken,
+	} {
+		if value, ok := data[key]; ok {
+			*field = string(value)
+		}
+	}
+	ca, cert, key := data[SecretKeyCA], data[SecretKeyCert], data[SecretKeyKey]
+	if len(ca) > 0 || len(cert) > 0 || len(key) > 0 {
+		if config.TLS == nil {
+			config.TLS = &TLSConfiguration{}
+		}
+		if len(ca) > 0 {
+			config.TLS.CA = string(ca)
+		}
+		if len(cert) > 0 {
+			config.TLS.Cert, config.TLS.Key = string(cert), string(key)
+		}
+	}
+	return validateConnection(config)
+}
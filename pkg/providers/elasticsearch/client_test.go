@@ -0,0 +1,161 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Client", func() {
+	var p *Provider
+
+	BeforeEach(func() {
+		p = &Provider{log: log.NullLogger{}}
+	})
+
+	It("should reject multiple credentials", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"apiKey":"a2V5","bearerToken":"token"}`))).ToNot(Succeed())
+		Expect(p.InjectBackendConfig([]byte(`{"username":"admin","apiKey":"a2V5"}`))).ToNot(Succeed())
+	})
+
+	It("should default the timeout and the connection pool", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"pool":{"maxConnections":5}}`))).To(Succeed())
+		Expect(p.config.Timeout.Duration).To(Equal(defaultTimeout))
+		Expect(p.config.Pool.MaxIdleConnections).To(Equal(defaultMaxIdleConnections))
+		Expect(p.config.Pool.IdleConnectionTimeout.Duration).To(Equal(defaultIdleConnectionTimeout))
+		Expect(p.conn.client.Timeout).To(Equal(defaultTimeout))
+		Expect(p.conn.client.Transport.(*http.Transport).MaxConnsPerHost).To(Equal(5))
+	})
+
+	It("should send the configured credentials", func() {
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		for config, expected := range map[string]string{
+			`"apiKey":"aWQ6a2V5"`:                    "ApiKey aWQ6a2V5",
+			`"bearerToken":"token"`:                  "Bearer token",
+			`"username":"admin","password":"secret"`: "Basic YWRtaW46c2VjcmV0",
+			`"index":"auditlog"`:                     "",
+		} {
+			Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `",` + config + `}`))).To(Succeed())
+			_, err := p.request(http.MethodGet, "/", nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(authorization).To(Equal(expected), config)
+		}
+	})
+
+	It("should verify the certificate of elasticsearch with the configured CA", func() {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `"}`))).To(Succeed())
+		_, err := p.request(http.MethodGet, "/", nil)
+		Expect(err).To(HaveOccurred())
+
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `","tls":{"insecureSkipVerify":true}}`))).To(Succeed())
+		_, err = p.request(http.MethodGet, "/", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `"}`))).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyCA: ca})).To(Succeed())
+		_, err = p.request(http.MethodGet, "/", nil)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should reject invalid certificates", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"tls":{"ca":"invalid"}}`))).ToNot(Succeed())
+		Expect(p.InjectBackendConfig([]byte(`{"tls":{"cert":"invalid","key":"invalid"}}`))).ToNot(Succeed())
+	})
+
+	It("should return transient errors if a request times out", func() {
+		done := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-done
+		}))
+		defer server.Close()
+		defer close(done)
+
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `","timeout":"50ms"}`))).To(Succeed())
+		start := time.Now()
+		_, err := p.request(http.MethodGet, "/", nil)
+		Expect(err).To(HaveOccurred())
+		Expect(provider.IsTransient(err)).To(BeTrue())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+	})
+
+	It("should overwrite the inline credentials with the credentials of the secret", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"username":"inline","password":"inline","secretRef":{"name":"es-credentials"}}`))).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{
+			SecretKeyUsername: []byte("admin"),
+			SecretKeyPassword: []byte("secret"),
+			SecretKeyCA:       []byte("invalid"),
+		})).ToNot(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{
+			SecretKeyUsername: []byte("admin"),
+			SecretKeyPassword: []byte("secret"),
+		})).To(Succeed())
+		Expect(p.conn.config.Username).To(Equal("admin"))
+		Expect(p.conn.config.Password).To(Equal("secret"))
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyAPIKey: []byte("aWQ6a2V5")})).ToNot(Succeed())
+
+		config := &Configuration{}
+		Expect(applyCredentials(config, map[string][]byte{SecretKeyCert: []byte("cert"), SecretKeyKey: []byte("key")})).To(Succeed())
+		Expect(config.TLS).To(Equal(&TLSConfiguration{Cert: "cert", Key: "key"}))
+	})
+
+	It("should keep the credentials of the secret out of the configuration", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"http://elasticsearch:9200","secretRef":{"name":"es-credentials"}}`))).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("admin"), SecretKeyPassword: []byte("secret")})).To(Succeed())
+
+		config, err := p.BackendConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(config)).ToNot(ContainSubstring("secret\""))
+		Expect(string(config)).ToNot(ContainSubstring("admin"))
+		Expect(p.BackendSecretRef()).To(Equal(&corev1.SecretReference{Name: "es-credentials"}))
+	})
+
+	It("should send the credentials of the reloaded secret", func() {
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authorization = r.Header.Get("Authorization")
+		}))
+		defer server.Close()
+
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + server.URL + `"}`))).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyBearerToken: []byte("first")})).To(Succeed())
+		_, err := p.request(http.MethodGet, "/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(authorization).To(Equal("Bearer first"))
+
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyBearerToken: []byte("second")})).To(Succeed())
+		_, err = p.request(http.MethodGet, "/", nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(authorization).To(Equal("Bearer second"))
+	})
+})
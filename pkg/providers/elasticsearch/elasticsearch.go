@@ -18,7 +18,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"github.com/hashicorp/go-multierror"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
@@ -45,58 +45,118 @@ func (p *Provider) bulk(data []byte) error {
 			return errors.Wrap(err, "unable to unmarshal bulk request items")
 		}
 
-		if len(bulkRes.Items) == 0 {
-			return errors.New("elastic search returned an error")
+		if len(items) == 0 {
+			return provider.NewTransientError(errors.New("elastic search returned an error"))
 		}
-		var allErrors *multierror.Error
-		for _, action := range items {
+		partialErr := &provider.PartialError{}
+		for i, action := range items {
 			for _, item := range action {
 				if item.Status < 200 || item.Status > 299 {
-					allErrors = multierror.Append(allErrors, errors.New(fmt.Sprintf("%#v", item.Error)))
+					var itemErr error = errors.Errorf("document returned status code %d", item.Status)
+					if item.Error != nil {
+						itemErr = item.Error
+					}
+					partialErr.Errors = append(partialErr.Errors, provider.EventError{
+						Index:     i,
+						Err:       itemErr,
+						Transient: isTransientItemError(item),
+					})
 				}
 			}
 		}
-		return allErrors
+		if len(partialErr.Errors) == 0 {
+			return nil
+		}
+		return partialErr
 	}
 
 	return nil
 }
 
+// isTransientItemError returns true if the document of the bulk item might be indexed by a retry
+func isTransientItemError(item BulkResponseItem) bool {
+	if item.Status == http.StatusTooManyRequests || item.Status >= 500 {
+		return true
+	}
+	return item.Error != nil && item.Error.Type == "es_rejected_execution_exception"
+}
+
 func (p *Provider) request(httpMethod, rawPath string, payload io.Reader) ([]byte, error) {
 	esURL, err := p.parseUrl(rawPath)
 	if err != nil {
 		return nil, err
 	}
-	req, err := http.NewRequest(httpMethod, esURL, payload)
+	status, body, err := p.send(httpMethod, esURL, payload)
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(p.config.Username, p.config.Password)
+	if status < 200 || status > 299 {
+		statusErr := errors.Errorf("request %s returned status code %d", esURL, status)
+		if status == http.StatusTooManyRequests || status >= 500 {
+			statusErr = provider.NewTransientError(statusErr)
+		}
+		p.log.V(5).Info(statusErr.Error(), "body", string(body))
+		return nil, statusErr
+	}
+	return body, nil
+}
+
+// send sends a request to elasticsearch and returns the status code and the body of the response
+func (p *Provider) send(httpMethod, esURL string, payload io.Reader) (int, []byte, error) {
+	req, err := http.NewRequest(httpMethod, esURL, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	conn := p.connection()
+	conn.authorize(req)
 	req.Header.Add("Content-Type", "application/x-ndjson")
 	req.Header.Add("Accept", "application/json")
 
-	res, err := p.client.Do(req)
+	res, err := conn.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to do request to %s", esURL)
+		return 0, nil, provider.NewTransientError(errors.Wrapf(err, "unable to do request to %s", esURL))
 	}
 	defer res.Body.Close()
-	if res.StatusCode < 200 || res.StatusCode > 299 {
-		statusErr := errors.Errorf("request %s returned status code %d", esURL, res.StatusCode)
-		// also try to log the body is possible
-		body, err := ioutil.ReadAll(res.Body)
-		if err != nil {
-			p.log.Error(err, "unable to read response body")
-			return nil, statusErr
-		}
-		p.log.V(5).Info(statusErr.Error(), "body", string(body))
-		return nil, statusErr
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return res.StatusCode, nil, errors.Wrap(err, "unable to read response body")
 	}
+	return res.StatusCode, body, nil
+}
 
-	body, err := ioutil.ReadAll(res.Body)
+// exists returns true if the resource of the path exists, e.g. an index or an alias
+func (p *Provider) exists(rawPath string) (bool, error) {
+	esURL, err := p.parseUrl(rawPath)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to read response body")
+		return false, err
 	}
-	return body, err
+	status, _, err := p.send(http.MethodHead, esURL, nil)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case status == http.StatusNotFound:
+		return false, nil
+	case status < 200 || status > 299:
+		return false, errors.Errorf("request %s returned status code %d", esURL, status)
+	}
+	return true, nil
+}
+
+// deleteIgnoreNotFound deletes the resource of the path, e.g. an index template, if it exists
+func (p *Provider) deleteIgnoreNotFound(rawPath string) error {
+	esURL, err := p.parseUrl(rawPath)
+	if err != nil {
+		return err
+	}
+	status, _, err := p.send(http.MethodDelete, esURL, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusNotFound && (status < 200 || status > 299) {
+		return errors.Errorf("request %s returned status code %d", esURL, status)
+	}
+	return nil
 }
 
 func (p *Provider) parseUrl(rawPath string) (string, error) {
@@ -104,7 +164,12 @@ func (p *Provider) parseUrl(rawPath string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	u.Path = path.Join(u.Path, rawPath)
+	ref, err := url.Parse(rawPath)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, ref.Path)
+	u.RawQuery = ref.RawQuery
 	return u.String(), nil
 }
 
@@ -117,9 +182,19 @@ type BulkResponse struct {
 
 // BulkResponseItem is response of one document from a bulk request
 type BulkResponseItem struct {
-	Index  string      `json:"_index"`
-	Type   string      `json:"_type"`
-	ID     string      `json:"_id"`
-	Status int         `json:"status"`
-	Error  interface{} `json:"error"`
+	Index  string     `json:"_index"`
+	Type   string     `json:"_type"`
+	ID     string     `json:"_id"`
+	Status int        `json:"status"`
+	Error  *BulkError `json:"error"`
+}
+
+// BulkError is the error of a document that could not be indexed
+type BulkError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Reason)
 }
@@ -0,0 +1,132 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// recordedRequest is a request that was received by the fake elasticsearch
+type recordedRequest struct {
+	method string
+	uri    string
+	body   string
+}
+
+// fakeResponse is the response of the fake elasticsearch to a request
+type fakeResponse struct {
+	status int
+	body   string
+}
+
+// fakeElasticsearch records the received requests and answers them with the responses of their method and unescaped uri.
+// Unknown HEAD requests are answered with 404, all other requests are acknowledged.
+type fakeElasticsearch struct {
+	*httptest.Server
+	mux       sync.Mutex
+	requests  []recordedRequest
+	responses map[string]fakeResponse
+}
+
+func newFakeElasticsearch() *fakeElasticsearch {
+	es := &fakeElasticsearch{responses: map[string]fakeResponse{}}
+	es.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer GinkgoRecover()
+		body, err := ioutil.ReadAll(r.Body)
+		Expect(err).ToNot(HaveOccurred())
+		es.mux.Lock()
+		defer es.mux.Unlock()
+		uri := r.URL.Path
+		if r.URL.RawQuery != "" {
+			uri += "?" + r.URL.RawQuery
+		}
+		es.requests = append(es.requests, recordedRequest{method: r.Method, uri: uri, body: string(body)})
+
+		res, ok := es.responses[r.Method+" "+uri]
+		switch {
+		case ok:
+		case r.Method == http.MethodHead:
+			res = fakeResponse{status: http.StatusNotFound}
+		case r.URL.Path == "/_bulk":
+			res = fakeResponse{status: http.StatusOK, body: `{"took":1,"errors":false,"items":[]}`}
+		default:
+			res = fakeResponse{status: http.StatusOK, body: `{"acknowledged":true}`}
+		}
+		w.WriteHeader(res.status)
+		_, _ = w.Write([]byte(res.body))
+	}))
+	return es
+}
+
+// recorded returns the received requests without the bulk requests
+func (es *fakeElasticsearch) recorded() []string {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+	requests := make([]string, 0, len(es.requests))
+	for _, req := range es.requests {
+		if req.uri != "/_bulk" {
+			requests = append(requests, req.method+" "+req.uri)
+		}
+	}
+	return requests
+}
+
+var _ = Describe("Elasticsearch", func() {
+	var (
+		es *fakeElasticsearch
+		p  *Provider
+	)
+
+	BeforeEach(func() {
+		es = newFakeElasticsearch()
+		p = &Provider{log: log.NullLogger{}, conn: &connection{client: http.DefaultClient, config: &Configuration{}}, config: &Configuration{Endpoint: es.URL + "/es"}}
+	})
+
+	AfterEach(func() {
+		es.Close()
+	})
+
+	It("should keep the query of the request path", func() {
+		esURL, err := p.parseUrl("_template/auditlog?include_type_name=true")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(esURL).To(Equal(es.URL + "/es/_template/auditlog?include_type_name=true"))
+	})
+
+	It("should check whether resources exist", func() {
+		es.responses["HEAD /es/auditlog"] = fakeResponse{status: http.StatusOK}
+		es.responses["HEAD /es/broken"] = fakeResponse{status: http.StatusForbidden}
+
+		Expect(p.exists("auditlog")).To(BeTrue())
+		Expect(p.exists("other")).To(BeFalse())
+		_, err := p.exists("broken")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should return transient errors if elasticsearch is overloaded", func() {
+		es.responses["POST /es/_bulk"] = fakeResponse{status: http.StatusTooManyRequests}
+		err := p.bulk([]byte("{}\n"))
+		Expect(err).To(HaveOccurred())
+		Expect(provider.IsTransient(err)).To(BeTrue())
+	})
+})
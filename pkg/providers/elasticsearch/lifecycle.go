@@ -0,0 +1,391 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ShootPlaceholder is replaced with the technical id of the shoot in the index name
+const ShootPlaceholder = "{shoot}"
+
+const (
+	// PolicyTypeILM manages the indices with an index lifecycle management policy of elasticsearch
+	PolicyTypeILM = "ILM"
+	// PolicyTypeISM manages the indices with an index state management policy of opensearch
+	PolicyTypeISM = "ISM"
+)
+
+// LifecycleConfiguration configures the rollover and the retention of the indices
+type LifecycleConfiguration struct {
+	// PolicyType is ILM for elasticsearch or ISM for opensearch, defaults to the policy type of the distribution.
+	PolicyType string `json:"policyType,omitempty"`
+	// Rollover writes the events to a write alias named after the index that is rolled over by the policy.
+	Rollover *RolloverConfiguration `json:"rollover,omitempty"`
+	// Retention is the age after which the indices are deleted by the policy, e.g. 30d.
+	Retention string `json:"retention,omitempty"`
+	// CleanupOnDelete deletes the indices, the index template and the policy of the shoot
+	// when the extension is deleted. The index has to contain the shoot placeholder.
+	CleanupOnDelete bool `json:"cleanupOnDelete,omitempty"`
+}
+
+// RolloverConfiguration are the conditions of which any rolls the write alias over to a new index
+type RolloverConfiguration struct {
+	// MaxAge is the maximum age of the index, e.g. 1d
+	MaxAge string `json:"maxAge,omitempty"`
+	// MaxSize is the maximum primary storage size of the index, e.g. 50gb
+	MaxSize string `json:"maxSize,omitempty"`
+	// MaxDocs is the maximum number of documents of the index
+	MaxDocs int64 `json:"maxDocs,omitempty"`
+}
+
+var (
+	timeUnitRegexp = regexp.MustCompile(`^[0-9]+(d|h|m|s|ms)$`)
+	byteUnitRegexp = regexp.MustCompile(`^[0-9]+(b|kb|mb|gb|tb|pb)$`)
+	datePatterns   = []string{"%Y", "%m", "%d", "%H"}
+)
+
+// validateLifecycle validates and defaults the index lifecycle configuration
+func validateLifecycle(config *Configuration) error {
+	lifecycle := config.Lifecycle
+	if lifecycle == nil {
+		return nil
+	}
+	switch lifecycle.PolicyType {
+	case "", PolicyTypeILM, PolicyTypeISM:
+	default:
+		return errors.Errorf("unknown policy type %q, must be one of %s or %s", lifecycle.PolicyType, PolicyTypeILM, PolicyTypeISM)
+	}
+	if lifecycle.Retention != "" && !timeUnitRegexp.MatchString(lifecycle.Retention) {
+		return errors.Errorf("retention %q is not a time unit like 30d", lifecycle.Retention)
+	}
+	if rollover := lifecycle.Rollover; rollover != nil {
+		if rollover.MaxAge == "" && rollover.MaxSize == "" && rollover.MaxDocs == 0 {
+			return errors.New("rollover requires at least one of maxAge, maxSize or maxDocs")
+		}
+		if rollover.MaxAge != "" && !timeUnitRegexp.MatchString(rollover.MaxAge) {
+			return errors.Errorf("rollover maxAge %q is not a time unit like 1d", rollover.MaxAge)
+		}
+		if rollover.MaxSize != "" && !byteUnitRegexp.MatchString(rollover.MaxSize) {
+			return errors.Errorf("rollover maxSize %q is not a byte size like 50gb", rollover.MaxSize)
+		}
+		if rollover.MaxDocs < 0 {
+			return errors.New("rollover maxDocs must not be negative")
+		}
+		if hasDatePattern(config.Index) {
+			return errors.Errorf("index %q with date patterns cannot be rolled over", config.Index)
+		}
+	}
+	if lifecycle.Retention != "" && lifecycle.Rollover == nil && !hasDatePattern(config.Index) {
+		return errors.Errorf("retention requires rollover or date patterns in the index %q", config.Index)
+	}
+	if lifecycle.CleanupOnDelete && !strings.Contains(config.Index, ShootPlaceholder) {
+		return errors.Errorf("cleanup on delete requires the shoot placeholder %s in the index %q", ShootPlaceholder, config.Index)
+	}
+	return nil
+}
+
+func hasDatePattern(index string) bool {
+	for _, pattern := range datePatterns {
+		if strings.Contains(index, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveShoot replaces the shoot placeholder of the configured index with the technical id of the shoot
+func (p *Provider) resolveShoot(technicalID string) {
+	p.config.Index = strings.Replace(p.config.Index, ShootPlaceholder, technicalID, -1)
+}
+
+// indexName returns the index the event is written to.
+// The date patterns are replaced with the time the request of the event was received.
+func (p *Provider) indexName(event *audit.Event) string {
+	index := p.config.Index
+	if strings.Contains(index, ShootPlaceholder) {
+		technicalID := provider.ShootMetadataFrom(event).TechnicalID
+		if technicalID == "" {
+			technicalID = "unknown"
+		}
+		index = strings.Replace(index, ShootPlaceholder, technicalID, -1)
+	}
+	if !hasDatePattern(index) {
+		return index
+	}
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	ts = ts.UTC()
+	return strings.NewReplacer(
+		"%Y", fmt.Sprintf("%04d", ts.Year()),
+		"%m", fmt.Sprintf("%02d", ts.Month()),
+		"%d", fmt.Sprintf("%02d", ts.Day()),
+		"%H", fmt.Sprintf("%02d", ts.Hour()),
+	).Replace(index)
+}
+
+// indexPattern returns the pattern that matches all indices of the configured index
+func (p *Provider) indexPattern() string {
+	if p.rollover() {
+		return p.config.Index + "-*"
+	}
+	pattern := strings.Replace(p.config.Index, ShootPlaceholder, "*", -1)
+	for _, datePattern := range datePatterns {
+		pattern = strings.Replace(pattern, datePattern, "*", -1)
+	}
+	for strings.Contains(pattern, "**") {
+		pattern = strings.Replace(pattern, "**", "*", -1)
+	}
+	return pattern
+}
+
+// baseName returns the configured index without date patterns.
+// It names the index template and the lifecycle policy.
+func (p *Provider) baseName() string {
+	index := p.config.Index
+	if i := strings.Index(index, "%"); i >= 0 && hasDatePattern(index) {
+		index = index[:i]
+	}
+	return strings.TrimRight(index, "-_.")
+}
+
+// policyType returns the configured policy type or the policy type of the distribution of the cluster
+func (p *Provider) policyType() string {
+	if p.config.Lifecycle != nil && p.config.Lifecycle.PolicyType != "" {
+		return p.config.Lifecycle.PolicyType
+	}
+	if p.version != nil && p.version.distribution == DistributionOpenSearch {
+		return PolicyTypeISM
+	}
+	return PolicyTypeILM
+}
+
+func (p *Provider) rollover() bool {
+	return p.config.Lifecycle != nil && p.config.Lifecycle.Rollover != nil
+}
+
+// lifecycleSettings returns the index settings that attach the indices to the lifecycle policy
+func (p *Provider) lifecycleSettings() map[string]interface{} {
+	lifecycle := p.config.Lifecycle
+	if lifecycle == nil || (lifecycle.Rollover == nil && lifecycle.Retention == "") {
+		return nil
+	}
+	if p.policyType() == PolicyTypeISM {
+		// the ism policy is attached by its ism template
+		if !p.rollover() {
+			return nil
+		}
+		return map[string]interface{}{"plugins.index_state_management.rollover_alias": p.config.Index}
+	}
+	settings := map[string]interface{}{"index.lifecycle.name": p.baseName()}
+	if p.rollover() {
+		settings["index.lifecycle.rollover_alias"] = p.config.Index
+	}
+	return settings
+}
+
+// ensureLifecyclePolicy installs the policy that rolls over and deletes the indices of the configured index
+func (p *Provider) ensureLifecyclePolicy() error {
+	lifecycle := p.config.Lifecycle
+	if lifecycle == nil || (lifecycle.Rollover == nil && lifecycle.Retention == "") {
+		return nil
+	}
+	if err := p.ensureVersion(); err != nil {
+		return err
+	}
+	name := p.baseName()
+	p.log.Info("Ensuring index lifecycle policy", "policy", name, "type", p.policyType())
+	if p.policyType() == PolicyTypeISM {
+		return p.ensureISMPolicy(name)
+	}
+
+	phases := map[string]interface{}{}
+	if rollover := lifecycle.Rollover; rollover != nil {
+		conditions := map[string]interface{}{}
+		if rollover.MaxAge != "" {
+			conditions["max_age"] = rollover.MaxAge
+		}
+		if rollover.MaxSize != "" {
+			conditions["max_size"] = rollover.MaxSize
+		}
+		if rollover.MaxDocs != 0 {
+			conditions["max_docs"] = rollover.MaxDocs
+		}
+		phases["hot"] = map[string]interface{}{
+			"actions": map[string]interface{}{"rollover": conditions},
+		}
+	}
+	if lifecycle.Retention != "" {
+		phases["delete"] = map[string]interface{}{
+			"min_age": lifecycle.Retention,
+			"actions": map[string]interface{}{"delete": map[string]interface{}{}},
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{"policy": map[string]interface{}{"phases": phases}})
+	if err != nil {
+		return err
+	}
+	if _, err := p.request(http.MethodPut, "_ilm/policy/"+name, bytes.NewReader(body)); err != nil {
+		return errors.Wrapf(err, "unable to install lifecycle policy %s", name)
+	}
+	return nil
+}
+
+// ensureISMPolicy installs the index state management policy of opensearch.
+// Existing policies can only be updated with their current sequence number and primary term.
+func (p *Provider) ensureISMPolicy(name string) error {
+	lifecycle := p.config.Lifecycle
+	hot := map[string]interface{}{
+		"name":        "hot",
+		"actions":     []interface{}{},
+		"transitions": []interface{}{},
+	}
+	states := []interface{}{hot}
+	if rollover := lifecycle.Rollover; rollover != nil {
+		conditions := map[string]interface{}{}
+		if rollover.MaxAge != "" {
+			conditions["min_index_age"] = rollover.MaxAge
+		}
+		if rollover.MaxSize != "" {
+			conditions["min_size"] = rollover.MaxSize
+		}
+		if rollover.MaxDocs != 0 {
+			conditions["min_doc_count"] = rollover.MaxDocs
+		}
+		hot["actions"] = []interface{}{map[string]interface{}{"rollover": conditions}}
+	}
+	if lifecycle.Retention != "" {
+		hot["transitions"] = []interface{}{map[string]interface{}{
+			"state_name": "delete",
+			"conditions": map[string]interface{}{"min_index_age": lifecycle.Retention},
+		}}
+		states = append(states, map[string]interface{}{
+			"name":        "delete",
+			"actions":     []interface{}{map[string]interface{}{"delete": map[string]interface{}{}}},
+			"transitions": []interface{}{},
+		})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"policy": map[string]interface{}{
+			"description":   "auditlog lifecycle of " + p.config.Index,
+			"default_state": "hot",
+			"states":        states,
+			"ism_template": []interface{}{map[string]interface{}{
+				"index_patterns": []string{p.indexPattern()},
+				"priority":       100,
+			}},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	policyPath := "_plugins/_ism/policies/" + name
+	esURL, err := p.parseUrl(policyPath)
+	if err != nil {
+		return err
+	}
+	status, existing, err := p.send(http.MethodGet, esURL, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case status == http.StatusNotFound:
+	case status >= 200 && status <= 299:
+		current := &struct {
+			SeqNo       int64 `json:"_seq_no"`
+			PrimaryTerm int64 `json:"_primary_term"`
+		}{}
+		if err := json.Unmarshal(existing, current); err != nil {
+			return errors.Wrapf(err, "unable to decode lifecycle policy %s", name)
+		}
+		policyPath = fmt.Sprintf("%s?if_seq_no=%d&if_primary_term=%d", policyPath, current.SeqNo, current.PrimaryTerm)
+	default:
+		return errors.Errorf("request %s returned status code %d", esURL, status)
+	}
+	if _, err := p.request(http.MethodPut, policyPath, bytes.NewReader(body)); err != nil {
+		return errors.Wrapf(err, "unable to install lifecycle policy %s", name)
+	}
+	return nil
+}
+
+// ensureWriteAlias creates the first index of the write alias if the alias does not exist yet
+func (p *Provider) ensureWriteAlias() error {
+	if !p.rollover() {
+		return nil
+	}
+	alias := p.config.Index
+	exists, err := p.exists("_alias/" + alias)
+	if err != nil || exists {
+		return err
+	}
+	p.log.Info("Creating the first index of the write alias", "alias", alias)
+	body, err := json.Marshal(map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := p.request(http.MethodPut, alias+"-000001", bytes.NewReader(body)); err != nil {
+		return errors.Wrapf(err, "unable to create the write alias %s", alias)
+	}
+	return nil
+}
+
+// cleanup deletes the indices, the index template and the lifecycle policy of the configured index
+func (p *Provider) cleanup() error {
+	if err := p.ensureVersion(); err != nil {
+		return err
+	}
+	pattern := p.indexPattern()
+	p.log.Info("Deleting indices", "indexPattern", pattern)
+
+	body, err := p.request(http.MethodGet, fmt.Sprintf("_cat/indices/%s?format=json&h=index", pattern), nil)
+	if err != nil {
+		return errors.Wrapf(err, "unable to list the indices %s", pattern)
+	}
+	indices := []struct {
+		Index string `json:"index"`
+	}{}
+	if err := json.Unmarshal(body, &indices); err != nil {
+		return errors.Wrapf(err, "unable to decode the indices %s", pattern)
+	}
+	for _, index := range indices {
+		if err := p.deleteIgnoreNotFound(index.Index); err != nil {
+			return err
+		}
+	}
+
+	if err := p.deleteIgnoreNotFound("_template/" + p.baseName()); err != nil {
+		return err
+	}
+	if p.policyType() == PolicyTypeISM {
+		return p.deleteIgnoreNotFound("_plugins/_ism/policies/" + p.baseName())
+	}
+	return p.deleteIgnoreNotFound("_ilm/policy/" + p.baseName())
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Lifecycle", func() {
+	var (
+		es *fakeElasticsearch
+		p  *Provider
+	)
+
+	BeforeEach(func() {
+		es = newFakeElasticsearch()
+		p = &Provider{log: log.NullLogger{}, conn: &connection{client: http.DefaultClient, config: &Configuration{}}}
+	})
+
+	AfterEach(func() {
+		es.Close()
+	})
+
+	inject := func(config string) {
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + es.URL + `","version":"7.10.2",` + config + `}`))).To(Succeed())
+	}
+
+	// body returns the body of the recorded request
+	body := func(request string) string {
+		for _, req := range es.requests {
+			if req.method+" "+req.uri == request {
+				return req.body
+			}
+		}
+		Fail("request " + request + " was not recorded")
+		return ""
+	}
+
+	It("should validate the lifecycle configuration", func() {
+		for config, valid := range map[string]bool{
+			`{"index":"auditlog-%Y.%m.%d","lifecycle":{"retention":"30d"}}`:                                        true,
+			`{"index":"auditlog","lifecycle":{"policyType":"ISM","rollover":{"maxSize":"50gb"},"retention":"7d"}}`: true,
+			`{"index":"auditlog-%Y","lifecycle":{"policyType":"Curator"}}`:                                         false,
+			`{"index":"auditlog-%Y","lifecycle":{"retention":"30 days"}}`:                                          false,
+			`{"index":"auditlog","lifecycle":{"rollover":{}}}`:                                                     false,
+			`{"index":"auditlog","lifecycle":{"rollover":{"maxSize":"50G"}}}`:                                      false,
+			`{"index":"auditlog-%Y","lifecycle":{"rollover":{"maxAge":"1d"}}}`:                                     false,
+			`{"index":"auditlog","lifecycle":{"retention":"30d"}}`:                                                 false,
+			`{"index":"auditlog-%Y","lifecycle":{"cleanupOnDelete":true}}`:                                         false,
+		} {
+			err := p.InjectBackendConfig([]byte(config))
+			if valid {
+				Expect(err).ToNot(HaveOccurred(), config)
+			} else {
+				Expect(err).To(HaveOccurred(), config)
+			}
+		}
+	})
+
+	It("should write the events to the index of their shoot and date", func() {
+		inject(`"index":"auditlog-{shoot}-%Y.%m.%d"`)
+		Expect(p.baseName()).To(Equal("auditlog-{shoot}"))
+		Expect(p.indexPattern()).To(Equal("auditlog-*-*.*.*"))
+
+		event := audit.Event{
+			AuditID:                  "1",
+			RequestReceivedTimestamp: metav1.NewMicroTime(time.Date(2020, 3, 4, 23, 30, 0, 0, time.FixedZone("CET", -3600))),
+			Annotations:              map[string]string{provider.AnnotationShootTechnicalID: "shoot--foo--bar"},
+		}
+		Expect(p.indexName(&event)).To(Equal("auditlog-shoot--foo--bar-2020.03.05"))
+		event.Annotations = nil
+		Expect(p.indexName(&event)).To(Equal("auditlog-unknown-2020.03.05"))
+
+		p.resolveShoot("shoot--foo--bar")
+		Expect(p.baseName()).To(Equal("auditlog-shoot--foo--bar"))
+		Expect(p.indexPattern()).To(Equal("auditlog-shoot--foo--bar-*.*.*"))
+
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{event}})).To(Succeed())
+		Expect(body("POST /_bulk")).To(HavePrefix(`{ "index": { "_index": "auditlog-shoot--foo--bar-2020.03.05" } }`))
+	})
+
+	It("should install an ilm policy that deletes dated indices", func() {
+		inject(`"index":"auditlog-shoot--foo--bar-%Y.%m.%d","lifecycle":{"retention":"30d"}`)
+		Expect(p.ensureLifecyclePolicy()).To(Succeed())
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+		Expect(p.ensureWriteAlias()).To(Succeed())
+
+		Expect(es.recorded()).To(Equal([]string{
+			"PUT /_ilm/policy/auditlog-shoot--foo--bar",
+			"PUT /_template/auditlog-shoot--foo--bar",
+		}))
+		Expect(body("PUT /_ilm/policy/auditlog-shoot--foo--bar")).To(MatchJSON(`{"policy":{"phases":{"delete":{"min_age":"30d","actions":{"delete":{}}}}}}`))
+		Expect(body("PUT /_template/auditlog-shoot--foo--bar")).To(MatchJSON(
+			`{"index_patterns":["auditlog-shoot--foo--bar-*.*.*"],"settings":{"index.lifecycle.name":"auditlog-shoot--foo--bar"}}`))
+	})
+
+	It("should roll over the write alias with an ilm policy", func() {
+		inject(`"index":"auditlog-shoot--foo--bar","lifecycle":{"rollover":{"maxAge":"1d","maxSize":"50gb","maxDocs":1000},"retention":"7d"},"objects":{"mode":"String"}`)
+		Expect(p.ensureLifecyclePolicy()).To(Succeed())
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+		Expect(p.ensureWriteAlias()).To(Succeed())
+
+		Expect(es.recorded()).To(Equal([]string{
+			"PUT /_ilm/policy/auditlog-shoot--foo--bar",
+			"PUT /_template/auditlog-shoot--foo--bar",
+			"HEAD /auditlog-shoot--foo--bar-*",
+			"HEAD /_alias/auditlog-shoot--foo--bar",
+			"PUT /auditlog-shoot--foo--bar-000001",
+		}))
+		Expect(body("PUT /_ilm/policy/auditlog-shoot--foo--bar")).To(MatchJSON(
+			`{"policy":{"phases":{"hot":{"actions":{"rollover":{"max_age":"1d","max_size":"50gb","max_docs":1000}}},"delete":{"min_age":"7d","actions":{"delete":{}}}}}}`))
+		Expect(body("PUT /_template/auditlog-shoot--foo--bar")).To(MatchJSON(
+			`{"index_patterns":["auditlog-shoot--foo--bar-*"],` +
+				`"settings":{"index.lifecycle.name":"auditlog-shoot--foo--bar","index.lifecycle.rollover_alias":"auditlog-shoot--foo--bar"},` +
+				`"mappings":{"properties":{"RequestObject":{"type":"text"},"ResponseObject":{"type":"text"}}}}`))
+		Expect(body("PUT /auditlog-shoot--foo--bar-000001")).To(MatchJSON(`{"aliases":{"auditlog-shoot--foo--bar":{"is_write_index":true}}}`))
+
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})).To(Succeed())
+		Expect(body("POST /_bulk")).To(HavePrefix(`{ "index": { "_index": "auditlog-shoot--foo--bar" } }`))
+	})
+
+	It("should not recreate an existing write alias", func() {
+		es.responses["HEAD /_alias/auditlog"] = fakeResponse{status: http.StatusOK}
+		inject(`"index":"auditlog","lifecycle":{"rollover":{"maxDocs":1000}}`)
+		Expect(p.ensureWriteAlias()).To(Succeed())
+		Expect(es.recorded()).To(Equal([]string{"HEAD /_alias/auditlog"}))
+	})
+
+	It("should update an existing ism policy", func() {
+		es.responses["GET /_plugins/_ism/policies/auditlog"] = fakeResponse{status: http.StatusOK, body: `{"_id":"auditlog","_seq_no":7,"_primary_term":2,"policy":{}}`}
+		inject(`"index":"auditlog","lifecycle":{"policyType":"ISM","rollover":{"maxAge":"1d"},"retention":"30d"}`)
+		Expect(p.ensureLifecyclePolicy()).To(Succeed())
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+
+		Expect(es.recorded()).To(Equal([]string{
+			"GET /_plugins/_ism/policies/auditlog",
+			"PUT /_plugins/_ism/policies/auditlog?if_seq_no=7&if_primary_term=2",
+			"PUT /_template/auditlog",
+		}))
+		Expect(body("PUT /_plugins/_ism/policies/auditlog?if_seq_no=7&if_primary_term=2")).To(MatchJSON(`{"policy":{
+			"description":"auditlog lifecycle of auditlog",
+			"default_state":"hot",
+			"states":[
+				{"name":"hot","actions":[{"rollover":{"min_index_age":"1d"}}],"transitions":[{"state_name":"delete","conditions":{"min_index_age":"30d"}}]},
+				{"name":"delete","actions":[{"delete":{}}],"transitions":[]}
+			],
+			"ism_template":[{"index_patterns":["auditlog-*"],"priority":100}]}}`))
+		Expect(body("PUT /_template/auditlog")).To(MatchJSON(
+			`{"index_patterns":["auditlog-*"],"settings":{"plugins.index_state_management.rollover_alias":"auditlog"}}`))
+	})
+
+	It("should delete the indices, the template and the policy of the shoot", func() {
+		es.responses["GET /_cat/indices/auditlog-shoot--foo--bar-*?format=json&h=index"] = fakeResponse{
+			status: http.StatusOK,
+			body:   `[{"index":"auditlog-shoot--foo--bar-000001"},{"index":"auditlog-shoot--foo--bar-000002"}]`,
+		}
+		es.responses["DELETE /_ilm/policy/auditlog-shoot--foo--bar"] = fakeResponse{status: http.StatusNotFound}
+		inject(`"index":"auditlog-{shoot}","lifecycle":{"rollover":{"maxAge":"1d"},"cleanupOnDelete":true}`)
+		p.resolveShoot("shoot--foo--bar")
+		Expect(p.cleanup()).To(Succeed())
+
+		Expect(es.recorded()).To(Equal([]string{
+			"GET /_cat/indices/auditlog-shoot--foo--bar-*?format=json&h=index",
+			"DELETE /auditlog-shoot--foo--bar-000001",
+			"DELETE /auditlog-shoot--foo--bar-000002",
+			"DELETE /_template/auditlog-shoot--foo--bar",
+			"DELETE /_ilm/policy/auditlog-shoot--foo--bar",
+		}))
+		for _, request := range es.recorded() {
+			Expect(strings.Contains(request, "{shoot}")).To(BeFalse())
+		}
+	})
+})
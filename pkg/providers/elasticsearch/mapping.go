@@ -0,0 +1,208 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+)
+
+const (
+	// ObjectsModeDrop omits the request and response objects of the events,
+	// as their dynamic mapping leads to conflicts like
+	// "Existing mapping for [ResponseObject.items.metadata.labels.app] must be of type object but found [text]".
+	ObjectsModeDrop = "Drop"
+	// ObjectsModeFlattened indexes the request and response objects as flattened fields,
+	// which requires elasticsearch 7.3 or newer with the default distribution or opensearch 2.7 or newer.
+	ObjectsModeFlattened = "Flattened"
+	// ObjectsModeString stores the request and response objects as serialized json in text fields
+	ObjectsModeString = "String"
+)
+
+// ObjectsConfiguration configures how the request and response objects of the events are indexed
+type ObjectsConfiguration struct {
+	// Mode is one of Drop, Flattened or String, defaults to Drop.
+	// The provider manages an index template that maps the objects if they are not dropped.
+	Mode string `json:"mode,omitempty"`
+	// Resources limits the indexed objects to the events of the given resources.
+	// The objects of all events are indexed if no resources are defined.
+	Resources []GroupResources `json:"resources,omitempty"`
+}
+
+// GroupResources are the resources of an api group
+type GroupResources struct {
+	// Group is the name of the api group. The empty string represents the core api group.
+	Group string `json:"group,omitempty"`
+	// Resources are the resources of the group. All resources of the group are selected if empty.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// document is the indexed representation of an audit event
+type document struct {
+	audit.Event
+	// Timestamp is required by data streams and set if the documents are created
+	Timestamp *metav1.MicroTime `json:"@timestamp,omitempty"`
+	// Shoot identifies the shoot of the event so that the events of multiple shoots can be queried in a shared index
+	Shoot *provider.ShootMetadata `json:"Shoot,omitempty"`
+	// RequestObject and ResponseObject replace the objects of the event according to the objects mode
+	RequestObject  interface{} `json:"RequestObject,omitempty"`
+	ResponseObject interface{} `json:"ResponseObject,omitempty"`
+}
+
+func (p *Provider) newDocument(event *audit.Event) *document {
+	doc := &document{Event: *event}
+	if p.config.OpType == OpTypeCreate && !event.RequestReceivedTimestamp.IsZero() {
+		doc.Timestamp = &event.RequestReceivedTimestamp
+	}
+	if metadata := provider.ShootMetadataFrom(event); !metadata.IsEmpty() {
+		doc.Shoot = &metadata
+	}
+	if p.indexObjects(event) {
+		doc.RequestObject = p.object(event.RequestObject)
+		doc.ResponseObject = p.object(event.ResponseObject)
+	}
+	return doc
+}
+
+// indexObjects returns true if the request and response objects of the event are indexed
+func (p *Provider) indexObjects(event *audit.Event) bool {
+	objects := p.config.Objects
+	if objects == nil || objects.Mode == ObjectsModeDrop {
+		return false
+	}
+	if len(objects.Resources) == 0 {
+		return true
+	}
+	if event.ObjectRef == nil {
+		return false
+	}
+	for _, gr := range objects.Resources {
+		if gr.Group != event.ObjectRef.APIGroup {
+			continue
+		}
+		if len(gr.Resources) == 0 {
+			return true
+		}
+		for _, resource := range gr.Resources {
+			if resource == event.ObjectRef.Resource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// object returns the indexed value of a request or response object
+func (p *Provider) object(o *runtime.Unknown) interface{} {
+	if o == nil || len(o.Raw) == 0 {
+		return nil
+	}
+	if p.config.Objects.Mode == ObjectsModeString {
+		return string(o.Raw)
+	}
+	// flattened fields can only be indexed from json
+	if (o.ContentType != "" && o.ContentType != runtime.ContentTypeJSON) || !json.Valid(o.Raw) {
+		return nil
+	}
+	return json.RawMessage(o.Raw)
+}
+
+// objectsMapping returns the mapping of the request and response objects or nil if the objects are dropped
+func (p *Provider) objectsMapping() map[string]interface{} {
+	if p.config.Objects == nil {
+		return nil
+	}
+	var mapping map[string]interface{}
+	switch p.config.Objects.Mode {
+	case ObjectsModeFlattened:
+		mapping = map[string]interface{}{"type": "flattened"}
+		if p.version.distribution == DistributionOpenSearch {
+			mapping = map[string]interface{}{"type": "flat_object"}
+		}
+	case ObjectsModeString:
+		mapping = map[string]interface{}{"type": "text"}
+	default:
+		return nil
+	}
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"RequestObject":  mapping,
+			"ResponseObject": mapping,
+		},
+	}
+}
+
+// ensureIndexTemplate installs an index template for the indices of the configured index
+// that maps the request and response objects and attaches the lifecycle policy.
+// The mapping is also added to the existing indices. Nothing is installed if neither is configured.
+func (p *Provider) ensureIndexTemplate() error {
+	if (p.config.Objects == nil || p.config.Objects.Mode == ObjectsModeDrop) && p.lifecycleSettings() == nil {
+		return nil
+	}
+	if err := p.ensureVersion(); err != nil {
+		return err
+	}
+	if p.config.Objects != nil && p.config.Objects.Mode == ObjectsModeFlattened &&
+		!p.version.atLeast(DistributionElasticsearch, 7, 3) && !p.version.atLeast(DistributionOpenSearch, 2, 7) {
+		return errors.Errorf("flattened objects are not supported by %s", p.version)
+	}
+	mapping, settings := p.objectsMapping(), p.lifecycleSettings()
+	name, pattern := p.baseName(), p.indexPattern()
+	p.log.Info("Ensuring index template", "template", name, "indexPattern", pattern)
+
+	template := map[string]interface{}{
+		"index_patterns": []string{pattern},
+	}
+	if settings != nil {
+		template["settings"] = settings
+	}
+	mappingPath := pattern + "/_mapping"
+	if mapping != nil {
+		template["mappings"] = mapping
+		if p.version.typed() {
+			template["mappings"] = map[string]interface{}{"_doc": mapping}
+			mappingPath += "/_doc"
+		}
+	}
+	body, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	if _, err := p.request(http.MethodPut, "_template/"+name, bytes.NewReader(body)); err != nil {
+		return errors.Wrapf(err, "unable to install index template %s", name)
+	}
+	if mapping == nil {
+		return nil
+	}
+
+	exists, err := p.exists(pattern)
+	if err != nil || !exists {
+		return err
+	}
+	body, err = json.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+	if _, err := p.request(http.MethodPut, mappingPath, bytes.NewReader(body)); err != nil {
+		return errors.Wrapf(err, "unable to update the mapping of the indices %s", pattern)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newObjectEvent(id, group, resource string) audit.Event {
+	return audit.Event{
+		Level:          audit.LevelRequestResponse,
+		AuditID:        types.UID(id),
+		Verb:           "update",
+		ObjectRef:      &audit.ObjectReference{APIGroup: group, Resource: resource, Name: "obj"},
+		RequestObject:  &runtime.Unknown{Raw: []byte(`{"metadata":{"labels":{"app":"a"}}}`), ContentType: runtime.ContentTypeJSON},
+		ResponseObject: &runtime.Unknown{Raw: []byte(`{"metadata":{"labels":{"app":{"name":"a"}}}}`)},
+	}
+}
+
+var _ = Describe("Mapping", func() {
+	var (
+		es *fakeElasticsearch
+		p  *Provider
+	)
+
+	BeforeEach(func() {
+		es = newFakeElasticsearch()
+		p = &Provider{log: log.NullLogger{}, conn: &connection{client: http.DefaultClient, config: &Configuration{}}}
+	})
+
+	AfterEach(func() {
+		es.Close()
+	})
+
+	inject := func(config string) {
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + es.URL + `","index":"auditlog","version":"7.10.2",` + config + `}`))).To(Succeed())
+	}
+
+	// documents returns the documents of the recorded bulk requests by the audit id
+	documents := func() map[string]map[string]interface{} {
+		docs := map[string]map[string]interface{}{}
+		for _, req := range es.requests {
+			if req.uri != "/_bulk" {
+				continue
+			}
+			scanner := bufio.NewScanner(bytes.NewBufferString(req.body))
+			for scanner.Scan() {
+				line := map[string]interface{}{}
+				Expect(json.Unmarshal(scanner.Bytes(), &line)).To(Succeed())
+				if id, ok := line["AuditID"]; ok {
+					docs[id.(string)] = line
+				}
+			}
+		}
+		return docs
+	}
+
+	It("should reject unknown object modes", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"objects":{"mode":"Nested"}}`))).ToNot(Succeed())
+	})
+
+	It("should drop the objects by default", func() {
+		inject(`"objects":{}`)
+		Expect(p.config.Objects.Mode).To(Equal(ObjectsModeDrop))
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+		Expect(es.requests).To(BeEmpty())
+
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{newObjectEvent("1", "", "pods")}})).To(Succeed())
+		doc := documents()["1"]
+		Expect(doc).ToNot(BeNil())
+		Expect(doc).ToNot(HaveKey("RequestObject"))
+		Expect(doc).ToNot(HaveKey("ResponseObject"))
+	})
+
+	It("should install an index template that maps the objects as flattened fields", func() {
+		inject(`"objects":{"mode":"Flattened"}`)
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+		Expect(es.requests).To(HaveLen(2))
+		Expect(es.requests[0].method).To(Equal(http.MethodPut))
+		Expect(es.requests[0].uri).To(Equal("/_template/auditlog"))
+		Expect(es.requests[0].body).To(MatchJSON(`{"index_patterns":["auditlog"],"mappings":{"properties":{"RequestObject":{"type":"flattened"},"ResponseObject":{"type":"flattened"}}}}`))
+		Expect(es.requests[1].method).To(Equal(http.MethodHead))
+		Expect(es.requests[1].uri).To(Equal("/auditlog"))
+	})
+
+	It("should add the mapping to an existing index", func() {
+		es.responses["HEAD /auditlog"] = fakeResponse{status: http.StatusOK}
+		inject(`"objects":{"mode":"String"}`)
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+		Expect(es.requests).To(HaveLen(3))
+		Expect(es.requests[2].method).To(Equal(http.MethodPut))
+		Expect(es.requests[2].uri).To(Equal("/auditlog/_mapping"))
+		Expect(es.requests[2].body).To(MatchJSON(`{"properties":{"RequestObject":{"type":"text"},"ResponseObject":{"type":"text"}}}`))
+	})
+
+	It("should index the objects as flattened fields", func() {
+		inject(`"objects":{"mode":"Flattened"}`)
+		event := newObjectEvent("1", "", "pods")
+		yamlEvent := newObjectEvent("2", "", "pods")
+		yamlEvent.RequestObject = &runtime.Unknown{Raw: []byte("metadata: {}"), ContentType: "application/yaml"}
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{event, yamlEvent}})).To(Succeed())
+
+		docs := documents()
+		Expect(docs["1"]["RequestObject"]).To(Equal(map[string]interface{}{"metadata": map[string]interface{}{"labels": map[string]interface{}{"app": "a"}}}))
+		Expect(docs["1"]["ResponseObject"]).To(HaveKey("metadata"))
+		Expect(docs["2"]).ToNot(HaveKey("RequestObject"))
+		Expect(docs["2"]).To(HaveKey("ResponseObject"))
+	})
+
+	It("should index the objects as serialized strings", func() {
+		inject(`"objects":{"mode":"String"}`)
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{newObjectEvent("1", "", "pods")}})).To(Succeed())
+
+		doc := documents()["1"]
+		Expect(doc["RequestObject"]).To(Equal(`{"metadata":{"labels":{"app":"a"}}}`))
+		Expect(doc["ResponseObject"]).To(Equal(`{"metadata":{"labels":{"app":{"name":"a"}}}}`))
+	})
+
+	It("should only index the objects of the selected resources", func() {
+		inject(`"objects":{"mode":"String","resources":[{"resources":["configmaps"]},{"group":"rbac.authorization.k8s.io"}]}`)
+		noRef := newObjectEvent("4", "", "")
+		noRef.ObjectRef = nil
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{
+			newObjectEvent("1", "", "configmaps"),
+			newObjectEvent("2", "", "pods"),
+			newObjectEvent("3", "rbac.authorization.k8s.io", "roles"),
+			noRef,
+		}})).To(Succeed())
+
+		docs := documents()
+		Expect(docs["1"]).To(HaveKey("RequestObject"))
+		Expect(docs["2"]).ToNot(HaveKey("RequestObject"))
+		Expect(docs["3"]).To(HaveKey("ResponseObject"))
+		Expect(docs["4"]).ToNot(HaveKey("RequestObject"))
+	})
+})
@@ -22,23 +22,28 @@ import (
 	"github.com/gardener/gardener/pkg/chartrenderer"
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/runtime/serializer"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apiserver/pkg/apis/audit"
 	"k8s.io/client-go/rest"
-	"net/http"
 	"path/filepath"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
+	"sync"
 )
 
 type Provider struct {
 	log       logr.Logger
-	client    *http.Client
 	renderer  chartrenderer.Interface
 	k8sClient client.Client
 	config    *Configuration
-	decoder   runtime.Decoder
+
+	connMux   sync.RWMutex
+	conn      *connection
+	hasSecret bool
+
+	versionMux sync.Mutex
+	version    *clusterVersion
 }
 
 // Configuration is the elasticsearch provider specific configuration
@@ -46,7 +51,35 @@ type Configuration struct {
 	Endpoint string `json:"endpoint"`
 	Username string `json:"username"`
 	Password string `json:"password"`
-	Index    string `json:"index"`
+	// APIKey is the base64 encoded id and api key that is sent in the ApiKey authorization header
+	APIKey string `json:"apiKey,omitempty"`
+	// BearerToken is sent as bearer token in the authorization header
+	BearerToken string `json:"bearerToken,omitempty"`
+	// SecretRef references a secret of the namespace of the shoot with the credentials and certificates,
+	// which overwrite the inline ones.
+	// The secret is mounted into the proxy, its data is never part of the configuration.
+	SecretRef *corev1.SecretReference `json:"secretRef,omitempty"`
+	// TLS configures the tls connection to elasticsearch
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+	// Timeout of a request, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// Pool configures the connection pool
+	Pool *PoolConfiguration `json:"pool,omitempty"`
+	// Distribution is elasticsearch or opensearch and Version is the version of the cluster, e.g. 7.10.2.
+	// Both are probed from the cluster if no version is configured.
+	Distribution string `json:"distribution,omitempty"`
+	Version      string `json:"version,omitempty"`
+	// OpType is the bulk operation of the events, index or create, which is required to write to data streams.
+	// Defaults to index.
+	OpType string `json:"opType,omitempty"`
+
+	// Index is the index the events are written to. It may contain the shoot placeholder {shoot}
+	// and the date patterns %Y, %m, %d and %H of the time the request of an event was received.
+	Index string `json:"index"`
+	// Lifecycle configures the rollover and the retention of the indices
+	Lifecycle *LifecycleConfiguration `json:"lifecycle,omitempty"`
+	// Objects configures whether and how the request and response objects of the events are indexed
+	Objects *ObjectsConfiguration `json:"objects,omitempty"`
 }
 
 // GrafanaImageName is the name of the grafana image
@@ -61,15 +94,16 @@ const GrafanaChartName = "shoot-auditlog-grafana"
 // GrafanaDeploymentName is the name of the audilog grafana deployment
 const GrafanaDeploymentName = "shoot-auditlog-grafana"
 
+// LoggingCredentialsSecretName is the name of the secret with the credentials of the logging elasticsearch of the seed
+const LoggingCredentialsSecretName = "logging-ingress-credentials"
+
 // GrafanaSecretName is the name of the secret that contains the admin credentials for the grafana dashboard
 const GrafanaSecretName = "shoot-auditlog-grafana-admin-secret"
 
 var _ provider.Interface = &Provider{}
 
 func (p *Provider) New() (provider.Interface, error) {
-	return &Provider{
-		client: http.DefaultClient,
-	}, nil
+	return &Provider{}, nil
 }
 
 func (p *Provider) Name() string {
@@ -95,7 +129,46 @@ func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
 	if err := yaml.Unmarshal(rawConfig, config); err != nil {
 		return err
 	}
+	if config.Objects != nil {
+		switch config.Objects.Mode {
+		case "":
+			config.Objects.Mode = ObjectsModeDrop
+		case ObjectsModeDrop, ObjectsModeFlattened, ObjectsModeString:
+		default:
+			return errors.Errorf("unknown objects mode %q, must be one of %s, %s or %s",
+				config.Objects.Mode, ObjectsModeDrop, ObjectsModeFlattened, ObjectsModeString)
+		}
+	}
+	switch config.OpType {
+	case "":
+		config.OpType = OpTypeIndex
+	case OpTypeIndex, OpTypeCreate:
+	default:
+		return errors.Errorf("unknown op type %q, must be one of %s or %s", config.OpType, OpTypeIndex, OpTypeCreate)
+	}
+	var version *clusterVersion
+	if config.Version != "" {
+		var err error
+		if version, err = parseVersion(config.Distribution, config.Version); err != nil {
+			return err
+		}
+	}
+	if err := validateLifecycle(config); err != nil {
+		return err
+	}
+	if err := validateConnection(config); err != nil {
+		return err
+	}
+	conn, err := newConnection(config, nil)
+	if err != nil {
+		return err
+	}
+	p.connMux.Lock()
+	defer p.connMux.Unlock()
+	p.conn = conn
+	p.hasSecret = false
 	p.config = config
+	p.version = version
 	return nil
 }
 
@@ -104,30 +177,33 @@ func (p *Provider) InjectLogger(log logr.Logger) error {
 	return nil
 }
 
-// InjectScheme injects the given scheme into the reconciler.
-func (p *Provider) InjectScheme(scheme *runtime.Scheme) error {
-	p.decoder = serializer.NewCodecFactory(scheme).UniversalDecoder()
-	return nil
+// BackendConfig returns the backend configuration that is completed with the discovered elastic search of the seed
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
 }
 
 func (p *Provider) Log(events *audit.EventList) error {
 	if p.config == nil {
 		return errors.New("configuration is not defined")
 	}
+	if err := p.ensureVersion(); err != nil {
+		return err
+	}
 	bulk := bytes.NewBuffer([]byte{})
 
-	for _, event := range events.Items {
-
-		// omit request and response object due to elasticsearch indexing issues
-		// Could not dynamically add mapping for field [app.kubernetes.io/instance]. Existing mapping for [ResponseObject.items.metadata.labels.app] must be of type object but found [text].
-		event.RequestObject = nil
-		event.ResponseObject = nil
-
-		obj, err := json.Marshal(event)
+	for i := range events.Items {
+		obj, err := json.Marshal(p.newDocument(&events.Items[i]))
 		if err != nil {
 			return err
 		}
-		bulk.WriteString(fmt.Sprintf(`{ "index": { "_index": "%s", "_type": "_doc" } }`, p.config.Index))
+		if p.version.typed() {
+			bulk.WriteString(fmt.Sprintf(`{ "%s": { "_index": "%s", "_type": "_doc" } }`, p.config.OpType, p.indexName(&events.Items[i])))
+		} else {
+			bulk.WriteString(fmt.Sprintf(`{ "%s": { "_index": "%s" } }`, p.config.OpType, p.indexName(&events.Items[i])))
+		}
 		bulk.WriteRune('\n')
 		bulk.Write(obj)
 		bulk.WriteRune('\n')
@@ -0,0 +1,101 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// maxIndexNameBytes is the maximum length of index names
+const maxIndexNameBytes = 255
+
+// indexPlaceholders replaces the placeholders of the index with values of their maximum length to validate the index name
+var indexPlaceholders = strings.NewReplacer(ShootPlaceholder, strings.Repeat("s", 63), "%Y", "2006", "%m", "01", "%d", "02", "%H", "15")
+
+// ValidateBackendConfig validates the endpoint, the index and the credentials and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	// the elasticsearch of the seed is used if no endpoint is defined
+	if config.Endpoint != "" {
+		allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	}
+	if config.Index != "" {
+		allErrs = append(allErrs, validateIndexName(config.Index, fldPath.Child("index"))...)
+	}
+
+	var credentials []string
+	for _, credential := range []struct{ name, value string }{
+		{"username", config.Username},
+		{"apiKey", config.APIKey},
+		{"bearerToken", config.BearerToken},
+	} {
+		if credential.value != "" {
+			credentials = append(credentials, credential.name)
+		}
+	}
+	if len(credentials) > 1 {
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child(credentials[1]),
+			fmt.Sprintf("Only one of username, apiKey or bearerToken can be defined, found %s", strings.Join(credentials, " and "))))
+	}
+	if config.Password != "" && config.Username == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("username"), "A username has to be defined for the password"))
+	}
+	if config.SecretRef != nil {
+		if config.SecretRef.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("secretRef", "name"), "A name has to be defined for the secret reference"))
+		}
+		if config.SecretRef.Namespace != "" {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("secretRef", "namespace"), "Only secrets of the namespace of the shoot can be referenced"))
+		}
+	}
+
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+// validateIndexName validates the index name with the rules of elasticsearch after the placeholders are replaced
+func validateIndexName(index string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	name := indexPlaceholders.Replace(index)
+	if name != strings.ToLower(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, index, "The index has to be lowercase"))
+	}
+	if strings.ContainsAny(name, `\/*?"<>| ,#:`) {
+		allErrs = append(allErrs, field.Invalid(fldPath, index, `The index must not contain \, /, *, ?, ", <, >, |, spaces, commas, # or :`))
+	}
+	if strings.HasPrefix(name, "-") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, "+") {
+		allErrs = append(allErrs, field.Invalid(fldPath, index, "The index must not start with -, _ or +"))
+	}
+	if name == "." || name == ".." {
+		allErrs = append(allErrs, field.Invalid(fldPath, index, "The index must not be . or .."))
+	}
+	if len(name) > maxIndexNameBytes {
+		allErrs = append(allErrs, field.TooLong(fldPath, index, maxIndexNameBytes))
+	}
+	return allErrs
+}
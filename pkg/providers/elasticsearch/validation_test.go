@@ -0,0 +1,83 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("Validation", func() {
+	var (
+		p       *Provider
+		fldPath = field.NewPath("backendProviderConfig")
+	)
+
+	BeforeEach(func() {
+		p = &Provider{}
+	})
+
+	It("should accept a valid configuration", func() {
+		Expect(p.ValidateBackendConfig([]byte(`{"endpoint":"https://elasticsearch:9200","index":"auditlog-{shoot}-%Y.%m.%d","username":"admin","password":"secret"}`), nil, fldPath)).To(BeEmpty())
+		Expect(p.ValidateBackendConfig([]byte(`{}`), nil, fldPath)).To(BeEmpty())
+	})
+
+	It("should reject invalid endpoints", func() {
+		errs := p.ValidateBackendConfig([]byte(`{"endpoint":"elasticsearch:9200"}`), nil, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeNotSupported))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.endpoint.scheme"))
+	})
+
+	It("should reject invalid index names", func() {
+		for _, index := range []string{"Auditlog", "audit log", "auditlog#{shoot}", "_auditlog", "..", "auditlog-{shoot}" + strings.Repeat("a", 200)} {
+			errs := p.ValidateBackendConfig([]byte(`{"index":"`+index+`"}`), nil, fldPath)
+			Expect(errs).ToNot(BeEmpty(), index)
+			Expect(errs[0].Field).To(Equal("backendProviderConfig.index"))
+		}
+	})
+
+	It("should reject multiple credentials", func() {
+		errs := p.ValidateBackendConfig([]byte(`{"username":"admin","bearerToken":"token"}`), nil, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.bearerToken"))
+	})
+
+	It("should require a username for the password and a name for the secret reference", func() {
+		errs := p.ValidateBackendConfig([]byte(`{"password":"secret","secretRef":{}}`), nil, fldPath)
+		Expect(errs).To(HaveLen(2))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.username"))
+		Expect(errs[1].Field).To(Equal("backendProviderConfig.secretRef.name"))
+	})
+
+	It("should forbid secrets of other namespaces", func() {
+		errs := p.ValidateBackendConfig([]byte(`{"secretRef":{"name":"es-credentials","namespace":"garden"}}`), nil, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeForbidden))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.secretRef.namespace"))
+	})
+
+	It("should reject settings that cannot be injected", func() {
+		errs := p.ValidateBackendConfig([]byte(`{"opType":"update"}`), nil, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeInvalid))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig"))
+	})
+})
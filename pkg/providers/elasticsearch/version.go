@@ -0,0 +1,140 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DistributionElasticsearch is the distribution of elasticsearch clusters
+	DistributionElasticsearch = "elasticsearch"
+	// DistributionOpenSearch is the distribution of opensearch clusters
+	DistributionOpenSearch = "opensearch"
+)
+
+const (
+	// OpTypeIndex indexes the events into indices and aliases
+	OpTypeIndex = "index"
+	// OpTypeCreate only creates documents, which is required to write to data streams
+	OpTypeCreate = "create"
+)
+
+// clusterVersion is the distribution and version of the cluster
+type clusterVersion struct {
+	distribution string
+	number       string
+	major        int
+	minor        int
+}
+
+// parseVersion parses the version number of the cluster, e.g. 7.10.2 or 8.0.0-SNAPSHOT
+func parseVersion(distribution, version string) (*clusterVersion, error) {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return nil, errors.Errorf("invalid version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid version %q", version)
+	}
+	minor, err := strconv.Atoi(strings.SplitN(parts[1], "-", 2)[0])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid version %q", version)
+	}
+	switch distribution {
+	case "":
+		distribution = DistributionElasticsearch
+	case DistributionElasticsearch, DistributionOpenSearch:
+	default:
+		return nil, errors.Errorf("unknown distribution %q, must be one of %s or %s", distribution, DistributionElasticsearch, DistributionOpenSearch)
+	}
+	return &clusterVersion{distribution: distribution, number: version, major: major, minor: minor}, nil
+}
+
+func (v *clusterVersion) String() string {
+	return v.distribution + " " + v.number
+}
+
+// atLeast returns true if the version is at least major.minor of the given distribution
+func (v *clusterVersion) atLeast(distribution string, major, minor int) bool {
+	return v.distribution == distribution && (v.major > major || (v.major == major && v.minor >= minor))
+}
+
+// typed returns true if the cluster still requires mapping types, which were removed with elasticsearch 7
+func (v *clusterVersion) typed() bool {
+	return v.distribution == DistributionElasticsearch && v.major < 7
+}
+
+// grafanaVersion returns the version of the grafana elasticsearch datasource.
+// Grafana supports the apis of elasticsearch 7.0 and newer as well as opensearch with version 70.
+func (v *clusterVersion) grafanaVersion() int {
+	switch {
+	case v.distribution == DistributionOpenSearch || v.major >= 7:
+		return 70
+	case v.major == 6:
+		return 60
+	case v.major == 5 && v.minor >= 6:
+		return 56
+	case v.major == 5:
+		return 5
+	default:
+		return 2
+	}
+}
+
+// ensureVersion determines the distribution and version of the cluster.
+// The cluster is probed once if they are not configured. The probed version is not part of the configuration
+// so that it is probed again after an upgrade of the cluster.
+func (p *Provider) ensureVersion() error {
+	p.versionMux.Lock()
+	defer p.versionMux.Unlock()
+	if p.version != nil {
+		return nil
+	}
+	distribution, number := p.config.Distribution, p.config.Version
+	if number == "" {
+		body, err := p.request(http.MethodGet, "", nil)
+		if err != nil {
+			return errors.Wrap(err, "unable to probe the version of the cluster")
+		}
+		info := &struct {
+			Version struct {
+				Number       string `json:"number"`
+				Distribution string `json:"distribution"`
+			} `json:"version"`
+		}{}
+		if err := json.Unmarshal(body, info); err != nil {
+			return errors.Wrap(err, "unable to decode the version of the cluster")
+		}
+		if info.Version.Number == "" {
+			return errors.New("the cluster did not return its version")
+		}
+		distribution, number = info.Version.Distribution, info.Version.Number
+	}
+	version, err := parseVersion(distribution, number)
+	if err != nil {
+		return err
+	}
+	if p.config.Version == "" {
+		p.log.Info("Probed the version of the cluster", "distribution", version.distribution, "version", version.number)
+	}
+	p.version = version
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// recordedResponse returns a response that was recorded from a cluster
+func recordedResponse(name string) fakeResponse {
+	body, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	Expect(err).ToNot(HaveOccurred())
+	return fakeResponse{status: http.StatusOK, body: string(body)}
+}
+
+var _ = Describe("Version", func() {
+	var (
+		es *fakeElasticsearch
+		p  *Provider
+	)
+
+	BeforeEach(func() {
+		es = newFakeElasticsearch()
+		p = &Provider{log: log.NullLogger{}}
+	})
+
+	AfterEach(func() {
+		es.Close()
+	})
+
+	inject := func(config string) {
+		Expect(p.InjectBackendConfig([]byte(`{"endpoint":"` + es.URL + `","index":"auditlog",` + config + `}`))).To(Succeed())
+	}
+
+	// bulkActions returns the action lines of the recorded bulk requests
+	bulkActions := func() []string {
+		actions := []string{}
+		for _, req := range es.requests {
+			if req.uri != "/_bulk" {
+				continue
+			}
+			scanner := bufio.NewScanner(bytes.NewBufferString(req.body))
+			for i := 0; scanner.Scan(); i++ {
+				if i%2 == 0 {
+					actions = append(actions, scanner.Text())
+				}
+			}
+		}
+		return actions
+	}
+
+	for _, c := range []struct {
+		recording    string
+		distribution string
+		version      string
+		action       string
+		grafana      int
+		policyType   string
+		flattened    string
+	}{
+		{"elasticsearch-6.json", DistributionElasticsearch, "6.8.23", `{ "index": { "_index": "auditlog", "_type": "_doc" } }`, 60, PolicyTypeILM, ""},
+		{"elasticsearch-7.json", DistributionElasticsearch, "7.17.9", `{ "index": { "_index": "auditlog" } }`, 70, PolicyTypeILM, "flattened"},
+		{"elasticsearch-8.json", DistributionElasticsearch, "8.11.1", `{ "index": { "_index": "auditlog" } }`, 70, PolicyTypeILM, "flattened"},
+		{"opensearch-1.json", DistributionOpenSearch, "1.3.13", `{ "index": { "_index": "auditlog" } }`, 70, PolicyTypeISM, ""},
+		{"opensearch-2.json", DistributionOpenSearch, "2.11.0", `{ "index": { "_index": "auditlog" } }`, 70, PolicyTypeISM, "flat_object"},
+	} {
+		c := c
+		It("should probe "+c.recording+" once and use its apis", func() {
+			es.responses["GET /"] = recordedResponse(c.recording)
+			inject(`"objects":{"mode":"Flattened"}`)
+
+			for i := 0; i < 2; i++ {
+				Expect(p.Log(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})).To(Succeed())
+			}
+			Expect(es.recorded()).To(Equal([]string{"GET /"}))
+			Expect(bulkActions()).To(Equal([]string{c.action, c.action}))
+			Expect(p.version.distribution).To(Equal(c.distribution))
+			Expect(p.version.number).To(Equal(c.version))
+			config, err := p.BackendConfig()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(config)).NotTo(ContainSubstring(`"version"`))
+			Expect(string(config)).NotTo(ContainSubstring(`"distribution"`))
+			Expect(p.version.grafanaVersion()).To(Equal(c.grafana))
+			Expect(p.policyType()).To(Equal(c.policyType))
+
+			err = p.ensureIndexTemplate()
+			if c.flattened == "" {
+				Expect(err).To(HaveOccurred())
+				return
+			}
+			Expect(err).ToNot(HaveOccurred())
+			Expect(es.requests[len(es.requests)-2].body).To(MatchJSON(`{"index_patterns":["auditlog"],"mappings":{"properties":` +
+				`{"RequestObject":{"type":"` + c.flattened + `"},"ResponseObject":{"type":"` + c.flattened + `"}}}}`))
+		})
+	}
+
+	It("should use the typed mapping apis of elasticsearch 6", func() {
+		es.responses["HEAD /auditlog"] = fakeResponse{status: http.StatusOK}
+		inject(`"version":"6.8.23","objects":{"mode":"String"}`)
+		Expect(p.ensureIndexTemplate()).To(Succeed())
+
+		Expect(es.recorded()).To(Equal([]string{"PUT /_template/auditlog", "HEAD /auditlog", "PUT /auditlog/_mapping/_doc"}))
+		Expect(es.requests[0].body).To(MatchJSON(`{"index_patterns":["auditlog"],"mappings":{"_doc":{"properties":{"RequestObject":{"type":"text"},"ResponseObject":{"type":"text"}}}}}`))
+		Expect(es.requests[2].body).To(MatchJSON(`{"properties":{"RequestObject":{"type":"text"},"ResponseObject":{"type":"text"}}}`))
+	})
+
+	It("should not probe a configured version", func() {
+		inject(`"distribution":"opensearch","version":"2.11.0"`)
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})).To(Succeed())
+		Expect(es.recorded()).To(BeEmpty())
+		Expect(p.policyType()).To(Equal(PolicyTypeISM))
+	})
+
+	It("should reject invalid versions and op types", func() {
+		Expect(p.InjectBackendConfig([]byte(`{"version":"latest"}`))).ToNot(Succeed())
+		Expect(p.InjectBackendConfig([]byte(`{"distribution":"solr","version":"9.0.0"}`))).ToNot(Succeed())
+		Expect(p.InjectBackendConfig([]byte(`{"opType":"upsert"}`))).ToNot(Succeed())
+	})
+
+	It("should retry the probe if it failed", func() {
+		es.responses["GET /"] = fakeResponse{status: http.StatusServiceUnavailable}
+		inject(`"opType":"create"`)
+		err := p.Log(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})
+		Expect(err).To(HaveOccurred())
+		Expect(provider.IsTransient(err)).To(BeTrue())
+
+		es.responses["GET /"] = recordedResponse("elasticsearch-8.json")
+		Expect(p.Log(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})).To(Succeed())
+		Expect(es.recorded()).To(Equal([]string{"GET /", "GET /"}))
+	})
+
+	It("should create the documents of data streams", func() {
+		es.responses["POST /_bulk"] = recordedResponse("bulk-create-8.json")
+		inject(`"version":"8.11.1","opType":"create"`)
+		event := audit.Event{AuditID: "1", RequestReceivedTimestamp: metav1.NewMicroTime(time.Now())}
+		err := p.Log(&audit.EventList{Items: []audit.Event{event, event}})
+
+		Expect(bulkActions()).To(Equal([]string{`{ "create": { "_index": "auditlog" } }`, `{ "create": { "_index": "auditlog" } }`}))
+		doc := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(bytes.SplitN([]byte(es.requests[0].body), []byte("\n"), 3)[1]), &doc)).To(Succeed())
+		Expect(doc).To(HaveKey("@timestamp"))
+
+		Expect(err).To(BeAssignableToTypeOf(&provider.PartialError{}))
+		partialErr := err.(*provider.PartialError)
+		Expect(partialErr.Errors).To(HaveLen(1))
+		Expect(partialErr.Errors[0].Index).To(Equal(1))
+		Expect(partialErr.Errors[0].Transient).To(BeFalse())
+		Expect(partialErr.Errors[0].Err.Error()).To(ContainSubstring("document_parsing_exception"))
+	})
+})
@@ -17,6 +17,7 @@ package providers
 import (
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	"github.com/pkg/errors"
+	"sort"
 )
 
 var ProviderFactory = &providerFactory{
@@ -31,6 +32,16 @@ func (pf *providerFactory) Register(p provider.Interface) {
 	pf.providers[p.Name()] = p
 }
 
+// Names returns the sorted names of all registered providers
+func (pf *providerFactory) Names() []string {
+	names := make([]string, 0, len(pf.providers))
+	for name := range pf.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (pf *providerFactory) Get(name string) (provider.Interface, error) {
 	p, ok := pf.providers[name]
 	if !ok {
@@ -0,0 +1,125 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"compress/gzip"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// backupTimeFormat is the time format of the backups, it sorts lexically and does not contain colons
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	compressedSuffix = ".gz"
+)
+
+// backup is a rotated file
+type backup struct {
+	path       string
+	timestamp  time.Time
+	compressed bool
+}
+
+// backupName returns the path of the backup of the file that is rotated at the given time,
+// e.g. /var/log/audit-2020-09-13T12-00-00.000.log for /var/log/audit.log
+func backupName(path string, rotated time.Time) string {
+	dir, prefix, ext := splitPath(path)
+	return filepath.Join(dir, prefix+rotated.UTC().Format(backupTimeFormat)+ext)
+}
+
+// listBackups returns the backups of the file ordered from the newest to the oldest backup.
+// Uncompressed backups take precedence over compressed backups with the same timestamp as their compression did not complete.
+func listBackups(path string) ([]backup, error) {
+	dir, prefix, ext := splitPath(path)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list backups")
+	}
+
+	backups := make(map[time.Time]backup)
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		compressed := strings.HasSuffix(name, ext+compressedSuffix)
+		if compressed {
+			name = strings.TrimSuffix(name, compressedSuffix)
+		}
+		if !strings.HasSuffix(name, ext) {
+			continue
+		}
+		timestamp, err := time.Parse(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+		if err != nil {
+			continue
+		}
+		if b, ok := backups[timestamp]; ok && !b.compressed {
+			continue
+		}
+		backups[timestamp] = backup{path: filepath.Join(dir, f.Name()), timestamp: timestamp, compressed: compressed}
+	}
+
+	list := make([]backup, 0, len(backups))
+	for _, b := range backups {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].timestamp.After(list[j].timestamp) })
+	return list, nil
+}
+
+// compress replaces the backup with a gzip compressed copy
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open backup %s", path)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+compressedSuffix, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create compressed backup of %s", path)
+	}
+	w := gzip.NewWriter(dst)
+	if _, err := io.Copy(w, src); err != nil {
+		_ = dst.Close()
+		return errors.Wrapf(err, "unable to compress backup %s", path)
+	}
+	if err := w.Close(); err != nil {
+		_ = dst.Close()
+		return errors.Wrapf(err, "unable to compress backup %s", path)
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return errors.Wrapf(err, "unable to sync compressed backup of %s", path)
+	}
+	if err := dst.Close(); err != nil {
+		return errors.Wrapf(err, "unable to close compressed backup of %s", path)
+	}
+	return os.Remove(path)
+}
+
+// splitPath returns the directory of the file, the prefix of its backups and its extension
+func splitPath(path string) (string, string, string) {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext) + "-", ext
+}
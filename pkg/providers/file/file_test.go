@@ -0,0 +1,246 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// clock is a fake clock that is safe to use by the background rotation
+type clock struct {
+	mux sync.Mutex
+	t   time.Time
+}
+
+func (c *clock) now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.t
+}
+
+func (c *clock) add(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.t = c.t.Add(d)
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		dir  string
+		path string
+		clk  *clock
+	)
+
+	newProvider := func(config string) *Provider {
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig([]byte(fmt.Sprintf(`{"path": %q, %s}`, path, config)))).To(Succeed())
+		p.now = clk.now
+		return p
+	}
+
+	newEvents := func(from, to int) *audit.EventList {
+		list := &audit.EventList{}
+		for i := from; i < to; i++ {
+			list.Items = append(list.Items, audit.Event{AuditID: types.UID(fmt.Sprintf("%d", i)), Verb: "get"})
+		}
+		return list
+	}
+
+	auditIDsOf := func(r io.Reader) []string {
+		ids := make([]string, 0)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			event := &auditv1.Event{}
+			Expect(json.Unmarshal(scanner.Bytes(), event)).To(Succeed())
+			Expect(event.APIVersion).To(Equal("audit.k8s.io/v1"))
+			Expect(event.Kind).To(Equal("Event"))
+			ids = append(ids, string(event.AuditID))
+		}
+		Expect(scanner.Err()).ToNot(HaveOccurred())
+		return ids
+	}
+
+	auditIDs := func(path string) []string {
+		f, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+		var r io.Reader = f
+		if filepath.Ext(path) == compressedSuffix {
+			gz, err := gzip.NewReader(f)
+			Expect(err).ToNot(HaveOccurred())
+			r = gz
+		}
+		return auditIDsOf(r)
+	}
+
+	backups := func() []backup {
+		list, err := listBackups(path)
+		Expect(err).ToNot(HaveOccurred())
+		return list
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "file-provider")
+		Expect(err).ToNot(HaveOccurred())
+		path = filepath.Join(dir, "audit", "audit.log")
+		clk = &clock{t: time.Date(2020, 9, 13, 12, 0, 0, 0, time.UTC)}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("should write one audit.k8s.io/v1 event per line", func() {
+		p := newProvider(`"syncInterval": "0s"`)
+		Expect(p.Log(newEvents(0, 3))).To(Succeed())
+		Expect(p.Log(newEvents(3, 4))).To(Succeed())
+		Expect(auditIDs(path)).To(Equal([]string{"0", "1", "2", "3"}))
+		Expect(p.Close()).To(Succeed())
+	})
+
+	It("should append to an existing file", func() {
+		p := newProvider(`"maxAge": "1h"`)
+		Expect(p.Log(newEvents(0, 2))).To(Succeed())
+		Expect(p.Close()).To(Succeed())
+
+		p = newProvider(`"maxAge": "1h"`)
+		Expect(p.Log(newEvents(2, 3))).To(Succeed())
+		Expect(p.Close()).To(Succeed())
+		Expect(auditIDs(path)).To(Equal([]string{"0", "1", "2"}))
+		Expect(backups()).To(BeEmpty())
+	})
+
+	It("should rotate the file by size and keep the configured number of compressed backups", func() {
+		p := newProvider(`"maxSize": "1", "maxBackups": 2`)
+		for i := 0; i < 4; i++ {
+			Expect(p.Log(newEvents(i, i+1))).To(Succeed())
+			clk.add(time.Second)
+		}
+
+		Eventually(func() []bool {
+			compressed := make([]bool, 0)
+			for _, b := range backups() {
+				compressed = append(compressed, b.compressed)
+			}
+			return compressed
+		}).Should(Equal([]bool{true, true}))
+		Expect(p.Close()).To(Succeed())
+
+		list := backups()
+		Expect(filepath.Base(list[0].path)).To(Equal("audit-2020-09-13T12-00-03.000.log.gz"))
+		Expect(auditIDs(list[0].path)).To(Equal([]string{"2"}))
+		Expect(auditIDs(list[1].path)).To(Equal([]string{"1"}))
+		Expect(auditIDs(path)).To(Equal([]string{"3"}))
+	})
+
+	It("should rotate the file by age", func() {
+		p := newProvider(`"maxAge": "1h", "compress": false`)
+		Expect(p.Log(newEvents(0, 2))).To(Succeed())
+		clk.add(time.Hour)
+		Expect(p.Log(newEvents(2, 3))).To(Succeed())
+		Expect(p.Close()).To(Succeed())
+
+		list := backups()
+		Expect(list).To(HaveLen(1))
+		Expect(filepath.Base(list[0].path)).To(Equal("audit-2020-09-13T13-00-00.000.log"))
+		Expect(auditIDs(list[0].path)).To(Equal([]string{"0", "1"}))
+		Expect(auditIDs(path)).To(Equal([]string{"2"}))
+	})
+
+	It("should rotate idle files in the background once they reached their maximum age", func() {
+		p := newProvider(`"maxAge": "1h", "compress": false, "syncInterval": "100ms"`)
+		Expect(p.Log(newEvents(0, 1))).To(Succeed())
+		clk.add(time.Hour)
+
+		Eventually(backups).Should(HaveLen(1))
+		Expect(p.Close()).To(Succeed())
+		Expect(auditIDs(backups()[0].path)).To(Equal([]string{"0"}))
+		Expect(auditIDs(path)).To(BeEmpty())
+	})
+
+	It("should compress backups of previous runs", func() {
+		Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+		backup := filepath.Join(filepath.Dir(path), "audit-2020-09-13T11-00-00.000.log")
+		Expect(ioutil.WriteFile(backup, []byte(`{"apiVersion":"audit.k8s.io/v1","kind":"Event","auditID":"x"}`+"\n"), 0600)).To(Succeed())
+
+		p := newProvider(`"maxAge": "1h"`)
+		Expect(p.Log(newEvents(0, 1))).To(Succeed())
+		Eventually(func() bool { return backups()[0].compressed }).Should(BeTrue())
+		Expect(p.Close()).To(Succeed())
+		Expect(auditIDs(backup + compressedSuffix)).To(Equal([]string{"x"}))
+	})
+
+	It("should return transient errors if the file cannot be opened", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "audit"), nil, 0600)).To(Succeed())
+
+		p := newProvider(`"maxAge": "1h"`)
+		err := p.Log(newEvents(0, 2))
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(2))
+		for _, e := range partialErr.Errors {
+			Expect(e.Transient).To(BeTrue())
+		}
+		Expect(p.Close()).To(Succeed())
+	})
+
+	Context("configuration", func() {
+		inject := func(config string) error {
+			return (&Provider{}).InjectBackendConfig([]byte(config))
+		}
+
+		It("should default the configuration", func() {
+			p := newProvider(`"maxBackups": 3`)
+			Expect(p.config.MaxSize.String()).To(Equal("100Mi"))
+			Expect(p.config.MaxAge.Duration).To(Equal(24 * time.Hour))
+			Expect(p.config.MaxBackups).To(Equal(3))
+			Expect(*p.config.Compress).To(BeTrue())
+			Expect(p.config.SyncInterval.Duration).To(Equal(time.Second))
+		})
+
+		It("should reject invalid configurations", func() {
+			Expect(inject(`{}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "audit.log"}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "/var/log/audit.log", "maxSize": "0"}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "/var/log/audit.log", "maxAge": "-1h"}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "/var/log/audit.log", "maxBackups": -1}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "/var/log/audit.log", "syncInterval": "-1s"}`)).ToNot(Succeed())
+			Expect(inject(`{"path": "/var/log/audit.log", "maxAge": "0s", "syncInterval": "0s"}`)).To(Succeed())
+		})
+	})
+})
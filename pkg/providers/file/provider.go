@@ -0,0 +1,426 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxAge       = 24 * time.Hour
+	defaultMaxBackups   = 5
+	defaultSyncInterval = time.Second
+	// maxTickInterval is the maximum interval in which the age of the file is checked
+	maxTickInterval = time.Second
+)
+
+var defaultMaxSize = resource.MustParse("100Mi")
+
+// Provider writes the events in the format of the log backend of the kube-apiserver to a local file,
+// so that they can be collected by node-local log collectors.
+// The file is rotated by size and age and the rotated files are kept as compressed backups.
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+
+	startOnce sync.Once
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	// mux protects the file
+	mux    sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	// dirty is set if events were written since the last sync
+	dirty bool
+	// rotated is signaled when the file was rotated
+	rotated chan struct{}
+	now     func() time.Time
+}
+
+// Configuration is the configuration of the file provider
+type Configuration struct {
+	// Path is the absolute path of the file
+	Path string `json:"path"`
+	// MaxSize is the size after which the file is rotated, defaults to 100Mi
+	MaxSize *resource.Quantity `json:"maxSize,omitempty"`
+	// MaxAge is the time after which the file is rotated, defaults to 24h.
+	// A duration of 0 disables the rotation by age.
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+	// MaxBackups is the number of rotated files that are kept, defaults to 5
+	MaxBackups int `json:"maxBackups,omitempty"`
+	// Compress compresses the rotated files with gzip, defaults to true
+	Compress *bool `json:"compress,omitempty"`
+	// SyncInterval is the interval in which the file is synced to disk, defaults to 1s.
+	// A duration of 0 syncs the file after every write.
+	SyncInterval *metav1.Duration `json:"syncInterval,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+var _ provider.Closer = &Provider{}
+
+// New returns a new file provider
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "file"
+}
+
+// InjectBackendConfig injects the backend configuration
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+	if err := validate(config); err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeFile()
+	p.rotated = make(chan struct{}, 1)
+	p.now = time.Now
+	p.config = config
+	return nil
+}
+
+// ValidateBackendConfig validates the path of the file and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	if config.Path == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("path"), "A path has to be defined"))
+	} else if !filepath.IsAbs(config.Path) {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("path"), config.Path, "The path has to be absolute"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+// InjectLogger injects the logger
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Reconcile is a noop
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// Delete is a noop as the file is local to the proxy
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the configuration including the defaults
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log appends every event as one JSON line to the file.
+// The file is rotated before the events are written if they would exceed its maximum size or if it reached its maximum age.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	p.startOnce.Do(p.start)
+
+	var (
+		partialErr = &provider.PartialError{}
+		lines      = &bytes.Buffer{}
+		indices    = make([]int, 0, len(events.Items))
+	)
+	for i := range events.Items {
+		data, err := provider.MarshalEventV1(&events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: errors.Wrap(err, "unable to marshal event")})
+			continue
+		}
+		lines.Write(data)
+		lines.WriteByte('\n')
+		indices = append(indices, i)
+	}
+
+	if lines.Len() != 0 {
+		if err := p.write(lines.Bytes()); err != nil {
+			for _, i := range indices {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err, Transient: true})
+			}
+		}
+	}
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	return nil
+}
+
+// Close stops the background sync and rotation and closes the file
+func (p *Provider) Close() error {
+	if p.config == nil || p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+	p.wg.Wait()
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.file == nil {
+		return nil
+	}
+	err := p.file.Sync()
+	if closeErr := p.file.Close(); err == nil {
+		err = closeErr
+	}
+	p.file = nil
+	return err
+}
+
+// start compresses and prunes the backups of previous runs and starts the background sync and rotation
+func (p *Provider) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.signalRotated()
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run(ctx)
+	}()
+}
+
+// run syncs the file, rotates it once it reached its maximum age and processes the backups after rotations
+// until the context is done
+func (p *Provider) run(ctx context.Context) {
+	interval := p.config.SyncInterval.Duration
+	if interval == 0 || interval > maxTickInterval {
+		interval = maxTickInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	lastSync := p.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.rotated:
+			if err := p.processBackups(); err != nil {
+				p.log.Error(err, "unable to process backups")
+			}
+		case <-ticker.C:
+			p.mux.Lock()
+			if p.file != nil && p.dirty && p.now().Sub(lastSync) >= p.config.SyncInterval.Duration {
+				if err := p.file.Sync(); err != nil {
+					p.log.Error(err, "unable to sync file")
+				} else {
+					p.dirty = false
+				}
+				lastSync = p.now()
+			}
+			if p.file != nil && p.expired() {
+				if err := p.rotate(); err != nil {
+					p.log.Error(err, "unable to rotate file")
+				}
+			}
+			p.mux.Unlock()
+		}
+	}
+}
+
+// write appends the lines to the file and rotates the file before if necessary
+func (p *Provider) write(lines []byte) error {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.file == nil {
+		if err := p.openFile(); err != nil {
+			return err
+		}
+	}
+	if (p.size > 0 && p.size+int64(len(lines)) > p.config.MaxSize.Value()) || p.expired() {
+		if err := p.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := p.file.Write(lines)
+	if err != nil {
+		// remove the partially written lines, so that the next write does not continue a torn line
+		if n > 0 {
+			_ = p.file.Truncate(p.size)
+		}
+		p.closeFile()
+		return errors.Wrap(err, "unable to write events")
+	}
+	p.size += int64(n)
+	p.dirty = true
+
+	if p.config.SyncInterval.Duration == 0 {
+		if err := p.file.Sync(); err != nil {
+			p.closeFile()
+			return errors.Wrap(err, "unable to sync file")
+		}
+		p.dirty = false
+	}
+	return nil
+}
+
+// expired returns whether the file is not empty and reached its maximum age
+func (p *Provider) expired() bool {
+	maxAge := p.config.MaxAge.Duration
+	return maxAge > 0 && p.size > 0 && p.now().Sub(p.opened) >= maxAge
+}
+
+// openFile opens the file for appending. The age of an existing file starts with its opening.
+func (p *Provider) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(p.config.Path), 0755); err != nil {
+		return errors.Wrap(err, "unable to create directory")
+	}
+	file, err := os.OpenFile(p.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to open file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.Wrap(err, "unable to stat file")
+	}
+	p.file, p.size, p.opened, p.dirty = file, info.Size(), p.now(), false
+	return nil
+}
+
+// rotate renames the file to a backup and opens a new file
+func (p *Provider) rotate() error {
+	if err := p.file.Sync(); err != nil {
+		return errors.Wrap(err, "unable to sync file")
+	}
+	p.closeFile()
+	if err := os.Rename(p.config.Path, backupName(p.config.Path, p.now())); err != nil {
+		return errors.Wrap(err, "unable to rotate file")
+	}
+	p.signalRotated()
+	return p.openFile()
+}
+
+// signalRotated triggers the processing of the backups unless it is already pending
+func (p *Provider) signalRotated() {
+	select {
+	case p.rotated <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Provider) closeFile() {
+	if p.file != nil {
+		_ = p.file.Close()
+		p.file = nil
+	}
+}
+
+// processBackups compresses the backups and removes the oldest ones that exceed the maximum number of backups
+func (p *Provider) processBackups() error {
+	if *p.config.Compress {
+		backups, err := listBackups(p.config.Path)
+		if err != nil {
+			return err
+		}
+		for _, b := range backups {
+			if b.compressed {
+				continue
+			}
+			if err := compress(b.path); err != nil {
+				return err
+			}
+		}
+	}
+
+	backups, err := listBackups(p.config.Path)
+	if err != nil {
+		return err
+	}
+	for i := p.config.MaxBackups; i < len(backups); i++ {
+		if err := os.Remove(backups[i].path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to remove backup %s", backups[i].path)
+		}
+	}
+	return nil
+}
+
+func setDefaults(config *Configuration) {
+	if config.MaxSize == nil {
+		maxSize := defaultMaxSize.DeepCopy()
+		config.MaxSize = &maxSize
+	}
+	if config.MaxAge == nil {
+		config.MaxAge = &metav1.Duration{Duration: defaultMaxAge}
+	}
+	if config.MaxBackups == 0 {
+		config.MaxBackups = defaultMaxBackups
+	}
+	if config.Compress == nil {
+		compress := true
+		config.Compress = &compress
+	}
+	if config.SyncInterval == nil {
+		config.SyncInterval = &metav1.Duration{Duration: defaultSyncInterval}
+	}
+}
+
+func validate(config *Configuration) error {
+	if config.Path == "" {
+		return errors.New("path is required")
+	}
+	if !filepath.IsAbs(config.Path) {
+		return errors.Errorf("path %q must be absolute", config.Path)
+	}
+	if config.MaxSize.Sign() <= 0 {
+		return errors.New("maximum size must be positive")
+	}
+	if config.MaxAge.Duration < 0 {
+		return errors.New("maximum age must not be negative")
+	}
+	if config.MaxBackups < 0 {
+		return errors.New("maximum number of backups must not be negative")
+	}
+	if config.SyncInterval.Duration < 0 {
+		return errors.New("sync interval must not be negative")
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forward
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// generateCertificate returns a self-signed PEM encoded server certificate and key for 127.0.0.1
+func generateCertificate() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fluent-bit"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		srv    *server
+		events *audit.EventList
+	)
+
+	newProvider := func(config *Configuration) *Provider {
+		rawConfig, err := json.Marshal(config)
+		Expect(err).ToNot(HaveOccurred())
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig(rawConfig)).To(Succeed())
+		return p
+	}
+
+	received := time.Date(2020, 9, 13, 12, 26, 40, 123456000, time.UTC)
+	newEvents := func(from, to int) *audit.EventList {
+		list := &audit.EventList{}
+		for i := from; i < to; i++ {
+			list.Items = append(list.Items, audit.Event{
+				AuditID:                  types.UID(fmt.Sprintf("%d", i)),
+				Verb:                     "get",
+				ObjectRef:                &audit.ObjectReference{Resource: []string{"pods", "secrets"}[i%2]},
+				ResponseStatus:           &metav1.Status{Code: 200},
+				RequestReceivedTimestamp: metav1.NewMicroTime(received),
+			})
+		}
+		return list
+	}
+
+	auditIDs := func(messages []message) []string {
+		ids := make([]string, 0)
+		for _, msg := range messages {
+			for _, e := range msg.entries {
+				ids = append(ids, e.record["auditID"].(string))
+			}
+		}
+		return ids
+	}
+
+	expectTransientErrors := func(err error, n int) {
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(n))
+		for _, e := range partialErr.Errors {
+			Expect(e.Transient).To(BeTrue())
+		}
+	}
+
+	BeforeEach(func() {
+		events = newEvents(0, 3)
+	})
+
+	AfterEach(func() {
+		if srv != nil {
+			srv.close()
+			srv = nil
+		}
+	})
+
+	It("should send the events as acknowledged PackedForward message", func() {
+		srv = newServer().start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Shoot: "shoot--dev--test"})
+		Expect(p.Log(events)).To(Succeed())
+
+		messages := srv.received()
+		Expect(messages).To(HaveLen(1))
+		msg := messages[0]
+		Expect(msg.tag).To(Equal("audit.shoot--dev--test"))
+		Expect(msg.option["size"]).To(Equal(int64(3)))
+		Expect(msg.option["chunk"]).ToNot(BeEmpty())
+		Expect(msg.option).ToNot(HaveKey("compressed"))
+		Expect(auditIDs(messages)).To(Equal([]string{"0", "1", "2"}))
+
+		e := msg.entries[0]
+		Expect(e.time.Equal(received)).To(BeTrue())
+		Expect(e.record["apiVersion"]).To(Equal("audit.k8s.io/v1"))
+		Expect(e.record["kind"]).To(Equal("Event"))
+		Expect(e.record["objectRef"]).To(Equal(map[string]interface{}{"resource": "pods"}))
+		Expect(e.record["responseStatus"]).To(HaveKeyWithValue("code", int64(200)))
+	})
+
+	It("should send one message per rendered tag", func() {
+		srv = newServer().start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Tag: "audit.{{ .Resource }}"})
+		Expect(p.Log(events)).To(Succeed())
+
+		messages := srv.received()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].tag).To(Equal("audit.pods"))
+		Expect(auditIDs(messages[:1])).To(Equal([]string{"0", "2"}))
+		Expect(messages[1].tag).To(Equal("audit.secrets"))
+		Expect(auditIDs(messages[1:])).To(Equal([]string{"1"}))
+	})
+
+	It("should send gzip compressed entries without chunk ids", func() {
+		srv = newServer().start(nil)
+		requireAck := false
+		p := newProvider(&Configuration{Address: srv.addr(), Compression: CompressionGzip, RequireAck: &requireAck})
+		Expect(p.Log(events)).To(Succeed())
+
+		Eventually(srv.received).Should(HaveLen(1))
+		msg := srv.received()[0]
+		Expect(msg.option["compressed"]).To(Equal(compressedGzip))
+		Expect(msg.option).ToNot(HaveKey("chunk"))
+		Expect(auditIDs([]message{msg})).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should reconnect and resend messages that are not acknowledged", func() {
+		srv = newServer()
+		srv.dropFirst = true
+		srv.start(nil)
+		p := newProvider(&Configuration{Address: srv.addr()})
+		Expect(p.Log(events)).To(Succeed())
+
+		messages := srv.received()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[1].option["chunk"]).To(Equal(messages[0].option["chunk"]))
+		Expect(srv.connections()).To(Equal(2))
+	})
+
+	It("should return transient errors if the messages are not acknowledged", func() {
+		srv = newServer()
+		srv.ack = false
+		srv.start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Timeout: &metav1.Duration{Duration: 100 * time.Millisecond}})
+		expectTransientErrors(p.Log(events), 3)
+	})
+
+	It("should reconnect for every message if the server does not keep the connection alive", func() {
+		srv = newServer()
+		srv.sharedKey = "secret"
+		srv.keepalive = false
+		srv.start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Security: &SecurityConfiguration{SharedKey: "secret"}})
+		Expect(p.Log(newEvents(0, 1))).To(Succeed())
+		Expect(p.Log(newEvents(1, 2))).To(Succeed())
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1"}))
+		Expect(srv.connections()).To(Equal(2))
+	})
+
+	It("should authenticate with the shared key and the user credentials", func() {
+		srv = newServer()
+		srv.sharedKey, srv.username, srv.password = "secret", "audit", "password"
+		srv.start(nil)
+		p := newProvider(&Configuration{
+			Address:  srv.addr(),
+			Shoot:    "shoot--dev--test",
+			Security: &SecurityConfiguration{SharedKey: "secret", Username: "audit", Password: "password"},
+		})
+		Expect(p.Log(events)).To(Succeed())
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+		Expect(srv.clientHostnames()).To(Equal([]string{"shoot--dev--test"}))
+	})
+
+	It("should fail if the authentication fails", func() {
+		srv = newServer()
+		srv.sharedKey = "secret"
+		srv.start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Security: &SecurityConfiguration{SharedKey: "wrong", SelfHostname: "proxy"}})
+		err := p.Log(events)
+		expectTransientErrors(err, 3)
+		Expect(err.Error()).To(ContainSubstring("shared key mismatch"))
+		Expect(srv.received()).To(BeEmpty())
+	})
+
+	It("should send messages over tls", func() {
+		cert, key := generateCertificate()
+		keyPair, err := tls.X509KeyPair(cert, key)
+		Expect(err).ToNot(HaveOccurred())
+		srv = newServer().start(&tls.Config{Certificates: []tls.Certificate{keyPair}})
+
+		p := newProvider(&Configuration{Address: srv.addr(), TLS: &TLSConfiguration{CA: string(cert)}})
+		Expect(p.Log(events)).To(Succeed())
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should authenticate with the credentials of the secret", func() {
+		srv = newServer()
+		srv.sharedKey, srv.username, srv.password = "rotated", "audit", "password"
+		srv.start(nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Security: &SecurityConfiguration{SelfHostname: "proxy"}})
+		Expect(p.InjectBackendSecret(map[string][]byte{
+			SecretKeySharedKey: []byte("rotated"),
+			SecretKeyUsername:  []byte("audit"),
+			SecretKeyPassword:  []byte("password"),
+		})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+		Expect(srv.clientHostnames()).To(Equal([]string{"proxy"}))
+
+		rawConfig, err := p.BackendConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(rawConfig)).ToNot(ContainSubstring("rotated"))
+	})
+
+	It("should send messages over tls with the CA of the secret", func() {
+		cert, key := generateCertificate()
+		keyPair, err := tls.X509KeyPair(cert, key)
+		Expect(err).ToNot(HaveOccurred())
+		srv = newServer().start(&tls.Config{Certificates: []tls.Certificate{keyPair}})
+
+		p := newProvider(&Configuration{Address: srv.addr()})
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyCA: cert})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should reject secrets without the shared key of the handshake", func() {
+		p := newProvider(&Configuration{Address: "fluent-bit:24224", Security: &SecurityConfiguration{}})
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("audit")})).ToNot(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeySharedKey: []byte("secret")})).To(Succeed())
+	})
+
+	It("should return transient errors if the server is not reachable", func() {
+		srv = newServer().start(nil)
+		addr := srv.addr()
+		srv.close()
+		srv = nil
+
+		p := newProvider(&Configuration{Address: addr})
+		expectTransientErrors(p.Log(events), 3)
+	})
+
+	Context("msgpack", func() {
+		roundTrip := func(v interface{}) interface{} {
+			b, err := appendJSON(nil, v)
+			Expect(err).ToNot(HaveOccurred())
+			decoded, err := newDecoder(strings.NewReader(string(b))).decode()
+			Expect(err).ToNot(HaveOccurred())
+			return decoded
+		}
+
+		It("should encode and decode integers of all sizes", func() {
+			for _, i := range []int64{0, 127, 128, 255, -1, -32, -33, -128, -129, math.MaxInt16, math.MinInt16 - 1, math.MaxInt32 + 1, math.MinInt64} {
+				Expect(roundTrip(json.Number(fmt.Sprintf("%d", i)))).To(Equal(i))
+			}
+			Expect(roundTrip(json.Number("1.5"))).To(Equal(1.5))
+		})
+
+		It("should encode and decode strings, arrays and maps of all sizes", func() {
+			for _, n := range []int{0, 31, 32, 255, 256, 65536} {
+				s := strings.Repeat("a", n)
+				Expect(roundTrip(s)).To(Equal(s))
+			}
+			array := make([]interface{}, 16)
+			for i := range array {
+				array[i] = true
+			}
+			Expect(roundTrip(array)).To(Equal(array))
+			Expect(roundTrip(map[string]interface{}{"a": nil, "b": []interface{}{"c", false}})).To(Equal(map[string]interface{}{"a": nil, "b": []interface{}{"c", false}}))
+		})
+	})
+
+	Context("configuration", func() {
+		inject := func(config string) error {
+			return (&Provider{}).InjectBackendConfig([]byte(config))
+		}
+
+		It("should default the configuration", func() {
+			p := newProvider(&Configuration{Address: "fluent-bit:24224"})
+			Expect(p.config.Tag).To(Equal("audit.{{ .Shoot }}"))
+			Expect(*p.config.RequireAck).To(BeTrue())
+			Expect(p.config.Compression).To(Equal(CompressionNone))
+			Expect(p.config.Timeout.Duration).To(Equal(30 * time.Second))
+		})
+
+		It("should reject invalid configurations", func() {
+			Expect(inject(`{}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "fluent-bit"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "fluent-bit:24224", "tag": "{{ .Shoot"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "fluent-bit:24224", "compression": "zstd"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "fluent-bit:24224", "tls": {"ca": "invalid"}}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "fluent-bit:24224", "security": {"sharedKey": "secret"}}`)).To(Succeed())
+			// the shared key can be injected from a secret
+			Expect(inject(`{"address": "fluent-bit:24224", "security": {}}`)).To(Succeed())
+		})
+	})
+})
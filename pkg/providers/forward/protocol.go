@@ -0,0 +1,186 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forward
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net"
+	"time"
+)
+
+// The forward protocol is specified at https://github.com/fluent/fluentd/wiki/Forward-Protocol-Specification-v1
+
+const (
+	messageHELO = "HELO"
+	messagePING = "PING"
+	messagePONG = "PONG"
+
+	compressedGzip = "gzip"
+)
+
+// conn is an established forward connection
+type conn struct {
+	net.Conn
+	dec *decoder
+	// keepalive is false if the server closes the connection after every message
+	keepalive bool
+}
+
+// newChunkID returns a random base64 encoded 128 bit id of a message that is acknowledged by the server
+func newChunkID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(id), nil
+}
+
+// encodeRecord converts the JSON encoded event to a msgpack map
+func encodeRecord(event []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(event))
+	dec.UseNumber()
+	var record map[string]interface{}
+	if err := dec.Decode(&record); err != nil {
+		return nil, err
+	}
+	return appendJSON(nil, record)
+}
+
+// appendEntry appends the [time, record] entry of a PackedForward message
+func appendEntry(b []byte, t time.Time, record []byte) []byte {
+	b = appendArrayHeader(b, 2)
+	b = appendEventTime(b, t)
+	return append(b, record...)
+}
+
+// encodePackedForward encodes the [tag, entries, option] message of the PackedForward or CompressedPackedForward mode
+func encodePackedForward(tag string, entries []byte, size int, chunk string, compressed bool) []byte {
+	b := appendArrayHeader(nil, 3)
+	b = appendString(b, tag)
+	b = appendBinary(b, entries)
+
+	options := 1
+	if chunk != "" {
+		options++
+	}
+	if compressed {
+		options++
+	}
+	b = appendMapHeader(b, options)
+	b = appendString(b, "size")
+	b = appendInt(b, int64(size))
+	if chunk != "" {
+		b = appendString(b, "chunk")
+		b = appendString(b, chunk)
+	}
+	if compressed {
+		b = appendString(b, "compressed")
+		b = appendString(b, compressedGzip)
+	}
+	return b
+}
+
+// readAck waits for the acknowledgement of the chunk
+func (c *conn) readAck(chunk string) error {
+	v, err := c.dec.decode()
+	if err != nil {
+		return errors.Wrap(err, "unable to read acknowledgement")
+	}
+	response, ok := v.(map[string]interface{})
+	if !ok {
+		return errors.Errorf("invalid acknowledgement of type %T", v)
+	}
+	if ack := string(bytesOf(response["ack"])); ack != chunk {
+		return errors.Errorf("acknowledgement %q does not match chunk %q", ack, chunk)
+	}
+	return nil
+}
+
+// handshake authenticates the client and the server with the shared key and the user credentials
+func (c *conn) handshake(security *SecurityConfiguration) error {
+	helo, err := c.readMessage(messageHELO, 2)
+	if err != nil {
+		return err
+	}
+	options, ok := helo[1].(map[string]interface{})
+	if !ok {
+		return errors.New("invalid HELO message without options")
+	}
+	nonce, authSalt := bytesOf(options["nonce"]), bytesOf(options["auth"])
+	if keepalive, ok := options["keepalive"].(bool); ok {
+		c.keepalive = keepalive
+	}
+
+	sharedKeySalt := make([]byte, 16)
+	if _, err := rand.Read(sharedKeySalt); err != nil {
+		return err
+	}
+	var username, passwordDigest string
+	if len(authSalt) != 0 {
+		username = security.Username
+		passwordDigest = digest(authSalt, []byte(security.Username), []byte(security.Password))
+	}
+	ping := appendArrayHeader(nil, 6)
+	ping = appendString(ping, messagePING)
+	ping = appendString(ping, security.SelfHostname)
+	ping = appendBinary(ping, sharedKeySalt)
+	ping = appendString(ping, digest(sharedKeySalt, []byte(security.SelfHostname), nonce, []byte(security.SharedKey)))
+	ping = appendString(ping, username)
+	ping = appendString(ping, passwordDigest)
+	if _, err := c.Write(ping); err != nil {
+		return errors.Wrap(err, "unable to send PING message")
+	}
+
+	pong, err := c.readMessage(messagePONG, 5)
+	if err != nil {
+		return err
+	}
+	if authenticated, _ := pong[1].(bool); !authenticated {
+		return errors.Errorf("authentication failed: %s", bytesOf(pong[2]))
+	}
+	serverHostname := bytesOf(pong[3])
+	if string(bytesOf(pong[4])) != digest(sharedKeySalt, serverHostname, nonce, []byte(security.SharedKey)) {
+		return errors.New("authentication of the server failed: shared key mismatch")
+	}
+	return nil
+}
+
+// readMessage reads a handshake message of the given type with at least the given number of elements
+func (c *conn) readMessage(typ string, elements int) ([]interface{}, error) {
+	v, err := c.dec.decode()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read %s message", typ)
+	}
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) < elements || string(bytesOf(msg[0])) != typ {
+		return nil, errors.Errorf("invalid %s message", typ)
+	}
+	return msg, nil
+}
+
+// digest returns the hex encoded sha512 digest of the concatenated values
+func digest(values ...[]byte) string {
+	h := sha512.New()
+	for _, v := range values {
+		h.Write(v)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
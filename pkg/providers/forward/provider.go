@@ -0,0 +1,531 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// CompressionNone sends the entries in the PackedForward mode
+	CompressionNone = "none"
+	// CompressionGzip sends the entries in the CompressedPackedForward mode
+	CompressionGzip = "gzip"
+
+	defaultTag          = "audit.{{ .Shoot }}"
+	defaultSelfHostname = "auditlog-proxy"
+	defaultTimeout      = 30 * time.Second
+	// connectedCheckTimeout is the time to wait for the closing of a connection before it is used
+	connectedCheckTimeout = time.Millisecond
+)
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	SecretKeySharedKey = "sharedKey"
+	SecretKeyUsername  = "username"
+	SecretKeyPassword  = "password"
+	SecretKeyCA        = "ca.crt"
+	SecretKeyCert      = "tls.crt"
+	SecretKeyKey       = "tls.key"
+)
+
+// Provider sends the events with the forward protocol of Fluentd and Fluent Bit
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+
+	tag *template.Template
+
+	// mux serializes the messages and acknowledgements on the connection
+	// and protects the credentials that are replaced whenever the mounted secret changes
+	mux       sync.Mutex
+	conn      *conn
+	tlsConfig *tls.Config
+	security  *SecurityConfiguration
+}
+
+// Configuration is the configuration of the forward provider
+type Configuration struct {
+	// Address is the host and port of the forward input, e.g. fluent-bit.garden:24224
+	Address string `json:"address"`
+	// Tag is a template of the tag of an event, defaults to audit.{{ .Shoot }}
+	Tag string `json:"tag,omitempty"`
+	// Shoot is the technical id of the shoot that can be used in the tag template.
+	// It is set by the extension controller.
+	Shoot string `json:"shoot,omitempty"`
+	// RequireAck waits for the acknowledgement of every message by the server, defaults to true
+	RequireAck *bool `json:"requireAck,omitempty"`
+	// Compression is either none or gzip, defaults to none
+	Compression string `json:"compression,omitempty"`
+	// Timeout of the connection, the writes and the acknowledgements, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// TLS enables tls for the connection
+	// +optional
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+	// Security enables the shared key handshake
+	// +optional
+	Security *SecurityConfiguration `json:"security,omitempty"`
+}
+
+// TLSConfiguration contains the PEM encoded certificates of the tls connection
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificate of the server
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// SecurityConfiguration contains the shared key and the optional user credentials of the handshake
+type SecurityConfiguration struct {
+	SharedKey string `json:"sharedKey"`
+	// SelfHostname is the hostname the client authenticates with, defaults to the shoot
+	SelfHostname string `json:"selfHostname,omitempty"`
+	// Username and Password are required if the server enables the user authentication
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// TemplateData are the fields of an event that can be used in the tag template
+type TemplateData struct {
+	Shoot     string
+	Namespace string
+	APIGroup  string
+	Resource  string
+	Name      string
+	Verb      string
+	User      string
+	Level     string
+	Stage     string
+}
+
+var _ provider.Interface = &Provider{}
+
+// New returns a new forward provider
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "forward"
+}
+
+// InjectBackendConfig injects the backend configuration
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return errors.Wrapf(err, "invalid address %q", config.Address)
+	}
+	tag, err := template.New("tag").Option("missingkey=error").Parse(config.Tag)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse tag template")
+	}
+	switch config.Compression {
+	case CompressionNone, CompressionGzip:
+	default:
+		return errors.Errorf("unsupported compression %q, must be one of %s or %s", config.Compression, CompressionNone, CompressionGzip)
+	}
+	// the shared key might still be injected from a secret
+	tlsConfig, err := tlsConfigFor(config.TLS)
+	if err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeConn()
+	p.tag = tag
+	p.tlsConfig, p.security = tlsConfig, config.Security
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the credentials of the handshake and the certificates of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes, the next message is sent on a new connection.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	config := withSecret(p.config, data)
+	if config.Security != nil && config.Security.SharedKey == "" {
+		return errors.Errorf("the secret has to contain the %s", SecretKeySharedKey)
+	}
+	tlsConfig, err := tlsConfigFor(config.TLS)
+	if err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeConn()
+	p.tlsConfig, p.security = tlsConfig, config.Security
+	return nil
+}
+
+// ValidateBackendConfig validates the address of the forward input and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	allErrs = append(allErrs, provider.ValidateAddress(config.Address, fldPath.Child("address"))...)
+	if config.Security != nil && config.Security.SharedKey == "" && secretRef == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("security", "sharedKey"), "A shared key or a backendProviderSecretRef has to be defined"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+// InjectLogger injects the logger
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Reconcile sets the shoot of the configuration to the namespace of the extension
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Shoot == "" {
+		p.config.Shoot = ex.GetNamespace()
+	}
+	return nil
+}
+
+// Delete is a noop
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the configuration including the shoot
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log sends the events of every tag as one PackedForward message.
+// A broken connection is reestablished once, messages that cannot be sent or are not acknowledged afterwards
+// are returned as transient errors.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+
+	var (
+		partialErr = &provider.PartialError{}
+		entries    = make(map[string][]byte)
+		indices    = make(map[string][]int)
+		tags       = make([]string, 0)
+	)
+	for i := range events.Items {
+		tag, entry, err := p.newEntry(&events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err})
+			continue
+		}
+		if _, ok := entries[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		entries[tag] = append(entries[tag], entry...)
+		indices[tag] = append(indices[tag], i)
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.conn != nil && !p.connected() {
+		p.log.V(1).Info("Connection closed by forward server, reconnecting")
+		p.closeConn()
+	}
+
+	reconnected := false
+	for _, tag := range tags {
+		msg, chunk, err := p.newMessage(tag, entries[tag], len(indices[tag]))
+		if err == nil {
+			err = p.send(msg, chunk)
+			if err != nil && !reconnected {
+				p.log.V(1).Info("Reconnecting to forward server", "reason", err.Error())
+				reconnected = true
+				err = p.send(msg, chunk)
+			}
+		}
+		if err != nil {
+			for _, i := range indices[tag] {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err, Transient: true})
+			}
+		}
+	}
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	return nil
+}
+
+// newEntry renders the tag and the [time, record] entry of the event
+func (p *Provider) newEntry(event *audit.Event) (string, []byte, error) {
+	data, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to marshal event")
+	}
+	record, err := encodeRecord(data)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to encode record")
+	}
+
+	templateData := &TemplateData{
+		Shoot: p.config.Shoot,
+		Verb:  event.Verb,
+		User:  event.User.Username,
+		Level: string(event.Level),
+		Stage: string(event.Stage),
+	}
+	if ref := event.ObjectRef; ref != nil {
+		templateData.Namespace, templateData.APIGroup, templateData.Resource, templateData.Name = ref.Namespace, ref.APIGroup, ref.Resource, ref.Name
+	}
+	var tag bytes.Buffer
+	if err := p.tag.Execute(&tag, templateData); err != nil {
+		return "", nil, errors.Wrap(err, "unable to render tag")
+	}
+	if tag.Len() == 0 {
+		return "", nil, errors.New("rendered tag is empty")
+	}
+
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return tag.String(), appendEntry(nil, ts, record), nil
+}
+
+// newMessage encodes the entries as PackedForward message with a chunk id if acknowledgements are required
+func (p *Provider) newMessage(tag string, entries []byte, size int) ([]byte, string, error) {
+	var chunk string
+	if *p.config.RequireAck {
+		var err error
+		if chunk, err = newChunkID(); err != nil {
+			return nil, "", errors.Wrap(err, "unable to generate chunk id")
+		}
+	}
+	compressed := p.config.Compression == CompressionGzip
+	if compressed {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(entries); err != nil {
+			return nil, "", errors.Wrap(err, "unable to compress entries")
+		}
+		if err := w.Close(); err != nil {
+			return nil, "", errors.Wrap(err, "unable to compress entries")
+		}
+		entries = buf.Bytes()
+	}
+	return encodePackedForward(tag, entries, size, chunk, compressed), chunk, nil
+}
+
+// send writes the message and waits for its acknowledgement.
+// The connection is closed if it fails, so that the next message reconnects.
+func (p *Provider) send(msg []byte, chunk string) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	if err := p.conn.SetDeadline(time.Now().Add(p.config.Timeout.Duration)); err != nil {
+		p.closeConn()
+		return err
+	}
+	if _, err := p.conn.Write(msg); err != nil {
+		p.closeConn()
+		return errors.Wrap(err, "unable to write message")
+	}
+	if chunk != "" {
+		if err := p.conn.readAck(chunk); err != nil {
+			p.closeConn()
+			return err
+		}
+	}
+	if !p.conn.keepalive {
+		p.closeConn()
+		return nil
+	}
+	_ = p.conn.SetDeadline(time.Time{})
+	return nil
+}
+
+func (p *Provider) connect() error {
+	netConn, err := net.DialTimeout("tcp", p.config.Address, p.config.Timeout.Duration)
+	if err != nil {
+		return errors.Wrapf(err, "unable to connect to %s", p.config.Address)
+	}
+	_ = netConn.SetDeadline(time.Now().Add(p.config.Timeout.Duration))
+	if p.tlsConfig != nil {
+		tlsConfig := p.tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(p.config.Address)
+		}
+		tlsConn := tls.Client(netConn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			_ = netConn.Close()
+			return errors.Wrapf(err, "unable to establish tls connection to %s", p.config.Address)
+		}
+		netConn = tlsConn
+	}
+
+	c := &conn{Conn: netConn, dec: newDecoder(netConn), keepalive: true}
+	if security := p.security; security != nil {
+		s := *security
+		if s.SelfHostname == "" {
+			s.SelfHostname = p.config.Shoot
+		}
+		if s.SelfHostname == "" {
+			s.SelfHostname = defaultSelfHostname
+		}
+		if err := c.handshake(&s); err != nil {
+			_ = netConn.Close()
+			return errors.Wrapf(err, "handshake with %s failed", p.config.Address)
+		}
+	}
+	_ = netConn.SetDeadline(time.Time{})
+	p.conn = c
+	return nil
+}
+
+// connected checks that the server did not close the connection.
+// Otherwise the first message written to a closed connection would be lost silently if no acknowledgements are required.
+// Servers only send acknowledgements, so a read either times out or returns the closing of the connection.
+func (p *Provider) connected() bool {
+	if err := p.conn.SetReadDeadline(time.Now().Add(connectedCheckTimeout)); err != nil {
+		return false
+	}
+	var buf [1]byte
+	_, err := p.conn.Read(buf[:])
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		_ = p.conn.SetReadDeadline(time.Time{})
+		return true
+	}
+	return false
+}
+
+func (p *Provider) closeConn() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func setDefaults(config *Configuration) {
+	if config.Tag == "" {
+		config.Tag = defaultTag
+	}
+	if config.RequireAck == nil {
+		requireAck := true
+		config.RequireAck = &requireAck
+	}
+	if config.Compression == "" {
+		config.Compression = CompressionNone
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+// withSecret returns a copy of the configuration with the credentials and certificates of the secret.
+// The shared key of the secret enables the handshake and the certificates of the secret enable tls.
+func withSecret(config *Configuration, data map[string][]byte) *Configuration {
+	c := *config
+	if c.TLS != nil {
+		tlsConfig := *c.TLS
+		c.TLS = &tlsConfig
+	}
+	if c.Security != nil {
+		security := *c.Security
+		c.Security = &security
+	}
+
+	if sharedKey, ok := data[SecretKeySharedKey]; ok {
+		if c.Security == nil {
+			c.Security = &SecurityConfiguration{}
+		}
+		c.Security.SharedKey = string(sharedKey)
+	}
+	if username, ok := data[SecretKeyUsername]; ok && c.Security != nil {
+		c.Security.Username, c.Security.Password = string(username), string(data[SecretKeyPassword])
+	}
+	_, hasCA := data[SecretKeyCA]
+	_, hasCert := data[SecretKeyCert]
+	if (hasCA || hasCert) && c.TLS == nil {
+		c.TLS = &TLSConfiguration{}
+	}
+	if hasCA {
+		c.TLS.CA = string(data[SecretKeyCA])
+	}
+	if hasCert {
+		c.TLS.Cert, c.TLS.Key = string(data[SecretKeyCert]), string(data[SecretKeyKey])
+	}
+	return &c
+}
+
+// tlsConfigFor returns the client tls configuration or nil if tls is not enabled
+func tlsConfigFor(config *TLSConfiguration) (*tls.Config, error) {
+	if config == nil {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{ServerName: config.ServerName, InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CA != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, errors.New("unable to parse CA bundle")
+		}
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(config.Cert), []byte(config.Key))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
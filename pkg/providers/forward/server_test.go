@@ -0,0 +1,230 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package forward
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+const serverHostname = "fluent-bit"
+
+// entry is a received [time, record] entry
+type entry struct {
+	time   time.Time
+	record map[string]interface{}
+}
+
+// message is a received PackedForward message
+type message struct {
+	tag     string
+	entries []entry
+	option  map[string]interface{}
+}
+
+// server is a forward server that receives PackedForward messages
+type server struct {
+	listener net.Listener
+	// sharedKey enables the handshake, username and password enable the user authentication
+	sharedKey string
+	username  string
+	password  string
+	// keepalive is announced in the HELO message
+	keepalive bool
+	// ack acknowledges the messages with chunk ids
+	ack bool
+	// dropFirst closes the first connection after its first message without acknowledging it
+	dropFirst bool
+
+	mux       sync.Mutex
+	messages  []message
+	conns     int
+	hostnames []string
+}
+
+func newServer() *server {
+	return &server{keepalive: true, ack: true}
+}
+
+// start listens for connections, the server must not be configured afterwards
+func (s *server) start(tlsConfig *tls.Config) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *server) addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *server) connections() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conns
+}
+
+func (s *server) clientHostnames() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string{}, s.hostnames...)
+}
+
+func (s *server) close() {
+	_ = s.listener.Close()
+}
+
+func (s *server) received() []message {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]message{}, s.messages...)
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	s.mux.Lock()
+	s.conns++
+	drop := s.dropFirst && s.conns == 1
+	s.mux.Unlock()
+
+	dec := newDecoder(conn)
+	if s.sharedKey != "" && !s.handshake(conn, dec) {
+		return
+	}
+	for {
+		v, err := dec.decode()
+		if err != nil {
+			return
+		}
+		msg := parseMessage(v)
+		s.mux.Lock()
+		s.messages = append(s.messages, msg)
+		s.mux.Unlock()
+		if drop {
+			return
+		}
+		if chunk, ok := msg.option["chunk"]; ok && s.ack {
+			response := appendMapHeader(nil, 1)
+			response = appendString(response, "ack")
+			response = appendString(response, chunk.(string))
+			if _, err := conn.Write(response); err != nil {
+				return
+			}
+		}
+		if !s.keepalive {
+			return
+		}
+	}
+}
+
+// handshake sends the HELO message, verifies the PING message and responds with the PONG message
+func (s *server) handshake(conn net.Conn, dec *decoder) bool {
+	nonce, authSalt := make([]byte, 16), make([]byte, 0)
+	_, _ = rand.Read(nonce)
+	if s.username != "" {
+		authSalt = make([]byte, 16)
+		_, _ = rand.Read(authSalt)
+	}
+	helo := appendArrayHeader(nil, 2)
+	helo = appendString(helo, messageHELO)
+	helo = appendMapHeader(helo, 3)
+	helo = appendString(helo, "nonce")
+	helo = appendBinary(helo, nonce)
+	helo = appendString(helo, "auth")
+	helo = appendBinary(helo, authSalt)
+	helo = appendString(helo, "keepalive")
+	helo = appendBool(helo, s.keepalive)
+	if _, err := conn.Write(helo); err != nil {
+		return false
+	}
+
+	v, err := dec.decode()
+	if err != nil {
+		return false
+	}
+	ping := v.([]interface{})
+	hostname, sharedKeySalt := bytesOf(ping[1]), bytesOf(ping[2])
+	s.mux.Lock()
+	s.hostnames = append(s.hostnames, string(hostname))
+	s.mux.Unlock()
+
+	authenticated, reason := true, ""
+	if string(bytesOf(ping[3])) != digest(sharedKeySalt, hostname, nonce, []byte(s.sharedKey)) {
+		authenticated, reason = false, "shared key mismatch"
+	} else if s.username != "" && (string(bytesOf(ping[4])) != s.username || string(bytesOf(ping[5])) != digest(authSalt, []byte(s.username), []byte(s.password))) {
+		authenticated, reason = false, "username/password mismatch"
+	}
+	pong := appendArrayHeader(nil, 5)
+	pong = appendString(pong, messagePONG)
+	pong = appendBool(pong, authenticated)
+	pong = appendString(pong, reason)
+	pong = appendString(pong, serverHostname)
+	pong = appendString(pong, digest(sharedKeySalt, []byte(serverHostname), nonce, []byte(s.sharedKey)))
+	if _, err := conn.Write(pong); err != nil {
+		return false
+	}
+	return authenticated
+}
+
+func parseMessage(v interface{}) message {
+	array := v.([]interface{})
+	Expect(array).To(HaveLen(3))
+	msg := message{tag: array[0].(string), option: array[2].(map[string]interface{})}
+
+	entries := array[1].([]byte)
+	if msg.option["compressed"] == compressedGzip {
+		r, err := gzip.NewReader(bytes.NewReader(entries))
+		Expect(err).ToNot(HaveOccurred())
+		entries, err = ioutil.ReadAll(r)
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	dec := newDecoder(bytes.NewReader(entries))
+	for {
+		v, err := dec.decode()
+		if err == io.EOF {
+			return msg
+		}
+		Expect(err).ToNot(HaveOccurred())
+		e := v.([]interface{})
+		ext := e[0].(extension)
+		Expect(ext.typ).To(Equal(int8(eventTimeExtType)))
+		Expect(ext.data).To(HaveLen(8))
+		t := time.Unix(int64(binary.BigEndian.Uint32(ext.data[:4])), int64(binary.BigEndian.Uint32(ext.data[4:])))
+		msg.entries = append(msg.entries, entry{time: t, record: e[1].(map[string]interface{})})
+	}
+}
@@ -0,0 +1,557 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	"github.com/Shopify/sarama"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/xdg/scram"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// recordingProducer records the messages that were written by a producer in the partitions selected by the producer
+type recordingProducer struct {
+	sarama.SyncProducer
+
+	mux     sync.Mutex
+	written map[topicPartition][]*sarama.ProducerMessage
+}
+
+func (r *recordingProducer) SendMessages(messages []*sarama.ProducerMessage) error {
+	err := r.SyncProducer.SendMessages(messages)
+	failed := make(map[*sarama.ProducerMessage]bool)
+	if producerErrs, ok := err.(sarama.ProducerErrors); ok {
+		for _, e := range producerErrs {
+			failed[e.Msg] = true
+		}
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, m := range messages {
+		if !failed[m] {
+			tp := topicPartition{topic: m.Topic, partition: m.Partition}
+			r.written[tp] = append(r.written[tp], m)
+		}
+	}
+	return err
+}
+
+// generateCertificate returns a self-signed PEM encoded certificate and key for 127.0.0.1
+// that can be used by servers and clients
+func generateCertificate() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kafka"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		broker   *sarama.MockBroker
+		metadata *sarama.MockMetadataResponse
+		recorder *recordingProducer
+		events   *audit.EventList
+		p        *Provider
+	)
+
+	newProvider := func(config *Configuration) *Provider {
+		rawConfig, err := json.Marshal(config)
+		Expect(err).ToNot(HaveOccurred())
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig(rawConfig)).To(Succeed())
+		return p
+	}
+
+	// newBroker starts a mock broker that is the leader of five partitions of the used topics
+	newBroker := func(listener net.Listener) *sarama.MockBroker {
+		b := sarama.NewMockBrokerListener(GinkgoT(), 1, listener)
+		metadata = sarama.NewMockMetadataResponse(GinkgoT()).SetBroker(b.Addr(), b.BrokerID())
+		for _, topic := range []string{"auditlog", "audit-pods", "audit-secrets"} {
+			for partition := int32(0); partition < 5; partition++ {
+				metadata.SetLeader(topic, partition, b.BrokerID())
+			}
+		}
+		return b
+	}
+
+	// handle sets the responses of the broker in addition to the metadata and producer id responses
+	handle := func(responses map[string]sarama.MockResponse) {
+		handlers := map[string]sarama.MockResponse{
+			"MetadataRequest":       metadata,
+			"InitProducerIDRequest": sarama.NewMockWrapper(&sarama.InitProducerIDResponse{ProducerID: 1000}),
+			"ProduceRequest":        sarama.NewMockProduceResponse(GinkgoT()).SetVersion(3),
+		}
+		for k, v := range responses {
+			handlers[k] = v
+		}
+		broker.SetHandlerByMap(handlers)
+	}
+
+	// produceResponse returns a produce response that fails with the given error for all partitions of the auditlog topic
+	produceResponse := func(err sarama.KError) *sarama.MockProduceResponse {
+		res := sarama.NewMockProduceResponse(GinkgoT()).SetVersion(3)
+		for partition := int32(0); partition < 5; partition++ {
+			res.SetError("auditlog", partition, err)
+		}
+		return res
+	}
+
+	// requests returns the number of received requests of the given type
+	requests := func(request interface{}) int {
+		count := 0
+		for _, rr := range broker.History() {
+			if reflect.TypeOf(rr.Request) == reflect.TypeOf(request) {
+				count++
+			}
+		}
+		return count
+	}
+
+	// written returns the written messages of all partitions
+	written := func() map[topicPartition][]*sarama.ProducerMessage {
+		recorder.mux.Lock()
+		defer recorder.mux.Unlock()
+		return recorder.written
+	}
+
+	// auditIDs returns the audit ids of the written messages of a partition
+	auditIDs := func(messages []*sarama.ProducerMessage) []string {
+		ids := make([]string, 0, len(messages))
+		for _, m := range messages {
+			value, err := m.Value.Encode()
+			Expect(err).ToNot(HaveOccurred())
+			event := &auditv1.Event{}
+			Expect(json.Unmarshal(value, event)).To(Succeed())
+			ids = append(ids, string(event.AuditID))
+		}
+		return ids
+	}
+
+	total := func() int {
+		count := 0
+		for _, messages := range written() {
+			count += len(messages)
+		}
+		return count
+	}
+
+	BeforeEach(func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		broker = newBroker(listener)
+		handle(nil)
+
+		recorder = &recordingProducer{written: make(map[topicPartition][]*sarama.ProducerMessage)}
+		newSyncProducer = func(addrs []string, config *sarama.Config) (sarama.SyncProducer, error) {
+			producer, err := sarama.NewSyncProducer(addrs, config)
+			if err != nil {
+				return nil, err
+			}
+			recorder.SyncProducer = producer
+			return recorder, nil
+		}
+
+		events = &audit.EventList{}
+		for i := 0; i < 4; i++ {
+			resource := "pods"
+			if i%2 == 1 {
+				resource = "secrets"
+			}
+			events.Items = append(events.Items, audit.Event{
+				AuditID:                  types.UID(fmt.Sprintf("%d", i)),
+				Verb:                     "get",
+				ObjectRef:                &audit.ObjectReference{Resource: resource, Namespace: "default"},
+				RequestReceivedTimestamp: metav1.NewMicroTime(time.Unix(1600000000, 0)),
+			})
+		}
+	})
+
+	AfterEach(func() {
+		if p != nil {
+			p.closeProducer()
+			p = nil
+		}
+		newSyncProducer = sarama.NewSyncProducer
+		broker.Close()
+	})
+
+	It("should write the events to the partitions of their keys", func() {
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Shoot: "shoot--dev--test"})
+		Expect(p.Log(events)).To(Succeed())
+		Expect(requests(&sarama.ProduceRequest{})).To(BeNumerically(">=", 1))
+
+		podsKey := []byte("shoot--dev--test//pods")
+		secretsKey := []byte("shoot--dev--test//secrets")
+		pods := topicPartition{topic: "auditlog", partition: (murmur2(podsKey) & 0x7fffffff) % 5}
+		secrets := topicPartition{topic: "auditlog", partition: (murmur2(secretsKey) & 0x7fffffff) % 5}
+		Expect(pods).ToNot(Equal(secrets))
+		Expect(written()).To(HaveLen(2))
+		Expect(auditIDs(written()[pods])).To(Equal([]string{"0", "2"}))
+		Expect(auditIDs(written()[secrets])).To(Equal([]string{"1", "3"}))
+		Expect(written()[pods][0].Key).To(Equal(sarama.ByteEncoder(podsKey)))
+
+		// the written messages carry the timestamps of the produce responses
+		m, err := p.newMessage(0, &events.Items[0])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m.Timestamp.Equal(time.Unix(1600000000, 0))).To(BeTrue())
+	})
+
+	It("should render the topics and distribute messages without key over all partitions", func() {
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Topic: "audit-{{ .Resource }}", Key: "{{ .Name }}"})
+		Expect(p.Log(events)).To(Succeed())
+
+		var pods, secrets []string
+		for tp, messages := range written() {
+			Expect(messages).To(HaveLen(1))
+			Expect(messages[0].Key).To(BeNil())
+			switch tp.topic {
+			case "audit-pods":
+				pods = append(pods, auditIDs(messages)...)
+			case "audit-secrets":
+				secrets = append(secrets, auditIDs(messages)...)
+			default:
+				Fail("unexpected topic " + tp.topic)
+			}
+		}
+		Expect(pods).To(ConsistOf("0", "2"))
+		Expect(secrets).To(ConsistOf("1", "3"))
+	})
+
+	It("should compress the record batches with gzip", func() {
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Compression: CompressionGzip})
+		Expect(p.saramaConfig.Producer.Compression).To(Equal(sarama.CompressionGZIP))
+		Expect(p.Log(events)).To(Succeed())
+		Expect(total()).To(Equal(4))
+	})
+
+	It("should retry record batches that failed with a retriable error", func() {
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}})
+		handle(map[string]sarama.MockResponse{
+			"ProduceRequest": sarama.NewMockSequence(produceResponse(sarama.ErrNotLeaderForPartition), sarama.NewMockProduceResponse(GinkgoT()).SetVersion(3)),
+		})
+		Expect(p.Log(events)).To(Succeed())
+		Expect(requests(&sarama.ProduceRequest{})).To(BeNumerically(">=", 2))
+		Expect(total()).To(Equal(4))
+	})
+
+	It("should return transient errors if the retries are exhausted", func() {
+		retries := 1
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Retries: &retries})
+		handle(map[string]sarama.MockResponse{"ProduceRequest": produceResponse(sarama.ErrNotEnoughReplicas)})
+
+		err := p.Log(events)
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(4))
+		for _, e := range partialErr.Errors {
+			Expect(e.Transient).To(BeTrue())
+		}
+		Expect(total()).To(BeZero())
+	})
+
+	It("should not retry record batches that failed with a permanent error", func() {
+		p = newProvider(&Configuration{Brokers: []string{broker.Addr()}})
+		handle(map[string]sarama.MockResponse{"ProduceRequest": produceResponse(sarama.ErrMessageSizeTooLarge)})
+
+		err := p.Log(events)
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(4))
+		indices := make([]int, 0, len(partialErr.Errors))
+		for _, e := range partialErr.Errors {
+			Expect(e.Transient).To(BeFalse())
+			indices = append(indices, e.Index)
+		}
+		Expect(indices).To(ConsistOf(0, 1, 2, 3))
+		Expect(requests(&sarama.ProduceRequest{})).To(BeNumerically("<=", 2))
+	})
+
+	It("should return transient errors if no broker is reachable", func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(listener.Close()).To(Succeed())
+		retries := 0
+		p = newProvider(&Configuration{Brokers: []string{listener.Addr().String()}, Retries: &retries})
+
+		err = p.Log(events)
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(4))
+		Expect(partialErr.Errors[0].Transient).To(BeTrue())
+	})
+
+	Context("idempotent", func() {
+		It("should initialize the producer id once", func() {
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Idempotent: true})
+			Expect(p.Log(events)).To(Succeed())
+			Expect(p.Log(events)).To(Succeed())
+			Expect(total()).To(Equal(8))
+			Expect(requests(&sarama.InitProducerIDRequest{})).To(Equal(1))
+		})
+
+		It("should request a new producer id after a failed record batch", func() {
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Idempotent: true})
+			handle(map[string]sarama.MockResponse{"ProduceRequest": produceResponse(sarama.ErrMessageSizeTooLarge)})
+			Expect(p.Log(events)).ToNot(Succeed())
+
+			handle(nil)
+			Expect(p.Log(events)).To(Succeed())
+			Expect(requests(&sarama.InitProducerIDRequest{})).To(Equal(2))
+		})
+	})
+
+	Context("authentication", func() {
+		sasl := func(err sarama.KError) map[string]sarama.MockResponse {
+			return map[string]sarama.MockResponse{
+				"SaslHandshakeRequest":    sarama.NewMockSaslHandshakeResponse(GinkgoT()).SetEnabledMechanisms([]string{SASLMechanismPlain}),
+				"SaslAuthenticateRequest": sarama.NewMockSaslAuthenticateResponse(GinkgoT()).SetError(err),
+			}
+		}
+
+		It("should authenticate with "+SASLMechanismPlain, func() {
+			handle(sasl(sarama.ErrNoError))
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, SASL: &SASLConfiguration{Mechanism: SASLMechanismPlain, Username: "auditlog", Password: "secret"}})
+			Expect(p.Log(events)).To(Succeed())
+			Expect(written()).To(HaveLen(2))
+
+			var authBytes [][]byte
+			for _, rr := range broker.History() {
+				if req, ok := rr.Request.(*sarama.SaslAuthenticateRequest); ok {
+					authBytes = append(authBytes, req.SaslAuthBytes)
+				}
+			}
+			Expect(authBytes).ToNot(BeEmpty())
+			Expect(string(authBytes[0])).To(Equal("\x00auditlog\x00secret"))
+		})
+
+		It("should fail to authenticate with "+SASLMechanismPlain+" if the broker rejects the credentials", func() {
+			retries := 0
+			handle(sasl(sarama.ErrSASLAuthenticationFailed))
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, Retries: &retries, SASL: &SASLConfiguration{Mechanism: SASLMechanismPlain, Username: "auditlog", Password: "wrong"}})
+			Expect(p.Log(events)).ToNot(Succeed())
+			Expect(requests(&sarama.ProduceRequest{})).To(BeZero())
+		})
+
+		It("should connect with mutual tls", func() {
+			cert, key := generateCertificate()
+			keyPair, err := tls.X509KeyPair(cert, key)
+			Expect(err).ToNot(HaveOccurred())
+			pool := x509.NewCertPool()
+			Expect(pool.AppendCertsFromPEM(cert)).To(BeTrue())
+
+			broker.Close()
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{keyPair}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert})
+			Expect(err).ToNot(HaveOccurred())
+			broker = newBroker(listener)
+			handle(nil)
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, TLS: &TLSConfiguration{CA: string(cert), Cert: string(cert), Key: string(key)}})
+			Expect(p.Log(events)).To(Succeed())
+			Expect(written()).To(HaveLen(2))
+		})
+
+		It("should authenticate with the credentials of the secret", func() {
+			handle(sasl(sarama.ErrNoError))
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, SASL: &SASLConfiguration{Mechanism: SASLMechanismPlain}})
+			Expect(p.InjectBackendSecret(map[string][]byte{
+				SecretKeyUsername: []byte("auditlog"),
+				SecretKeyPassword: []byte("rotated"),
+			})).To(Succeed())
+			Expect(p.Log(events)).To(Succeed())
+
+			var authBytes [][]byte
+			for _, rr := range broker.History() {
+				if req, ok := rr.Request.(*sarama.SaslAuthenticateRequest); ok {
+					authBytes = append(authBytes, req.SaslAuthBytes)
+				}
+			}
+			Expect(authBytes).ToNot(BeEmpty())
+			Expect(string(authBytes[0])).To(Equal("\x00auditlog\x00rotated"))
+
+			rawConfig, err := p.BackendConfig()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(rawConfig)).ToNot(ContainSubstring("rotated"))
+		})
+
+		It("should connect with the certificates of the secret", func() {
+			cert, key := generateCertificate()
+			keyPair, err := tls.X509KeyPair(cert, key)
+			Expect(err).ToNot(HaveOccurred())
+			pool := x509.NewCertPool()
+			Expect(pool.AppendCertsFromPEM(cert)).To(BeTrue())
+
+			broker.Close()
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{keyPair}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert})
+			Expect(err).ToNot(HaveOccurred())
+			broker = newBroker(listener)
+			handle(nil)
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}})
+			Expect(p.InjectBackendSecret(map[string][]byte{
+				SecretKeyCA:   cert,
+				SecretKeyCert: cert,
+				SecretKeyKey:  key,
+			})).To(Succeed())
+			Expect(p.Log(events)).To(Succeed())
+			Expect(written()).To(HaveLen(2))
+		})
+
+		It("should reject secrets without the credentials of the SASL mechanism", func() {
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}, SASL: &SASLConfiguration{Mechanism: SASLMechanismPlain}})
+			Expect(p.InjectBackendSecret(map[string][]byte{})).ToNot(Succeed())
+			Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("auditlog")})).ToNot(Succeed())
+
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}})
+			Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("auditlog"), SecretKeyPassword: []byte("secret")})).ToNot(Succeed())
+		})
+	})
+
+	Context("configuration", func() {
+		inject := func(config string) error {
+			return (&Provider{}).InjectBackendConfig([]byte(config))
+		}
+
+		It("should default the configuration", func() {
+			p = newProvider(&Configuration{Brokers: []string{broker.Addr()}})
+			Expect(p.config.Topic).To(Equal("auditlog"))
+			Expect(p.config.Key).To(Equal("{{ .Shoot }}/{{ .APIGroup }}/{{ .Resource }}"))
+			Expect(p.config.Compression).To(Equal(CompressionNone))
+			Expect(p.config.RequiredAcks).To(Equal(RequiredAcksAll))
+			Expect(*p.config.Retries).To(Equal(3))
+			Expect(p.config.Timeout.Duration).To(Equal(30 * time.Second))
+		})
+
+		It("should reject invalid configurations", func() {
+			Expect(inject(`{}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "topic": "{{ .Foo"}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "compression": "lz4"}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "requiredAcks": "none"}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "requiredAcks": "leader", "idempotent": true}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "idempotent": true, "retries": 0}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "sasl": {"mechanism": "GSSAPI"}}`)).ToNot(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "sasl": {"mechanism": "PLAIN", "username": "auditlog"}}`)).ToNot(Succeed())
+			// the credentials can be injected from a secret
+			Expect(inject(`{"brokers": ["kafka:9092"], "sasl": {"mechanism": "PLAIN"}}`)).To(Succeed())
+			Expect(inject(`{"brokers": ["kafka:9092"], "requiredAcks": "leader", "compression": "gzip"}`)).To(Succeed())
+		})
+	})
+})
+
+var _ = Describe("scramClient", func() {
+	// authenticate runs the conversation of the scram client with the server of the scram package
+	authenticate := func(mechanism, password string) error {
+		c := sarama.NewConfig()
+		Expect(setSASLConfig(c, &SASLConfiguration{Mechanism: mechanism})).To(Succeed())
+		hash := scram.SHA256
+		if mechanism == SASLMechanismScramSHA512 {
+			hash = scramSHA512
+		}
+		stored, err := hash.NewClient("auditlog", "secret", "")
+		Expect(err).ToNot(HaveOccurred())
+		credentials := stored.GetStoredCredentials(scram.KeyFactors{Salt: "salt", Iters: 4096})
+		server, err := hash.NewServer(func(string) (scram.StoredCredentials, error) { return credentials, nil })
+		Expect(err).ToNot(HaveOccurred())
+		conversation := server.NewConversation()
+
+		client := c.Net.SASL.SCRAMClientGeneratorFunc()
+		if err := client.Begin("auditlog", password, ""); err != nil {
+			return err
+		}
+		challenge := ""
+		for !client.Done() {
+			response, err := client.Step(challenge)
+			if err != nil {
+				return err
+			}
+			if client.Done() {
+				break
+			}
+			if challenge, err = conversation.Step(response); err != nil {
+				return err
+			}
+		}
+		Expect(conversation.Valid()).To(BeTrue())
+		return nil
+	}
+
+	for _, mechanism := range []string{SASLMechanismScramSHA256, SASLMechanismScramSHA512} {
+		mechanism := mechanism
+
+		It("should authenticate with "+mechanism, func() {
+			Expect(authenticate(mechanism, "secret")).To(Succeed())
+		})
+
+		It("should fail to authenticate with "+mechanism+" and a wrong password", func() {
+			Expect(authenticate(mechanism, "wrong")).ToNot(Succeed())
+		})
+	}
+})
+
+var _ = Describe("murmur2", func() {
+	It("should compute the same hashes as the java client", func() {
+		Expect(murmur2([]byte("21"))).To(Equal(int32(-973932308)))
+		Expect(murmur2([]byte("foobar"))).To(Equal(int32(-790332482)))
+		Expect(murmur2([]byte("a-little-bit-long-string"))).To(Equal(int32(-985981536)))
+		Expect(murmur2([]byte("a-little-bit-longer-string"))).To(Equal(int32(-1486304829)))
+		Expect(murmur2([]byte("lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8"))).To(Equal(int32(-58897971)))
+		Expect(murmur2([]byte("abc"))).To(Equal(int32(479470107)))
+	})
+})
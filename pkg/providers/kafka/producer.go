@@ -0,0 +1,188 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CompressionNone does not compress the record batches
+	CompressionNone = "none"
+	// CompressionGzip compresses the record batches with gzip
+	CompressionGzip = "gzip"
+
+	clientID = "gardener-auditlog-proxy"
+)
+
+// newSyncProducer is replaced by the tests to observe the partitions of the written messages
+var newSyncProducer = sarama.NewSyncProducer
+
+// newSaramaConfig returns the producer configuration for the given provider configuration.
+// At most one request is in flight per broker so that retried record batches keep the order of their partition.
+func newSaramaConfig(config *Configuration) (*sarama.Config, error) {
+	c := sarama.NewConfig()
+	c.ClientID = clientID
+	// Produce v3 is the first version that supports record batches with producer ids and sequence numbers,
+	// SASL authenticate requests require kafka 1.0
+	c.Version = sarama.V1_0_0_0
+
+	c.Net.MaxOpenRequests = 1
+	c.Net.DialTimeout = config.Timeout.Duration
+	c.Net.ReadTimeout = config.Timeout.Duration
+	c.Net.WriteTimeout = config.Timeout.Duration
+	c.Metadata.Full = false
+	c.Metadata.Retry.Max = *config.Retries
+	c.Metadata.Retry.Backoff = retryBackoff
+
+	c.Producer.Return.Successes = true
+	c.Producer.Timeout = config.Timeout.Duration
+	c.Producer.Retry.Max = *config.Retries
+	c.Producer.Retry.Backoff = retryBackoff
+	c.Producer.Partitioner = newPartitioner
+	c.Producer.Idempotent = config.Idempotent
+
+	switch config.Compression {
+	case CompressionNone:
+		c.Producer.Compression = sarama.CompressionNone
+	case CompressionGzip:
+		c.Producer.Compression = sarama.CompressionGZIP
+	default:
+		return nil, errors.Errorf("unsupported compression %q, must be one of %s or %s", config.Compression, CompressionNone, CompressionGzip)
+	}
+	switch config.RequiredAcks {
+	case RequiredAcksAll:
+		c.Producer.RequiredAcks = sarama.WaitForAll
+	case RequiredAcksLeader:
+		if config.Idempotent {
+			return nil, errors.New("the idempotent producer requires the acknowledgement of all replicas")
+		}
+		c.Producer.RequiredAcks = sarama.WaitForLocal
+	default:
+		return nil, errors.Errorf("unsupported required acks %q, must be one of %s or %s", config.RequiredAcks, RequiredAcksAll, RequiredAcksLeader)
+	}
+
+	if config.TLS != nil {
+		tlsConfig, err := tlsConfigFor(config.TLS)
+		if err != nil {
+			return nil, err
+		}
+		c.Net.TLS.Enable, c.Net.TLS.Config = true, tlsConfig
+	}
+	if config.SASL != nil {
+		if err := setSASLConfig(c, config.SASL); err != nil {
+			return nil, err
+		}
+	}
+
+	// the SASL credentials might still be injected from a secret
+	validated := *c
+	if config.SASL != nil && config.SASL.Username == "" && config.SASL.Password == "" {
+		validated.Net.SASL.Enable = false
+	}
+	if err := validated.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid producer configuration")
+	}
+	return c, nil
+}
+
+// partitioner selects the partition of a message the same way as the default partitioner of the java client,
+// so that consumers can rely on the same key to partition mapping.
+// Messages without key are distributed round-robin.
+type partitioner struct {
+	roundRobin sarama.Partitioner
+}
+
+func newPartitioner(topic string) sarama.Partitioner {
+	return &partitioner{roundRobin: sarama.NewRoundRobinPartitioner(topic)}
+}
+
+func (p *partitioner) Partition(message *sarama.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Key == nil {
+		return p.roundRobin.Partition(message, numPartitions)
+	}
+	key, err := message.Key.Encode()
+	if err != nil {
+		return -1, err
+	}
+	return (murmur2(key) & 0x7fffffff) % numPartitions, nil
+}
+
+func (p *partitioner) RequiresConsistency() bool {
+	return true
+}
+
+// asProviderError marks errors that are not permanent kafka errors or configuration errors as transient
+func asProviderError(err error) error {
+	if kerr, ok := err.(sarama.KError); ok && !retriable(kerr) {
+		return err
+	}
+	if _, ok := errors.Cause(err).(sarama.ConfigurationError); ok {
+		return err
+	}
+	return provider.NewTransientError(err)
+}
+
+// retriable returns true if a request that failed with the kafka error might succeed if it is sent again
+func retriable(err sarama.KError) bool {
+	switch err {
+	case sarama.ErrUnknownTopicOrPartition, sarama.ErrLeaderNotAvailable, sarama.ErrNotLeaderForPartition,
+		sarama.ErrRequestTimedOut, sarama.ErrNetworkException, sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend, sarama.ErrOutOfOrderSequenceNumber, sarama.ErrUnknownProducerID,
+		sarama.ErrKafkaStorageError, sarama.ErrFencedLeaderEpoch, sarama.ErrOffsetsLoadInProgress,
+		sarama.ErrConsumerCoordinatorNotAvailable, sarama.ErrNotCoordinatorForConsumer, sarama.ErrConcurrentTransactions:
+		return true
+	}
+	return false
+}
+
+// murmur2 is the hash function of the default partitioner of the java client
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := length &^ 3
+	switch length % 4 {
+	case 3:
+		h ^= uint32(data[tail+2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[tail+1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[tail])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
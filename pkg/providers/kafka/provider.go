@@ -0,0 +1,455 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/Shopify/sarama"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	// RequiredAcksAll waits until all in-sync replicas acknowledged a record batch
+	RequiredAcksAll = "all"
+	// RequiredAcksLeader only waits until the leader acknowledged a record batch
+	RequiredAcksLeader = "leader"
+
+	defaultTopic   = "auditlog"
+	defaultKey     = "{{ .Shoot }}/{{ .APIGroup }}/{{ .Resource }}"
+	defaultRetries = 3
+	defaultTimeout = 30 * time.Second
+	retryBackoff   = 100 * time.Millisecond
+)
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	SecretKeyUsername = "username"
+	SecretKeyPassword = "password"
+	SecretKeyCA       = "ca.crt"
+	SecretKeyCert     = "tls.crt"
+	SecretKeyKey      = "tls.key"
+)
+
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+
+	// mux serializes the writes so that the events of a key are written in order
+	// and protects the producer that is replaced whenever the mounted secret changes
+	mux          sync.Mutex
+	saramaConfig *sarama.Config
+	producer     sarama.SyncProducer
+	topic        *template.Template
+	key          *template.Template
+}
+
+// Configuration is the kafka provider specific configuration
+type Configuration struct {
+	// Brokers are the addresses of the bootstrap brokers, e.g. kafka-0.kafka:9092
+	Brokers []string `json:"brokers"`
+	// Topic is a template of the topic an event is written to, defaults to auditlog
+	Topic string `json:"topic,omitempty"`
+	// Key is a template of the message key, defaults to {{ .Shoot }}/{{ .APIGroup }}/{{ .Resource }}.
+	// Events with the same key are written in order to the same partition.
+	// Events with an empty key are distributed over all partitions.
+	Key string `json:"key,omitempty"`
+	// Shoot is the technical id of the shoot that can be used in the templates.
+	// It is set by the extension controller.
+	Shoot string `json:"shoot,omitempty"`
+
+	// Compression is either none or gzip, defaults to none
+	Compression string `json:"compression,omitempty"`
+	// RequiredAcks is either all or leader, defaults to all
+	RequiredAcks string `json:"requiredAcks,omitempty"`
+	// Idempotent enables the idempotent producer so that retried record batches are not written twice.
+	// It requires at least one retry.
+	Idempotent bool `json:"idempotent,omitempty"`
+	// Retries is the number of times a failed record batch is sent again, defaults to 3
+	Retries *int `json:"retries,omitempty"`
+	// Timeout of the connections and requests, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// TLS enables tls for the connections to the brokers
+	// +optional
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+	// SASL configures the authentication at the brokers
+	// +optional
+	SASL *SASLConfiguration `json:"sasl,omitempty"`
+}
+
+// TLSConfiguration contains the PEM encoded certificates of the tls connections
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificates of the brokers
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// SASLConfiguration contains the credentials of the SASL authentication
+type SASLConfiguration struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512
+	Mechanism string `json:"mechanism"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+}
+
+// TemplateData are the fields of an event that can be used in the topic and key templates
+type TemplateData struct {
+	Shoot     string
+	Namespace string
+	APIGroup  string
+	Resource  string
+	Name      string
+	Verb      string
+	User      string
+	Level     string
+	Stage     string
+}
+
+var _ provider.Interface = &Provider{}
+
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+func (p *Provider) Name() string {
+	return "kafka"
+}
+
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+	if len(config.Brokers) == 0 {
+		return errors.New("at least one broker has to be defined")
+	}
+
+	topic, err := template.New("topic").Option("missingkey=error").Parse(config.Topic)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse topic template")
+	}
+	key, err := template.New("key").Option("missingkey=error").Parse(config.Key)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse key template")
+	}
+
+	saramaConfig, err := newSaramaConfig(config)
+	if err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeProducer()
+	p.saramaConfig = saramaConfig
+	p.topic, p.key = topic, key
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the SASL credentials and the certificates of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes, the next events are written by a new producer.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	config, err := withSecret(p.config, data)
+	if err != nil {
+		return err
+	}
+	if config.SASL != nil && (config.SASL.Username == "" || config.SASL.Password == "") {
+		return errors.Errorf("the secret has to contain the %s and the %s", SecretKeyUsername, SecretKeyPassword)
+	}
+	saramaConfig, err := newSaramaConfig(config)
+	if err != nil {
+		return err
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeProducer()
+	p.saramaConfig = saramaConfig
+	return nil
+}
+
+// ValidateBackendConfig validates the brokers and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	if len(config.Brokers) == 0 {
+		allErrs = append(allErrs, field.Required(fldPath.Child("brokers"), "At least one broker has to be defined"))
+	}
+	for i, broker := range config.Brokers {
+		allErrs = append(allErrs, provider.ValidateAddress(broker, fldPath.Child("brokers").Index(i))...)
+	}
+	if sasl := config.SASL; sasl != nil && (sasl.Username == "" || sasl.Password == "") && secretRef == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("sasl", "password"), "A username and a password or a backendProviderSecretRef has to be defined"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Reconcile sets the shoot of the configuration to the namespace of the extension
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Shoot == "" {
+		p.config.Shoot = ex.GetNamespace()
+	}
+	return nil
+}
+
+// Delete noop delete function
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the backend configuration that is completed with the shoot
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log writes the events to the partitions that are selected by their keys.
+// The producer connects to the brokers with the first events.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	partialErr := &provider.PartialError{}
+	messages := make([]*sarama.ProducerMessage, 0, len(events.Items))
+	for i := range events.Items {
+		m, err := p.newMessage(i, &events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err})
+			continue
+		}
+		messages = append(messages, m)
+	}
+
+	if len(messages) != 0 {
+		if err := p.produce(messages); err != nil {
+			partialErr.Errors = append(partialErr.Errors, err.Errors...)
+		}
+	}
+
+	if len(partialErr.Errors) != 0 {
+		if p.config.Idempotent {
+			// failed record batches leave gaps in the sequence numbers so that a new producer id is required
+			p.closeProducer()
+		}
+		return partialErr
+	}
+	p.log.Info("Successfully produced messages", "events", len(events.Items))
+	return nil
+}
+
+// produce writes the messages and returns the errors of the messages that could not be written
+func (p *Provider) produce(messages []*sarama.ProducerMessage) *provider.PartialError {
+	partialErr := &provider.PartialError{}
+	fail := func(m *sarama.ProducerMessage, err error) {
+		err = asProviderError(err)
+		partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: m.Metadata.(int), Err: err, Transient: provider.IsTransient(err)})
+	}
+
+	if p.producer == nil {
+		producer, err := newSyncProducer(p.config.Brokers, p.saramaConfig)
+		if err != nil {
+			for _, m := range messages {
+				fail(m, errors.Wrap(err, "unable to connect to the brokers"))
+			}
+			return partialErr
+		}
+		p.producer = producer
+	}
+
+	err := p.producer.SendMessages(messages)
+	if err == nil {
+		return nil
+	}
+	if producerErrs, ok := err.(sarama.ProducerErrors); ok {
+		for _, e := range producerErrs {
+			fail(e.Msg, e.Err)
+		}
+	} else {
+		for _, m := range messages {
+			fail(m, err)
+		}
+	}
+	return partialErr
+}
+
+func (p *Provider) closeProducer() {
+	if p.producer == nil {
+		return
+	}
+	if err := p.producer.Close(); err != nil && p.log != nil {
+		p.log.Error(err, "Unable to close producer")
+	}
+	p.producer = nil
+}
+
+func (p *Provider) newMessage(index int, event *audit.Event) (*sarama.ProducerMessage, error) {
+	value, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal event")
+	}
+
+	data := &TemplateData{
+		Shoot: p.config.Shoot,
+		Verb:  event.Verb,
+		User:  event.User.Username,
+		Level: string(event.Level),
+		Stage: string(event.Stage),
+	}
+	if ref := event.ObjectRef; ref != nil {
+		data.Namespace, data.APIGroup, data.Resource, data.Name = ref.Namespace, ref.APIGroup, ref.Resource, ref.Name
+	}
+
+	var topic, key bytes.Buffer
+	if err := p.topic.Execute(&topic, data); err != nil {
+		return nil, errors.Wrap(err, "unable to render topic")
+	}
+	if topic.Len() == 0 {
+		return nil, errors.New("rendered topic is empty")
+	}
+	if err := p.key.Execute(&key, data); err != nil {
+		return nil, errors.Wrap(err, "unable to render key")
+	}
+
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	m := &sarama.ProducerMessage{Topic: topic.String(), Value: sarama.ByteEncoder(value), Timestamp: ts, Metadata: index}
+	if key.Len() != 0 {
+		m.Key = sarama.ByteEncoder(key.Bytes())
+	}
+	return m, nil
+}
+
+func setDefaults(config *Configuration) {
+	if config.Topic == "" {
+		config.Topic = defaultTopic
+	}
+	if config.Key == "" {
+		config.Key = defaultKey
+	}
+	if config.Compression == "" {
+		config.Compression = CompressionNone
+	}
+	if config.RequiredAcks == "" {
+		config.RequiredAcks = RequiredAcksAll
+	}
+	if config.Retries == nil {
+		retries := defaultRetries
+		config.Retries = &retries
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+// withSecret returns a copy of the configuration with the credentials and certificates of the secret.
+// The certificates of the secret enable tls, the credentials require the SASL mechanism of the configuration.
+func withSecret(config *Configuration, data map[string][]byte) (*Configuration, error) {
+	c := *config
+	if c.TLS != nil {
+		tlsConfig := *c.TLS
+		c.TLS = &tlsConfig
+	}
+	if c.SASL != nil {
+		sasl := *c.SASL
+		c.SASL = &sasl
+	}
+
+	_, hasUsername := data[SecretKeyUsername]
+	_, hasPassword := data[SecretKeyPassword]
+	if hasUsername || hasPassword {
+		if c.SASL == nil {
+			return nil, errors.New("the SASL mechanism has to be defined for the credentials of the secret")
+		}
+		c.SASL.Username, c.SASL.Password = string(data[SecretKeyUsername]), string(data[SecretKeyPassword])
+	}
+	_, hasCA := data[SecretKeyCA]
+	_, hasCert := data[SecretKeyCert]
+	if (hasCA || hasCert) && c.TLS == nil {
+		c.TLS = &TLSConfiguration{}
+	}
+	if hasCA {
+		c.TLS.CA = string(data[SecretKeyCA])
+	}
+	if hasCert {
+		c.TLS.Cert, c.TLS.Key = string(data[SecretKeyCert]), string(data[SecretKeyKey])
+	}
+	return &c, nil
+}
+
+func tlsConfigFor(config *TLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CA != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, errors.New("unable to parse CA bundle")
+		}
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(config.Cert), []byte(config.Key))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loki
+
+import (
+	"context"
+	"fmt"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// ServiceName is the name of the loki service in the shoot namespace of the seed
+	ServiceName = "loki"
+	// servicePortName is the name of the port of the loki service that serves the push api
+	servicePortName = "metrics"
+)
+
+// Reconcile reconciles the auditlog extension for the loki provider.
+// The loki of the seed is used if no endpoint is configured.
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Endpoint != "" {
+		return nil
+	}
+
+	lokiService := &corev1.Service{}
+	if err := p.k8sClient.Get(ctx, client.ObjectKey{Name: ServiceName, Namespace: ex.GetNamespace()}, lokiService); err != nil {
+		return errors.Wrapf(err, "unable to get service %s", ServiceName)
+	}
+	port, err := getPortByName(servicePortName, lokiService.Spec.Ports)
+	if err != nil {
+		return err
+	}
+	p.config.Endpoint = fmt.Sprintf("http://%s.%s:%d", lokiService.GetName(), lokiService.GetNamespace(), port)
+	return nil
+}
+
+// Delete noop delete function as the loki of the seed is not managed by the provider
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+func getPortByName(name string, ports []corev1.ServicePort) (int32, error) {
+	for _, port := range ports {
+		if port.Name == name {
+			return port.Port, nil
+		}
+	}
+	return 0, errors.Errorf("unable to find port for %s", name)
+}
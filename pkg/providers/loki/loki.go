@@ -0,0 +1,269 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/snappy"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PushPath is the path of the loki push api
+const PushPath = "/loki/api/v1/push"
+
+// streamLabelValues are the event fields that can be used as stream labels
+var streamLabelValues = map[string]func(event *audit.Event) string{
+	"namespace": func(event *audit.Event) string {
+		if event.ObjectRef == nil {
+			return ""
+		}
+		return event.ObjectRef.Namespace
+	},
+	"resource": func(event *audit.Event) string {
+		if event.ObjectRef == nil {
+			return ""
+		}
+		return event.ObjectRef.Resource
+	},
+	"verb":  func(event *audit.Event) string { return event.Verb },
+	"user":  func(event *audit.Event) string { return event.User.Username },
+	"level": func(event *audit.Event) string { return string(event.Level) },
+	"stage": func(event *audit.Event) string { return string(event.Stage) },
+}
+
+// entry is a log line of an event together with its stream labels
+type entry struct {
+	index     int
+	labels    map[string]string
+	timestamp time.Time
+	line      string
+}
+
+func (p *Provider) newEntry(index int, event *audit.Event) (entry, error) {
+	line, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return entry{}, errors.Wrap(err, "unable to marshal event")
+	}
+
+	labels := make(map[string]string, len(p.config.Labels)+len(p.config.StreamLabels))
+	for name, value := range p.config.Labels {
+		labels[name] = value
+	}
+	for _, name := range p.config.StreamLabels {
+		// loki does not accept empty label values
+		if value := streamLabelValues[name](event); value != "" {
+			labels[name] = value
+		}
+	}
+
+	metadata := provider.ShootMetadataFrom(event)
+	for name, value := range map[string]string{"shoot": metadata.Name, "project": metadata.Project, "seed": metadata.Seed} {
+		if _, ok := labels[name]; !ok && value != "" {
+			labels[name] = value
+		}
+	}
+
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	return entry{index: index, labels: labels, timestamp: ts, line: string(line)}, nil
+}
+
+// stream is a set of entries with the same labels
+type stream struct {
+	labels  map[string]string
+	entries []entry
+}
+
+// groupStreams groups the entries by their labels.
+// The entries of a stream are ordered by their timestamp as loki rejects out-of-order entries.
+func groupStreams(entries []entry) []*stream {
+	var (
+		streams = make([]*stream, 0)
+		byKey   = make(map[string]*stream)
+	)
+	for _, e := range entries {
+		key := formatLabels(e.labels)
+		s, ok := byKey[key]
+		if !ok {
+			s = &stream{labels: e.labels}
+			byKey[key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, e)
+	}
+	for _, s := range streams {
+		sort.SliceStable(s.entries, func(i, j int) bool { return s.entries[i].timestamp.Before(s.entries[j].timestamp) })
+	}
+	return streams
+}
+
+// formatLabels formats the labels in the prometheus label syntax, e.g. {job="auditlog", verb="get"}
+func formatLabels(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(labels[name]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// pushRequest is the protobuf message of the loki push api
+type pushRequest struct {
+	Streams []*pushStream `protobuf:"bytes,1,rep,name=streams,proto3"`
+}
+
+func (m *pushRequest) Reset()         { *m = pushRequest{} }
+func (m *pushRequest) String() string { return proto.CompactTextString(m) }
+func (*pushRequest) ProtoMessage()    {}
+
+type pushStream struct {
+	Labels  string       `protobuf:"bytes,1,opt,name=labels,proto3"`
+	Entries []*pushEntry `protobuf:"bytes,2,rep,name=entries,proto3"`
+}
+
+func (m *pushStream) Reset()         { *m = pushStream{} }
+func (m *pushStream) String() string { return proto.CompactTextString(m) }
+func (*pushStream) ProtoMessage()    {}
+
+type pushEntry struct {
+	Timestamp *timestamp.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3"`
+	Line      string               `protobuf:"bytes,2,opt,name=line,proto3"`
+}
+
+func (m *pushEntry) Reset()         { *m = pushEntry{} }
+func (m *pushEntry) String() string { return proto.CompactTextString(m) }
+func (*pushEntry) ProtoMessage()    {}
+
+// jsonPushRequest is the json body of the loki push api
+type jsonPushRequest struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+func encodeProtobuf(streams []*stream) ([]byte, error) {
+	req := &pushRequest{Streams: make([]*pushStream, 0, len(streams))}
+	for _, s := range streams {
+		ps := &pushStream{Labels: formatLabels(s.labels), Entries: make([]*pushEntry, 0, len(s.entries))}
+		for _, e := range s.entries {
+			ps.Entries = append(ps.Entries, &pushEntry{
+				Timestamp: &timestamp.Timestamp{Seconds: e.timestamp.Unix(), Nanos: int32(e.timestamp.Nanosecond())},
+				Line:      e.line,
+			})
+		}
+		req.Streams = append(req.Streams, ps)
+	}
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+func encodeJSON(streams []*stream) ([]byte, error) {
+	req := &jsonPushRequest{Streams: make([]jsonStream, 0, len(streams))}
+	for _, s := range streams {
+		js := jsonStream{Stream: s.labels, Values: make([][2]string, 0, len(s.entries))}
+		for _, e := range s.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(e.timestamp.UnixNano(), 10), e.line})
+		}
+		req.Streams = append(req.Streams, js)
+	}
+	return json.Marshal(req)
+}
+
+// push sends the entries with one request to loki
+func (p *Provider) push(entries []entry) error {
+	streams := groupStreams(entries)
+
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	if p.config.Encoding == EncodingJSON {
+		body, err = encodeJSON(streams)
+		contentType = "application/json"
+	} else {
+		body, err = encodeProtobuf(streams)
+		contentType = "application/x-protobuf"
+	}
+	if err != nil {
+		return errors.Wrap(err, "unable to encode push request")
+	}
+
+	pushURL, err := p.pushURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, pushURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if p.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.config.TenantID)
+	}
+	if creds := p.currentCredentials(); creds.username != "" {
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return provider.NewTransientError(errors.Wrapf(err, "unable to do request to %s", pushURL))
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		statusErr := errors.Errorf("request %s returned status code %d: %s", pushURL, res.StatusCode, strings.TrimSpace(string(resBody)))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			statusErr = provider.NewTransientError(statusErr)
+		}
+		return statusErr
+	}
+	return nil
+}
+
+func (p *Provider) pushURL() (string, error) {
+	u, err := url.Parse(p.config.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(u.Path, PushPath)
+	return u.String(), nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loki
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func newEvent(id, namespace, verb string, ts time.Time) audit.Event {
+	return audit.Event{
+		Level:                    audit.LevelMetadata,
+		AuditID:                  types.UID(id),
+		Verb:                     verb,
+		Stage:                    audit.StageResponseComplete,
+		User:                     audit.UserInfo{Username: "admin"},
+		ObjectRef:                &audit.ObjectReference{Resource: "pods", Namespace: namespace},
+		RequestReceivedTimestamp: metav1.NewMicroTime(ts),
+	}
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		bodies   [][]byte
+		status   int
+		p        *Provider
+		now      = time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+		events   *audit.EventList
+	)
+
+	newProvider := func(config string) *Provider {
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig([]byte(fmt.Sprintf(`{"endpoint":%q,%s}`, server.URL, config)))).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		requests, bodies, status = nil, nil, http.StatusNoContent
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			requests = append(requests, r)
+			bodies = append(bodies, body)
+			w.WriteHeader(status)
+		}))
+		events = &audit.EventList{Items: []audit.Event{
+			newEvent("1", "default", "get", now.Add(time.Second)),
+			newEvent("2", "kube-system", "list", now),
+			newEvent("3", "default", "get", now),
+		}}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should push snappy compressed protobuf streams", func() {
+		p = newProvider(`"tenantID":"shoot--foo--bar"`)
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal(PushPath))
+		Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+		Expect(requests[0].Header.Get("X-Scope-OrgID")).To(Equal("shoot--foo--bar"))
+
+		data, err := snappy.Decode(nil, bodies[0])
+		Expect(err).NotTo(HaveOccurred())
+		req := &pushRequest{}
+		Expect(proto.Unmarshal(data, req)).To(Succeed())
+		Expect(req.Streams).To(HaveLen(2))
+		Expect(req.Streams[0].Labels).To(Equal(`{job="shoot-auditlog", namespace="default", resource="pods", verb="get"}`))
+		Expect(req.Streams[0].Entries).To(HaveLen(2))
+		Expect(req.Streams[0].Entries[0].Timestamp.Seconds).To(Equal(now.Unix()))
+		Expect(req.Streams[0].Entries[0].Line).To(ContainSubstring(`"auditID":"3"`))
+		Expect(req.Streams[0].Entries[1].Line).To(ContainSubstring(`"auditID":"1"`))
+		Expect(req.Streams[1].Labels).To(Equal(`{job="shoot-auditlog", namespace="kube-system", resource="pods", verb="list"}`))
+	})
+
+	It("should push json streams with the configured labels", func() {
+		p = newProvider(`"encoding":"json","labels":{"cluster":"foo"},"streamLabels":["user"]`)
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Header.Get("Content-Type")).To(Equal("application/json"))
+		req := &jsonPushRequest{}
+		Expect(json.Unmarshal(bodies[0], req)).To(Succeed())
+		Expect(req.Streams).To(HaveLen(1))
+		Expect(req.Streams[0].Stream).To(Equal(map[string]string{"cluster": "foo", "user": "admin"}))
+		Expect(req.Streams[0].Values).To(HaveLen(3))
+		Expect(req.Streams[0].Values[0][0]).To(Equal(fmt.Sprintf("%d", now.UnixNano())))
+	})
+
+	It("should add the shoot metadata as labels", func() {
+		p = newProvider(`"encoding":"json","labels":{"seed":"static"},"streamLabels":["verb"]`)
+		for i := range events.Items {
+			events.Items[i].Annotations = provider.ShootMetadata{Name: "bar", Project: "foo", TechnicalID: "shoot--foo--bar", Seed: "aws"}.Annotations()
+		}
+		Expect(p.Log(events)).To(Succeed())
+
+		req := &jsonPushRequest{}
+		Expect(json.Unmarshal(bodies[0], req)).To(Succeed())
+		Expect(req.Streams).To(HaveLen(2))
+		Expect(req.Streams[0].Stream).To(Equal(map[string]string{"seed": "static", "shoot": "bar", "project": "foo", "verb": "get"}))
+		Expect(req.Streams[0].Values[0][1]).To(ContainSubstring(`"shoot.gardener.cloud/technical-id":"shoot--foo--bar"`))
+	})
+
+	It("should split the events into batches", func() {
+		p = newProvider(`"maxBatchSize":2`)
+		Expect(p.Log(events)).To(Succeed())
+		Expect(requests).To(HaveLen(2))
+	})
+
+	It("should return the events of failed batches as partial error", func() {
+		p = newProvider(`"maxBatchSize":2`)
+		status = http.StatusTooManyRequests
+		err := p.Log(events)
+
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(3))
+		for i, eventErr := range partialErr.Errors {
+			Expect(eventErr.Index).To(Equal(i))
+			Expect(eventErr.Transient).To(BeTrue())
+		}
+	})
+
+	It("should not retry rejected events", func() {
+		p = newProvider(`"maxBatchSize":2`)
+		status = http.StatusBadRequest
+		err := p.Log(events)
+
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors[0].Transient).To(BeFalse())
+	})
+
+	It("should send the credentials of the reloaded secret", func() {
+		p = newProvider(`"username":"inline","password":"inline"`)
+		Expect(p.Log(events)).To(Succeed())
+		username, password, _ := requests[0].BasicAuth()
+		Expect(username).To(Equal("inline"))
+		Expect(password).To(Equal("inline"))
+
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("admin"), SecretKeyPassword: []byte("secret")})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+		username, password, _ = requests[1].BasicAuth()
+		Expect(username).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+
+		config, err := p.BackendConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(config)).ToNot(ContainSubstring("secret"))
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyUsername: []byte("")})).ToNot(Succeed())
+	})
+
+	It("should reject unknown stream labels", func() {
+		Expect((&Provider{}).InjectBackendConfig([]byte(`{"streamLabels":["foo"]}`))).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,262 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package loki
+
+import (
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"time"
+)
+
+const (
+	// EncodingProtobuf pushes the events as snappy compressed protobuf
+	EncodingProtobuf = "protobuf"
+	// EncodingJSON pushes the events as json
+	EncodingJSON = "json"
+
+	defaultMaxBatchSize  = 500
+	defaultMaxBatchBytes = 1024 * 1024
+	requestTimeout       = 30 * time.Second
+)
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	SecretKeyUsername = "username"
+	SecretKeyPassword = "password"
+)
+
+// defaultStreamLabels are the event fields that are added as stream labels if none are configured
+var defaultStreamLabels = []string{"namespace", "verb", "resource"}
+
+type Provider struct {
+	log       logr.Logger
+	client    *http.Client
+	k8sClient client.Client
+	config    *Configuration
+
+	// credentialsMux protects the credentials that are replaced whenever the mounted secret changes
+	credentialsMux sync.RWMutex
+	credentials    *credentials
+}
+
+// credentials are the basic auth credentials that are sent to loki.
+// The credentials of secrets are never part of the configuration of the provider.
+type credentials struct {
+	username string
+	password string
+}
+
+// Configuration is the loki provider specific configuration
+type Configuration struct {
+	// Endpoint is the url of loki, e.g. http://loki:3100.
+	// The loki of the seed is used if no endpoint is configured.
+	Endpoint string `json:"endpoint"`
+	// TenantID is sent as X-Scope-OrgID header to multi-tenant lokis
+	TenantID string `json:"tenantID,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Encoding is either protobuf or json, defaults to protobuf
+	Encoding string `json:"encoding,omitempty"`
+	// Labels are static labels that are added to all streams
+	Labels map[string]string `json:"labels,omitempty"`
+	// StreamLabels are the event fields that are added as stream labels.
+	// Supported fields are namespace, verb, user, resource, level and stage.
+	// The shoot, project and seed attached by the proxy are always added as labels unless a static label has the same name.
+	StreamLabels []string `json:"streamLabels,omitempty"`
+	// MaxBatchSize is the maximum number of events that are pushed with one request
+	MaxBatchSize int `json:"maxBatchSize,omitempty"`
+	// MaxBatchBytes is the maximum size of the log lines that are pushed with one request
+	MaxBatchBytes int `json:"maxBatchBytes,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{
+		client: &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return "loki"
+}
+
+func (p *Provider) InjectClient(k8sClient client.Client) error {
+	p.k8sClient = k8sClient
+	return nil
+}
+
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+
+	switch config.Encoding {
+	case EncodingProtobuf, EncodingJSON:
+	default:
+		return errors.Errorf("unsupported encoding %q, must be one of %s or %s", config.Encoding, EncodingProtobuf, EncodingJSON)
+	}
+	for _, label := range config.StreamLabels {
+		if _, ok := streamLabelValues[label]; !ok {
+			return errors.Errorf("unsupported stream label %q", label)
+		}
+	}
+	p.setCredentials(&credentials{username: config.Username, password: config.Password})
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the credentials of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	creds := &credentials{username: p.config.Username, password: p.config.Password}
+	if value, ok := data[SecretKeyUsername]; ok {
+		creds.username = string(value)
+	}
+	if value, ok := data[SecretKeyPassword]; ok {
+		creds.password = string(value)
+	}
+	if creds.password != "" && creds.username == "" {
+		return errors.New("a username has to be defined for the password")
+	}
+	p.setCredentials(creds)
+	return nil
+}
+
+func (p *Provider) setCredentials(creds *credentials) {
+	p.credentialsMux.Lock()
+	defer p.credentialsMux.Unlock()
+	p.credentials = creds
+}
+
+// currentCredentials returns the credentials that are used for the next request
+func (p *Provider) currentCredentials() *credentials {
+	p.credentialsMux.RLock()
+	defer p.credentialsMux.RUnlock()
+	return p.credentials
+}
+
+// ValidateBackendConfig validates the endpoint and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	// the loki of the seed is used if no endpoint is defined
+	if config.Endpoint != "" {
+		allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	}
+	if config.Password != "" && config.Username == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("username"), "A username has to be defined for the password"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// BackendConfig returns the backend configuration that is completed with the discovered loki of the seed
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log pushes the events in batches to loki.
+// The events of failed batches are returned as partial error.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+
+	var (
+		partialErr = &provider.PartialError{}
+		batch      = make([]entry, 0)
+		batchBytes = 0
+	)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := p.push(batch); err != nil {
+			for _, e := range batch {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: e.index, Err: err, Transient: provider.IsTransient(err)})
+			}
+		}
+		batch = make([]entry, 0)
+		batchBytes = 0
+	}
+
+	for i := range events.Items {
+		e, err := p.newEntry(i, &events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err})
+			continue
+		}
+		if len(batch) >= p.config.MaxBatchSize || (len(batch) != 0 && batchBytes+len(e.line) > p.config.MaxBatchBytes) {
+			flush()
+		}
+		batch = append(batch, e)
+		batchBytes += len(e.line)
+	}
+	flush()
+
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	p.log.Info("Successfully pushed logs", "events", len(events.Items))
+	return nil
+}
+
+func setDefaults(config *Configuration) {
+	if config.Encoding == "" {
+		config.Encoding = EncodingProtobuf
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = map[string]string{"job": "shoot-auditlog"}
+	}
+	if len(config.StreamLabels) == 0 {
+		config.StreamLabels = defaultStreamLabels
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultMaxBatchBytes
+	}
+}
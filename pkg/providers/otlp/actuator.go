@@ -0,0 +1,58 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"github.com/gardener/gardener-extensions/pkg/controller"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/gardener/gardener/pkg/operation/common"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reconcile sets the names of the shoot, its project and its seed that are exported as resource attributes.
+// Explicitly configured names are kept.
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Shoot == "" {
+		p.config.Shoot = ex.GetNamespace()
+	}
+	if p.k8sClient == nil {
+		return nil
+	}
+
+	cluster, err := controller.GetCluster(ctx, p.k8sClient, ex.GetNamespace())
+	if err != nil {
+		return errors.Wrap(err, "unable to get cluster")
+	}
+	if shoot := cluster.Shoot; shoot != nil {
+		if p.config.ShootName == "" {
+			p.config.ShootName = shoot.Name
+		}
+		if p.config.Project == "" {
+			p.config.Project = common.ProjectNameForNamespace(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: shoot.Namespace}})
+		}
+	}
+	if seed := cluster.Seed; seed != nil && p.config.Seed == "" {
+		p.config.Seed = seed.Name
+	}
+	return nil
+}
+
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
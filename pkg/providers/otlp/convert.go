@@ -0,0 +1,157 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sort"
+	"time"
+)
+
+// severity numbers and texts of the OTLP log data model
+const (
+	severityInfo  int32 = 9
+	severityWarn  int32 = 13
+	severityError int32 = 17
+)
+
+var severityTexts = map[int32]string{severityInfo: "INFO", severityWarn: "WARN", severityError: "ERROR"}
+
+// newLogRecord converts the event to a log record.
+// The time of the record is the time the request was received and the observed time is the time of the audit stage.
+// The body is the event in the audit.k8s.io/v1 format and the attributes contain the most relevant fields of the event.
+func newLogRecord(event *audit.Event) (*logRecord, error) {
+	body, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &logRecord{
+		timeUnixNano:         unixNano(event.RequestReceivedTimestamp.Time),
+		observedTimeUnixNano: unixNano(event.StageTimestamp.Time),
+		severityNumber:       severityInfo,
+		body:                 string(body),
+	}
+	if r.observedTimeUnixNano == 0 {
+		r.observedTimeUnixNano = unixNano(time.Now())
+	}
+
+	attrs := &attributes{}
+	attrs.add("k8s.audit.event.id", string(event.AuditID))
+	attrs.add("k8s.audit.level", string(event.Level))
+	attrs.add("k8s.audit.stage", string(event.Stage))
+	attrs.add("k8s.audit.verb", event.Verb)
+	attrs.add("k8s.audit.request_uri", event.RequestURI)
+	attrs.add("k8s.audit.user.name", event.User.Username)
+	attrs.add("k8s.audit.user.uid", event.User.UID)
+	attrs.add("k8s.audit.user.groups", event.User.Groups)
+	if event.ImpersonatedUser != nil {
+		attrs.add("k8s.audit.impersonated_user.name", event.ImpersonatedUser.Username)
+	}
+	attrs.add("k8s.audit.source_ips", event.SourceIPs)
+	attrs.add("user_agent.original", event.UserAgent)
+	if ref := event.ObjectRef; ref != nil {
+		attrs.add("k8s.audit.object.api_group", ref.APIGroup)
+		attrs.add("k8s.audit.object.api_version", ref.APIVersion)
+		attrs.add("k8s.audit.object.resource", ref.Resource)
+		attrs.add("k8s.audit.object.subresource", ref.Subresource)
+		attrs.add("k8s.audit.object.namespace", ref.Namespace)
+		attrs.add("k8s.audit.object.name", ref.Name)
+	}
+	if status := event.ResponseStatus; status != nil {
+		attrs.add("k8s.audit.response.code", int64(status.Code))
+		attrs.add("k8s.audit.response.status", status.Status)
+		attrs.add("k8s.audit.response.reason", string(status.Reason))
+		switch {
+		case status.Code >= 500:
+			r.severityNumber = severityError
+		case status.Code >= 400:
+			r.severityNumber = severityWarn
+		}
+	}
+	r.severityText = severityTexts[r.severityNumber]
+	r.attributes = attrs.kvs
+	return r, nil
+}
+
+// resourceAttributes returns the attributes of the shoot and the configured attributes sorted by key.
+// The configured names take precedence over the shoot metadata that is attached to the events by the proxy
+// and the configured attributes take precedence over all others.
+func resourceAttributes(config *Configuration, metadata provider.ShootMetadata) []keyValue {
+	shootName := firstNonEmpty(config.ShootName, metadata.Name)
+	values := map[string]string{
+		"service.name":                 "kube-apiserver",
+		"k8s.cluster.name":             shootName,
+		"gardener.shoot.name":          shootName,
+		"gardener.shoot.technical_id":  firstNonEmpty(config.Shoot, metadata.TechnicalID),
+		"gardener.shoot.uid":           metadata.UID,
+		"gardener.shoot.provider_type": metadata.ProviderType,
+		"gardener.project.name":        firstNonEmpty(config.Project, metadata.Project),
+		"gardener.seed.name":           firstNonEmpty(config.Seed, metadata.Seed),
+		"cloud.region":                 metadata.Region,
+	}
+	for k, v := range config.ResourceAttributes {
+		values[k] = v
+	}
+
+	keys := make([]string, 0, len(values))
+	for k, v := range values {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	attrs := make([]keyValue, 0, len(keys))
+	for _, k := range keys {
+		attrs = append(attrs, keyValue{key: k, value: values[k]})
+	}
+	return attrs
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// attributes collects the non empty attributes of a log record
+type attributes struct {
+	kvs []keyValue
+}
+
+func (a *attributes) add(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return
+		}
+	case []string:
+		if len(v) == 0 {
+			return
+		}
+	}
+	a.kvs = append(a.kvs, keyValue{key: key, value: value})
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
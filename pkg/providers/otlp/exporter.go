@@ -0,0 +1,212 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// grpcExportPath is the path of the Export method of the LogsService
+	grpcExportPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+	// maxResponseSize is the maximum size of a response that is read
+	maxResponseSize = 1024 * 1024
+)
+
+// grpcRetryableCodes are the status codes of gRPC responses that are retried as defined by the OTLP specification
+var grpcRetryableCodes = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+// exporter sends an encoded ExportLogsServiceRequest and returns the partial success of the response
+type exporter interface {
+	export(ctx context.Context, request []byte) (*exportPartialSuccess, error)
+}
+
+// httpExporter exports the logs with OTLP/HTTP in the binary protobuf encoding
+type httpExporter struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	gzip     bool
+}
+
+func (e *httpExporter) export(ctx context.Context, request []byte) (*exportPartialSuccess, error) {
+	body, err := compress(request, e.gzip)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	if e.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, provider.NewTransientError(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, provider.NewTransientError(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err := errors.Errorf("export failed with status %d: %s", res.StatusCode, string(data))
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nil, provider.NewTransientError(err)
+		}
+		return nil, err
+	}
+	return decodeExportLogsServiceResponse(data)
+}
+
+// grpcExporter exports the logs with OTLP/gRPC by calling the unary Export method over HTTP/2
+type grpcExporter struct {
+	client   *http.Client
+	endpoint string
+	headers  map[string]string
+	gzip     bool
+}
+
+func (e *grpcExporter) export(ctx context.Context, request []byte) (*exportPartialSuccess, error) {
+	msg, err := compress(request, e.gzip)
+	if err != nil {
+		return nil, err
+	}
+	// length-prefixed message with the compressed flag
+	frame := make([]byte, 5, 5+len(msg))
+	if e.gzip {
+		frame[0] = 1
+	}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if e.gzip {
+		req.Header.Set("Grpc-Encoding", "gzip")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", strconv.FormatInt(time.Until(deadline).Milliseconds(), 10)+"m")
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return nil, provider.NewTransientError(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxResponseSize))
+	if err != nil {
+		return nil, provider.NewTransientError(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err := errors.Errorf("export failed with http status %d", res.StatusCode)
+		switch res.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nil, provider.NewTransientError(err)
+		}
+		return nil, err
+	}
+
+	// the status is sent in the trailers or in the headers of trailers-only responses
+	status, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return nil, provider.NewTransientError(errors.Errorf("response has no valid grpc status %q", status))
+	}
+	if code != 0 {
+		if decoded, err := url.PathUnescape(message); err == nil {
+			message = decoded
+		}
+		err := errors.Errorf("export failed with grpc status %d: %s", code, message)
+		if grpcRetryableCodes[code] {
+			return nil, provider.NewTransientError(err)
+		}
+		return nil, err
+	}
+
+	if len(data) < 5 {
+		return &exportPartialSuccess{}, nil
+	}
+	length := binary.BigEndian.Uint32(data[1:5])
+	if uint32(len(data)-5) < length {
+		return nil, errors.New("truncated grpc response")
+	}
+	response := data[5 : 5+length]
+	if data[0] == 1 {
+		r, err := gzip.NewReader(bytes.NewReader(response))
+		if err != nil {
+			return nil, err
+		}
+		if response, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	return decodeExportLogsServiceResponse(response)
+}
+
+func compress(data []byte, enabled bool) ([]byte, error) {
+	if !enabled {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,552 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/golang/protobuf/proto"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/http2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// exportedRecord is a decoded log record
+type exportedRecord struct {
+	timeUnixNano         uint64
+	observedTimeUnixNano uint64
+	severityNumber       int32
+	severityText         string
+	body                 string
+	attributes           map[string]interface{}
+}
+
+// exportRequest is a decoded ExportLogsServiceRequest with one resource and scope
+type exportRequest struct {
+	header    http.Header
+	resource  map[string]interface{}
+	scopeName string
+	records   []*exportedRecord
+}
+
+func mustDecodeFields(data []byte) []field {
+	fields, err := decodeFields(data)
+	Expect(err).ToNot(HaveOccurred())
+	return fields
+}
+
+func decodeAnyValue(data []byte) interface{} {
+	for _, f := range mustDecodeFields(data) {
+		switch f.number {
+		case 1:
+			return string(f.data)
+		case 2:
+			return f.value == 1
+		case 3:
+			return int64(f.value)
+		case 4:
+			return math.Float64frombits(f.value)
+		case 5:
+			values := make([]string, 0)
+			for _, v := range mustDecodeFields(f.data) {
+				values = append(values, decodeAnyValue(v.data).(string))
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+func decodeKeyValue(data []byte, into map[string]interface{}) {
+	var key string
+	var value interface{}
+	for _, f := range mustDecodeFields(data) {
+		switch f.number {
+		case 1:
+			key = string(f.data)
+		case 2:
+			value = decodeAnyValue(f.data)
+		}
+	}
+	into[key] = value
+}
+
+func decodeExportRequest(data []byte) *exportRequest {
+	req := &exportRequest{resource: map[string]interface{}{}}
+	resourceLogs := mustDecodeFields(data)
+	Expect(resourceLogs).To(HaveLen(1))
+	for _, f := range mustDecodeFields(resourceLogs[0].data) {
+		switch f.number {
+		case 1:
+			for _, attr := range mustDecodeFields(f.data) {
+				decodeKeyValue(attr.data, req.resource)
+			}
+		case 2:
+			for _, g := range mustDecodeFields(f.data) {
+				switch g.number {
+				case 1:
+					for _, h := range mustDecodeFields(g.data) {
+						if h.number == 1 {
+							req.scopeName = string(h.data)
+						}
+					}
+				case 2:
+					r := &exportedRecord{attributes: map[string]interface{}{}}
+					for _, h := range mustDecodeFields(g.data) {
+						switch h.number {
+						case 1:
+							r.timeUnixNano = h.value
+						case 2:
+							r.severityNumber = int32(h.value)
+						case 3:
+							r.severityText = string(h.data)
+						case 5:
+							r.body = decodeAnyValue(h.data).(string)
+						case 6:
+							decodeKeyValue(h.data, r.attributes)
+						case 11:
+							r.observedTimeUnixNano = h.value
+						}
+					}
+					req.records = append(req.records, r)
+				}
+			}
+		}
+	}
+	return req
+}
+
+func gunzip(data []byte) []byte {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	Expect(err).ToNot(HaveOccurred())
+	data, err = ioutil.ReadAll(r)
+	Expect(err).ToNot(HaveOccurred())
+	return data
+}
+
+// encodePartialSuccess encodes an ExportLogsServiceResponse with a partial success
+func encodePartialSuccess(rejected int64, message string) []byte {
+	b := proto.NewBuffer(nil)
+	putMessage(b, 1, func(b *proto.Buffer) {
+		putTag(b, 1, wireVarint)
+		_ = b.EncodeVarint(uint64(rejected))
+		putString(b, 2, message)
+	})
+	return b.Bytes()
+}
+
+// collector is a fake OpenTelemetry collector that receives logs over OTLP/HTTP and OTLP/gRPC
+type collector struct {
+	mux      sync.Mutex
+	requests []*exportRequest
+	// status is the http status of OTLP/HTTP responses and grpcStatus the status of OTLP/gRPC responses
+	status     int
+	grpcStatus int
+	response   []byte
+}
+
+func (c *collector) received() []*exportRequest {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return append([]*exportRequest(nil), c.requests...)
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer GinkgoRecover()
+	body, err := ioutil.ReadAll(r.Body)
+	Expect(err).ToNot(HaveOccurred())
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if r.Header.Get("Content-Type") == "application/grpc" {
+		Expect(r.ProtoMajor).To(Equal(2))
+		Expect(r.URL.Path).To(Equal(grpcExportPath))
+		Expect(len(body)).To(BeNumerically(">=", 5))
+		msg := body[5:]
+		Expect(binary.BigEndian.Uint32(body[1:5])).To(Equal(uint32(len(msg))))
+		if body[0] == 1 {
+			Expect(r.Header.Get("Grpc-Encoding")).To(Equal("gzip"))
+			msg = gunzip(msg)
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		if c.grpcStatus != 0 {
+			w.Header().Set("Grpc-Status", fmt.Sprintf("%d", c.grpcStatus))
+			w.Header().Set("Grpc-Message", "collector%20unavailable")
+			return
+		}
+		req := decodeExportRequest(msg)
+		req.header = r.Header
+		c.requests = append(c.requests, req)
+
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(c.response)))
+		_, _ = w.Write(append(frame, c.response...))
+		w.Header().Set("Grpc-Status", "0")
+		return
+	}
+
+	Expect(r.URL.Path).To(Equal("/v1/logs"))
+	Expect(r.Header.Get("Content-Type")).To(Equal("application/x-protobuf"))
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		body = gunzip(body)
+	}
+	if c.status != http.StatusOK {
+		w.WriteHeader(c.status)
+		return
+	}
+	req := decodeExportRequest(body)
+	req.header = r.Header
+	c.requests = append(c.requests, req)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(c.response)
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		c      *collector
+		events *audit.EventList
+	)
+
+	newProvider := func(config *Configuration) *Provider {
+		rawConfig, err := json.Marshal(config)
+		Expect(err).ToNot(HaveOccurred())
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig(rawConfig)).To(Succeed())
+		return p
+	}
+
+	auditIDs := func(requests []*exportRequest) []string {
+		ids := make([]string, 0)
+		for _, req := range requests {
+			for _, r := range req.records {
+				ids = append(ids, r.attributes["k8s.audit.event.id"].(string))
+			}
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		c = &collector{status: http.StatusOK}
+		events = &audit.EventList{}
+		for i := 0; i < 3; i++ {
+			events.Items = append(events.Items, audit.Event{AuditID: types.UID(fmt.Sprintf("%d", i)), Verb: "get"})
+		}
+	})
+
+	Context("http/protobuf", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			server = httptest.NewServer(c)
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("should export the events as log records", func() {
+			received := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+			event := audit.Event{
+				AuditID:                  "1",
+				Level:                    audit.LevelMetadata,
+				Stage:                    audit.StageResponseComplete,
+				Verb:                     "delete",
+				RequestURI:               "/api/v1/namespaces/default/pods/x",
+				User:                     audit.UserInfo{Username: "admin", Groups: []string{"system:masters"}},
+				SourceIPs:                []string{"10.0.0.1"},
+				UserAgent:                "kubectl",
+				ObjectRef:                &audit.ObjectReference{APIVersion: "v1", Resource: "pods", Namespace: "default", Name: "x"},
+				ResponseStatus:           &metav1.Status{Code: 403, Status: metav1.StatusFailure, Reason: metav1.StatusReasonForbidden},
+				RequestReceivedTimestamp: metav1.NewMicroTime(received),
+				StageTimestamp:           metav1.NewMicroTime(received.Add(time.Second)),
+			}
+			p := newProvider(&Configuration{
+				Endpoint:           server.URL,
+				Headers:            map[string]string{"Authorization": "Bearer token"},
+				ResourceAttributes: map[string]string{"deployment.environment": "live"},
+				Shoot:              "shoot--dev--test",
+				ShootName:          "test",
+				Project:            "dev",
+				Seed:               "aws",
+			})
+			Expect(p.Log(&audit.EventList{Items: []audit.Event{event}})).To(Succeed())
+
+			requests := c.received()
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].header.Get("Authorization")).To(Equal("Bearer token"))
+			Expect(requests[0].scopeName).To(Equal("gardener-extension-shoot-auditlog-service"))
+			Expect(requests[0].resource).To(Equal(map[string]interface{}{
+				"service.name":                "kube-apiserver",
+				"k8s.cluster.name":            "test",
+				"gardener.shoot.name":         "test",
+				"gardener.shoot.technical_id": "shoot--dev--test",
+				"gardener.project.name":       "dev",
+				"gardener.seed.name":          "aws",
+				"deployment.environment":      "live",
+			}))
+
+			Expect(requests[0].records).To(HaveLen(1))
+			r := requests[0].records[0]
+			Expect(r.timeUnixNano).To(Equal(uint64(received.UnixNano())))
+			Expect(r.observedTimeUnixNano).To(Equal(uint64(received.Add(time.Second).UnixNano())))
+			Expect(r.severityNumber).To(Equal(severityWarn))
+			Expect(r.severityText).To(Equal("WARN"))
+			Expect(r.attributes).To(Equal(map[string]interface{}{
+				"k8s.audit.event.id":           "1",
+				"k8s.audit.level":              "Metadata",
+				"k8s.audit.stage":              "ResponseComplete",
+				"k8s.audit.verb":               "delete",
+				"k8s.audit.request_uri":        "/api/v1/namespaces/default/pods/x",
+				"k8s.audit.user.name":          "admin",
+				"k8s.audit.user.groups":        []string{"system:masters"},
+				"k8s.audit.source_ips":         []string{"10.0.0.1"},
+				"user_agent.original":          "kubectl",
+				"k8s.audit.object.api_version": "v1",
+				"k8s.audit.object.resource":    "pods",
+				"k8s.audit.object.namespace":   "default",
+				"k8s.audit.object.name":        "x",
+				"k8s.audit.response.code":      int64(403),
+				"k8s.audit.response.status":    "Failure",
+				"k8s.audit.response.reason":    "Forbidden",
+			}))
+
+			body := &auditv1.Event{}
+			Expect(json.Unmarshal([]byte(r.body), body)).To(Succeed())
+			Expect(body.AuditID).To(Equal(types.UID("1")))
+		})
+
+		It("should export the events in compressed batches", func() {
+			p := newProvider(&Configuration{Endpoint: server.URL, MaxBatchSize: 2, Compression: CompressionGzip})
+			Expect(p.Log(events)).To(Succeed())
+
+			requests := c.received()
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[0].header.Get("Content-Encoding")).To(Equal("gzip"))
+			Expect(auditIDs(requests)).To(Equal([]string{"0", "1", "2"}))
+		})
+
+		It("should export the shoot metadata of the events as resource attributes", func() {
+			p := newProvider(&Configuration{Endpoint: server.URL, Seed: "configured"})
+			for i := range events.Items {
+				events.Items[i].Annotations = provider.ShootMetadata{
+					Name: "test", Project: "dev", TechnicalID: "shoot--dev--test", UID: "1234", Seed: "aws", Region: "eu-west-1", ProviderType: "aws",
+				}.Annotations()
+			}
+			Expect(p.Log(events)).To(Succeed())
+
+			requests := c.received()
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].resource).To(Equal(map[string]interface{}{
+				"service.name":                 "kube-apiserver",
+				"k8s.cluster.name":             "test",
+				"gardener.shoot.name":          "test",
+				"gardener.shoot.technical_id":  "shoot--dev--test",
+				"gardener.shoot.uid":           "1234",
+				"gardener.shoot.provider_type": "aws",
+				"gardener.project.name":        "dev",
+				"gardener.seed.name":           "configured",
+				"cloud.region":                 "eu-west-1",
+			}))
+		})
+
+		It("should accept partially successful exports", func() {
+			c.response = encodePartialSuccess(1, "invalid record")
+			p := newProvider(&Configuration{Endpoint: server.URL})
+			Expect(p.Log(events)).To(Succeed())
+		})
+
+		It("should return transient errors for retryable status codes", func() {
+			c.status = http.StatusServiceUnavailable
+			p := newProvider(&Configuration{Endpoint: server.URL, MaxBatchSize: 2})
+			err := p.Log(events)
+			Expect(err).To(HaveOccurred())
+			partialErr, ok := err.(*provider.PartialError)
+			Expect(ok).To(BeTrue())
+			Expect(partialErr.Errors).To(HaveLen(3))
+			Expect(partialErr.Errors[2].Index).To(Equal(2))
+			Expect(partialErr.Errors[2].Transient).To(BeTrue())
+		})
+
+		It("should return permanent errors for other status codes", func() {
+			c.status = http.StatusBadRequest
+			p := newProvider(&Configuration{Endpoint: server.URL})
+			err := p.Log(events)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*provider.PartialError).Errors[0].Transient).To(BeFalse())
+		})
+	})
+
+	Context("grpc", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			server := &http2.Server{}
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					go server.ServeConn(conn, &http2.ServeConnOpts{Handler: c})
+				}
+			}()
+		})
+
+		AfterEach(func() {
+			_ = listener.Close()
+		})
+
+		It("should export the events without tls", func() {
+			p := newProvider(&Configuration{
+				Endpoint:    "http://" + listener.Addr().String(),
+				Protocol:    ProtocolGRPC,
+				Compression: CompressionGzip,
+				Headers:     map[string]string{"Authorization": "Bearer token"},
+			})
+			Expect(p.Log(events)).To(Succeed())
+
+			requests := c.received()
+			Expect(requests).To(HaveLen(1))
+			Expect(requests[0].header.Get("Authorization")).To(Equal("Bearer token"))
+			Expect(requests[0].header.Get("Grpc-Timeout")).ToNot(BeEmpty())
+			Expect(auditIDs(requests)).To(Equal([]string{"0", "1", "2"}))
+		})
+
+		It("should decode the partial success of the response", func() {
+			c.response = encodePartialSuccess(2, "invalid records")
+			p := newProvider(&Configuration{Endpoint: "http://" + listener.Addr().String(), Protocol: ProtocolGRPC})
+			partialSuccess, err := p.exporter.export(context.TODO(), encodeExportLogsServiceRequest(&resourceLogs{}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(partialSuccess).To(Equal(&exportPartialSuccess{rejectedLogRecords: 2, errorMessage: "invalid records"}))
+		})
+
+		It("should return transient errors for retryable grpc status codes", func() {
+			c.grpcStatus = 14
+			p := newProvider(&Configuration{Endpoint: "http://" + listener.Addr().String(), Protocol: ProtocolGRPC})
+			err := p.Log(events)
+			Expect(err).To(HaveOccurred())
+			partialErr := err.(*provider.PartialError)
+			Expect(partialErr.Errors).To(HaveLen(3))
+			Expect(partialErr.Errors[0].Transient).To(BeTrue())
+			Expect(partialErr.Errors[0].Err).To(MatchError(ContainSubstring("grpc status 14: collector unavailable")))
+		})
+
+		It("should return permanent errors for other grpc status codes", func() {
+			c.grpcStatus = 3
+			p := newProvider(&Configuration{Endpoint: "http://" + listener.Addr().String(), Protocol: ProtocolGRPC})
+			err := p.Log(events)
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*provider.PartialError).Errors[0].Transient).To(BeFalse())
+		})
+	})
+
+	It("should export the events over grpc with tls", func() {
+		server := httptest.NewUnstartedServer(c)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		p := newProvider(&Configuration{Endpoint: server.URL, Protocol: ProtocolGRPC, TLS: &TLSConfiguration{CA: string(ca)}})
+		Expect(p.Log(events)).To(Succeed())
+		Expect(auditIDs(c.received())).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should export the events with the headers and the CA of the secret", func() {
+		server := httptest.NewUnstartedServer(c)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		p := newProvider(&Configuration{Endpoint: server.URL, Protocol: ProtocolGRPC, Headers: map[string]string{"X-Scope-OrgID": "audit", "Authorization": "Bearer inline"}})
+		Expect(p.InjectBackendSecret(map[string][]byte{
+			SecretKeyHeaders: []byte("Authorization: Bearer rotated"),
+			SecretKeyCA:      ca,
+		})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+
+		requests := c.received()
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].header.Get("Authorization")).To(Equal("Bearer rotated"))
+		Expect(requests[0].header.Get("X-Scope-OrgID")).To(Equal("audit"))
+		Expect(p.config.Headers).To(HaveKeyWithValue("Authorization", "Bearer inline"))
+	})
+
+	It("should reject secrets with invalid headers", func() {
+		p := newProvider(&Configuration{Endpoint: "https://otel-collector:4318"})
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyHeaders: []byte("[invalid")})).ToNot(Succeed())
+	})
+
+	It("should set the shoot during the reconciliation", func() {
+		p := newProvider(&Configuration{Endpoint: "https://otel-collector:4318"})
+		ex := &extensionsv1alpha1.Extension{ObjectMeta: metav1.ObjectMeta{Namespace: "shoot--dev--test"}}
+		Expect(p.Reconcile(context.TODO(), ex)).To(Succeed())
+		Expect(p.config.Shoot).To(Equal("shoot--dev--test"))
+	})
+
+	Context("configuration", func() {
+		inject := func(config string) error {
+			return (&Provider{}).InjectBackendConfig([]byte(config))
+		}
+
+		It("should default the configuration", func() {
+			p := newProvider(&Configuration{Endpoint: "https://otel-collector:4318"})
+			Expect(p.config.Protocol).To(Equal(ProtocolHTTPProtobuf))
+			Expect(p.config.Compression).To(Equal(CompressionNone))
+			Expect(p.config.MaxBatchSize).To(Equal(512))
+			Expect(p.config.Timeout.Duration).To(Equal(30 * time.Second))
+			Expect(p.exporter.(*httpExporter).endpoint).To(Equal("https://otel-collector:4318/v1/logs"))
+		})
+
+		It("should reject invalid configurations", func() {
+			Expect(inject(`{}`)).ToNot(Succeed())
+			Expect(inject(`{"endpoint": "otel-collector:4317"}`)).ToNot(Succeed())
+			Expect(inject(`{"endpoint": "https://otel-collector:4317", "protocol": "http/json"}`)).ToNot(Succeed())
+			Expect(inject(`{"endpoint": "https://otel-collector:4317", "compression": "zstd"}`)).ToNot(Succeed())
+			Expect(inject(`{"endpoint": "https://otel-collector:4317", "tls": {"ca": "invalid"}}`)).ToNot(Succeed())
+			Expect(inject(`{"endpoint": "https://otel-collector:4317", "protocol": "grpc"}`)).To(Succeed())
+		})
+	})
+})
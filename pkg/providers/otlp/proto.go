@@ -0,0 +1,243 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"encoding/binary"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// The messages of the OTLP logs protocol as defined in
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+// are encoded by hand as the generated types are not available.
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// keyValue is an attribute with a string, int64, float64, bool or []string value
+type keyValue struct {
+	key   string
+	value interface{}
+}
+
+// logRecord is an OTLP LogRecord
+type logRecord struct {
+	timeUnixNano         uint64
+	observedTimeUnixNano uint64
+	severityNumber       int32
+	severityText         string
+	body                 string
+	attributes           []keyValue
+}
+
+// resourceLogs are the log records of one resource and instrumentation scope
+type resourceLogs struct {
+	resource     []keyValue
+	scopeName    string
+	scopeVersion string
+	records      []*logRecord
+}
+
+// encodeExportLogsServiceRequest encodes an ExportLogsServiceRequest
+func encodeExportLogsServiceRequest(rl *resourceLogs) []byte {
+	b := proto.NewBuffer(nil)
+	// ExportLogsServiceRequest.resource_logs
+	putMessage(b, 1, func(b *proto.Buffer) {
+		// ResourceLogs.resource
+		putMessage(b, 1, func(b *proto.Buffer) {
+			putAttributes(b, 1, rl.resource)
+		})
+		// ResourceLogs.scope_logs
+		putMessage(b, 2, func(b *proto.Buffer) {
+			// ScopeLogs.scope
+			putMessage(b, 1, func(b *proto.Buffer) {
+				putString(b, 1, rl.scopeName)
+				putString(b, 2, rl.scopeVersion)
+			})
+			for _, r := range rl.records {
+				// ScopeLogs.log_records
+				putMessage(b, 2, func(b *proto.Buffer) { encodeLogRecord(b, r) })
+			}
+		})
+	})
+	return b.Bytes()
+}
+
+func encodeLogRecord(b *proto.Buffer, r *logRecord) {
+	if r.timeUnixNano != 0 {
+		putTag(b, 1, wireFixed64)
+		_ = b.EncodeFixed64(r.timeUnixNano)
+	}
+	if r.severityNumber != 0 {
+		putTag(b, 2, wireVarint)
+		_ = b.EncodeVarint(uint64(r.severityNumber))
+	}
+	putString(b, 3, r.severityText)
+	putMessage(b, 5, func(b *proto.Buffer) { encodeAnyValue(b, r.body) })
+	putAttributes(b, 6, r.attributes)
+	if r.observedTimeUnixNano != 0 {
+		putTag(b, 11, wireFixed64)
+		_ = b.EncodeFixed64(r.observedTimeUnixNano)
+	}
+}
+
+func putAttributes(b *proto.Buffer, field int, attributes []keyValue) {
+	for _, kv := range attributes {
+		kv := kv
+		putMessage(b, field, func(b *proto.Buffer) {
+			putString(b, 1, kv.key)
+			putMessage(b, 2, func(b *proto.Buffer) { encodeAnyValue(b, kv.value) })
+		})
+	}
+}
+
+// encodeAnyValue encodes the oneof of an AnyValue. The value is always encoded, even if it is a zero value.
+func encodeAnyValue(b *proto.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		putTag(b, 1, wireBytes)
+		_ = b.EncodeStringBytes(v)
+	case bool:
+		putTag(b, 2, wireVarint)
+		if v {
+			_ = b.EncodeVarint(1)
+		} else {
+			_ = b.EncodeVarint(0)
+		}
+	case int64:
+		putTag(b, 3, wireVarint)
+		_ = b.EncodeVarint(uint64(v))
+	case float64:
+		putTag(b, 4, wireFixed64)
+		_ = b.EncodeFixed64(math.Float64bits(v))
+	case []string:
+		// ArrayValue.values
+		putMessage(b, 5, func(b *proto.Buffer) {
+			for _, s := range v {
+				s := s
+				putMessage(b, 1, func(b *proto.Buffer) { encodeAnyValue(b, s) })
+			}
+		})
+	}
+}
+
+func putTag(b *proto.Buffer, field, wireType int) {
+	_ = b.EncodeVarint(uint64(field)<<3 | uint64(wireType))
+}
+
+// putString encodes a non empty string field
+func putString(b *proto.Buffer, field int, s string) {
+	if s == "" {
+		return
+	}
+	putTag(b, field, wireBytes)
+	_ = b.EncodeStringBytes(s)
+}
+
+// putMessage encodes the message that is written by encode as embedded message
+func putMessage(b *proto.Buffer, field int, encode func(b *proto.Buffer)) {
+	inner := proto.NewBuffer(nil)
+	encode(inner)
+	putTag(b, field, wireBytes)
+	_ = b.EncodeRawBytes(inner.Bytes())
+}
+
+// field is a decoded field of a protobuf message.
+// Varint and fixed values are stored in value, length delimited values in data.
+type field struct {
+	number   int
+	wireType int
+	value    uint64
+	data     []byte
+}
+
+// decodeFields decodes the fields of a protobuf message
+func decodeFields(data []byte) ([]field, error) {
+	fields := make([]field, 0)
+	for len(data) != 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("invalid field key")
+		}
+		data = data[n:]
+		f := field{number: int(key >> 3), wireType: int(key & 7)}
+		switch f.wireType {
+		case wireVarint:
+			if f.value, n = binary.Uvarint(data); n <= 0 {
+				return nil, errors.New("invalid varint")
+			}
+			data = data[n:]
+		case wireFixed64:
+			if len(data) < 8 {
+				return nil, errors.New("truncated fixed64")
+			}
+			f.value, data = binary.LittleEndian.Uint64(data), data[8:]
+		case wireFixed32:
+			if len(data) < 4 {
+				return nil, errors.New("truncated fixed32")
+			}
+			f.value, data = uint64(binary.LittleEndian.Uint32(data)), data[4:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return nil, errors.New("truncated length delimited field")
+			}
+			f.data, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return nil, errors.Errorf("unsupported wire type %d", f.wireType)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// exportPartialSuccess is the partial success of an ExportLogsServiceResponse
+type exportPartialSuccess struct {
+	rejectedLogRecords int64
+	errorMessage       string
+}
+
+// decodeExportLogsServiceResponse decodes the partial success of an ExportLogsServiceResponse
+func decodeExportLogsServiceResponse(data []byte) (*exportPartialSuccess, error) {
+	fields, err := decodeFields(data)
+	if err != nil {
+		return nil, err
+	}
+	partialSuccess := &exportPartialSuccess{}
+	for _, f := range fields {
+		if f.number != 1 || f.wireType != wireBytes {
+			continue
+		}
+		inner, err := decodeFields(f.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range inner {
+			switch {
+			case g.number == 1 && g.wireType == wireVarint:
+				partialSuccess.rejectedLogRecords = int64(g.value)
+			case g.number == 2 && g.wireType == wireBytes:
+				partialSuccess.errorMessage = string(g.data)
+			}
+		}
+	}
+	return partialSuccess, nil
+}
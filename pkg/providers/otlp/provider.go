@@ -0,0 +1,400 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	validationfield "k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net"
+	"net/http"
+	"net/url"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"time"
+)
+
+const (
+	// ProtocolHTTPProtobuf exports the logs with OTLP/HTTP in the binary protobuf encoding
+	ProtocolHTTPProtobuf = "http/protobuf"
+	// ProtocolGRPC exports the logs with OTLP/gRPC
+	ProtocolGRPC = "grpc"
+
+	// CompressionGzip compresses the export requests with gzip
+	CompressionGzip = "gzip"
+	// CompressionNone does not compress the export requests
+	CompressionNone = "none"
+
+	// scopeName is the name of the instrumentation scope of the log records
+	scopeName = "gardener-extension-shoot-auditlog-service"
+	// defaultLogsPath is the path of the OTLP/HTTP logs endpoint
+	defaultLogsPath = "/v1/logs"
+
+	defaultMaxBatchSize = 512
+	defaultTimeout      = 30 * time.Second
+)
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	// SecretKeyHeaders contains a yaml map of headers that overwrite the headers of the configuration
+	SecretKeyHeaders = "headers"
+	SecretKeyCA      = "ca.crt"
+	SecretKeyCert    = "tls.crt"
+	SecretKeyKey     = "tls.key"
+)
+
+type Provider struct {
+	log       logr.Logger
+	k8sClient client.Client
+	config    *Configuration
+
+	// exporterMux protects the exporter that is replaced whenever the mounted secret changes
+	exporterMux sync.RWMutex
+	exporter    exporter
+}
+
+// Configuration is the otlp provider specific configuration
+type Configuration struct {
+	// Endpoint is the url of the collector, e.g. https://otel-collector:4318/v1/logs for http/protobuf
+	// or https://otel-collector:4317 for grpc. The path of http/protobuf endpoints defaults to /v1/logs,
+	// grpc endpoints with the http scheme are called without tls.
+	Endpoint string `json:"endpoint"`
+	// Protocol is either http/protobuf or grpc, defaults to http/protobuf
+	Protocol string `json:"protocol,omitempty"`
+	// Headers are sent with every export request, e.g. for authentication
+	Headers map[string]string `json:"headers,omitempty"`
+	// Compression is either gzip or none, defaults to none
+	Compression string `json:"compression,omitempty"`
+	// TLS configures the tls connection to the collector
+	// +optional
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+	// ResourceAttributes are added to the attributes of the resource of the log records
+	ResourceAttributes map[string]string `json:"resourceAttributes,omitempty"`
+	// MaxBatchSize is the maximum number of log records that are exported with one request, defaults to 512
+	MaxBatchSize int `json:"maxBatchSize,omitempty"`
+	// Timeout of the export requests, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Shoot is the technical id of the shoot, ShootName, Project and Seed are the names of the shoot, its project and its seed.
+	// They are set by the extension controller.
+	Shoot     string `json:"shoot,omitempty"`
+	ShootName string `json:"shootName,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Seed      string `json:"seed,omitempty"`
+}
+
+// TLSConfiguration configures the tls connection to the collector
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificate of the collector
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+func (p *Provider) Name() string {
+	return "otlp"
+}
+
+func (p *Provider) InjectClient(k8sClient client.Client) error {
+	p.k8sClient = k8sClient
+	return nil
+}
+
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse endpoint")
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return errors.Errorf("endpoint %q must be an absolute http or https url", config.Endpoint)
+	}
+	switch config.Compression {
+	case CompressionGzip, CompressionNone:
+	default:
+		return errors.Errorf("unsupported compression %q, must be one of %s or %s", config.Compression, CompressionGzip, CompressionNone)
+	}
+	if config.MaxBatchSize < 0 {
+		return errors.New("maximum batch size must not be negative")
+	}
+
+	e, err := newExporter(config, nil)
+	if err != nil {
+		return err
+	}
+	p.setExporter(e)
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the headers and certificates of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes, requests that are in flight finish with the previous credentials.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	e, err := newExporter(p.config, data)
+	if err != nil {
+		return err
+	}
+	p.setExporter(e)
+	return nil
+}
+
+func (p *Provider) setExporter(e exporter) {
+	p.exporterMux.Lock()
+	defer p.exporterMux.Unlock()
+	p.exporter = e
+}
+
+// currentExporter returns the exporter that is used for the next request
+func (p *Provider) currentExporter() exporter {
+	p.exporterMux.RLock()
+	defer p.exporterMux.RUnlock()
+	return p.exporter
+}
+
+// ValidateBackendConfig validates the endpoint of the collector and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *validationfield.Path) validationfield.ErrorList {
+	allErrs := validationfield.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log converts the events to log records and exports them in batches of the maximum batch size
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+
+	var (
+		partialErr = &provider.PartialError{}
+		records    = make([]*logRecord, 0, len(events.Items))
+		indices    = make([]int, 0, len(events.Items))
+	)
+	for i := range events.Items {
+		r, err := newLogRecord(&events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: errors.Wrap(err, "unable to convert event")})
+			continue
+		}
+		records = append(records, r)
+		indices = append(indices, i)
+	}
+
+	// the shoot metadata is the same for all events of the proxy
+	var metadata provider.ShootMetadata
+	if len(events.Items) != 0 {
+		metadata = provider.ShootMetadataFrom(&events.Items[0])
+	}
+	resource := resourceAttributes(p.config, metadata)
+	e := p.currentExporter()
+	for start := 0; start < len(records); start += p.config.MaxBatchSize {
+		end := start + p.config.MaxBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+		request := encodeExportLogsServiceRequest(&resourceLogs{resource: resource, scopeName: scopeName, records: records[start:end]})
+
+		ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout.Duration)
+		partialSuccess, err := e.export(ctx, request)
+		cancel()
+		if err != nil {
+			for _, i := range indices[start:end] {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err, Transient: provider.IsTransient(err)})
+			}
+			continue
+		}
+		// rejected log records must not be retried and cannot be attributed to events
+		if partialSuccess.rejectedLogRecords > 0 || partialSuccess.errorMessage != "" {
+			p.log.Info("Collector rejected log records", "rejected", partialSuccess.rejectedLogRecords, "message", partialSuccess.errorMessage)
+		}
+	}
+
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	return nil
+}
+
+func setDefaults(config *Configuration) {
+	if config.Protocol == "" {
+		config.Protocol = ProtocolHTTPProtobuf
+	}
+	if config.Compression == "" {
+		config.Compression = CompressionNone
+	}
+	if config.MaxBatchSize == 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+// newExporter creates the exporter of the protocol with the headers and certificates of the configuration
+// that are overwritten by the given secret data.
+func newExporter(config *Configuration, data map[string][]byte) (exporter, error) {
+	config, err := withSecret(config, data)
+	if err != nil {
+		return nil, err
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse endpoint")
+	}
+	tlsConfig, err := tlsConfigFor(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	gzip := config.Compression == CompressionGzip
+
+	switch config.Protocol {
+	case ProtocolHTTPProtobuf:
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = defaultLogsPath
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		return &httpExporter{
+			client:   &http.Client{Transport: transport, Timeout: config.Timeout.Duration},
+			endpoint: endpoint.String(),
+			headers:  config.Headers,
+			gzip:     gzip,
+		}, nil
+	case ProtocolGRPC:
+		transport := &http2.Transport{TLSClientConfig: tlsConfig}
+		if endpoint.Scheme == "http" {
+			// grpc without tls uses HTTP/2 with prior knowledge
+			transport.AllowHTTP = true
+			transport.DialTLS = func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, addr, config.Timeout.Duration)
+			}
+		}
+		endpoint.Path = grpcExportPath
+		return &grpcExporter{
+			client:   &http.Client{Transport: transport, Timeout: config.Timeout.Duration},
+			endpoint: endpoint.String(),
+			headers:  config.Headers,
+			gzip:     gzip,
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported protocol %q, must be one of %s or %s", config.Protocol, ProtocolHTTPProtobuf, ProtocolGRPC)
+	}
+}
+
+// withSecret returns a copy of the configuration with the headers and certificates of the secret.
+// The headers of the secret are added to the headers of the configuration, the certificates of the secret replace
+// the certificates of the configuration.
+func withSecret(config *Configuration, data map[string][]byte) (*Configuration, error) {
+	c := *config
+	if rawHeaders, ok := data[SecretKeyHeaders]; ok {
+		headers := map[string]string{}
+		if err := yaml.Unmarshal(rawHeaders, &headers); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse the %s of the secret", SecretKeyHeaders)
+		}
+		c.Headers = make(map[string]string, len(config.Headers)+len(headers))
+		for k, v := range config.Headers {
+			c.Headers[k] = v
+		}
+		for k, v := range headers {
+			c.Headers[k] = v
+		}
+	}
+
+	_, hasCA := data[SecretKeyCA]
+	_, hasCert := data[SecretKeyCert]
+	if hasCA || hasCert {
+		tlsConfig := TLSConfiguration{}
+		if c.TLS != nil {
+			tlsConfig = *c.TLS
+		}
+		if hasCA {
+			tlsConfig.CA = string(data[SecretKeyCA])
+		}
+		if hasCert {
+			tlsConfig.Cert, tlsConfig.Key = string(data[SecretKeyCert]), string(data[SecretKeyKey])
+		}
+		c.TLS = &tlsConfig
+	}
+	return &c, nil
+}
+
+func tlsConfigFor(config *TLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config == nil {
+		return tlsConfig, nil
+	}
+	tlsConfig.ServerName, tlsConfig.InsecureSkipVerify = config.ServerName, config.InsecureSkipVerify
+	if config.CA != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, errors.New("unable to parse CA bundle")
+		}
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(config.Cert), []byte(config.Key))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
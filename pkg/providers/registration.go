@@ -16,10 +16,28 @@ package providers
 
 import (
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/elasticsearch"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/file"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/forward"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/kafka"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/loki"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/otlp"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/s3"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/splunk"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/standard"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/syslog"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers/webhook"
 )
 
 func init() {
 	ProviderFactory.Register(&standard.Provider{})
 	ProviderFactory.Register(&elasticsearch.Provider{})
+	ProviderFactory.Register(&loki.Provider{})
+	ProviderFactory.Register(&splunk.Provider{})
+	ProviderFactory.Register(&webhook.Provider{})
+	ProviderFactory.Register(&kafka.Provider{})
+	ProviderFactory.Register(&s3.Provider{})
+	ProviderFactory.Register(&syslog.Provider{})
+	ProviderFactory.Register(&otlp.Provider{})
+	ProviderFactory.Register(&file.Provider{})
+	ProviderFactory.Register(&forward.Provider{})
 }
@@ -0,0 +1,145 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// spoolSuffix is the suffix of the files that hold the events of objects that are not yet uploaded
+const spoolSuffix = ".jsonl"
+
+// object is an archive object that is filled with JSON lines until it is uploaded.
+// The lines are either kept in memory or in a spool file that survives restarts of the proxy.
+type object struct {
+	// key is the object key without the suffix of the compression
+	key     string
+	created time.Time
+	// size is the size of the uncompressed lines
+	size int64
+	file *os.File
+	buf  bytes.Buffer
+}
+
+// newObject creates a new object that is spooled to the given directory if it is not empty
+func newObject(key string, created time.Time, spoolDirectory string) (*object, error) {
+	o := &object{key: key, created: created}
+	if spoolDirectory == "" {
+		return o, nil
+	}
+	file, err := os.OpenFile(spoolPath(spoolDirectory, key), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create spool file")
+	}
+	o.file = file
+	return o, nil
+}
+
+// write appends the lines to the object. Spooled lines are synced to disk before write returns.
+func (o *object) write(lines []byte) error {
+	if o.file == nil {
+		o.buf.Write(lines)
+		o.size += int64(len(lines))
+		return nil
+	}
+	n, err := o.file.Write(lines)
+	if err == nil {
+		err = o.file.Sync()
+	}
+	if err != nil {
+		// truncate partially written lines so that they are not uploaded
+		_ = o.file.Truncate(o.size)
+		_, _ = o.file.Seek(o.size, 0)
+		return errors.Wrap(err, "unable to write spool file")
+	}
+	o.size += int64(n)
+	return nil
+}
+
+// contents returns all lines of the object
+func (o *object) contents() ([]byte, error) {
+	if o.file == nil {
+		return o.buf.Bytes(), nil
+	}
+	return ioutil.ReadFile(o.file.Name())
+}
+
+// close closes the spool file but keeps it on disk so that the object is uploaded after a restart
+func (o *object) close() error {
+	if o.file == nil {
+		return nil
+	}
+	return o.file.Close()
+}
+
+// remove deletes the spool file of an uploaded object
+func (o *object) remove() error {
+	if o.file == nil {
+		return nil
+	}
+	_ = o.file.Close()
+	return os.Remove(o.file.Name())
+}
+
+// recoverObjects loads the objects of the spool files that were not uploaded before the last shutdown.
+// Lines that were partially written during a crash are truncated.
+func recoverObjects(spoolDirectory string) ([]*object, error) {
+	files, err := ioutil.ReadDir(spoolDirectory)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read spool directory")
+	}
+	objects := make([]*object, 0)
+	for _, info := range files {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), spoolSuffix) {
+			continue
+		}
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(info.Name(), spoolSuffix))
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(spoolDirectory, info.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read spool file %s", path)
+		}
+		size := int64(bytes.LastIndexByte(data, '\n') + 1)
+		if size == 0 {
+			_ = os.Remove(path)
+			continue
+		}
+		if size != int64(len(data)) {
+			if err := os.Truncate(path, size); err != nil {
+				return nil, errors.Wrapf(err, "unable to truncate spool file %s", path)
+			}
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to open spool file %s", path)
+		}
+		objects = append(objects, &object{key: string(key), created: info.ModTime(), size: size, file: file})
+	}
+	return objects, nil
+}
+
+func spoolPath(spoolDirectory, key string) string {
+	return filepath.Join(spoolDirectory, base64.RawURLEncoding.EncodeToString([]byte(key))+spoolSuffix)
+}
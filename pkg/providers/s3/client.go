@@ -0,0 +1,164 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emptyPayloadHash is the sha256 hash of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// client is a minimal client of the S3 REST API that supports the operations required to archive objects
+type client struct {
+	endpoint   *url.URL
+	bucket     string
+	pathStyle  bool
+	httpClient *http.Client
+	// signerMux protects the signer that is replaced whenever the credentials of the mounted secret change
+	signerMux sync.RWMutex
+	signer    *signer
+	// now is the clock of the signatures
+	now func() time.Time
+}
+
+// s3Error is the error document returned by S3
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// putObject uploads the object with the given key.
+// The content md5 is always sent as it is required by buckets with object lock.
+func (c *client) putObject(ctx context.Context, key string, body []byte, header http.Header) error {
+	req, err := c.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	sum := md5.Sum(body)
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	c.sign(req, hashHex(body))
+
+	_, err = c.do(req)
+	return errors.Wrapf(err, "unable to put object %s", key)
+}
+
+// headBucket checks that the bucket exists and that the credentials grant access to it
+func (c *client) headBucket(ctx context.Context) error {
+	req, err := c.newRequest(ctx, http.MethodHead, "", nil)
+	if err != nil {
+		return err
+	}
+	c.sign(req, emptyPayloadHash)
+
+	status, err := c.do(req)
+	switch status {
+	case http.StatusNotFound:
+		return errors.Errorf("bucket %s does not exist", c.bucket)
+	case http.StatusForbidden:
+		return errors.Errorf("access to bucket %s is denied", c.bucket)
+	}
+	return errors.Wrapf(err, "unable to access bucket %s", c.bucket)
+}
+
+// sign signs the request with the current credentials
+func (c *client) sign(req *http.Request, payloadHash string) {
+	c.signerMux.RLock()
+	s := c.signer
+	c.signerMux.RUnlock()
+	s.sign(req, payloadHash, c.now())
+}
+
+// setSigner replaces the signer, requests that are in flight keep their signature
+func (c *client) setSigner(s *signer) {
+	c.signerMux.Lock()
+	defer c.signerMux.Unlock()
+	c.signer = s
+}
+
+// newRequest creates a request for the object with the given key or for the bucket if the key is empty.
+// The bucket is either part of the path or of the host depending on the addressing style.
+func (c *client) newRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	u := *c.endpoint
+	segments := []string{strings.TrimSuffix(u.Path, "/")}
+	if c.pathStyle {
+		segments = append(segments, c.bucket)
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	if key != "" {
+		segments = append(segments, strings.Split(key, "/")...)
+	}
+
+	decoded, encoded := make([]string, 0, len(segments)), make([]string, 0, len(segments))
+	for _, segment := range segments {
+		decoded = append(decoded, segment)
+		encoded = append(encoded, uriEncode(segment))
+	}
+	u.Path, u.RawPath = strings.Join(decoded, "/"), strings.Join(encoded, "/")
+	if u.Path == "" {
+		u.Path, u.RawPath = "/", "/"
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	return req.WithContext(ctx), nil
+}
+
+// do sends the request and returns its status.
+// Failed requests with a status that might succeed later are returned as transient errors.
+func (c *client) do(req *http.Request) (int, error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, provider.NewTransientError(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return res.StatusCode, nil
+	}
+
+	err = errors.Errorf("request failed with status %d", res.StatusCode)
+	doc := &s3Error{}
+	if xml.Unmarshal(body, doc) == nil && doc.Code != "" {
+		err = errors.Errorf("request failed with status %d: %s: %s", res.StatusCode, doc.Code, doc.Message)
+	}
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 || doc.Code == "RequestTimeout" {
+		return res.StatusCode, provider.NewTransientError(err)
+	}
+	return res.StatusCode, err
+}
@@ -0,0 +1,606 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"time"
+)
+
+const (
+	// CompressionGzip compresses the objects with gzip
+	CompressionGzip = "gzip"
+	// CompressionNone uploads the objects uncompressed
+	CompressionNone = "none"
+
+	// ServerSideEncryptionAES256 encrypts the objects with S3 managed keys
+	ServerSideEncryptionAES256 = "AES256"
+	// ServerSideEncryptionKMS encrypts the objects with KMS managed keys
+	ServerSideEncryptionKMS = "aws:kms"
+
+	// ObjectLockGovernance protects the objects from deletion by users without special permissions
+	ObjectLockGovernance = "GOVERNANCE"
+	// ObjectLockCompliance protects the objects from deletion by all users including the root user
+	ObjectLockCompliance = "COMPLIANCE"
+
+	defaultRegion         = "us-east-1"
+	defaultMaxObjectBytes = 64 * 1024 * 1024
+	defaultMaxObjectAge   = 5 * time.Minute
+	defaultTimeout        = 30 * time.Second
+
+	// maxPendingObjects is the number of flushed objects that are not yet uploaded
+	// after which new events are rejected
+	maxPendingObjects = 16
+	// partitionFormat is the time format of the partitions of the object keys
+	partitionFormat = "2006/01/02/15"
+	// objectTimeFormat is the time format of the object names
+	objectTimeFormat = "20060102T150405Z"
+)
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	SecretKeyAccessKeyID     = "accessKeyID"
+	SecretKeySecretAccessKey = "secretAccessKey"
+	SecretKeySessionToken    = "sessionToken"
+)
+
+// Provider archives the events as compressed JSON lines in an S3 compatible object storage.
+// The objects are partitioned by shoot and hour and are uploaded once they reach their maximum size or age.
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+	client *client
+
+	startOnce sync.Once
+	startErr  error
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	// mux protects the objects, flushMux serializes the uploads
+	mux      sync.Mutex
+	flushMux sync.Mutex
+	open     map[string]*object
+	pending  []*object
+	// flush is signaled when an object reached its maximum size
+	flush chan struct{}
+	now   func() time.Time
+}
+
+// Configuration is the configuration of the s3 provider
+type Configuration struct {
+	// Endpoint is the url of the S3 compatible endpoint, defaults to https://s3.<region>.amazonaws.com
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region is the region of the bucket that is used for the signatures, defaults to us-east-1
+	Region string `json:"region,omitempty"`
+	Bucket string `json:"bucket"`
+	// PathStyle addresses the bucket as part of the path instead of the host, e.g. for MinIO
+	PathStyle bool `json:"pathStyle,omitempty"`
+	// CA is the PEM encoded CA bundle that is used to verify the certificate of the endpoint
+	CA string `json:"ca,omitempty"`
+
+	// AccessKeyID, SecretAccessKey and SessionToken are the credentials,
+	// they can also be read from the referenced secret
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+
+	// Prefix is prepended to all object keys
+	Prefix string `json:"prefix,omitempty"`
+	// Shoot is the technical id of the shoot that is part of the object keys.
+	// It is set by the extension controller.
+	Shoot string `json:"shoot,omitempty"`
+	// Compression is either gzip or none, defaults to gzip
+	Compression string `json:"compression,omitempty"`
+	// MaxObjectBytes is the size of the uncompressed events after which an object is uploaded, defaults to 64Mi
+	MaxObjectBytes int64 `json:"maxObjectBytes,omitempty"`
+	// MaxObjectAge is the time after which an object is uploaded, defaults to 5m
+	MaxObjectAge *metav1.Duration `json:"maxObjectAge,omitempty"`
+	// SpoolDirectory is the directory the events are written to until their objects are uploaded.
+	// If it is not set, the events are kept in memory and are lost if the proxy crashes.
+	SpoolDirectory string `json:"spoolDirectory,omitempty"`
+
+	// ServerSideEncryption configures the encryption of the objects
+	// +optional
+	ServerSideEncryption *ServerSideEncryption `json:"serverSideEncryption,omitempty"`
+	// ObjectLock configures the retention of the objects in buckets with object lock
+	// +optional
+	ObjectLock *ObjectLock `json:"objectLock,omitempty"`
+
+	// Timeout of the requests, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ServerSideEncryption is the encryption of the objects at rest
+type ServerSideEncryption struct {
+	// Algorithm is either AES256 or aws:kms
+	Algorithm string `json:"algorithm"`
+	// KMSKeyID is the key that is used with aws:kms, the default key of the account is used otherwise
+	KMSKeyID string `json:"kmsKeyID,omitempty"`
+}
+
+// ObjectLock is the retention of the objects
+type ObjectLock struct {
+	// Mode is either GOVERNANCE or COMPLIANCE
+	Mode string `json:"mode"`
+	// Retention is the time after the upload until which an object cannot be deleted
+	Retention metav1.Duration `json:"retention"`
+}
+
+var _ provider.Interface = &Provider{}
+var _ provider.Closer = &Provider{}
+
+// New returns a new s3 provider
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "s3"
+}
+
+// InjectBackendConfig injects the backend configuration
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+	if err := validate(config); err != nil {
+		return err
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse endpoint")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(config.CA)) {
+			return errors.New("unable to parse CA bundle")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	p.client = &client{
+		endpoint:   endpoint,
+		bucket:     config.Bucket,
+		pathStyle:  config.PathStyle,
+		httpClient: &http.Client{Transport: transport, Timeout: config.Timeout.Duration},
+		now:        time.Now,
+	}
+	p.client.setSigner(&signer{
+		accessKeyID:     config.AccessKeyID,
+		secretAccessKey: config.SecretAccessKey,
+		sessionToken:    config.SessionToken,
+		region:          config.Region,
+	})
+	p.open = make(map[string]*object)
+	p.flush = make(chan struct{}, 1)
+	p.now = time.Now
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the credentials of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes. The credentials of the secret are never part of the configuration.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	s := &signer{
+		accessKeyID:     p.config.AccessKeyID,
+		secretAccessKey: p.config.SecretAccessKey,
+		sessionToken:    p.config.SessionToken,
+		region:          p.config.Region,
+	}
+	for key, field := range map[string]*string{
+		SecretKeyAccessKeyID:     &s.accessKeyID,
+		SecretKeySecretAccessKey: &s.secretAccessKey,
+		SecretKeySessionToken:    &s.sessionToken,
+	} {
+		if value, ok := data[key]; ok {
+			*field = string(value)
+		}
+	}
+	if s.accessKeyID == "" || s.secretAccessKey == "" {
+		return errors.Errorf("the secret has to contain the %s and the %s", SecretKeyAccessKeyID, SecretKeySecretAccessKey)
+	}
+	p.client.setSigner(s)
+	return nil
+}
+
+// ValidateBackendConfig validates the bucket, the endpoint and the credentials and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	if config.Bucket == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("bucket"), "A bucket has to be defined"))
+	}
+	if config.Endpoint != "" {
+		allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	}
+	// the credentials are either defined together or read from the referenced secret
+	switch {
+	case config.AccessKeyID == "" && config.SecretAccessKey == "":
+		if secretRef == nil {
+			allErrs = append(allErrs, field.Required(fldPath.Child("accessKeyID"), "An access key id and a secret access key or a backendProviderSecretRef has to be defined"))
+		}
+	case config.AccessKeyID == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("accessKeyID"), "An access key id has to be defined for the secret access key"))
+	case config.SecretAccessKey == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("secretAccessKey"), "A secret access key has to be defined for the access key id"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+// InjectLogger injects the logger
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Reconcile sets the shoot of the object keys and validates that the bucket is accessible
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Shoot == "" {
+		p.config.Shoot = ex.GetNamespace()
+	}
+	return p.client.headBucket(ctx)
+}
+
+// Delete is a noop as the archived events have to be retained
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the configuration including the shoot
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log appends the events to the objects of their partitions.
+// The events are acknowledged once they are written to the spool directory and are uploaded in the background.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	p.startOnce.Do(p.start)
+	if p.startErr != nil {
+		return p.startErr
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if len(p.pending) >= maxPendingObjects {
+		return provider.NewTransientError(errors.Errorf("%d objects are waiting for their upload", len(p.pending)))
+	}
+
+	var (
+		partialErr = &provider.PartialError{}
+		lines      = make(map[string]*bytes.Buffer)
+		indices    = make(map[string][]int)
+		partitions = make([]string, 0)
+	)
+	for i := range events.Items {
+		event := &events.Items[i]
+		data, err := provider.MarshalEventV1(event)
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: errors.Wrap(err, "unable to marshal event")})
+			continue
+		}
+		partition := p.partitionOf(event)
+		if _, ok := lines[partition]; !ok {
+			lines[partition] = &bytes.Buffer{}
+			partitions = append(partitions, partition)
+		}
+		lines[partition].Write(data)
+		lines[partition].WriteByte('\n')
+		indices[partition] = append(indices[partition], i)
+	}
+
+	for _, partition := range partitions {
+		if err := p.write(partition, lines[partition].Bytes()); err != nil {
+			for _, i := range indices[partition] {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err, Transient: true})
+			}
+		}
+	}
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	return nil
+}
+
+// Close uploads all objects and stops the background uploads.
+// Objects that cannot be uploaded are kept in the spool directory and are uploaded after the next start.
+func (p *Provider) Close() error {
+	if p.config == nil || p.cancel == nil {
+		return nil
+	}
+	p.cancel()
+	p.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.Timeout.Duration)
+	defer cancel()
+	err := p.upload(ctx, true)
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	for _, o := range p.pending {
+		_ = o.close()
+	}
+	for _, o := range p.open {
+		_ = o.close()
+	}
+	return err
+}
+
+// start recovers the objects of the spool directory and starts the background uploads
+func (p *Provider) start() {
+	if dir := p.config.SpoolDirectory; dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			p.startErr = errors.Wrap(err, "unable to create spool directory")
+			return
+		}
+		objects, err := recoverObjects(dir)
+		if err != nil {
+			p.startErr = err
+			return
+		}
+		if len(objects) != 0 {
+			p.log.Info("Recovered objects from spool directory", "objects", len(objects))
+			p.flush <- struct{}{}
+		}
+		p.pending = objects
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.run(ctx)
+	}()
+}
+
+// run uploads the objects that reached their maximum size or age until the context is done
+func (p *Provider) run(ctx context.Context) {
+	interval := p.config.MaxObjectAge.Duration / 2
+	if interval > time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-p.flush:
+		}
+		if err := p.upload(ctx, false); err != nil {
+			p.log.Error(err, "unable to upload objects, retrying")
+		}
+	}
+}
+
+// write appends the lines to the open object of the partition and flushes the object if it reached its maximum size
+func (p *Provider) write(partition string, lines []byte) error {
+	o, ok := p.open[partition]
+	if !ok {
+		now := p.now().UTC()
+		var err error
+		o, err = newObject(path.Join(partition, now.Format(objectTimeFormat)+"-"+utilrand.String(8)), now, p.config.SpoolDirectory)
+		if err != nil {
+			return err
+		}
+		p.open[partition] = o
+	}
+	if err := o.write(lines); err != nil {
+		return err
+	}
+	if o.size >= p.config.MaxObjectBytes {
+		delete(p.open, partition)
+		p.pending = append(p.pending, o)
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// upload flushes the objects that reached their maximum age or all objects if force is set
+// and uploads all flushed objects in the order they were flushed.
+func (p *Provider) upload(ctx context.Context, force bool) error {
+	p.flushMux.Lock()
+	defer p.flushMux.Unlock()
+
+	p.mux.Lock()
+	for partition, o := range p.open {
+		if force || p.now().Sub(o.created) >= p.config.MaxObjectAge.Duration {
+			delete(p.open, partition)
+			p.pending = append(p.pending, o)
+		}
+	}
+	pending := append([]*object(nil), p.pending...)
+	p.mux.Unlock()
+
+	for _, o := range pending {
+		if err := p.uploadObject(ctx, o); err != nil {
+			return err
+		}
+		p.mux.Lock()
+		p.pending = p.pending[1:]
+		p.mux.Unlock()
+		if err := o.remove(); err != nil {
+			p.log.Error(err, "unable to remove spool file", "object", o.key)
+		}
+	}
+	return nil
+}
+
+func (p *Provider) uploadObject(ctx context.Context, o *object) error {
+	data, err := o.contents()
+	if err != nil {
+		return errors.Wrapf(err, "unable to read object %s", o.key)
+	}
+
+	header := http.Header{}
+	key := o.key + spoolSuffix
+	if p.config.Compression == CompressionGzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		data, key = buf.Bytes(), key+".gz"
+		header.Set("Content-Type", "application/gzip")
+	} else {
+		header.Set("Content-Type", "application/x-ndjson")
+	}
+	if sse := p.config.ServerSideEncryption; sse != nil {
+		header.Set("X-Amz-Server-Side-Encryption", sse.Algorithm)
+		if sse.KMSKeyID != "" {
+			header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", sse.KMSKeyID)
+		}
+	}
+	if lock := p.config.ObjectLock; lock != nil {
+		header.Set("X-Amz-Object-Lock-Mode", lock.Mode)
+		header.Set("X-Amz-Object-Lock-Retain-Until-Date", p.now().Add(lock.Retention.Duration).UTC().Format(time.RFC3339))
+	}
+
+	if err := p.client.putObject(ctx, key, data, header); err != nil {
+		return err
+	}
+	p.log.V(1).Info("Successfully uploaded object", "key", key, "bytes", len(data))
+	return nil
+}
+
+// partitionOf returns the key prefix of the objects an event is written to
+func (p *Provider) partitionOf(event *audit.Event) string {
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = p.now()
+	}
+	return path.Join(p.config.Prefix, p.config.Shoot, ts.UTC().Format(partitionFormat))
+}
+
+func setDefaults(config *Configuration) {
+	if config.Region == "" {
+		config.Region = defaultRegion
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	if config.Compression == "" {
+		config.Compression = CompressionGzip
+	}
+	if config.MaxObjectBytes == 0 {
+		config.MaxObjectBytes = defaultMaxObjectBytes
+	}
+	if config.MaxObjectAge == nil {
+		config.MaxObjectAge = &metav1.Duration{Duration: defaultMaxObjectAge}
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+func validate(config *Configuration) error {
+	if config.Bucket == "" {
+		return errors.New("bucket has to be defined")
+	}
+	// the credentials are either defined together or read from the referenced secret
+	if (config.AccessKeyID == "") != (config.SecretAccessKey == "") {
+		return errors.New("access key id and secret access key have to be defined together")
+	}
+	switch config.Compression {
+	case CompressionGzip, CompressionNone:
+	default:
+		return errors.Errorf("unsupported compression %q, must be one of %s or %s", config.Compression, CompressionGzip, CompressionNone)
+	}
+	if config.MaxObjectBytes < 0 {
+		return errors.New("maximum object size must not be negative")
+	}
+	if config.MaxObjectAge.Duration <= 0 {
+		return errors.New("maximum object age must be positive")
+	}
+	if sse := config.ServerSideEncryption; sse != nil {
+		switch sse.Algorithm {
+		case ServerSideEncryptionAES256:
+			if sse.KMSKeyID != "" {
+				return errors.Errorf("a kms key can only be used with %s", ServerSideEncryptionKMS)
+			}
+		case ServerSideEncryptionKMS:
+		default:
+			return errors.Errorf("unsupported server side encryption %q, must be one of %s or %s", sse.Algorithm, ServerSideEncryptionAES256, ServerSideEncryptionKMS)
+		}
+	}
+	if lock := config.ObjectLock; lock != nil {
+		switch lock.Mode {
+		case ObjectLockGovernance, ObjectLockCompliance:
+		default:
+			return errors.Errorf("unsupported object lock mode %q, must be one of %s or %s", lock.Mode, ObjectLockGovernance, ObjectLockCompliance)
+		}
+		if lock.Retention.Duration <= 0 {
+			return errors.New("object lock retention must be positive")
+		}
+	}
+	u, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse endpoint")
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("endpoint %s must be an absolute http or https url", config.Endpoint)
+	}
+	return nil
+}
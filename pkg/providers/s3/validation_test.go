@@ -0,0 +1,46 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package s3
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var _ = Describe("Validation", func() {
+	var (
+		fldPath   = field.NewPath("backendProviderConfig")
+		secretRef = &corev1.SecretReference{Name: "s3-credentials"}
+	)
+
+	It("should require credentials if no secret is referenced", func() {
+		config := []byte(`{"bucket":"auditlog"}`)
+		errs := (&Provider{}).ValidateBackendConfig(config, nil, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.accessKeyID"))
+
+		Expect((&Provider{}).ValidateBackendConfig(config, secretRef, fldPath)).To(BeEmpty())
+	})
+
+	It("should require the secret access key for the access key id", func() {
+		errs := (&Provider{}).ValidateBackendConfig([]byte(`{"bucket":"auditlog","accessKeyID":"access"}`), secretRef, fldPath)
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0].Type).To(Equal(field.ErrorTypeRequired))
+		Expect(errs[0].Field).To(Equal("backendProviderConfig.secretAccessKey"))
+	})
+})
@@ -0,0 +1,247 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	"io"
+	"io/ioutil"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// EventPath is the path of the HTTP Event Collector event endpoint
+	EventPath = "/services/collector/event"
+	// AckPath is the path of the HTTP Event Collector acknowledgement endpoint
+	AckPath = "/services/collector/ack"
+
+	channelHeader = "X-Splunk-Request-Channel"
+)
+
+// Event is the envelope of an event that is sent to the HTTP Event Collector
+type Event struct {
+	Time       json.Number       `json:"time,omitempty"`
+	Host       string            `json:"host,omitempty"`
+	Source     string            `json:"source,omitempty"`
+	SourceType string            `json:"sourcetype,omitempty"`
+	Index      string            `json:"index,omitempty"`
+	Fields     map[string]string `json:"fields,omitempty"`
+	Event      json.RawMessage   `json:"event"`
+}
+
+// Response is the response of the HTTP Event Collector
+type Response struct {
+	Text               string `json:"text"`
+	Code               int    `json:"code"`
+	AckID              *int64 `json:"ackId,omitempty"`
+	InvalidEventNumber *int   `json:"invalid-event-number,omitempty"`
+}
+
+// AckRequest queries the acknowledgement status of sent events
+type AckRequest struct {
+	Acks []int64 `json:"acks"`
+}
+
+// AckResponse contains the acknowledgement status of the queried ack ids
+type AckResponse struct {
+	Acks map[string]bool `json:"acks"`
+}
+
+// batch is a set of events that are sent with one request
+type batch struct {
+	indexes []int
+	body    bytes.Buffer
+}
+
+func (b *batch) add(index int, data []byte) {
+	b.indexes = append(b.indexes, index)
+	b.body.Write(data)
+	b.body.WriteRune('\n')
+}
+
+// fail returns an event error for all events of the batch starting with the given position
+func (b *batch) fail(from int, err error, transient bool) []provider.EventError {
+	eventErrs := make([]provider.EventError, 0, len(b.indexes)-from)
+	for _, index := range b.indexes[from:] {
+		eventErrs = append(eventErrs, provider.EventError{Index: index, Err: err, Transient: transient})
+	}
+	return eventErrs
+}
+
+func (p *Provider) encode(event *audit.Event) ([]byte, error) {
+	data, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to marshal event")
+	}
+
+	metadata := provider.ShootMetadataFrom(event)
+	hecEvent := &Event{
+		Host:       p.config.Host,
+		Source:     p.config.Source,
+		SourceType: p.config.SourceType,
+		Index:      p.config.Index,
+		Fields:     fields(metadata),
+		Event:      data,
+	}
+	if hecEvent.Host == "" {
+		hecEvent.Host = metadata.TechnicalID
+	}
+	if ts := event.RequestReceivedTimestamp.Time; !ts.IsZero() {
+		hecEvent.Time = json.Number(strconv.FormatFloat(float64(ts.UnixNano())/float64(time.Second), 'f', 6, 64))
+	}
+	return json.Marshal(hecEvent)
+}
+
+// fields returns the shoot metadata as indexed fields, so that the events of multiple shoots can be searched efficiently
+func fields(metadata provider.ShootMetadata) map[string]string {
+	fields := map[string]string{}
+	for name, value := range map[string]string{
+		"shoot":         metadata.Name,
+		"project":       metadata.Project,
+		"technical_id":  metadata.TechnicalID,
+		"shoot_uid":     metadata.UID,
+		"seed":          metadata.Seed,
+		"region":        metadata.Region,
+		"provider_type": metadata.ProviderType,
+	} {
+		if value != "" {
+			fields[name] = value
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// send sends the batch to the HTTP Event Collector and returns the ack id of the batch if indexer acknowledgement is enabled.
+// The events that were not accepted are returned as event errors.
+func (p *Provider) send(b *batch) (*int64, []provider.EventError) {
+	statusCode, body, err := p.request(EventPath, &b.body)
+	if err != nil {
+		return nil, b.fail(0, err, provider.IsTransient(err))
+	}
+	res := &Response{}
+	if err := json.Unmarshal(body, res); err != nil {
+		p.log.V(5).Info("Unable to decode response", "statusCode", statusCode, "body", string(body))
+	}
+
+	if statusCode >= 200 && statusCode <= 299 {
+		return res.AckID, nil
+	}
+
+	statusErr := errors.Errorf("request returned status code %d: %s (code %d)", statusCode, res.Text, res.Code)
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		return nil, b.fail(0, provider.NewTransientError(statusErr), true)
+	case statusCode == http.StatusBadRequest && res.InvalidEventNumber != nil && *res.InvalidEventNumber >= 0 && *res.InvalidEventNumber < len(b.indexes):
+		// the events before the invalid event are indexed, the events after it are not processed
+		invalid := *res.InvalidEventNumber
+		eventErrs := []provider.EventError{{Index: b.indexes[invalid], Err: statusErr}}
+		return nil, append(eventErrs, b.fail(invalid+1, errors.New("event was not processed because of a previous invalid event"), true)...)
+	default:
+		return nil, b.fail(0, statusErr, false)
+	}
+}
+
+// awaitAcks polls the acknowledgement status of the sent batches until all are acknowledged or the timeout is reached.
+// The events of batches that are not acknowledged are returned as transient event errors.
+func (p *Provider) awaitAcks(pending map[int64]*batch) []provider.EventError {
+	ack := p.config.Acknowledgement
+	timeout := time.After(ack.Timeout.Duration)
+	for len(pending) != 0 {
+		select {
+		case <-timeout:
+			eventErrs := make([]provider.EventError, 0)
+			for _, b := range pending {
+				eventErrs = append(eventErrs, b.fail(0, provider.NewTransientError(errors.New("events were not acknowledged by the indexer")), true)...)
+			}
+			sort.Slice(eventErrs, func(i, j int) bool { return eventErrs[i].Index < eventErrs[j].Index })
+			return eventErrs
+		case <-time.After(ack.PollInterval.Duration):
+		}
+
+		ackReq := &AckRequest{Acks: make([]int64, 0, len(pending))}
+		for id := range pending {
+			ackReq.Acks = append(ackReq.Acks, id)
+		}
+		body, err := json.Marshal(ackReq)
+		if err != nil {
+			p.log.Error(err, "unable to marshal acknowledgement request")
+			continue
+		}
+		statusCode, body, err := p.request(AckPath, bytes.NewBuffer(body))
+		if err != nil {
+			p.log.Error(err, "unable to query acknowledgement status")
+			continue
+		}
+		if statusCode < 200 || statusCode > 299 {
+			p.log.Info("Unable to query acknowledgement status", "statusCode", statusCode, "body", string(body))
+			continue
+		}
+		res := &AckResponse{}
+		if err := json.Unmarshal(body, res); err != nil {
+			p.log.Error(err, "unable to decode acknowledgement response")
+			continue
+		}
+
+		for id, acked := range res.Acks {
+			ackID, err := strconv.ParseInt(id, 10, 64)
+			if err == nil && acked {
+				delete(pending, ackID)
+			}
+		}
+	}
+	return nil
+}
+
+// request posts the payload to the given path of the HTTP Event Collector and returns the status code and body of the response
+func (p *Provider) request(rawPath string, payload io.Reader) (int, []byte, error) {
+	u, err := url.Parse(p.config.Endpoint)
+	if err != nil {
+		return 0, nil, err
+	}
+	u.Path = path.Join(u.Path, rawPath)
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Splunk "+p.currentToken())
+	req.Header.Set("Content-Type", "application/json")
+	if p.config.Acknowledgement != nil {
+		req.Header.Set(channelHeader, p.config.Acknowledgement.Channel)
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, provider.NewTransientError(errors.Wrapf(err, "unable to do request to %s", u.String()))
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, provider.NewTransientError(errors.Wrap(err, "unable to read response body"))
+	}
+	return res.StatusCode, body, nil
+}
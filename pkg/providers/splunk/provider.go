@@ -0,0 +1,256 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splunk
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net/http"
+	"sigs.k8s.io/yaml"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSourceType      = "kube:apiserver:audit"
+	defaultMaxBatchSize    = 500
+	defaultMaxBatchBytes   = 1024 * 1024
+	defaultAckTimeout      = 30 * time.Second
+	defaultAckPollInterval = time.Second
+	requestTimeout         = 30 * time.Second
+
+	// SecretKeyToken is the key of the token in the secret that is referenced by the backendProviderSecretRef
+	SecretKeyToken = "token"
+)
+
+type Provider struct {
+	log    logr.Logger
+	client *http.Client
+	config *Configuration
+
+	// tokenMux protects the token that is replaced whenever the mounted secret changes.
+	// The token of a secret is never part of the configuration.
+	tokenMux sync.RWMutex
+	token    string
+}
+
+// Configuration is the splunk provider specific configuration
+type Configuration struct {
+	// Endpoint is the url of the HTTP Event Collector, e.g. https://splunk:8088
+	Endpoint string `json:"endpoint"`
+	// Token is the HTTP Event Collector token, it can also be read from the referenced secret
+	Token string `json:"token,omitempty"`
+
+	Index      string `json:"index,omitempty"`
+	Source     string `json:"source,omitempty"`
+	SourceType string `json:"sourcetype,omitempty"`
+	// Host defaults to the technical id of the shoot that is attached to the events by the proxy
+	Host string `json:"host,omitempty"`
+
+	// MaxBatchSize is the maximum number of events that are sent with one request
+	MaxBatchSize int `json:"maxBatchSize,omitempty"`
+	// MaxBatchBytes is the maximum size of the events that are sent with one request
+	MaxBatchBytes int `json:"maxBatchBytes,omitempty"`
+
+	// Acknowledgement has to be configured if indexer acknowledgement is enabled for the token.
+	// +optional
+	Acknowledgement *AcknowledgementConfiguration `json:"acknowledgement,omitempty"`
+}
+
+// AcknowledgementConfiguration configures how the indexer acknowledgement of the sent events is awaited
+type AcknowledgementConfiguration struct {
+	// Channel is the id of the request channel. A random channel is used if no channel is defined.
+	Channel string `json:"channel,omitempty"`
+	// Timeout is the maximum time to wait for the acknowledgement of sent events.
+	// Events that are not acknowledged within the timeout are sent again.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// PollInterval is the interval in which the acknowledgement status is queried
+	PollInterval *metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{
+		client: &http.Client{Timeout: requestTimeout},
+	}, nil
+}
+
+func (p *Provider) Name() string {
+	return "splunk"
+}
+
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	if config.Endpoint == "" {
+		return errors.New("endpoint is not defined")
+	}
+	setDefaults(config)
+	p.setToken(config.Token)
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the token of the configuration with the token of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	token := p.config.Token
+	if value, ok := data[SecretKeyToken]; ok {
+		token = string(value)
+	}
+	if token == "" {
+		return errors.Errorf("the secret has to contain the %s", SecretKeyToken)
+	}
+	p.setToken(token)
+	return nil
+}
+
+func (p *Provider) setToken(token string) {
+	p.tokenMux.Lock()
+	defer p.tokenMux.Unlock()
+	p.token = token
+}
+
+// currentToken returns the token that is used for the next request
+func (p *Provider) currentToken() string {
+	p.tokenMux.RLock()
+	defer p.tokenMux.RUnlock()
+	return p.token
+}
+
+// ValidateBackendConfig validates the endpoint and the token of the HTTP event collector and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	if config.Token == "" && secretRef == nil {
+		allErrs = append(allErrs, field.Required(fldPath.Child("token"), "A token or a backendProviderSecretRef has to be defined"))
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Log sends the events in batches to the HTTP Event Collector.
+// If indexer acknowledgement is configured, it only returns after all batches are acknowledged.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+
+	var (
+		partialErr = &provider.PartialError{}
+		pending    = make(map[int64]*batch)
+		current    = &batch{}
+	)
+	flush := func() {
+		if len(current.indexes) == 0 {
+			return
+		}
+		ackID, eventErrs := p.send(current)
+		partialErr.Errors = append(partialErr.Errors, eventErrs...)
+		if ackID != nil && len(eventErrs) == 0 {
+			pending[*ackID] = current
+		}
+		current = &batch{}
+	}
+
+	for i := range events.Items {
+		data, err := p.encode(&events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err})
+			continue
+		}
+		if len(current.indexes) >= p.config.MaxBatchSize || (len(current.indexes) != 0 && current.body.Len()+len(data) > p.config.MaxBatchBytes) {
+			flush()
+		}
+		current.add(i, data)
+	}
+	flush()
+
+	if len(pending) != 0 {
+		partialErr.Errors = append(partialErr.Errors, p.awaitAcks(pending)...)
+	}
+
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	p.log.Info("Successfully sent events", "events", len(events.Items))
+	return nil
+}
+
+// Reconcile noop reconcile function
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// Delete noop delete function
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the backend configuration including the generated acknowledgement channel
+// so that the channel is stable between restarts of the proxy.
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+func setDefaults(config *Configuration) {
+	if config.SourceType == "" {
+		config.SourceType = defaultSourceType
+	}
+	if config.MaxBatchSize <= 0 {
+		config.MaxBatchSize = defaultMaxBatchSize
+	}
+	if config.MaxBatchBytes <= 0 {
+		config.MaxBatchBytes = defaultMaxBatchBytes
+	}
+	if ack := config.Acknowledgement; ack != nil {
+		if ack.Channel == "" {
+			ack.Channel = string(uuid.NewUUID())
+		}
+		if ack.Timeout == nil {
+			ack.Timeout = &metav1.Duration{Duration: defaultAckTimeout}
+		}
+		if ack.PollInterval == nil {
+			ack.PollInterval = &metav1.Duration{Duration: defaultAckPollInterval}
+		}
+	}
+}
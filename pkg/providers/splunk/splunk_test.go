@@ -0,0 +1,234 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splunk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// hec is a stand-in for the HTTP Event Collector
+type hec struct {
+	mux          sync.Mutex
+	requests     []*http.Request
+	events       [][]Event
+	status       int
+	invalidEvent *int
+	acked        bool
+	nextAckID    int64
+}
+
+func (h *hec) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	body, err := ioutil.ReadAll(r.Body)
+	Expect(err).ToNot(HaveOccurred())
+
+	if r.URL.Path == AckPath {
+		ackReq := &AckRequest{}
+		Expect(json.Unmarshal(body, ackReq)).To(Succeed())
+		ackRes := &AckResponse{Acks: map[string]bool{}}
+		for _, id := range ackReq.Acks {
+			ackRes.Acks[fmt.Sprintf("%d", id)] = h.acked
+		}
+		Expect(json.NewEncoder(w).Encode(ackRes)).To(Succeed())
+		return
+	}
+
+	h.requests = append(h.requests, r)
+	events := make([]Event, 0)
+	decoder := json.NewDecoder(bytes.NewBuffer(body))
+	for decoder.More() {
+		event := Event{}
+		Expect(decoder.Decode(&event)).To(Succeed())
+		events = append(events, event)
+	}
+	h.events = append(h.events, events)
+
+	res := &Response{Text: "Success"}
+	if h.status != http.StatusOK {
+		res.Text, res.Code, res.InvalidEventNumber = "Invalid data format", 6, h.invalidEvent
+	} else if r.Header.Get(channelHeader) != "" {
+		ackID := h.nextAckID
+		h.nextAckID++
+		res.AckID = &ackID
+	}
+	w.WriteHeader(h.status)
+	Expect(json.NewEncoder(w).Encode(res)).To(Succeed())
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		server  *httptest.Server
+		backend *hec
+		now     = time.Date(2020, 3, 1, 12, 0, 0, 500000000, time.UTC)
+		events  *audit.EventList
+	)
+
+	newProvider := func(config string) *Provider {
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig([]byte(fmt.Sprintf(`{"endpoint":%q,"token":"secret",%s}`, server.URL, config)))).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		backend = &hec{status: http.StatusOK}
+		server = httptest.NewServer(backend)
+		events = &audit.EventList{}
+		for i := 0; i < 3; i++ {
+			events.Items = append(events.Items, audit.Event{
+				AuditID:                  types.UID(fmt.Sprintf("%d", i)),
+				Verb:                     "get",
+				RequestReceivedTimestamp: metav1.NewMicroTime(now),
+			})
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should send the events in batches", func() {
+		p := newProvider(`"index":"audit","host":"shoot--foo--bar","maxBatchSize":2`)
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(backend.requests).To(HaveLen(2))
+		Expect(backend.requests[0].URL.Path).To(Equal(EventPath))
+		Expect(backend.requests[0].Header.Get("Authorization")).To(Equal("Splunk secret"))
+		Expect(backend.events[0]).To(HaveLen(2))
+		Expect(backend.events[1]).To(HaveLen(1))
+
+		event := backend.events[0][0]
+		Expect(event.Time.String()).To(Equal("1583064000.500000"))
+		Expect(event.Index).To(Equal("audit"))
+		Expect(event.Host).To(Equal("shoot--foo--bar"))
+		Expect(event.SourceType).To(Equal(defaultSourceType))
+		Expect(string(event.Event)).To(ContainSubstring(`"auditID":"0"`))
+	})
+
+	It("should send the shoot metadata as indexed fields", func() {
+		p := newProvider(`"index":"audit"`)
+		events.Items[0].Annotations = provider.ShootMetadata{Name: "bar", Project: "foo", TechnicalID: "shoot--foo--bar", Seed: "aws", Region: "eu-west-1"}.Annotations()
+		Expect(p.Log(events)).To(Succeed())
+
+		event := backend.events[0][0]
+		Expect(event.Host).To(Equal("shoot--foo--bar"))
+		Expect(event.Fields).To(Equal(map[string]string{
+			"shoot":        "bar",
+			"project":      "foo",
+			"technical_id": "shoot--foo--bar",
+			"seed":         "aws",
+			"region":       "eu-west-1",
+		}))
+		Expect(backend.events[0][1].Fields).To(BeNil())
+	})
+
+	It("should only reject the invalid event of a batch", func() {
+		p := newProvider(`"maxBatchSize":5`)
+		backend.status, backend.invalidEvent = http.StatusBadRequest, new(int)
+		*backend.invalidEvent = 1
+
+		err := p.Log(events)
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(2))
+		Expect(partialErr.Errors[0].Index).To(Equal(1))
+		Expect(partialErr.Errors[0].Transient).To(BeFalse())
+		Expect(partialErr.Errors[1].Index).To(Equal(2))
+		Expect(partialErr.Errors[1].Transient).To(BeTrue())
+	})
+
+	It("should retry events if the collector is busy", func() {
+		p := newProvider(`"maxBatchSize":5`)
+		backend.status = http.StatusServiceUnavailable
+
+		err := p.Log(events)
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(3))
+		Expect(partialErr.Errors[0].Transient).To(BeTrue())
+	})
+
+	Context("indexer acknowledgement", func() {
+		const ackConfig = `"maxBatchSize":2,"acknowledgement":{"channel":"8a3f2f7e-7f9d-4a55-9a28-6a0d5f1e0b1c","timeout":"200ms","pollInterval":"10ms"}`
+
+		It("should wait until all batches are acknowledged", func() {
+			p := newProvider(ackConfig)
+			backend.acked = true
+			Expect(p.Log(events)).To(Succeed())
+			Expect(backend.requests[0].Header.Get(channelHeader)).To(Equal("8a3f2f7e-7f9d-4a55-9a28-6a0d5f1e0b1c"))
+		})
+
+		It("should retry the events of batches that are not acknowledged", func() {
+			p := newProvider(ackConfig)
+			err := p.Log(events)
+			partialErr, ok := err.(*provider.PartialError)
+			Expect(ok).To(BeTrue())
+			Expect(partialErr.Errors).To(HaveLen(3))
+			for i, eventErr := range partialErr.Errors {
+				Expect(eventErr.Index).To(Equal(i))
+				Expect(eventErr.Transient).To(BeTrue())
+			}
+		})
+
+		It("should generate a channel if none is configured", func() {
+			p := newProvider(`"acknowledgement":{}`)
+			Expect(p.config.Acknowledgement.Channel).ToNot(BeEmpty())
+		})
+	})
+
+	It("should require an endpoint", func() {
+		Expect((&Provider{}).InjectBackendConfig([]byte(`{"token":"secret"}`))).ToNot(Succeed())
+	})
+
+	It("should send the token of the reloaded secret", func() {
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig([]byte(fmt.Sprintf(`{"endpoint":%q}`, server.URL)))).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{})).ToNot(Succeed())
+
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyToken: []byte("first")})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyToken: []byte("second")})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(backend.requests).To(HaveLen(2))
+		Expect(backend.requests[0].Header.Get("Authorization")).To(Equal("Splunk first"))
+		Expect(backend.requests[1].Header.Get("Authorization")).To(Equal("Splunk second"))
+		config, err := p.BackendConfig()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(config)).ToNot(ContainSubstring("first"))
+	})
+})
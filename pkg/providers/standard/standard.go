@@ -20,6 +20,8 @@ import (
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"k8s.io/apiserver/pkg/apis/audit"
 )
 
@@ -50,6 +52,11 @@ func (p *Provider) Log(events *audit.EventList) error {
 	return nil
 }
 
+// ValidateBackendConfig noop validation function, the provider has no configuration
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	return nil
+}
+
 // Reconcile noop reconcile function
 func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
 
@@ -0,0 +1,181 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"bytes"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// nilValue is used for empty header fields
+	nilValue = "-"
+	// timestampFormat is the RFC 3339 format of the header timestamp with microseconds
+	timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	maxHostnameLength = 255
+	maxAppNameLength  = 48
+	maxMsgIDLength    = 32
+)
+
+// facilities are the facility codes by name as defined in RFC 5424
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14, "solaris-cron": 15,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// severities are the severity codes by name as defined in RFC 5424
+var severities = map[string]int{
+	"emerg": 0, "alert": 1, "crit": 2, "err": 3, "warning": 4, "notice": 5, "info": 6, "debug": 7,
+}
+
+// renderMessage renders the event as RFC 5424 message.
+// The structured data contains the user, request, object reference and response code and the message is the
+// event in the audit.k8s.io/v1 format.
+func (p *Provider) renderMessage(event *audit.Event) ([]byte, error) {
+	msg, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := event.RequestReceivedTimestamp.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<" + strconv.Itoa(p.facility*8+p.severityOf(event)) + ">1 ")
+	buf.WriteString(ts.UTC().Format(timestampFormat) + " ")
+	buf.WriteString(headerField(p.hostname(), maxHostnameLength) + " ")
+	buf.WriteString(headerField(p.config.AppName, maxAppNameLength) + " ")
+	buf.WriteString(nilValue + " ")
+	buf.WriteString(headerField(string(event.Stage), maxMsgIDLength) + " ")
+
+	sd := &structuredData{enterpriseNumber: strconv.Itoa(p.config.EnterpriseNumber)}
+	sd.element("user",
+		"name", event.User.Username,
+		"uid", event.User.UID,
+		"groups", strings.Join(event.User.Groups, ","),
+		"impersonatedName", impersonatedUser(event))
+	sd.element("request",
+		"auditID", string(event.AuditID),
+		"level", string(event.Level),
+		"verb", event.Verb,
+		"requestURI", event.RequestURI,
+		"sourceIPs", strings.Join(event.SourceIPs, ","))
+	if ref := event.ObjectRef; ref != nil {
+		sd.element("objectRef",
+			"apiGroup", ref.APIGroup,
+			"apiVersion", ref.APIVersion,
+			"resource", ref.Resource,
+			"subresource", ref.Subresource,
+			"namespace", ref.Namespace,
+			"name", ref.Name)
+	}
+	if status := event.ResponseStatus; status != nil {
+		sd.element("response", "code", strconv.Itoa(int(status.Code)))
+	}
+	buf.WriteString(sd.String())
+
+	buf.WriteByte(' ')
+	buf.Write(msg)
+	return buf.Bytes(), nil
+}
+
+// severityOf returns the severity of the response code of the event if it is mapped
+// and the severity of its level otherwise
+func (p *Provider) severityOf(event *audit.Event) int {
+	if status := event.ResponseStatus; status != nil {
+		code := strconv.Itoa(int(status.Code))
+		if severity, ok := p.codeSeverities[code]; ok {
+			return severity
+		}
+		if severity, ok := p.codeSeverities[code[:1]+"xx"]; ok {
+			return severity
+		}
+	}
+	if severity, ok := p.levelSeverities[event.Level]; ok {
+		return severity
+	}
+	return p.defaultSeverity
+}
+
+func (p *Provider) hostname() string {
+	if p.config.Hostname != "" {
+		return p.config.Hostname
+	}
+	return p.config.Shoot
+}
+
+func impersonatedUser(event *audit.Event) string {
+	if event.ImpersonatedUser == nil {
+		return ""
+	}
+	return event.ImpersonatedUser.Username
+}
+
+// headerField replaces all characters that are not allowed in header fields and truncates the value
+func headerField(value string, maxLength int) string {
+	if value == "" {
+		return nilValue
+	}
+	field := []byte(value)
+	for i, c := range field {
+		if c < 33 || c > 126 {
+			field[i] = '_'
+		}
+	}
+	if len(field) > maxLength {
+		field = field[:maxLength]
+	}
+	return string(field)
+}
+
+// structuredData renders the structured data elements of a message
+type structuredData struct {
+	enterpriseNumber string
+	buf              bytes.Buffer
+}
+
+// element adds an element with the given parameter names and values. Empty values are omitted.
+func (sd *structuredData) element(id string, params ...string) {
+	sd.buf.WriteString("[" + id + "@" + sd.enterpriseNumber)
+	for i := 0; i+1 < len(params); i += 2 {
+		if params[i+1] == "" {
+			continue
+		}
+		sd.buf.WriteString(" " + params[i] + `="`)
+		sd.buf.WriteString(escapeParamValue(params[i+1]))
+		sd.buf.WriteByte('"')
+	}
+	sd.buf.WriteByte(']')
+}
+
+func (sd *structuredData) String() string {
+	if sd.buf.Len() == 0 {
+		return nilValue
+	}
+	return sd.buf.String()
+}
+
+// escapeParamValue escapes the characters '"', '\' and ']' of parameter values
+func escapeParamValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
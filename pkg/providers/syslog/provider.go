@@ -0,0 +1,453 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"net"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// NetworkUDP sends every message as one datagram as defined in RFC 5426
+	NetworkUDP = "udp"
+	// NetworkTCP sends the messages over a tcp connection as defined in RFC 6587
+	NetworkTCP = "tcp"
+	// NetworkTLS sends the messages over a tls connection as defined in RFC 5425
+	NetworkTLS = "tls"
+
+	// FramingOctetCounting prefixes every message with its length
+	FramingOctetCounting = "octet-counting"
+	// FramingNonTransparent terminates every message with a line feed
+	FramingNonTransparent = "non-transparent"
+
+	defaultAppName          = "kube-apiserver"
+	defaultFacility         = "local0"
+	defaultSeverity         = "info"
+	defaultEnterpriseNumber = 32473
+	defaultTimeout          = 10 * time.Second
+	// defaultUDPMaxMessageSize is the maximum payload of an UDP datagram
+	defaultUDPMaxMessageSize = 65507
+	// connectedCheckTimeout is the time to wait for the closing of a connection before it is used
+	connectedCheckTimeout = time.Millisecond
+)
+
+// defaultResponseCodeSeverities are used if no severities of response codes are configured
+var defaultResponseCodeSeverities = map[string]string{"4xx": "warning", "5xx": "err"}
+
+// Provider sends the events as RFC 5424 messages to a syslog server
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+
+	tlsConfig       *tls.Config
+	facility        int
+	defaultSeverity int
+	levelSeverities map[audit.Level]int
+	codeSeverities  map[string]int
+
+	// mux serializes the writes to the connection
+	mux  sync.Mutex
+	conn net.Conn
+}
+
+// Configuration is the configuration of the syslog provider
+type Configuration struct {
+	// Address is the host and port of the syslog server
+	Address string `json:"address"`
+	// Network is either udp, tcp or tls, defaults to tcp
+	Network string `json:"network,omitempty"`
+	// Framing of the messages sent over tcp and tls is either octet-counting or non-transparent,
+	// defaults to octet-counting
+	Framing string `json:"framing,omitempty"`
+	// TLS configures the tls connection
+	// +optional
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+
+	// Hostname is the hostname of the messages, defaults to the shoot
+	Hostname string `json:"hostname,omitempty"`
+	// Shoot is the technical id of the shoot. It is set by the extension controller.
+	Shoot string `json:"shoot,omitempty"`
+	// AppName is the app name of the messages, defaults to kube-apiserver
+	AppName string `json:"appName,omitempty"`
+	// EnterpriseNumber is the private enterprise number of the structured data ids,
+	// defaults to the documentation number 32473
+	EnterpriseNumber int `json:"enterpriseNumber,omitempty"`
+	// Facility is the name of the facility of the messages, defaults to local0
+	Facility string `json:"facility,omitempty"`
+	// Severity maps the events to severities
+	Severity SeverityConfiguration `json:"severity,omitempty"`
+
+	// MaxMessageSize is the size after which messages are truncated, defaults to 65507 for udp and
+	// no limit for tcp and tls
+	MaxMessageSize int `json:"maxMessageSize,omitempty"`
+	// Timeout of the connection and writes, defaults to 10s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// TLSConfiguration configures the tls connection to the syslog server
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificate of the server
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert               string `json:"cert,omitempty"`
+	Key                string `json:"key,omitempty"`
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+// SeverityConfiguration maps the audit levels and response codes of the events to severities
+type SeverityConfiguration struct {
+	// Default is the severity of events that are not mapped otherwise, defaults to info
+	Default string `json:"default,omitempty"`
+	// Levels maps audit levels to severities
+	Levels map[audit.Level]string `json:"levels,omitempty"`
+	// ResponseCodes maps response codes, e.g. 403, or classes of response codes, e.g. 5xx, to severities.
+	// They take precedence over the levels and default to 4xx: warning and 5xx: err.
+	ResponseCodes map[string]string `json:"responseCodes,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+
+// New returns a new syslog provider
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+// Name returns the name of the provider
+func (p *Provider) Name() string {
+	return "syslog"
+}
+
+// InjectBackendConfig injects the backend configuration
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+	setDefaults(config)
+
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return errors.Wrapf(err, "invalid address %q", config.Address)
+	}
+	switch config.Network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return errors.Errorf("unsupported network %q, must be one of %s, %s or %s", config.Network, NetworkUDP, NetworkTCP, NetworkTLS)
+	}
+	switch config.Framing {
+	case FramingOctetCounting, FramingNonTransparent:
+	default:
+		return errors.Errorf("unsupported framing %q, must be one of %s or %s", config.Framing, FramingOctetCounting, FramingNonTransparent)
+	}
+	if config.EnterpriseNumber < 0 {
+		return errors.New("enterprise number must not be negative")
+	}
+
+	facility, ok := facilities[config.Facility]
+	if !ok {
+		return errors.Errorf("unknown facility %q", config.Facility)
+	}
+	severity, err := severityOf(config.Severity.Default)
+	if err != nil {
+		return err
+	}
+	levels := make(map[audit.Level]int, len(config.Severity.Levels))
+	for level, name := range config.Severity.Levels {
+		if levels[level], err = severityOf(name); err != nil {
+			return err
+		}
+	}
+	codes := make(map[string]int, len(config.Severity.ResponseCodes))
+	for code, name := range config.Severity.ResponseCodes {
+		if !isResponseCode(code) {
+			return errors.Errorf("invalid response code %q, must be a code like 403 or a class like 5xx", code)
+		}
+		if codes[code], err = severityOf(name); err != nil {
+			return err
+		}
+	}
+
+	var tlsConfig *tls.Config
+	if config.Network == NetworkTLS {
+		if tlsConfig, err = tlsConfigFor(config.TLS); err != nil {
+			return err
+		}
+	}
+
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closeConn()
+	p.tlsConfig = tlsConfig
+	p.facility, p.defaultSeverity, p.levelSeverities, p.codeSeverities = facility, severity, levels, codes
+	p.config = config
+	return nil
+}
+
+// ValidateBackendConfig validates the address of the syslog server and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	allErrs = append(allErrs, provider.ValidateAddress(config.Address, fldPath.Child("address"))...)
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+// InjectLogger injects the logger
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Reconcile sets the shoot that is used as default hostname
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	if p.config.Shoot == "" {
+		p.config.Shoot = ex.GetNamespace()
+	}
+	return nil
+}
+
+// Delete is a noop
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// BackendConfig returns the configuration including the shoot
+func (p *Provider) BackendConfig() ([]byte, error) {
+	if p.config == nil {
+		return nil, errors.New("configuration is not defined")
+	}
+	return json.Marshal(p.config)
+}
+
+// Log sends every event as one message.
+// A broken connection is reestablished once, events that cannot be sent afterwards are returned as transient errors.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.conn != nil && p.config.Network != NetworkUDP && !p.connected() {
+		p.log.V(1).Info("Connection closed by syslog server, reconnecting")
+		p.closeConn()
+	}
+
+	partialErr := &provider.PartialError{}
+	reconnected := false
+	for i := range events.Items {
+		msg, err := p.renderMessage(&events.Items[i])
+		if err != nil {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: errors.Wrap(err, "unable to render message")})
+			continue
+		}
+		msg = p.frame(msg)
+
+		err = p.write(msg)
+		if err != nil && !reconnected {
+			p.log.V(1).Info("Reconnecting to syslog server", "reason", err.Error())
+			reconnected = true
+			err = p.write(msg)
+		}
+		if err != nil {
+			for j := i; j < len(events.Items); j++ {
+				partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: j, Err: err, Transient: true})
+			}
+			break
+		}
+	}
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	return nil
+}
+
+// frame truncates the message to the maximum size and adds the framing of stream connections
+func (p *Provider) frame(msg []byte) []byte {
+	if p.config.MaxMessageSize > 0 && len(msg) > p.config.MaxMessageSize {
+		msg = msg[:p.config.MaxMessageSize]
+	}
+	if p.config.Network == NetworkUDP {
+		return msg
+	}
+	if p.config.Framing == FramingNonTransparent {
+		return append(msg, '\n')
+	}
+	return append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+}
+
+// write sends the message and closes the connection if it fails, so that the next write reconnects
+func (p *Provider) write(msg []byte) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	if err := p.conn.SetWriteDeadline(time.Now().Add(p.config.Timeout.Duration)); err != nil {
+		p.closeConn()
+		return err
+	}
+	if _, err := p.conn.Write(msg); err != nil {
+		p.closeConn()
+		return errors.Wrap(err, "unable to write message")
+	}
+	return nil
+}
+
+func (p *Provider) connect() error {
+	network := p.config.Network
+	if network == NetworkTLS {
+		network = NetworkTCP
+	}
+	conn, err := net.DialTimeout(network, p.config.Address, p.config.Timeout.Duration)
+	if err != nil {
+		return errors.Wrapf(err, "unable to connect to %s", p.config.Address)
+	}
+	if p.config.Network == NetworkTLS {
+		tlsConfig := p.tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(p.config.Address)
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		_ = tlsConn.SetDeadline(time.Now().Add(p.config.Timeout.Duration))
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return errors.Wrapf(err, "unable to establish tls connection to %s", p.config.Address)
+		}
+		_ = tlsConn.SetDeadline(time.Time{})
+		conn = tlsConn
+	}
+	p.conn = conn
+	return nil
+}
+
+// connected checks that the server did not close the stream connection.
+// Otherwise the first message written to a closed connection would be lost silently.
+// Syslog servers never send data, so a read either times out or returns the closing of the connection.
+func (p *Provider) connected() bool {
+	if err := p.conn.SetReadDeadline(time.Now().Add(connectedCheckTimeout)); err != nil {
+		return false
+	}
+	var buf [1]byte
+	_, err := p.conn.Read(buf[:])
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		_ = p.conn.SetReadDeadline(time.Time{})
+		return true
+	}
+	return false
+}
+
+func (p *Provider) closeConn() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func setDefaults(config *Configuration) {
+	if config.Network == "" {
+		config.Network = NetworkTCP
+	}
+	if config.Framing == "" {
+		config.Framing = FramingOctetCounting
+	}
+	if config.AppName == "" {
+		config.AppName = defaultAppName
+	}
+	if config.EnterpriseNumber == 0 {
+		config.EnterpriseNumber = defaultEnterpriseNumber
+	}
+	if config.Facility == "" {
+		config.Facility = defaultFacility
+	}
+	if config.Severity.Default == "" {
+		config.Severity.Default = defaultSeverity
+	}
+	if config.Severity.ResponseCodes == nil {
+		config.Severity.ResponseCodes = make(map[string]string, len(defaultResponseCodeSeverities))
+		for code, severity := range defaultResponseCodeSeverities {
+			config.Severity.ResponseCodes[code] = severity
+		}
+	}
+	if config.MaxMessageSize == 0 && config.Network == NetworkUDP {
+		config.MaxMessageSize = defaultUDPMaxMessageSize
+	}
+	if config.Timeout == nil {
+		config.Timeout = &metav1.Duration{Duration: defaultTimeout}
+	}
+}
+
+func severityOf(name string) (int, error) {
+	severity, ok := severities[name]
+	if !ok {
+		return 0, errors.Errorf("unknown severity %q", name)
+	}
+	return severity, nil
+}
+
+// isResponseCode checks that the code is a three digit response code or a class like 5xx
+func isResponseCode(code string) bool {
+	if len(code) != 3 || code[0] < '1' || code[0] > '5' {
+		return false
+	}
+	if code[1:] == "xx" {
+		return true
+	}
+	_, err := strconv.Atoi(code)
+	return err == nil
+}
+
+func tlsConfigFor(config *TLSConfiguration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if config == nil {
+		return tlsConfig, nil
+	}
+	tlsConfig.ServerName, tlsConfig.InsecureSkipVerify = config.ServerName, config.InsecureSkipVerify
+	if config.CA != "" {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM([]byte(config.CA)) {
+			return nil, errors.New("unable to parse CA bundle")
+		}
+	}
+	if config.Cert != "" || config.Key != "" {
+		cert, err := tls.X509KeyPair([]byte(config.Cert), []byte(config.Key))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,384 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package syslog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// server is a syslog server that receives messages over tcp, tls or udp
+type server struct {
+	listener   net.Listener
+	packetConn net.PacketConn
+	framing    string
+	// closeAfter closes every connection after the given number of messages if it is positive
+	closeAfter int
+
+	mux      sync.Mutex
+	messages []string
+	conns    int
+}
+
+func newStreamServer(framing string, tlsConfig *tls.Config) *server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	s := &server{listener: listener, framing: framing}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func newPacketServer() *server {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	Expect(err).ToNot(HaveOccurred())
+	s := &server{packetConn: conn}
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.receive(string(buf[:n]))
+		}
+	}()
+	return s
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer conn.Close()
+	s.mux.Lock()
+	s.conns++
+	closeAfter := s.closeAfter
+	s.mux.Unlock()
+
+	r := bufio.NewReader(conn)
+	for received := 0; closeAfter <= 0 || received < closeAfter; received++ {
+		var msg string
+		if s.framing == FramingNonTransparent {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			msg = strings.TrimSuffix(line, "\n")
+		} else {
+			length, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+			Expect(err).ToNot(HaveOccurred())
+			buf := make([]byte, n)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			msg = string(buf)
+		}
+		s.receive(msg)
+	}
+}
+
+func (s *server) receive(msg string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.messages = append(s.messages, msg)
+}
+
+func (s *server) received() []string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func (s *server) connections() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.conns
+}
+
+func (s *server) addr() string {
+	if s.packetConn != nil {
+		return s.packetConn.LocalAddr().String()
+	}
+	return s.listener.Addr().String()
+}
+
+func (s *server) close() {
+	if s.packetConn != nil {
+		_ = s.packetConn.Close()
+		return
+	}
+	_ = s.listener.Close()
+}
+
+// generateCertificate returns a self-signed PEM encoded server certificate and key for 127.0.0.1
+func generateCertificate() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "syslog"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		srv    *server
+		events *audit.EventList
+	)
+
+	newProvider := func(config *Configuration) *Provider {
+		rawConfig, err := json.Marshal(config)
+		Expect(err).ToNot(HaveOccurred())
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig(rawConfig)).To(Succeed())
+		return p
+	}
+
+	newEvents := func(from, to int) *audit.EventList {
+		list := &audit.EventList{}
+		for i := from; i < to; i++ {
+			list.Items = append(list.Items, audit.Event{AuditID: types.UID(fmt.Sprintf("%d", i)), Verb: "get"})
+		}
+		return list
+	}
+
+	auditIDs := func(messages []string) []string {
+		ids := make([]string, 0, len(messages))
+		for _, msg := range messages {
+			ids = append(ids, strings.SplitN(strings.SplitN(msg, `auditID="`, 2)[1], `"`, 2)[0])
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		events = newEvents(0, 3)
+	})
+
+	AfterEach(func() {
+		if srv != nil {
+			srv.close()
+		}
+	})
+
+	Context("messages", func() {
+		var (
+			p     *Provider
+			event *audit.Event
+		)
+
+		BeforeEach(func() {
+			p = newProvider(&Configuration{Address: "syslog:6514", Shoot: "shoot--dev--test"})
+			event = &audit.Event{
+				AuditID:                  "1",
+				Level:                    audit.LevelMetadata,
+				Stage:                    audit.StageResponseComplete,
+				Verb:                     "get",
+				RequestURI:               `/api/v1/namespaces/default/pods/"x]`,
+				User:                     audit.UserInfo{Username: "admin", Groups: []string{"system:masters", "system:authenticated"}},
+				ObjectRef:                &audit.ObjectReference{APIVersion: "v1", Resource: "pods", Namespace: "default", Name: "x"},
+				ResponseStatus:           &metav1.Status{Code: 403},
+				RequestReceivedTimestamp: metav1.NewMicroTime(time.Date(2020, 9, 13, 12, 26, 40, 123456000, time.UTC)),
+			}
+		})
+
+		It("should render the event as RFC 5424 message with structured data", func() {
+			msg, err := p.renderMessage(event)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(msg)).To(HavePrefix(`<132>1 2020-09-13T12:26:40.123456Z shoot--dev--test kube-apiserver - ResponseComplete ` +
+				`[user@32473 name="admin" groups="system:masters,system:authenticated"]` +
+				`[request@32473 auditID="1" level="Metadata" verb="get" requestURI="/api/v1/namespaces/default/pods/\"x\]"]` +
+				`[objectRef@32473 apiVersion="v1" resource="pods" namespace="default" name="x"]` +
+				`[response@32473 code="403"] {"kind":"Event","apiVersion":"audit.k8s.io/v1"`))
+		})
+
+		It("should map the response codes before the levels to severities", func() {
+			p = newProvider(&Configuration{
+				Address:  "syslog:6514",
+				Facility: "auth",
+				Severity: SeverityConfiguration{
+					Default:       "notice",
+					Levels:        map[audit.Level]string{audit.LevelRequestResponse: "debug"},
+					ResponseCodes: map[string]string{"403": "alert", "4xx": "err"},
+				},
+			})
+			Expect(p.severityOf(event)).To(Equal(1))
+			event.ResponseStatus.Code = 404
+			Expect(p.severityOf(event)).To(Equal(3))
+			event.ResponseStatus.Code = 200
+			Expect(p.severityOf(event)).To(Equal(5))
+			event.Level = audit.LevelRequestResponse
+			Expect(p.severityOf(event)).To(Equal(7))
+
+			msg, err := p.renderMessage(event)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(msg)).To(HavePrefix("<39>1 "))
+		})
+
+		It("should use nil values for empty header fields", func() {
+			p = newProvider(&Configuration{Address: "syslog:6514"})
+			msg, err := p.renderMessage(&audit.Event{AuditID: "1", RequestReceivedTimestamp: event.RequestReceivedTimestamp})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(msg)).To(HavePrefix(`<134>1 2020-09-13T12:26:40.123456Z - kube-apiserver - - [user@32473][request@32473 auditID="1"] {`))
+		})
+	})
+
+	It("should send octet counted messages over tcp", func() {
+		srv = newStreamServer(FramingOctetCounting, nil)
+		p := newProvider(&Configuration{Address: srv.addr()})
+		Expect(p.Log(events)).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(3))
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should send non-transparent framed messages over tcp", func() {
+		srv = newStreamServer(FramingNonTransparent, nil)
+		p := newProvider(&Configuration{Address: srv.addr(), Framing: FramingNonTransparent})
+		Expect(p.Log(events)).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(3))
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2"}))
+	})
+
+	It("should send messages over tls", func() {
+		cert, key := generateCertificate()
+		keyPair, err := tls.X509KeyPair(cert, key)
+		Expect(err).ToNot(HaveOccurred())
+		srv = newStreamServer(FramingOctetCounting, &tls.Config{Certificates: []tls.Certificate{keyPair}})
+
+		p := newProvider(&Configuration{Address: srv.addr(), Network: NetworkTLS, TLS: &TLSConfiguration{CA: string(cert)}})
+		Expect(p.Log(events)).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(3))
+	})
+
+	It("should send truncated messages over udp", func() {
+		srv = newPacketServer()
+		p := newProvider(&Configuration{Address: srv.addr(), Network: NetworkUDP, MaxMessageSize: 100})
+		Expect(p.Log(events)).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(3))
+		for _, msg := range srv.received() {
+			Expect(msg).To(HaveLen(100))
+		}
+	})
+
+	It("should reconnect if the server closed the connection", func() {
+		srv = newStreamServer(FramingOctetCounting, nil)
+		srv.mux.Lock()
+		srv.closeAfter = 3
+		srv.mux.Unlock()
+		p := newProvider(&Configuration{Address: srv.addr()})
+		Expect(p.Log(events)).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(3))
+
+		Expect(p.Log(newEvents(3, 5))).To(Succeed())
+		Eventually(srv.received).Should(HaveLen(5))
+		Expect(auditIDs(srv.received())).To(Equal([]string{"0", "1", "2", "3", "4"}))
+		Expect(srv.connections()).To(Equal(2))
+	})
+
+	It("should return transient errors if the server is not reachable", func() {
+		srv = newStreamServer(FramingOctetCounting, nil)
+		addr := srv.addr()
+		srv.close()
+		srv = nil
+
+		p := newProvider(&Configuration{Address: addr})
+		err := p.Log(events)
+		Expect(err).To(HaveOccurred())
+		partialErr, ok := err.(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(3))
+		for _, e := range partialErr.Errors {
+			Expect(e.Transient).To(BeTrue())
+		}
+	})
+
+	Context("configuration", func() {
+		inject := func(config string) error {
+			return (&Provider{}).InjectBackendConfig([]byte(config))
+		}
+
+		It("should default the configuration", func() {
+			p := newProvider(&Configuration{Address: "syslog:514", Network: NetworkUDP})
+			Expect(p.config.Framing).To(Equal(FramingOctetCounting))
+			Expect(p.config.Facility).To(Equal("local0"))
+			Expect(p.config.Severity.Default).To(Equal("info"))
+			Expect(p.config.Severity.ResponseCodes).To(Equal(map[string]string{"4xx": "warning", "5xx": "err"}))
+			Expect(p.config.MaxMessageSize).To(Equal(65507))
+			Expect(p.config.Timeout.Duration).To(Equal(10 * time.Second))
+		})
+
+		It("should reject invalid configurations", func() {
+			Expect(inject(`{}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "network": "unix"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "framing": "none"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "facility": "local8"}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "severity": {"default": "warn"}}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "severity": {"levels": {"Metadata": "error"}}}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "severity": {"responseCodes": {"4x": "err"}}}`)).ToNot(Succeed())
+			Expect(inject(`{"address": "syslog:514", "severity": {"responseCodes": {"404": "err", "5xx": "crit"}}}`)).To(Succeed())
+		})
+	})
+})
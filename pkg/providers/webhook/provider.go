@@ -0,0 +1,321 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"net/http"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Keys of the credentials in the secret that is referenced by the backendProviderSecretRef
+const (
+	SecretKeyBearerToken = "bearerToken"
+	SecretKeyUsername    = "username"
+	SecretKeyPassword    = "password"
+	SecretKeyCA          = "ca.crt"
+	SecretKeyCert        = "tls.crt"
+	SecretKeyKey         = "tls.key"
+)
+
+type Provider struct {
+	log    logr.Logger
+	config *Configuration
+
+	// connMux protects the connection that is replaced whenever the mounted secret changes
+	connMux sync.RWMutex
+	conn    *connection
+}
+
+// connection is the client and the url of the endpoint with the credentials of the configuration and the secret.
+// The credentials of secrets are only part of the connection and never of the configuration of the provider.
+type connection struct {
+	client *http.Client
+	url    string
+}
+
+// Configuration is the webhook provider specific configuration.
+// The endpoint and its credentials are either defined by a kubeconfig or explicitly.
+type Configuration struct {
+	// Kubeconfig is a kubeconfig in the format of the audit webhook configuration of the kube-apiserver.
+	// The server and the credentials of the current context are used.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+
+	// Endpoint is the url the event lists are posted to
+	Endpoint string `json:"endpoint,omitempty"`
+	// TLS configures the client certificate and the trusted CA of the endpoint
+	TLS *TLSConfiguration `json:"tls,omitempty"`
+	// BearerToken is sent as bearer token in the authorization header
+	BearerToken string `json:"bearerToken,omitempty"`
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+
+	// Timeout of a request, defaults to 30s
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// MaxBatchSize is the maximum number of events that are forwarded with one request.
+	// The event lists are forwarded as received from the kube-apiserver if no maximum is defined.
+	MaxBatchSize int `json:"maxBatchSize,omitempty"`
+}
+
+// TLSConfiguration contains the PEM encoded certificates of a tls connection
+type TLSConfiguration struct {
+	// CA is the CA bundle that is used to verify the certificate of the endpoint
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are the client certificate and key that are used for mutual tls
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// ServerName overrides the name that is used to verify the certificate of the endpoint
+	ServerName         string `json:"serverName,omitempty"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"`
+}
+
+var _ provider.Interface = &Provider{}
+
+func (p *Provider) New() (provider.Interface, error) {
+	return &Provider{}, nil
+}
+
+func (p *Provider) Name() string {
+	return "webhook"
+}
+
+func (p *Provider) InjectBackendConfig(rawConfig []byte) error {
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return err
+	}
+
+	conn, err := newConnection(config, nil)
+	if err != nil {
+		return err
+	}
+	p.setConnection(conn)
+	p.config = config
+	return nil
+}
+
+// InjectBackendSecret overwrites the credentials and certificates of the configuration with the data of the secret.
+// It is called with the referenced secret by the extension controller and with the mounted secret by the proxy
+// whenever it changes, requests that are in flight finish with the previous credentials.
+func (p *Provider) InjectBackendSecret(data map[string][]byte) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+	conn, err := newConnection(p.config, data)
+	if err != nil {
+		return err
+	}
+	p.setConnection(conn)
+	return nil
+}
+
+func (p *Provider) setConnection(conn *connection) {
+	p.connMux.Lock()
+	defer p.connMux.Unlock()
+	p.conn = conn
+}
+
+// connection returns the connection that is used for the next request
+func (p *Provider) connection() *connection {
+	p.connMux.RLock()
+	defer p.connMux.RUnlock()
+	return p.conn
+}
+
+// ValidateBackendConfig validates that either a kubeconfig or an endpoint is defined and the remaining settings as a whole
+func (p *Provider) ValidateBackendConfig(rawConfig []byte, secretRef *corev1.SecretReference, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	config := &Configuration{}
+	if err := yaml.Unmarshal(rawConfig, config); err != nil {
+		return append(allErrs, provider.InvalidBackendConfig(fldPath, err))
+	}
+	switch {
+	case config.Kubeconfig != "" && config.Endpoint != "":
+		allErrs = append(allErrs, field.Forbidden(fldPath.Child("endpoint"), "Either a kubeconfig or an endpoint can be defined"))
+	case config.Kubeconfig == "":
+		allErrs = append(allErrs, provider.ValidateURL(config.Endpoint, fldPath.Child("endpoint"), "http", "https")...)
+	}
+	if len(allErrs) != 0 {
+		return allErrs
+	}
+	return provider.ValidateBackendConfigInjection(p, rawConfig, fldPath)
+}
+
+func (p *Provider) InjectLogger(log logr.Logger) error {
+	p.log = log
+	return nil
+}
+
+// Log forwards the events as audit.k8s.io/v1 event lists.
+func (p *Provider) Log(events *audit.EventList) error {
+	if p.config == nil {
+		return errors.New("configuration is not defined")
+	}
+
+	batchSize := len(events.Items)
+	if p.config.MaxBatchSize > 0 && p.config.MaxBatchSize < batchSize {
+		batchSize = p.config.MaxBatchSize
+	}
+	if batchSize == len(events.Items) {
+		if err := p.forward(events); err != nil {
+			return err
+		}
+		p.log.Info("Successfully forwarded events", "events", len(events.Items))
+		return nil
+	}
+
+	partialErr := &provider.PartialError{}
+	for start := 0; start < len(events.Items); start += batchSize {
+		end := start + batchSize
+		if end > len(events.Items) {
+			end = len(events.Items)
+		}
+		err := p.forward(&audit.EventList{ListMeta: events.ListMeta, Items: events.Items[start:end]})
+		if err == nil {
+			continue
+		}
+		for i := start; i < end; i++ {
+			partialErr.Errors = append(partialErr.Errors, provider.EventError{Index: i, Err: err, Transient: provider.IsTransient(err)})
+		}
+	}
+	if len(partialErr.Errors) != 0 {
+		return partialErr
+	}
+	p.log.Info("Successfully forwarded events", "events", len(events.Items))
+	return nil
+}
+
+func (p *Provider) forward(events *audit.EventList) error {
+	eventList, err := provider.ConvertEventListToV1(events)
+	if err != nil {
+		return errors.Wrap(err, "unable to convert event list")
+	}
+	body, err := json.Marshal(eventList)
+	if err != nil {
+		return errors.Wrap(err, "unable to marshal event list")
+	}
+
+	conn := p.connection()
+	req, err := http.NewRequest(http.MethodPost, conn.url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := conn.client.Do(req)
+	if err != nil {
+		return provider.NewTransientError(errors.Wrapf(err, "unable to do request to %s", conn.url))
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		statusErr := errors.Errorf("request %s returned status code %d: %s", conn.url, res.StatusCode, strings.TrimSpace(string(resBody)))
+		if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+			statusErr = provider.NewTransientError(statusErr)
+		}
+		return statusErr
+	}
+	return nil
+}
+
+// Reconcile noop reconcile function
+func (p *Provider) Reconcile(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// Delete noop delete function
+func (p *Provider) Delete(ctx context.Context, ex *extensionsv1alpha1.Extension) error { return nil }
+
+// newConnection creates a connection with the credentials of the configuration that are overwritten by the given secret data.
+// The credentials of the secret replace the authentication of the configuration, e.g. a bearer token replaces a username and password.
+func newConnection(config *Configuration, data map[string][]byte) (*connection, error) {
+	restConfig, err := restConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := data[SecretKeyBearerToken]; ok {
+		restConfig.BearerToken, restConfig.BearerTokenFile, restConfig.Username, restConfig.Password = string(token), "", "", ""
+	}
+	if username, ok := data[SecretKeyUsername]; ok {
+		restConfig.BearerToken, restConfig.BearerTokenFile, restConfig.Username, restConfig.Password = "", "", string(username), string(data[SecretKeyPassword])
+	}
+	if ca, ok := data[SecretKeyCA]; ok {
+		restConfig.CAData, restConfig.CAFile = ca, ""
+	}
+	if cert, ok := data[SecretKeyCert]; ok {
+		restConfig.CertData, restConfig.CertFile, restConfig.KeyData, restConfig.KeyFile = cert, "", data[SecretKeyKey], ""
+	}
+	transport, err := rest.TransportFor(restConfig)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create transport")
+	}
+
+	timeout := defaultTimeout
+	if config.Timeout != nil {
+		timeout = config.Timeout.Duration
+	}
+	return &connection{client: &http.Client{Transport: transport, Timeout: timeout}, url: restConfig.Host}, nil
+}
+
+// restConfigFor returns the client configuration of the kubeconfig or the explicitly defined endpoint
+func restConfigFor(config *Configuration) (*rest.Config, error) {
+	if config.Kubeconfig != "" {
+		if config.Endpoint != "" {
+			return nil, errors.New("either a kubeconfig or an endpoint can be defined")
+		}
+		restConfig, err := clientcmd.RESTConfigFromKubeConfig([]byte(config.Kubeconfig))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load kubeconfig")
+		}
+		return restConfig, nil
+	}
+
+	if config.Endpoint == "" {
+		return nil, errors.New("either a kubeconfig or an endpoint has to be defined")
+	}
+	restConfig := &rest.Config{
+		Host:        config.Endpoint,
+		BearerToken: config.BearerToken,
+		Username:    config.Username,
+		Password:    config.Password,
+	}
+	if config.TLS != nil {
+		restConfig.TLSClientConfig = rest.TLSClientConfig{
+			CAData:     []byte(config.TLS.CA),
+			CertData:   []byte(config.TLS.Cert),
+			KeyData:    []byte(config.TLS.Key),
+			ServerName: config.TLS.ServerName,
+			Insecure:   config.TLS.InsecureSkipVerify,
+		}
+	}
+	return restConfig, nil
+}
@@ -0,0 +1,225 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// generateClientCertificate returns a self-signed PEM encoded client certificate and key
+func generateClientCertificate() ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ToNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "auditlog-proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ToNot(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ToNot(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+var _ = Describe("Provider", func() {
+	var (
+		server   *httptest.Server
+		requests []*http.Request
+		lists    []*auditv1.EventList
+		status   int
+		serverCA []byte
+		events   *audit.EventList
+	)
+
+	newProvider := func(config *Configuration) *Provider {
+		rawConfig, err := json.Marshal(config)
+		Expect(err).ToNot(HaveOccurred())
+		i, err := (&Provider{}).New()
+		Expect(err).ToNot(HaveOccurred())
+		p := i.(*Provider)
+		Expect(p.InjectLogger(log.NullLogger{})).To(Succeed())
+		Expect(p.InjectBackendConfig(rawConfig)).To(Succeed())
+		return p
+	}
+
+	BeforeEach(func() {
+		requests, lists, status = nil, nil, http.StatusOK
+		server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			list := &auditv1.EventList{}
+			Expect(json.Unmarshal(body, list)).To(Succeed())
+			requests = append(requests, r)
+			lists = append(lists, list)
+			w.WriteHeader(status)
+		}))
+		events = &audit.EventList{}
+		for i := 0; i < 3; i++ {
+			events.Items = append(events.Items, audit.Event{AuditID: types.UID(fmt.Sprintf("%d", i)), Verb: "get"})
+		}
+	})
+
+	JustBeforeEach(func() {
+		server.StartTLS()
+		serverCA = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should forward the event list in the audit.k8s.io/v1 format with a bearer token", func() {
+		p := newProvider(&Configuration{Endpoint: server.URL + "/audit", BearerToken: "secret", TLS: &TLSConfiguration{CA: string(serverCA)}})
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].URL.Path).To(Equal("/audit"))
+		Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer secret"))
+		Expect(lists[0].APIVersion).To(Equal("audit.k8s.io/v1"))
+		Expect(lists[0].Kind).To(Equal("EventList"))
+		Expect(lists[0].Items).To(HaveLen(3))
+		Expect(lists[0].Items[2].AuditID).To(Equal(types.UID("2")))
+	})
+
+	It("should use the server and credentials of a kubeconfig", func() {
+		kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: siem
+  cluster:
+    server: %s
+    certificate-authority-data: %s
+users:
+- name: proxy
+  user:
+    username: admin
+    password: secret
+contexts:
+- name: siem
+  context:
+    cluster: siem
+    user: proxy
+current-context: siem
+`, server.URL, base64.StdEncoding.EncodeToString(serverCA))
+		p := newProvider(&Configuration{Kubeconfig: kubeconfig})
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		username, password, ok := requests[0].BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(username).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+	})
+
+	It("should send the credentials of the reloaded secret", func() {
+		p := newProvider(&Configuration{Endpoint: server.URL, BearerToken: "inline"})
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyCA: serverCA, SecretKeyUsername: []byte("admin"), SecretKeyPassword: []byte("secret")})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+		Expect(p.InjectBackendSecret(map[string][]byte{SecretKeyCA: serverCA, SecretKeyBearerToken: []byte("rotated")})).To(Succeed())
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(requests).To(HaveLen(2))
+		username, password, ok := requests[0].BasicAuth()
+		Expect(ok).To(BeTrue())
+		Expect(username).To(Equal("admin"))
+		Expect(password).To(Equal("secret"))
+		Expect(requests[1].Header.Get("Authorization")).To(Equal("Bearer rotated"))
+		Expect(p.config.BearerToken).To(Equal("inline"))
+	})
+
+	Context("mutual tls", func() {
+		var clientCert, clientKey []byte
+
+		BeforeEach(func() {
+			clientCert, clientKey = generateClientCertificate()
+			clientCAs := x509.NewCertPool()
+			Expect(clientCAs.AppendCertsFromPEM(clientCert)).To(BeTrue())
+			server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+		})
+
+		It("should authenticate with the client certificate", func() {
+			p := newProvider(&Configuration{Endpoint: server.URL, TLS: &TLSConfiguration{CA: string(serverCA), Cert: string(clientCert), Key: string(clientKey)}})
+			Expect(p.Log(events)).To(Succeed())
+			Expect(requests).To(HaveLen(1))
+		})
+
+		It("should fail without a client certificate", func() {
+			p := newProvider(&Configuration{Endpoint: server.URL, TLS: &TLSConfiguration{CA: string(serverCA)}})
+			err := p.Log(events)
+			Expect(err).To(HaveOccurred())
+			Expect(provider.IsTransient(err)).To(BeTrue())
+		})
+	})
+
+	It("should split the event list into batches", func() {
+		p := newProvider(&Configuration{Endpoint: server.URL, MaxBatchSize: 2, TLS: &TLSConfiguration{CA: string(serverCA)}})
+		Expect(p.Log(events)).To(Succeed())
+
+		Expect(lists).To(HaveLen(2))
+		Expect(lists[0].Items).To(HaveLen(2))
+		Expect(lists[1].Items).To(HaveLen(1))
+	})
+
+	It("should return the events of failed batches as partial error", func() {
+		status = http.StatusServiceUnavailable
+		p := newProvider(&Configuration{Endpoint: server.URL, MaxBatchSize: 2, TLS: &TLSConfiguration{CA: string(serverCA)}})
+
+		partialErr, ok := p.Log(events).(*provider.PartialError)
+		Expect(ok).To(BeTrue())
+		Expect(partialErr.Errors).To(HaveLen(3))
+		Expect(partialErr.Errors[2].Index).To(Equal(2))
+		Expect(partialErr.Errors[2].Transient).To(BeTrue())
+	})
+
+	It("should not retry rejected event lists", func() {
+		status = http.StatusBadRequest
+		p := newProvider(&Configuration{Endpoint: server.URL, TLS: &TLSConfiguration{CA: string(serverCA)}})
+		err := p.Log(events)
+		Expect(err).To(HaveOccurred())
+		Expect(provider.IsTransient(err)).To(BeFalse())
+	})
+
+	It("should require either a kubeconfig or an endpoint", func() {
+		Expect((&Provider{}).InjectBackendConfig([]byte(`{}`))).ToNot(Succeed())
+		Expect((&Provider{}).InjectBackendConfig([]byte(`{"kubeconfig":"foo","endpoint":"https://siem"}`))).ToNot(Succeed())
+	})
+})
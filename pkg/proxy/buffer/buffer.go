@@ -0,0 +1,568 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned if a record cannot be appended because the buffer reached its maximum size.
+var ErrFull = errors.New("buffer is full")
+
+// ErrClosed is returned if the buffer is already closed.
+var ErrClosed = errors.New("buffer is closed")
+
+// SyncPolicy defines when appended records are flushed to disk
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes every record before Append returns
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes the current segment periodically
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	checkpointFile = "checkpoint"
+)
+
+// Options contains the configuration of a write-ahead buffer
+type Options struct {
+	// Directory is the directory where the segments and the checkpoint are stored
+	Directory string
+	// MaxSize is the maximum size of all segments in bytes
+	MaxSize int64
+	// SegmentSize is the size in bytes after which a new segment is started
+	SegmentSize int64
+	// SyncPolicy defines when records are flushed to disk
+	SyncPolicy SyncPolicy
+	// SyncInterval is the flush interval for the SyncInterval policy
+	SyncInterval time.Duration
+}
+
+// Stats describes the backlog of a buffer
+type Stats struct {
+	// Records is the number of records that are not yet acknowledged
+	Records int64
+	// Bytes is the size of the records that are not yet acknowledged
+	Bytes int64
+	// DiskBytes is the size of all segments on disk
+	DiskBytes int64
+	// Segments is the number of segments on disk
+	Segments int
+}
+
+// WAL is a segment based write-ahead log that persists records on disk until they are acknowledged.
+// It supports multiple writers and exactly one reader.
+type WAL struct {
+	log  logr.Logger
+	opts Options
+
+	mux    sync.Mutex
+	closed bool
+	dirty  bool
+	notify chan struct{}
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	// segments are the ids of all segments on disk in ascending order.
+	// The last segment is the one that is currently written.
+	segments  []uint64
+	sizes     map[uint64]int64
+	writer    *os.File
+	diskBytes int64
+
+	reader      *os.File
+	readSegment uint64
+	readOffset  int64
+	// nextOffset is the offset after the record that was returned by the last call to Next
+	nextOffset int64
+	nextSize   int64
+
+	pendingRecords int64
+	pendingBytes   int64
+}
+
+// Open opens or creates a write-ahead buffer in the configured directory.
+// Records that were not acknowledged before the buffer was closed are replayed.
+func Open(log logr.Logger, opts Options) (*WAL, error) {
+	if opts.Directory == "" {
+		return nil, errors.New("no buffer directory defined")
+	}
+	if opts.SegmentSize <= 0 {
+		return nil, errors.New("segment size has to be positive")
+	}
+	if err := os.MkdirAll(opts.Directory, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create buffer directory")
+	}
+
+	w := &WAL{
+		log:    log,
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		sizes:  map[uint64]int64{},
+	}
+	if err := w.recover(); err != nil {
+		return nil, err
+	}
+
+	if opts.SyncPolicy == SyncInterval && opts.SyncInterval > 0 {
+		w.wg.Add(1)
+		go w.syncLoop()
+	}
+	return w, nil
+}
+
+// Append persists a record in the buffer.
+func (w *WAL) Append(data []byte) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+
+	recordSize := int64(headerSize + len(data))
+	if w.opts.MaxSize > 0 && w.diskBytes+recordSize > w.opts.MaxSize {
+		return ErrFull
+	}
+
+	current := w.segments[len(w.segments)-1]
+	if w.sizes[current] > 0 && w.sizes[current]+recordSize > w.opts.SegmentSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+		current = w.segments[len(w.segments)-1]
+	}
+
+	if _, err := w.writer.Write(encodeRecord(data)); err != nil {
+		// drop the partially written record so that readers never see it
+		if truncErr := w.writer.Truncate(w.sizes[current]); truncErr != nil {
+			w.log.Error(truncErr, "unable to truncate segment after failed write", "segment", current)
+		}
+		return errors.Wrapf(err, "unable to write record to segment %d", current)
+	}
+	if w.opts.SyncPolicy == SyncAlways {
+		if err := w.writer.Sync(); err != nil {
+			return errors.Wrapf(err, "unable to sync segment %d", current)
+		}
+	} else {
+		w.dirty = true
+	}
+
+	w.sizes[current] += recordSize
+	w.diskBytes += recordSize
+	w.pendingRecords++
+	w.pendingBytes += int64(len(data))
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Next returns the oldest record that is not yet acknowledged.
+// It blocks until a record is available or the context is done.
+// Calling Next again without acknowledging the record returns the same record.
+func (w *WAL) Next(ctx context.Context) ([]byte, error) {
+	for {
+		data, err := w.next()
+		if err != nil || data != nil {
+			return data, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-w.stop:
+			return nil, ErrClosed
+		case <-w.notify:
+		}
+	}
+}
+
+// Ack acknowledges the record that was returned by the last call to Next.
+// The record is not replayed anymore.
+func (w *WAL) Ack() error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return ErrClosed
+	}
+	if w.nextOffset <= w.readOffset {
+		return errors.New("no record to acknowledge")
+	}
+
+	w.readOffset = w.nextOffset
+	w.pendingRecords--
+	w.pendingBytes -= w.nextSize
+	return w.writeCheckpoint()
+}
+
+// Stats returns the current backlog of the buffer.
+func (w *WAL) Stats() Stats {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return Stats{
+		Records:   w.pendingRecords,
+		Bytes:     w.pendingBytes,
+		DiskBytes: w.diskBytes,
+		Segments:  len(w.segments),
+	}
+}
+
+// Close flushes and closes the buffer.
+// Records that are not acknowledged are kept on disk and replayed by the next Open.
+func (w *WAL) Close() error {
+	w.mux.Lock()
+	if w.closed {
+		w.mux.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.stop)
+	w.mux.Unlock()
+
+	w.wg.Wait()
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	var result error
+	if err := w.writer.Sync(); err != nil {
+		result = err
+	}
+	if err := w.writer.Close(); err != nil && result == nil {
+		result = err
+	}
+	if w.reader != nil {
+		if err := w.reader.Close(); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// next reads the record at the read position or returns nil if no record is available.
+func (w *WAL) next() ([]byte, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.closed {
+		return nil, ErrClosed
+	}
+
+	for {
+		size := w.sizes[w.readSegment]
+		if w.readOffset < size {
+			if err := w.openReader(); err != nil {
+				return nil, err
+			}
+			data, err := readRecord(w.reader, w.readOffset, size)
+			if err != nil {
+				// the record is corrupted so there is no way to find the next record in this segment
+				w.log.Error(err, "skipping corrupted rest of segment", "segment", w.readSegment, "offset", w.readOffset)
+				w.pendingRecords, w.pendingBytes = w.countPending(w.readSegment + 1)
+				w.readOffset = size
+				continue
+			}
+			w.nextOffset = w.readOffset + int64(headerSize+len(data))
+			w.nextSize = int64(len(data))
+			return data, nil
+		}
+
+		// the currently written segment is completely read
+		if w.readSegment == w.segments[len(w.segments)-1] {
+			return nil, nil
+		}
+		if err := w.removeReadSegment(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (w *WAL) openReader() error {
+	if w.reader != nil {
+		return nil
+	}
+	f, err := os.Open(w.segmentPath(w.readSegment))
+	if err != nil {
+		return errors.Wrapf(err, "unable to open segment %d", w.readSegment)
+	}
+	w.reader = f
+	return nil
+}
+
+// removeReadSegment deletes the completely acknowledged read segment and continues with the next one.
+func (w *WAL) removeReadSegment() error {
+	if w.reader != nil {
+		if err := w.reader.Close(); err != nil {
+			w.log.Error(err, "unable to close segment", "segment", w.readSegment)
+		}
+		w.reader = nil
+	}
+	if err := os.Remove(w.segmentPath(w.readSegment)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "unable to remove segment %d", w.readSegment)
+	}
+	w.diskBytes -= w.sizes[w.readSegment]
+	delete(w.sizes, w.readSegment)
+	w.segments = w.segments[1:]
+
+	w.readSegment = w.segments[0]
+	w.readOffset = 0
+	w.nextOffset = 0
+	return w.writeCheckpoint()
+}
+
+// rotate closes the current segment and starts a new one
+func (w *WAL) rotate() error {
+	if err := w.writer.Sync(); err != nil {
+		return err
+	}
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	return w.createSegment(w.segments[len(w.segments)-1] + 1)
+}
+
+func (w *WAL) createSegment(id uint64) error {
+	f, err := os.OpenFile(w.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create segment %d", id)
+	}
+	w.writer = f
+	w.segments = append(w.segments, id)
+	w.sizes[id] = 0
+	w.dirty = false
+	return nil
+}
+
+func (w *WAL) syncLoop() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.mux.Lock()
+			if w.dirty {
+				if err := w.writer.Sync(); err != nil {
+					w.log.Error(err, "unable to sync buffer segment")
+				} else {
+					w.dirty = false
+				}
+			}
+			w.mux.Unlock()
+		}
+	}
+}
+
+// recover loads the segments and the checkpoint from disk and truncates torn writes.
+func (w *WAL) recover() error {
+	files, err := ioutil.ReadDir(w.opts.Directory)
+	if err != nil {
+		return errors.Wrap(err, "unable to read buffer directory")
+	}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(file.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		w.segments = append(w.segments, id)
+		w.sizes[id] = file.Size()
+		w.diskBytes += file.Size()
+	}
+	sort.Slice(w.segments, func(i, j int) bool { return w.segments[i] < w.segments[j] })
+
+	readSegment, readOffset, err := w.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	// drop segments that are already acknowledged but could not be removed
+	for len(w.segments) > 0 && w.segments[0] < readSegment {
+		if err := os.Remove(w.segmentPath(w.segments[0])); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to remove segment %d", w.segments[0])
+		}
+		w.diskBytes -= w.sizes[w.segments[0]]
+		delete(w.sizes, w.segments[0])
+		w.segments = w.segments[1:]
+	}
+
+	if len(w.segments) == 0 {
+		if readSegment == 0 {
+			readSegment = 1
+		}
+		if err := w.createSegment(readSegment); err != nil {
+			return err
+		}
+		w.readSegment = readSegment
+		return w.writeCheckpoint()
+	}
+
+	if w.segments[0] != readSegment {
+		readOffset = 0
+	}
+	w.readSegment = w.segments[0]
+	w.readOffset = readOffset
+
+	// a crash during a write can leave a partial record at the end of the last segment
+	last := w.segments[len(w.segments)-1]
+	validSize, err := w.validSize(last)
+	if err != nil {
+		return err
+	}
+	if validSize != w.sizes[last] {
+		w.log.Info("Truncating incomplete record at the end of the segment", "segment", last, "size", w.sizes[last], "validSize", validSize)
+		if err := os.Truncate(w.segmentPath(last), validSize); err != nil {
+			return errors.Wrapf(err, "unable to truncate segment %d", last)
+		}
+		w.diskBytes -= w.sizes[last] - validSize
+		w.sizes[last] = validSize
+	}
+	if w.readSegment == last && w.readOffset > validSize {
+		w.readOffset = validSize
+	}
+
+	f, err := os.OpenFile(w.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "unable to open segment %d", last)
+	}
+	w.writer = f
+
+	w.pendingRecords, w.pendingBytes = w.countPending(w.readSegment)
+	if w.pendingRecords > 0 {
+		w.log.Info("Replaying buffered event lists", "records", w.pendingRecords, "bytes", w.pendingBytes)
+	}
+	return nil
+}
+
+// validSize returns the size of the segment up to the last complete record.
+func (w *WAL) validSize(id uint64) (int64, error) {
+	f, err := os.Open(w.segmentPath(id))
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to open segment %d", id)
+	}
+	defer f.Close()
+
+	var offset int64
+	for offset < w.sizes[id] {
+		data, err := readRecord(f, offset, w.sizes[id])
+		if err != nil {
+			break
+		}
+		offset += int64(headerSize + len(data))
+	}
+	return offset, nil
+}
+
+// countPending counts the records and their size starting at the read position.
+// Segments before the given segment id are ignored.
+func (w *WAL) countPending(from uint64) (int64, int64) {
+	var records, size int64
+	for _, id := range w.segments {
+		if id < from {
+			continue
+		}
+		var offset int64
+		if id == w.readSegment {
+			offset = w.readOffset
+		}
+		f, err := os.Open(w.segmentPath(id))
+		if err != nil {
+			w.log.Error(err, "unable to open segment", "segment", id)
+			continue
+		}
+		for offset < w.sizes[id] {
+			data, err := readRecord(f, offset, w.sizes[id])
+			if err != nil {
+				break
+			}
+			records++
+			size += int64(len(data))
+			offset += int64(headerSize + len(data))
+		}
+		f.Close()
+	}
+	return records, size
+}
+
+func (w *WAL) readCheckpoint() (uint64, int64, error) {
+	data, err := ioutil.ReadFile(filepath.Join(w.opts.Directory, checkpointFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			if len(w.segments) == 0 {
+				return 0, 0, nil
+			}
+			return w.segments[0], 0, nil
+		}
+		return 0, 0, errors.Wrap(err, "unable to read checkpoint")
+	}
+
+	var (
+		segment uint64
+		offset  int64
+	)
+	if _, err := fmt.Sscanf(string(data), "%d %d", &segment, &offset); err != nil {
+		return 0, 0, errors.Wrapf(err, "unable to parse checkpoint %q", string(data))
+	}
+	return segment, offset, nil
+}
+
+// writeCheckpoint atomically persists the current read position.
+func (w *WAL) writeCheckpoint() error {
+	path := filepath.Join(w.opts.Directory, checkpointFile)
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to write checkpoint")
+	}
+	if _, err := fmt.Fprintf(f, "%d %d", w.readSegment, w.readOffset); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to write checkpoint")
+	}
+	if w.opts.SyncPolicy == SyncAlways {
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return errors.Wrap(err, "unable to sync checkpoint")
+		}
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to write checkpoint")
+	}
+	return os.Rename(tmp, path)
+}
+
+func (w *WAL) segmentPath(id uint64) string {
+	return filepath.Join(w.opts.Directory, fmt.Sprintf("%020d%s", id, segmentSuffix))
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/buffer"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("WAL", func() {
+	var (
+		dir    string
+		logger logr.Logger
+		opts   buffer.Options
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auditlog-buffer")
+		Expect(err).ToNot(HaveOccurred())
+		logger = log.NullLogger{}
+		opts = buffer.Options{
+			Directory:   dir,
+			MaxSize:     1024,
+			SegmentSize: 64,
+			SyncPolicy:  buffer.SyncAlways,
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	next := func(w *buffer.WAL) string {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		data, err := w.Next(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	It("should return records in order until they are acknowledged", func() {
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		Expect(w.Append([]byte("first"))).To(Succeed())
+		Expect(w.Append([]byte("second"))).To(Succeed())
+		Expect(w.Stats().Records).To(Equal(int64(2)))
+
+		Expect(next(w)).To(Equal("first"))
+		Expect(next(w)).To(Equal("first"))
+		Expect(w.Ack()).To(Succeed())
+		Expect(next(w)).To(Equal("second"))
+		Expect(w.Ack()).To(Succeed())
+
+		Expect(w.Stats().Records).To(BeZero())
+		Expect(w.Stats().Bytes).To(BeZero())
+	})
+
+	It("should block until a record is appended", func() {
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		go func() {
+			defer GinkgoRecover()
+			time.Sleep(50 * time.Millisecond)
+			Expect(w.Append([]byte("late"))).To(Succeed())
+		}()
+		Expect(next(w)).To(Equal("late"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(w.Ack()).To(Succeed())
+		_, err = w.Next(ctx)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("should replay records that are not acknowledged after a restart", func() {
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 10; i++ {
+			Expect(w.Append([]byte(fmt.Sprintf("record-%d", i)))).To(Succeed())
+		}
+		for i := 0; i < 4; i++ {
+			Expect(next(w)).To(Equal(fmt.Sprintf("record-%d", i)))
+			Expect(w.Ack()).To(Succeed())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		w, err = buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+		Expect(w.Stats().Records).To(Equal(int64(6)))
+		for i := 4; i < 10; i++ {
+			Expect(next(w)).To(Equal(fmt.Sprintf("record-%d", i)))
+			Expect(w.Ack()).To(Succeed())
+		}
+	})
+
+	It("should remove segments that are completely acknowledged", func() {
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		for i := 0; i < 10; i++ {
+			Expect(w.Append([]byte(fmt.Sprintf("record-%d", i)))).To(Succeed())
+		}
+		Expect(w.Stats().Segments).To(BeNumerically(">", 1))
+
+		for i := 0; i < 10; i++ {
+			Expect(next(w)).To(Equal(fmt.Sprintf("record-%d", i)))
+			Expect(w.Ack()).To(Succeed())
+		}
+		Expect(w.Append([]byte("trigger"))).To(Succeed())
+		Expect(next(w)).To(Equal("trigger"))
+		Expect(w.Stats().Segments).To(Equal(1))
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(segments).To(HaveLen(1))
+	})
+
+	It("should reject records if the buffer is full", func() {
+		opts.MaxSize = 64
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+
+		Expect(w.Append(make([]byte, 40))).To(Succeed())
+		Expect(w.Append(make([]byte, 40))).To(Equal(buffer.ErrFull))
+	})
+
+	It("should truncate an incomplete record at the end of the last segment", func() {
+		w, err := buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Append([]byte("complete"))).To(Succeed())
+		Expect(w.Close()).To(Succeed())
+
+		segments, err := filepath.Glob(filepath.Join(dir, "*.seg"))
+		Expect(err).ToNot(HaveOccurred())
+		f, err := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0600)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = f.Write([]byte{0, 0, 0, 20, 1, 2})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		w, err = buffer.Open(logger, opts)
+		Expect(err).ToNot(HaveOccurred())
+		defer w.Close()
+		Expect(w.Stats().Records).To(Equal(int64(1)))
+		Expect(next(w)).To(Equal("complete"))
+		Expect(w.Ack()).To(Succeed())
+
+		Expect(w.Append([]byte("after"))).To(Succeed())
+		Expect(next(w)).To(Equal("after"))
+	})
+})
@@ -0,0 +1,61 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buffer
+
+import (
+	"encoding/binary"
+	"github.com/pkg/errors"
+	"hash/crc32"
+	"io"
+)
+
+// headerSize is the size of the record header which consists of the payload length and its crc32 checksum
+const headerSize = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeRecord(data []byte) []byte {
+	record := make([]byte, headerSize+len(data))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.Checksum(data, crcTable))
+	copy(record[headerSize:], data)
+	return record
+}
+
+// readRecord reads the record at the given offset.
+// The record must not exceed the given segment size.
+func readRecord(r io.ReaderAt, offset, segmentSize int64) ([]byte, error) {
+	if offset+headerSize > segmentSize {
+		return nil, errors.Errorf("incomplete record header at offset %d", offset)
+	}
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, offset); err != nil {
+		return nil, err
+	}
+	length := int64(binary.BigEndian.Uint32(header[0:4]))
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if offset+headerSize+length > segmentSize {
+		return nil, errors.Errorf("incomplete record at offset %d", offset)
+	}
+
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, offset+headerSize); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(data, crcTable) != checksum {
+		return nil, errors.Errorf("checksum mismatch of record at offset %d", offset)
+	}
+	return data, nil
+}
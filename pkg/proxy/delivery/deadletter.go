@@ -0,0 +1,190 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/pkg/errors"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DeadLetterReasonAnnotation is the annotation that contains the reason why an event was dead-lettered
+const DeadLetterReasonAnnotation = "auditlog.extensions.gardener.cloud/dead-letter-reason"
+
+// FailedEvent is an event that could not be delivered
+type FailedEvent struct {
+	Event  audit.Event
+	Reason string
+}
+
+// DeadLetter stores events that could not be delivered to a provider
+type DeadLetter interface {
+	// Write stores the failed events that could not be delivered to the given provider
+	Write(providerName string, events []FailedEvent) error
+}
+
+// ErrDeadLetterFull is returned if the events do not fit into the dead-letter file anymore
+var ErrDeadLetterFull = errors.New("dead-letter file is full")
+
+// fileDeadLetter appends undeliverable events to a file as json lines.
+// The file is never rotated, events that would exceed the maximum size are rejected until the file is moved away.
+type fileDeadLetter struct {
+	mux         sync.Mutex
+	path        string
+	maxSize     int64
+	file        *os.File
+	size        int64
+	full        bool
+	observeFull func(full bool)
+}
+
+// deadLetterRecord is a line of the dead-letter file
+type deadLetterRecord struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Provider  string         `json:"provider"`
+	Reason    string         `json:"reason"`
+	Event     *auditv1.Event `json:"event"`
+}
+
+// NewFileDeadLetter creates a dead-letter sink that appends the events as json lines to the file at the given path.
+// If the maximum size is positive, events that would exceed the size are rejected with ErrDeadLetterFull so that
+// they are kept by the caller. The file is reopened once it has been moved away or truncated.
+// Every change of the state is reported to observeFull.
+func NewFileDeadLetter(path string, maxSize int64, observeFull func(full bool)) (DeadLetter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create dead-letter directory")
+	}
+	f := &fileDeadLetter{path: path, maxSize: maxSize, observeFull: observeFull}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *fileDeadLetter) Write(providerName string, events []FailedEvent) error {
+	buf := bytes.NewBuffer([]byte{})
+	encoder := json.NewEncoder(buf)
+	now := time.Now().UTC()
+	for i := range events {
+		event, err := provider.ConvertEventToV1(&events[i].Event)
+		if err != nil {
+			return err
+		}
+		if err := encoder.Encode(&deadLetterRecord{
+			Timestamp: now,
+			Provider:  providerName,
+			Reason:    events[i].Reason,
+			Event:     event,
+		}); err != nil {
+			return err
+		}
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(buf.Len()) > f.maxSize {
+		if err := f.reopen(); err != nil {
+			return err
+		}
+		if f.size > 0 && f.size+int64(buf.Len()) > f.maxSize {
+			f.setFull(true)
+			return ErrDeadLetterFull
+		}
+	}
+	f.setFull(false)
+	n, err := f.file.Write(buf.Bytes())
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+func (f *fileDeadLetter) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "unable to open dead-letter file")
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(err, "unable to determine size of dead-letter file")
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// reopen opens the file at the path again if the open file has been moved away or truncated.
+func (f *fileDeadLetter) reopen() error {
+	current, err := f.file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "unable to determine size of dead-letter file")
+	}
+	info, err := os.Stat(f.path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "unable to determine size of dead-letter file")
+	}
+	if err == nil && os.SameFile(current, info) {
+		f.size = current.Size()
+		return nil
+	}
+
+	if err := f.file.Close(); err != nil {
+		return errors.Wrap(err, "unable to close dead-letter file")
+	}
+	return f.open()
+}
+
+// setFull reports changes of the state to observeFull
+func (f *fileDeadLetter) setFull(full bool) {
+	if f.full == full {
+		return
+	}
+	f.full = full
+	if f.observeFull != nil {
+		f.observeFull(full)
+	}
+}
+
+// providerDeadLetter writes undeliverable events to another provider, e.g. a dedicated elasticsearch index.
+type providerDeadLetter struct {
+	provider provider.Interface
+}
+
+// NewProviderDeadLetter creates a dead-letter sink that logs the events to the given provider.
+// The reason of the failure is added as annotation to every event.
+func NewProviderDeadLetter(p provider.Interface) DeadLetter {
+	return &providerDeadLetter{provider: p}
+}
+
+func (p *providerDeadLetter) Write(_ string, events []FailedEvent) error {
+	eventList := &audit.EventList{Items: make([]audit.Event, 0, len(events))}
+	for _, failed := range events {
+		event := failed.Event.DeepCopy()
+		if event.Annotations == nil {
+			event.Annotations = map[string]string{}
+		}
+		event.Annotations[DeadLetterReasonAnnotation] = failed.Reason
+		eventList.Items = append(eventList.Items, *event)
+	}
+	return p.provider.Log(eventList)
+}
@@ -0,0 +1,209 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"time"
+)
+
+// jitterFactor is the maximum factor a backoff is randomly extended with
+const jitterFactor = 0.5
+
+// Options contains the retry and dead-letter configuration of a Deliverer
+type Options struct {
+	// MaxRetries is the maximum number of retries of transient failures
+	MaxRetries int
+	// InitialBackoff is the time to wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait between two retries
+	MaxBackoff time.Duration
+	// DeadLetter receives the events that cannot be delivered.
+	// Undeliverable events are returned as error if no dead-letter sink is defined.
+	DeadLetter DeadLetter
+}
+
+// UndeliveredError is returned for the events that could neither be delivered nor written to the dead-letter sink
+type UndeliveredError struct {
+	// Events are the undelivered events
+	Events []audit.Event
+	// Err is the reason why the events could not be delivered
+	Err error
+}
+
+func (e *UndeliveredError) Error() string {
+	return e.Err.Error()
+}
+
+// Undelivered returns the events of the event list that were not delivered because of the given error.
+// All events are returned if the error does not contain the undelivered events.
+func Undelivered(events *audit.EventList, err error) *audit.EventList {
+	if undeliveredErr, ok := errors.Cause(err).(*UndeliveredError); ok {
+		return &audit.EventList{ListMeta: events.ListMeta, Items: undeliveredErr.Events}
+	}
+	return events
+}
+
+// Deliverer delivers event lists to a provider.
+// Transient failures are retried with a jittered exponential backoff and only the failed events of
+// partially failed event lists are retried.
+// Events that are permanently rejected or still fail after all retries are written to the dead-letter sink.
+type Deliverer struct {
+	log      logr.Logger
+	provider provider.Interface
+	opts     Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a new deliverer for the given provider
+func New(log logr.Logger, p provider.Interface, opts Options) *Deliverer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Deliverer{
+		log:      log,
+		provider: p,
+		opts:     opts,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Close aborts all pending retries.
+func (d *Deliverer) Close() {
+	d.cancel()
+}
+
+// Log delivers the event list to the provider.
+// Retries end when the context is done. Events that cannot be retried before the deadline of the context are written
+// to the dead-letter sink like events that still fail after all retries.
+// An UndeliveredError is only returned if some events could neither be delivered nor written to the dead-letter sink.
+func (d *Deliverer) Log(ctx context.Context, events *audit.EventList) error {
+	var (
+		pending = events.Items
+		backoff = d.opts.InitialBackoff
+	)
+	for retry := 0; ; retry++ {
+		err := d.provider.Log(&audit.EventList{ListMeta: events.ListMeta, Items: pending})
+		if err == nil {
+			return nil
+		}
+
+		retryable, rejected := classify(pending, err)
+		if len(rejected) != 0 {
+			d.log.Info("Events were rejected by the provider", "provider", d.provider.Name(), "events", len(rejected), "reason", err.Error())
+			if err := d.deadLetter(rejected); err != nil {
+				undelivered := make([]audit.Event, 0, len(rejected)+len(retryable))
+				for _, failed := range rejected {
+					undelivered = append(undelivered, failed.Event)
+				}
+				return &UndeliveredError{Events: append(undelivered, retryable...), Err: err}
+			}
+		}
+		if len(retryable) == 0 {
+			return nil
+		}
+
+		delay := jitter(backoff)
+		var reason string
+		switch {
+		case retry >= d.opts.MaxRetries:
+			reason = "retries exhausted"
+		case exceedsDeadline(ctx, delay):
+			reason = "delivery deadline exceeded"
+		}
+		if reason != "" {
+			d.log.Info("Events could not be delivered", "provider", d.provider.Name(), "events", len(retryable), "retries", retry, "reason", reason)
+			failed := make([]FailedEvent, 0, len(retryable))
+			for _, event := range retryable {
+				failed = append(failed, FailedEvent{Event: event, Reason: fmt.Sprintf("%s: %v", reason, err)})
+			}
+			if err := d.deadLetter(failed); err != nil {
+				return &UndeliveredError{Events: retryable, Err: err}
+			}
+			return nil
+		}
+
+		d.log.V(3).Info("Retrying delivery of failed events", "provider", d.provider.Name(), "events", len(retryable), "retry", retry+1, "backoff", delay.String(), "reason", err.Error())
+		select {
+		case <-d.ctx.Done():
+			return &UndeliveredError{Events: retryable, Err: errors.Wrap(err, "delivery aborted")}
+		case <-ctx.Done():
+			return &UndeliveredError{Events: retryable, Err: errors.Wrap(err, "delivery aborted")}
+		case <-time.After(delay):
+		}
+		if backoff *= 2; backoff > d.opts.MaxBackoff {
+			backoff = d.opts.MaxBackoff
+		}
+		pending = retryable
+	}
+}
+
+func (d *Deliverer) deadLetter(events []FailedEvent) error {
+	if d.opts.DeadLetter == nil {
+		return fmt.Errorf("%d events could not be delivered to provider %s: %s", len(events), d.provider.Name(), events[0].Reason)
+	}
+	if err := d.opts.DeadLetter.Write(d.provider.Name(), events); err != nil {
+		return errors.Wrapf(err, "unable to write %d undeliverable events to the dead-letter sink", len(events))
+	}
+	return nil
+}
+
+// classify splits the events of a failed delivery into events that can be retried and events that are permanently rejected.
+func classify(events []audit.Event, err error) ([]audit.Event, []FailedEvent) {
+	partialErr, ok := errors.Cause(err).(*provider.PartialError)
+	if !ok {
+		if provider.IsTransient(err) {
+			return events, nil
+		}
+		rejected := make([]FailedEvent, 0, len(events))
+		for _, event := range events {
+			rejected = append(rejected, FailedEvent{Event: event, Reason: err.Error()})
+		}
+		return nil, rejected
+	}
+
+	var (
+		retryable = make([]audit.Event, 0)
+		rejected  = make([]FailedEvent, 0)
+	)
+	for _, eventErr := range partialErr.Errors {
+		if eventErr.Index < 0 || eventErr.Index >= len(events) {
+			continue
+		}
+		if eventErr.Transient {
+			retryable = append(retryable, events[eventErr.Index])
+			continue
+		}
+		rejected = append(rejected, FailedEvent{Event: events[eventErr.Index], Reason: eventErr.Err.Error()})
+	}
+	return retryable, rejected
+}
+
+// exceedsDeadline returns whether the deadline of the context is reached before the given delay elapsed
+func exceedsDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Now().Add(delay).After(deadline)
+}
+
+func jitter(backoff time.Duration) time.Duration {
+	return wait.Jitter(backoff, jitterFactor)
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package delivery_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/delivery"
+
+	extensionsv1alpha1 "github.com/gardener/gardener/pkg/apis/extensions/v1alpha1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// fakeProvider returns the configured errors for consecutive calls and records the logged events
+type fakeProvider struct {
+	errs   []func(events *audit.EventList) error
+	logged [][]types.UID
+}
+
+func (f *fakeProvider) Name() string                     { return "fake" }
+func (f *fakeProvider) New() (provider.Interface, error) { return f, nil }
+func (f *fakeProvider) Reconcile(_ context.Context, _ *extensionsv1alpha1.Extension) error {
+	return nil
+}
+func (f *fakeProvider) Delete(_ context.Context, _ *extensionsv1alpha1.Extension) error {
+	return nil
+}
+func (f *fakeProvider) ValidateBackendConfig(_ []byte, _ *corev1.SecretReference, _ *field.Path) field.ErrorList {
+	return nil
+}
+func (f *fakeProvider) Log(events *audit.EventList) error {
+	ids := make([]types.UID, 0, len(events.Items))
+	for _, event := range events.Items {
+		ids = append(ids, event.AuditID)
+	}
+	f.logged = append(f.logged, ids)
+
+	call := len(f.logged) - 1
+	if call < len(f.errs) && f.errs[call] != nil {
+		return f.errs[call](events)
+	}
+	return nil
+}
+
+// memoryDeadLetter keeps all dead-lettered events in memory
+type memoryDeadLetter struct {
+	events []delivery.FailedEvent
+	err    error
+}
+
+func (m *memoryDeadLetter) Write(_ string, events []delivery.FailedEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func eventList(ids ...types.UID) *audit.EventList {
+	list := &audit.EventList{}
+	for _, id := range ids {
+		list.Items = append(list.Items, audit.Event{AuditID: id, Verb: "get"})
+	}
+	return list
+}
+
+var _ = Describe("Deliverer", func() {
+	var (
+		p          *fakeProvider
+		deadLetter *memoryDeadLetter
+		opts       delivery.Options
+	)
+
+	BeforeEach(func() {
+		p = &fakeProvider{}
+		deadLetter = &memoryDeadLetter{}
+		opts = delivery.Options{
+			MaxRetries:     3,
+			InitialBackoff: time.Millisecond,
+			MaxBackoff:     2 * time.Millisecond,
+			DeadLetter:     deadLetter,
+		}
+	})
+
+	It("should retry transient failures of the whole event list", func() {
+		transient := func(_ *audit.EventList) error { return provider.NewTransientError(errors.New("connection refused")) }
+		p.errs = append(p.errs, transient, transient)
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(context.Background(), eventList("a", "b"))).To(Succeed())
+		Expect(p.logged).To(Equal([][]types.UID{{"a", "b"}, {"a", "b"}, {"a", "b"}}))
+		Expect(deadLetter.events).To(BeEmpty())
+	})
+
+	It("should only retry the transiently failed events and dead-letter rejected events", func() {
+		p.errs = append(p.errs, func(_ *audit.EventList) error {
+			return &provider.PartialError{Errors: []provider.EventError{
+				{Index: 1, Err: errors.New("es_rejected_execution_exception"), Transient: true},
+				{Index: 2, Err: errors.New("mapper_parsing_exception")},
+			}}
+		})
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(context.Background(), eventList("a", "b", "c"))).To(Succeed())
+		Expect(p.logged).To(Equal([][]types.UID{{"a", "b", "c"}, {"b"}}))
+		Expect(deadLetter.events).To(HaveLen(1))
+		Expect(deadLetter.events[0].Event.AuditID).To(Equal(types.UID("c")))
+		Expect(deadLetter.events[0].Reason).To(Equal("mapper_parsing_exception"))
+	})
+
+	It("should dead-letter events after all retries are exhausted", func() {
+		for i := 0; i < 4; i++ {
+			p.errs = append(p.errs, func(_ *audit.EventList) error { return provider.NewTransientError(errors.New("unavailable")) })
+		}
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(context.Background(), eventList("a"))).To(Succeed())
+		Expect(p.logged).To(HaveLen(4))
+		Expect(deadLetter.events).To(HaveLen(1))
+		Expect(deadLetter.events[0].Reason).To(ContainSubstring("retries exhausted"))
+	})
+
+	It("should dead-letter events that cannot be retried before the deadline of the context", func() {
+		for i := 0; i < 4; i++ {
+			p.errs = append(p.errs, func(_ *audit.EventList) error { return provider.NewTransientError(errors.New("unavailable")) })
+		}
+		opts.InitialBackoff = time.Minute
+		opts.MaxBackoff = time.Minute
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(ctx, eventList("a"))).To(Succeed())
+		Expect(p.logged).To(HaveLen(1))
+		Expect(deadLetter.events).To(HaveLen(1))
+		Expect(deadLetter.events[0].Reason).To(ContainSubstring("delivery deadline exceeded"))
+	})
+
+	It("should return an error if the dead-letter sink fails", func() {
+		p.errs = append(p.errs, func(_ *audit.EventList) error { return errors.New("invalid") })
+		deadLetter.err = errors.New("disk full")
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(context.Background(), eventList("a"))).To(HaveOccurred())
+	})
+
+	It("should return an error for undeliverable events if no dead-letter sink is configured", func() {
+		p.errs = append(p.errs, func(_ *audit.EventList) error { return errors.New("invalid") })
+		opts.DeadLetter = nil
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		Expect(d.Log(context.Background(), eventList("a"))).To(HaveOccurred())
+	})
+
+	It("should only return the undelivered events of partially delivered event lists", func() {
+		p.errs = append(p.errs, func(_ *audit.EventList) error {
+			return &provider.PartialError{Errors: []provider.EventError{{Index: 1, Err: errors.New("mapper_parsing_exception")}}}
+		})
+		opts.DeadLetter = nil
+
+		d := delivery.New(log.NullLogger{}, p, opts)
+		events := eventList("a", "b", "c")
+		err := d.Log(context.Background(), events)
+		Expect(err).To(HaveOccurred())
+		Expect(delivery.Undelivered(events, err)).To(Equal(eventList("b")))
+		Expect(delivery.Undelivered(events, errors.New("unknown"))).To(Equal(events))
+	})
+})
+
+var _ = Describe("FileDeadLetter", func() {
+	It("should append the failed events as audit.k8s.io/v1 json lines", func() {
+		dir, err := ioutil.TempDir("", "auditlog-deadletter")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dead-letter.jsonl")
+
+		deadLetter, err := delivery.NewFileDeadLetter(path, 0, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("a").Items[0], Reason: "first"},
+		})).To(Succeed())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("b").Items[0], Reason: "second"},
+		})).To(Succeed())
+
+		f, err := os.Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		lines := make([]map[string]interface{}, 0)
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := map[string]interface{}{}
+			Expect(json.Unmarshal(scanner.Bytes(), &line)).To(Succeed())
+			lines = append(lines, line)
+		}
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]["provider"]).To(Equal("elasticsearch"))
+		Expect(lines[1]["reason"]).To(Equal("second"))
+		event := lines[1]["event"].(map[string]interface{})
+		Expect(event["apiVersion"]).To(Equal("audit.k8s.io/v1"))
+		Expect(event["auditID"]).To(Equal("b"))
+	})
+
+	It("should reject the events that exceed the maximum size until the file is moved away", func() {
+		dir, err := ioutil.TempDir("", "auditlog-deadletter")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dead-letter.jsonl")
+
+		full := make([]bool, 0)
+		deadLetter, err := delivery.NewFileDeadLetter(path, 512, func(f bool) { full = append(full, f) })
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("a").Items[0], Reason: "rejected"},
+		})).To(Succeed())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("b").Items[0], Reason: "rejected"},
+		})).To(Equal(delivery.ErrDeadLetterFull))
+		Expect(full).To(Equal([]bool{true}))
+
+		content, err := ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring(`"auditID":"a"`))
+		Expect(string(content)).ToNot(ContainSubstring(`"auditID":"b"`))
+
+		Expect(os.Rename(path, path+".1")).To(Succeed())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("b").Items[0], Reason: "rejected"},
+		})).To(Succeed())
+		Expect(full).To(Equal([]bool{true, false}))
+
+		content, err = ioutil.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring(`"auditID":"b"`))
+	})
+
+	It("should accept events again after the file has been truncated", func() {
+		dir, err := ioutil.TempDir("", "auditlog-deadletter")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "dead-letter.jsonl")
+
+		deadLetter, err := delivery.NewFileDeadLetter(path, 512, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("a").Items[0], Reason: "rejected"},
+		})).To(Succeed())
+		Expect(os.Truncate(path, 0)).To(Succeed())
+		Expect(deadLetter.Write("elasticsearch", []delivery.FailedEvent{
+			{Event: eventList("b").Items[0], Reason: "rejected"},
+		})).To(Succeed())
+	})
+})
@@ -0,0 +1,62 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+// Enricher attaches the metadata of the shoot as annotations to the audit events
+type Enricher struct {
+	annotations map[string]string
+}
+
+// New creates an enricher for the given shoot metadata.
+// The returned enricher does not modify the events if the metadata is nil.
+func New(config *apisconfig.ShootMetadata) *Enricher {
+	if config == nil {
+		return &Enricher{}
+	}
+	return &Enricher{annotations: provider.ShootMetadata{
+		Name:         config.Name,
+		Project:      config.Project,
+		TechnicalID:  config.TechnicalID,
+		UID:          config.UID,
+		Seed:         config.Seed,
+		Region:       config.Region,
+		ProviderType: config.ProviderType,
+	}.Annotations()}
+}
+
+// Apply attaches the shoot metadata to all events of the list and returns the list.
+// Existing annotations with the same keys are overwritten.
+func (e *Enricher) Apply(events *audit.EventList) *audit.EventList {
+	if len(e.annotations) == 0 {
+		return events
+	}
+	for i := range events.Items {
+		annotations := make(map[string]string, len(events.Items[i].Annotations)+len(e.annotations))
+		for key, value := range events.Items[i].Annotations {
+			annotations[key] = value
+		}
+		for key, value := range e.annotations {
+			annotations[key] = value
+		}
+		events.Items[i].Annotations = annotations
+	}
+	return events
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enrichment_test
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/enrichment"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+var _ = Describe("Enricher", func() {
+	It("should attach the shoot metadata to all events", func() {
+		e := enrichment.New(&apisconfig.ShootMetadata{
+			Name:         "test",
+			Project:      "dev",
+			TechnicalID:  "shoot--dev--test",
+			UID:          "1234",
+			Seed:         "aws-eu1",
+			Region:       "eu-west-1",
+			ProviderType: "aws",
+		})
+		events := e.Apply(&audit.EventList{Items: []audit.Event{
+			{AuditID: "1"},
+			{AuditID: "2", Annotations: map[string]string{"authorization.k8s.io/decision": "allow", provider.AnnotationShootName: "spoofed"}},
+		}})
+
+		Expect(events.Items).To(HaveLen(2))
+		for i := range events.Items {
+			Expect(provider.ShootMetadataFrom(&events.Items[i])).To(Equal(provider.ShootMetadata{
+				Name:         "test",
+				Project:      "dev",
+				TechnicalID:  "shoot--dev--test",
+				UID:          "1234",
+				Seed:         "aws-eu1",
+				Region:       "eu-west-1",
+				ProviderType: "aws",
+			}))
+		}
+		Expect(events.Items[0].Annotations).To(HaveLen(7))
+		Expect(events.Items[1].Annotations).To(HaveKeyWithValue("authorization.k8s.io/decision", "allow"))
+	})
+
+	It("should only attach the defined fields", func() {
+		events := enrichment.New(&apisconfig.ShootMetadata{TechnicalID: "shoot--dev--test"}).Apply(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})
+		Expect(events.Items[0].Annotations).To(Equal(map[string]string{provider.AnnotationShootTechnicalID: "shoot--dev--test"}))
+	})
+
+	It("should not modify the events without metadata", func() {
+		events := enrichment.New(nil).Apply(&audit.EventList{Items: []audit.Event{{AuditID: "1"}}})
+		Expect(events.Items[0].Annotations).To(BeNil())
+	})
+})
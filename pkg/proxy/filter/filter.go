@@ -0,0 +1,174 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"strings"
+)
+
+// Filter selects the audit events that are sent to an output
+type Filter struct {
+	include []*Matcher
+	exclude []*Matcher
+}
+
+// Matcher matches audit events
+type Matcher struct {
+	verbs         sets.String
+	users         sets.String
+	userGroups    sets.String
+	namespaces    sets.String
+	resources     map[string]sets.String
+	levels        sets.String
+	stages        sets.String
+	responseCodes map[int32]bool
+	userAgents    []string
+}
+
+// New creates a new filter from the given output filter configuration.
+// The returned filter selects all events if the configuration is nil.
+func New(config *apisconfig.OutputFilter) *Filter {
+	f := &Filter{}
+	if config == nil {
+		return f
+	}
+	for _, m := range config.Include {
+		f.include = append(f.include, NewMatcher(m))
+	}
+	for _, m := range config.Exclude {
+		f.exclude = append(f.exclude, NewMatcher(m))
+	}
+	return f
+}
+
+// Matches returns true if the event is selected by the filter
+func (f *Filter) Matches(event *audit.Event) bool {
+	if len(f.include) != 0 && !matchesAny(f.include, event) {
+		return false
+	}
+	return !matchesAny(f.exclude, event)
+}
+
+// Filter returns an event list with all events that are selected by the filter.
+// The given event list is returned if all events are selected.
+func (f *Filter) Filter(events *audit.EventList) *audit.EventList {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return events
+	}
+	filtered := &audit.EventList{ListMeta: events.ListMeta, Items: make([]audit.Event, 0, len(events.Items))}
+	for i := range events.Items {
+		if f.Matches(&events.Items[i]) {
+			filtered.Items = append(filtered.Items, events.Items[i])
+		}
+	}
+	return filtered
+}
+
+// NewMatcher creates a matcher from the given configuration.
+// The returned matcher matches all events if no field is defined.
+func NewMatcher(config apisconfig.EventMatcher) *Matcher {
+	m := &Matcher{
+		verbs:      newSet(config.Verbs),
+		users:      newSet(config.Users),
+		userGroups: newSet(config.UserGroups),
+		namespaces: newSet(config.Namespaces),
+		levels:     newSet(config.Levels),
+		stages:     newSet(config.Stages),
+		userAgents: config.UserAgents,
+	}
+	if len(config.Resources) != 0 {
+		m.resources = map[string]sets.String{}
+		for _, gr := range config.Resources {
+			if _, ok := m.resources[gr.Group]; !ok {
+				m.resources[gr.Group] = sets.NewString()
+			}
+			m.resources[gr.Group].Insert(gr.Resources...)
+		}
+	}
+	if len(config.ResponseCodes) != 0 {
+		m.responseCodes = make(map[int32]bool, len(config.ResponseCodes))
+		for _, code := range config.ResponseCodes {
+			m.responseCodes[code] = true
+		}
+	}
+	return m
+}
+
+// Matches returns true if the event matches all defined fields
+func (m *Matcher) Matches(event *audit.Event) bool {
+	if m.verbs != nil && !m.verbs.Has(event.Verb) {
+		return false
+	}
+	if m.users != nil && !m.users.Has(event.User.Username) {
+		return false
+	}
+	if m.userGroups != nil && !m.userGroups.HasAny(event.User.Groups...) {
+		return false
+	}
+	if m.levels != nil && !m.levels.Has(string(event.Level)) {
+		return false
+	}
+	if m.stages != nil && !m.stages.Has(string(event.Stage)) {
+		return false
+	}
+	if m.namespaces != nil && (event.ObjectRef == nil || !m.namespaces.Has(event.ObjectRef.Namespace)) {
+		return false
+	}
+	if m.resources != nil {
+		if event.ObjectRef == nil {
+			return false
+		}
+		resources, ok := m.resources[event.ObjectRef.APIGroup]
+		if !ok || (resources.Len() != 0 && !resources.Has(event.ObjectRef.Resource)) {
+			return false
+		}
+	}
+	if m.responseCodes != nil && (event.ResponseStatus == nil || !m.responseCodes[event.ResponseStatus.Code]) {
+		return false
+	}
+	if len(m.userAgents) != 0 && !hasAnyPrefix(event.UserAgent, m.userAgents) {
+		return false
+	}
+	return true
+}
+
+func matchesAny(matchers []*Matcher, event *audit.Event) bool {
+	for _, m := range matchers {
+		if m.Matches(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSet returns nil for an empty list so that an undefined field matches all events
+func newSet(values []string) sets.String {
+	if len(values) == 0 {
+		return nil
+	}
+	return sets.NewString(values...)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter_test
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/filter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+func event(id types.UID, verb, group, resource, namespace string, groups ...string) audit.Event {
+	return audit.Event{
+		AuditID: id,
+		Verb:    verb,
+		Level:   audit.LevelMetadata,
+		Stage:   audit.StageResponseComplete,
+		User:    audit.UserInfo{Username: "admin", Groups: groups},
+		ObjectRef: &audit.ObjectReference{
+			APIGroup:  group,
+			Resource:  resource,
+			Namespace: namespace,
+		},
+	}
+}
+
+func ids(events *audit.EventList) []types.UID {
+	out := make([]types.UID, 0, len(events.Items))
+	for _, e := range events.Items {
+		out = append(out, e.AuditID)
+	}
+	return out
+}
+
+var _ = Describe("Filter", func() {
+	var events *audit.EventList
+
+	BeforeEach(func() {
+		events = &audit.EventList{Items: []audit.Event{
+			event("1", "get", "", "secrets", "default"),
+			event("2", "create", "apps", "deployments", "default", "system:masters"),
+			event("3", "delete", "", "configmaps", "kube-system"),
+		}}
+	})
+
+	It("should select all events without a configuration", func() {
+		Expect(filter.New(nil).Filter(events)).To(BeIdenticalTo(events))
+	})
+
+	It("should select the events that match any include matcher", func() {
+		f := filter.New(&apisconfig.OutputFilter{
+			Include: []apisconfig.EventMatcher{
+				{Verbs: []string{"create"}},
+				{Namespaces: []string{"kube-system"}},
+			},
+		})
+		Expect(ids(f.Filter(events))).To(Equal([]types.UID{"2", "3"}))
+	})
+
+	It("should require all fields of a matcher to match", func() {
+		f := filter.New(&apisconfig.OutputFilter{
+			Include: []apisconfig.EventMatcher{
+				{Verbs: []string{"get", "create"}, Resources: []apisconfig.GroupResources{{Group: "apps"}}},
+			},
+		})
+		Expect(ids(f.Filter(events))).To(Equal([]types.UID{"2"}))
+	})
+
+	It("should drop the events that match an exclude matcher", func() {
+		f := filter.New(&apisconfig.OutputFilter{
+			Exclude: []apisconfig.EventMatcher{
+				{Resources: []apisconfig.GroupResources{{Resources: []string{"secrets", "configmaps"}}}},
+				{UserGroups: []string{"system:masters"}},
+			},
+		})
+		Expect(f.Filter(events).Items).To(BeEmpty())
+	})
+	It("should match response codes and user agent prefixes", func() {
+		events.Items[0].ResponseStatus = &metav1.Status{Code: 403}
+		events.Items[0].UserAgent = "kubectl/v1.18.0 (linux/amd64) kubernetes/abcdef"
+		events.Items[1].ResponseStatus = &metav1.Status{Code: 201}
+		events.Items[1].UserAgent = "kube-controller-manager/v1.18.0"
+
+		f := filter.New(&apisconfig.OutputFilter{
+			Include: []apisconfig.EventMatcher{{ResponseCodes: []int32{401, 403}}},
+		})
+		Expect(ids(f.Filter(events))).To(Equal([]types.UID{"1"}))
+
+		f = filter.New(&apisconfig.OutputFilter{
+			Include: []apisconfig.EventMatcher{{UserAgents: []string{"kube-controller-manager/", "kube-scheduler/"}}},
+		})
+		Expect(ids(f.Filter(events))).To(Equal([]types.UID{"2"}))
+	})
+})
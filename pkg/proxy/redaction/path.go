@@ -0,0 +1,158 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"strings"
+)
+
+// Roots are the fields of the audit.k8s.io/v1 event a path can start with.
+// The other fields of the event are required to process the event and cannot be redacted.
+var Roots = sets.NewString("requestObject", "responseObject", "annotations", "user", "impersonatedUser", "sourceIPs", "userAgent", "requestURI")
+
+type segmentKind int
+
+const (
+	// fieldSegment selects the field with the name of the segment
+	fieldSegment segmentKind = iota
+	// anyFieldSegment selects all fields of an object
+	anyFieldSegment
+	// anyItemSegment selects all items of a list
+	anyItemSegment
+)
+
+type segment struct {
+	kind segmentKind
+	name string
+}
+
+// Path selects fields of an audit.k8s.io/v1 event
+type Path []segment
+
+// ParsePath parses a path like "requestObject.spec.containers[*].env[*].value" or "annotations['example.com/token']"
+func ParsePath(path string) (Path, error) {
+	var (
+		p    Path
+		rest = path
+	)
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			p = append(p, segment{kind: anyItemSegment})
+			rest = rest[len("[*]"):]
+		case strings.HasPrefix(rest, "['"), strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest[2:], rest[1:2]+"]")
+			if end < 0 {
+				return nil, errors.Errorf("unterminated field name in path %q", path)
+			}
+			p = append(p, segment{kind: fieldSegment, name: rest[2 : 2+end]})
+			rest = rest[2+end+2:]
+		default:
+			if len(p) != 0 {
+				if rest[0] != '.' {
+					return nil, errors.Errorf("expected '.' or '[' before %q in path %q", rest, path)
+				}
+				rest = rest[1:]
+			}
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			switch name {
+			case "":
+				return nil, errors.Errorf("empty field name in path %q", path)
+			case "*":
+				p = append(p, segment{kind: anyFieldSegment})
+			default:
+				p = append(p, segment{kind: fieldSegment, name: name})
+			}
+			rest = rest[end:]
+		}
+	}
+
+	if len(p) == 0 {
+		return nil, errors.New("path must not be empty")
+	}
+	if p[0].kind != fieldSegment || !Roots.Has(p[0].name) {
+		return nil, errors.Errorf("path %q has to start with one of %s", path, strings.Join(Roots.List(), ", "))
+	}
+	return p, nil
+}
+
+// MustParsePath parses the path and panics if it is invalid
+func MustParsePath(path string) Path {
+	p, err := ParsePath(path)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// redactFunc returns the redacted value or false if the value has to be removed
+type redactFunc func(value interface{}) (interface{}, bool)
+
+// apply redacts the fields of the decoded json value that are selected by the path and returns the updated value
+func (p Path) apply(value interface{}, redact redactFunc) interface{} {
+	seg, rest := p[0], p[1:]
+	update := func(child interface{}) (interface{}, bool) {
+		if len(rest) == 0 {
+			return redact(child)
+		}
+		return rest.apply(child, redact), true
+	}
+
+	switch seg.kind {
+	case fieldSegment:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		if child, ok := obj[seg.name]; ok {
+			if child, keep := update(child); keep {
+				obj[seg.name] = child
+			} else {
+				delete(obj, seg.name)
+			}
+		}
+	case anyFieldSegment:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		for key, child := range obj {
+			if child, keep := update(child); keep {
+				obj[key] = child
+			} else {
+				delete(obj, key)
+			}
+		}
+	case anyItemSegment:
+		list, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		kept := list[:0]
+		for _, item := range list {
+			if item, keep := update(item); keep {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	}
+	return value
+}
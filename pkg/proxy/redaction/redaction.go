@@ -0,0 +1,243 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/filter"
+	"github.com/pkg/errors"
+	"k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"regexp"
+)
+
+// Mask is the value that replaces masked values
+const Mask = "******"
+
+const lastAppliedConfiguration = "metadata.annotations['kubectl.kubernetes.io/last-applied-configuration']"
+
+// Builtin are the redactions that are always applied before the configured redactions.
+// They mask the data of secrets, also in json patches and in the last applied configuration,
+// and the tokens of token reviews and token requests.
+var Builtin = []apisconfig.Redaction{
+	{
+		Name:  "builtin-secrets",
+		Match: apisconfig.EventMatcher{Resources: []apisconfig.GroupResources{{Resources: []string{"secrets"}}}},
+		Paths: []string{
+			"requestObject.data",
+			"requestObject.stringData",
+			"requestObject." + lastAppliedConfiguration,
+			"requestObject[*].value",
+			"responseObject.data",
+			"responseObject.stringData",
+			"responseObject." + lastAppliedConfiguration,
+			"responseObject.items[*].data",
+			"responseObject.items[*].stringData",
+			"responseObject.items[*]." + lastAppliedConfiguration,
+		},
+		Action: apisconfig.RedactionActionMask,
+	},
+	{
+		Name:   "builtin-token-reviews",
+		Match:  apisconfig.EventMatcher{Resources: []apisconfig.GroupResources{{Group: "authentication.k8s.io", Resources: []string{"tokenreviews"}}}},
+		Paths:  []string{"requestObject.spec.token", "responseObject.spec.token"},
+		Action: apisconfig.RedactionActionMask,
+	},
+	{
+		Name:   "builtin-token-requests",
+		Match:  apisconfig.EventMatcher{Resources: []apisconfig.GroupResources{{Resources: []string{"serviceaccounts"}}}},
+		Paths:  []string{"responseObject.status.token"},
+		Action: apisconfig.RedactionActionMask,
+	},
+}
+
+// Observer is called for every event that is redacted by a redaction
+type Observer func(redaction string)
+
+// Engine masks, hashes or removes fields of the audit events.
+// Events that cannot be redacted lose their request and response objects,
+// and they are dropped if they can still not be redacted, so that no sensitive data is leaked.
+type Engine struct {
+	redactions []*redaction
+	observe    Observer
+}
+
+type redaction struct {
+	name    string
+	matcher *filter.Matcher
+	paths   []Path
+	redact  redactFunc
+}
+
+// New creates a redaction engine from the builtin and the given redactions.
+// The hash key is required if a redaction uses the Hash action. The observer is optional.
+func New(config []apisconfig.Redaction, hashKey []byte, observe Observer) (*Engine, error) {
+	e := &Engine{observe: observe}
+	for _, r := range append(append([]apisconfig.Redaction{}, Builtin...), config...) {
+		redaction := &redaction{name: r.Name, matcher: filter.NewMatcher(r.Match)}
+		for _, path := range r.Paths {
+			p, err := ParsePath(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid path of redaction %q", r.Name)
+			}
+			redaction.paths = append(redaction.paths, p)
+		}
+
+		var pattern *regexp.Regexp
+		if r.Pattern != "" {
+			var err error
+			if pattern, err = regexp.Compile(r.Pattern); err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern of redaction %q", r.Name)
+			}
+		}
+		switch r.Action {
+		case apisconfig.RedactionActionMask:
+			redaction.redact = replacer(pattern, func(string) string { return Mask })
+		case apisconfig.RedactionActionHash:
+			if len(hashKey) == 0 {
+				return nil, errors.Errorf("a hash key is required for the action %q of redaction %q", r.Action, r.Name)
+			}
+			redaction.redact = replacer(pattern, hasher(hashKey))
+		case apisconfig.RedactionActionRemove:
+			redaction.redact = func(interface{}) (interface{}, bool) { return nil, false }
+		default:
+			return nil, errors.Errorf("unsupported action %q of redaction %q", r.Action, r.Name)
+		}
+		e.redactions = append(e.redactions, redaction)
+	}
+	return e, nil
+}
+
+// Apply redacts the events of the list in place and returns the list.
+func (e *Engine) Apply(events *audit.EventList) *audit.EventList {
+	items := events.Items[:0]
+	for _, event := range events.Items {
+		if e.Redact(&event) {
+			items = append(items, event)
+		}
+	}
+	events.Items = items
+	return events
+}
+
+// Redact redacts the event in place by all redactions it matches.
+// It returns false if the event could not be redacted and has to be dropped.
+func (e *Engine) Redact(event *audit.Event) bool {
+	var matched []*redaction
+	for _, r := range e.redactions {
+		if r.matcher.Matches(event) {
+			matched = append(matched, r)
+		}
+	}
+	if len(matched) == 0 {
+		return true
+	}
+
+	redacted, err := redact(event, matched)
+	if err != nil {
+		withoutObjects := *event
+		withoutObjects.RequestObject, withoutObjects.ResponseObject = nil, nil
+		if redacted, err = redact(&withoutObjects, matched); err != nil {
+			return false
+		}
+	}
+	*event = *redacted
+
+	if e.observe != nil {
+		for _, r := range matched {
+			e.observe(r.name)
+		}
+	}
+	return true
+}
+
+// redact applies the redactions to the audit.k8s.io/v1 json representation of the event
+func redact(event *audit.Event, redactions []*redaction) (*audit.Event, error) {
+	raw, err := provider.MarshalEventV1(event)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	for _, r := range redactions {
+		for _, p := range r.paths {
+			value = p.apply(value, r.redact)
+		}
+	}
+
+	if raw, err = json.Marshal(value); err != nil {
+		return nil, err
+	}
+	out := &auditv1.Event{}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return nil, err
+	}
+	return provider.ConvertEventFromV1(out)
+}
+
+// replacer returns a redactFunc that replaces all values of objects and lists.
+// Only the parts of string values that match the pattern are replaced if a pattern is defined.
+func replacer(pattern *regexp.Regexp, replace func(string) string) redactFunc {
+	var redact func(value interface{}) interface{}
+	redact = func(value interface{}) interface{} {
+		switch v := value.(type) {
+		case nil:
+			return nil
+		case map[string]interface{}:
+			for key, child := range v {
+				v[key] = redact(child)
+			}
+			return v
+		case []interface{}:
+			for i, item := range v {
+				v[i] = redact(item)
+			}
+			return v
+		case string:
+			if pattern != nil {
+				return pattern.ReplaceAllStringFunc(v, replace)
+			}
+			return replace(v)
+		default:
+			if pattern != nil {
+				return v
+			}
+			return replace(fmt.Sprint(v))
+		}
+	}
+	return func(value interface{}) (interface{}, bool) { return redact(value), true }
+}
+
+// hasher returns a function that replaces values with their hex encoded HMAC-SHA256 so that equal values can still be correlated.
+// Unlike a plain hash the keyed hash cannot be reversed by hashing guessed values without the key.
+func hasher(key []byte) func(string) string {
+	return func(value string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(value))
+		return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+	}
+}
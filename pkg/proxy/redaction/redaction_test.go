@@ -0,0 +1,218 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redaction_test
+
+import (
+	"encoding/json"
+
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/redaction"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+func event(group, resource, verb string, requestObject, responseObject string) audit.Event {
+	e := audit.Event{
+		AuditID:   "1",
+		Level:     audit.LevelRequestResponse,
+		Stage:     audit.StageResponseComplete,
+		Verb:      verb,
+		User:      audit.UserInfo{Username: "alice", Extra: map[string]audit.ExtraValue{"scopes": {"openid", "email"}}},
+		ObjectRef: &audit.ObjectReference{APIGroup: group, Resource: resource, Namespace: "default"},
+	}
+	if requestObject != "" {
+		e.RequestObject = &runtime.Unknown{Raw: []byte(requestObject), ContentType: runtime.ContentTypeJSON}
+	}
+	if responseObject != "" {
+		e.ResponseObject = &runtime.Unknown{Raw: []byte(responseObject), ContentType: runtime.ContentTypeJSON}
+	}
+	return e
+}
+
+func object(o *runtime.Unknown) interface{} {
+	ExpectWithOffset(1, o).NotTo(BeNil())
+	var value interface{}
+	ExpectWithOffset(1, json.Unmarshal(o.Raw, &value)).To(Succeed())
+	return value
+}
+
+var _ = Describe("ParsePath", func() {
+	It("should parse valid paths", func() {
+		for _, path := range []string{
+			"requestObject",
+			"requestObject.data.*",
+			"requestObject[*].value",
+			"responseObject.spec.containers[*].env[*].value",
+			"annotations['example.com/token']",
+			`requestObject.metadata.annotations["kubectl.kubernetes.io/last-applied-configuration"]`,
+			"user.extra['example.com/scopes'][*]",
+		} {
+			_, err := redaction.ParsePath(path)
+			Expect(err).NotTo(HaveOccurred(), path)
+		}
+	})
+
+	It("should reject invalid paths", func() {
+		for _, path := range []string{
+			"",
+			"level",
+			"[*].value",
+			"*.data",
+			"requestObject.",
+			"requestObject..data",
+			"requestObject.data[0]",
+			"annotations['example.com/token'",
+			"annotations['example.com/token']value",
+		} {
+			_, err := redaction.ParsePath(path)
+			Expect(err).To(HaveOccurred(), path)
+		}
+	})
+})
+
+var _ = Describe("Engine", func() {
+	const secret = `{"kind":"Secret","metadata":{"name":"s","annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{\"data\":{\"password\":\"c2VjcmV0\"}}"}},"data":{"password":"c2VjcmV0"},"stringData":{"token":"secret"}}`
+
+	var engine *redaction.Engine
+
+	BeforeEach(func() {
+		var err error
+		engine, err = redaction.New(nil, nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should mask the data of secrets in the request and response objects", func() {
+		e := event("", "secrets", "create", secret, secret)
+		Expect(engine.Redact(&e)).To(BeTrue())
+
+		for _, o := range []*runtime.Unknown{e.RequestObject, e.ResponseObject} {
+			Expect(object(o)).To(Equal(map[string]interface{}{
+				"kind": "Secret",
+				"metadata": map[string]interface{}{
+					"name":        "s",
+					"annotations": map[string]interface{}{"kubectl.kubernetes.io/last-applied-configuration": redaction.Mask},
+				},
+				"data":       map[string]interface{}{"password": redaction.Mask},
+				"stringData": map[string]interface{}{"token": redaction.Mask},
+			}))
+			Expect(string(o.Raw)).NotTo(ContainSubstring("c2VjcmV0"))
+		}
+		Expect(e.User.Extra).To(HaveKeyWithValue("scopes", audit.ExtraValue{"openid", "email"}))
+	})
+
+	It("should mask the data of listed and patched secrets", func() {
+		e := event("", "secrets", "patch", `[{"op":"replace","path":"/data/password","value":"c2VjcmV0"}]`, `{"kind":"SecretList","items":[`+secret+`]}`)
+		Expect(engine.Redact(&e)).To(BeTrue())
+
+		Expect(object(e.RequestObject)).To(Equal([]interface{}{
+			map[string]interface{}{"op": "replace", "path": "/data/password", "value": redaction.Mask},
+		}))
+		Expect(string(e.ResponseObject.Raw)).NotTo(ContainSubstring("c2VjcmV0"))
+		Expect(string(e.ResponseObject.Raw)).NotTo(ContainSubstring(`"secret"`))
+	})
+
+	It("should remove the objects of secrets that cannot be decoded", func() {
+		e := event("", "secrets", "patch", "", "")
+		e.RequestObject = &runtime.Unknown{Raw: []byte("data:\n  password: c2VjcmV0\n"), ContentType: "application/apply-patch+yaml"}
+		Expect(engine.Redact(&e)).To(BeTrue())
+		Expect(e.RequestObject).To(BeNil())
+		Expect(e.User.Username).To(Equal("alice"))
+	})
+
+	It("should mask the tokens of token reviews", func() {
+		e := event("authentication.k8s.io", "tokenreviews", "create", `{"spec":{"token":"abc"}}`, `{"spec":{"token":"abc"},"status":{"authenticated":true}}`)
+		Expect(engine.Redact(&e)).To(BeTrue())
+		Expect(object(e.RequestObject)).To(Equal(map[string]interface{}{"spec": map[string]interface{}{"token": redaction.Mask}}))
+		Expect(object(e.ResponseObject)).To(Equal(map[string]interface{}{
+			"spec":   map[string]interface{}{"token": redaction.Mask},
+			"status": map[string]interface{}{"authenticated": true},
+		}))
+	})
+
+	It("should not touch events that match no redaction", func() {
+		e := event("", "configmaps", "create", `{"data":{"key":"value"}}`, "")
+		requestObject := e.RequestObject
+		Expect(engine.Redact(&e)).To(BeTrue())
+		Expect(e.RequestObject).To(BeIdenticalTo(requestObject))
+	})
+
+	It("should apply the configured redactions and observe them", func() {
+		var observed []string
+		var err error
+		engine, err = redaction.New([]apisconfig.Redaction{
+			{
+				Name:   "env",
+				Match:  apisconfig.EventMatcher{Resources: []apisconfig.GroupResources{{Resources: []string{"pods"}}}},
+				Paths:  []string{"requestObject.spec.containers[*].env[*].value"},
+				Action: apisconfig.RedactionActionMask,
+			},
+			{Name: "extra", Paths: []string{"user.extra.*"}, Action: apisconfig.RedactionActionHash},
+			{Name: "tokens", Paths: []string{"annotations['example.com/header']"}, Action: apisconfig.RedactionActionMask, Pattern: `(?i)bearer\s+\S+`},
+			{Name: "annotations", Paths: []string{"requestObject.metadata.annotations"}, Action: apisconfig.RedactionActionRemove},
+		}, []byte("key"), func(name string) { observed = append(observed, name) })
+		Expect(err).NotTo(HaveOccurred())
+
+		e := event("", "pods", "create", `{"metadata":{"annotations":{"a":"b"}},"spec":{"containers":[{"name":"c","env":[{"name":"PASSWORD","value":"secret"},{"name":"PORT","value":"80"}]}]}}`, "")
+		e.Annotations = map[string]string{"example.com/header": "Authorization: Bearer abc.def", "example.com/other": "Bearer xyz"}
+		Expect(engine.Redact(&e)).To(BeTrue())
+
+		Expect(object(e.RequestObject)).To(Equal(map[string]interface{}{
+			"metadata": map[string]interface{}{},
+			"spec": map[string]interface{}{"containers": []interface{}{map[string]interface{}{
+				"name": "c",
+				"env": []interface{}{
+					map[string]interface{}{"name": "PASSWORD", "value": redaction.Mask},
+					map[string]interface{}{"name": "PORT", "value": redaction.Mask},
+				},
+			}}},
+		}))
+		Expect(e.Annotations).To(Equal(map[string]string{"example.com/header": "Authorization: " + redaction.Mask, "example.com/other": "Bearer xyz"}))
+		Expect(e.User.Extra["scopes"]).To(HaveLen(2))
+		Expect(e.User.Extra["scopes"][0]).To(HavePrefix("hmac-sha256:"))
+		Expect(e.User.Extra["scopes"][0]).NotTo(Equal(e.User.Extra["scopes"][1]))
+		Expect(e.User.Username).To(Equal("alice"))
+		Expect(e.ObjectRef).To(Equal(&audit.ObjectReference{Resource: "pods", Namespace: "default"}))
+		Expect(observed).To(Equal([]string{"env", "extra", "tokens", "annotations"}))
+	})
+
+	It("should hash equal values to equal hashes that depend on the key", func() {
+		hashUsernames := func(key string) []audit.Event {
+			engine, err := redaction.New([]apisconfig.Redaction{
+				{Name: "user", Paths: []string{"user.username"}, Action: apisconfig.RedactionActionHash},
+			}, []byte(key), nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			events := &audit.EventList{Items: []audit.Event{event("", "pods", "get", "", ""), event("", "pods", "list", "", "")}}
+			return engine.Apply(events).Items
+		}
+
+		first := hashUsernames("first")
+		Expect(first).To(HaveLen(2))
+		Expect(first[0].User.Username).To(HavePrefix("hmac-sha256:"))
+		Expect(first[0].User.Username).To(Equal(first[1].User.Username))
+		Expect(hashUsernames("second")[0].User.Username).NotTo(Equal(first[0].User.Username))
+	})
+
+	It("should reject invalid redactions", func() {
+		_, err := redaction.New([]apisconfig.Redaction{{Name: "level", Paths: []string{"level"}, Action: apisconfig.RedactionActionMask}}, nil, nil)
+		Expect(err).To(HaveOccurred())
+
+		_, err = redaction.New([]apisconfig.Redaction{{Name: "user", Paths: []string{"user.username"}, Action: apisconfig.RedactionActionHash}}, nil, nil)
+		Expect(err).To(HaveOccurred())
+	})
+})
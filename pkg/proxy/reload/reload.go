@@ -0,0 +1,170 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultInterval is the default interval in which watched files are checked for changes
+const DefaultInterval = 10 * time.Second
+
+// Handler is called with the content of all watched files, in the order of their paths, whenever one of them changes.
+// The previous content is kept if the handler returns an error.
+type Handler func(data [][]byte) error
+
+// DirectoryHandler is called with the content of all files of the watched directory by their names
+// whenever one of them changes. The previous content is kept if the handler returns an error.
+type DirectoryHandler func(data map[string][]byte) error
+
+// Watcher periodically reads a set of files and calls its handler whenever their content changes.
+// The files are polled instead of relying on file system notifications because mounted secrets are
+// updated by atomically swapping symlinks.
+type Watcher struct {
+	log      logr.Logger
+	paths    []string
+	interval time.Duration
+	read     func() ([]string, [][]byte, error)
+	handler  func(names []string, data [][]byte) error
+
+	checksum []byte
+}
+
+// NewWatcher creates a new watcher for the given files.
+// The files are initially read and passed to the handler before the watcher is returned.
+func NewWatcher(log logr.Logger, interval time.Duration, handler Handler, paths ...string) (*Watcher, error) {
+	w := &Watcher{
+		log:      log,
+		paths:    paths,
+		interval: interval,
+		handler:  func(_ []string, data [][]byte) error { return handler(data) },
+	}
+	w.read = w.readFiles
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewDirectoryWatcher creates a new watcher for the files of the given directory, e.g. a mounted secret.
+// Hidden files are ignored, they contain the data of the mounted secret that the visible files link to.
+// The files are initially read and passed to the handler before the watcher is returned.
+func NewDirectoryWatcher(log logr.Logger, interval time.Duration, handler DirectoryHandler, dir string) (*Watcher, error) {
+	w := &Watcher{
+		log:      log,
+		paths:    []string{dir},
+		interval: interval,
+		handler: func(names []string, data [][]byte) error {
+			files := make(map[string][]byte, len(names))
+			for i, name := range names {
+				files[name] = data[i]
+			}
+			return handler(files)
+		},
+	}
+	w.read = w.readDirectory
+	if _, err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Start checks the files for changes until the stop channel is closed.
+func (w *Watcher) Start(stop <-chan struct{}) {
+	go wait.Until(func() {
+		changed, err := w.Reload()
+		if err != nil {
+			w.log.Error(err, "unable to reload files", "paths", w.paths)
+			return
+		}
+		if changed {
+			w.log.Info("Files reloaded", "paths", w.paths)
+		}
+	}, w.interval, stop)
+}
+
+// Reload reads the files and calls the handler if their content changed since the last successful reload.
+func (w *Watcher) Reload() (bool, error) {
+	names, data, err := w.read()
+	if err != nil {
+		return false, err
+	}
+
+	hash := sha256.New()
+	for i := range data {
+		nameSum, sum := sha256.Sum256([]byte(names[i])), sha256.Sum256(data[i])
+		hash.Write(nameSum[:])
+		hash.Write(sum[:])
+	}
+	checksum := hash.Sum(nil)
+	if bytes.Equal(checksum, w.checksum) {
+		return false, nil
+	}
+	if err := w.handler(names, data); err != nil {
+		return false, err
+	}
+	w.checksum = checksum
+	return true, nil
+}
+
+func (w *Watcher) readFiles() ([]string, [][]byte, error) {
+	data := make([][]byte, 0, len(w.paths))
+	for _, path := range w.paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to read %s", path)
+		}
+		data = append(data, content)
+	}
+	return w.paths, data, nil
+}
+
+func (w *Watcher) readDirectory() ([]string, [][]byte, error) {
+	dir := w.paths[0]
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "unable to read directory %s", dir)
+	}
+	var (
+		names = make([]string, 0, len(infos))
+		data  = make([][]byte, 0, len(infos))
+	)
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, info.Name())
+		// the files of mounted secrets are symlinks, so the type of their target is checked
+		if stat, err := os.Stat(path); err != nil || stat.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to read %s", path)
+		}
+		names = append(names, info.Name())
+		data = append(data, content)
+	}
+	return names, data, nil
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reload_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/reload"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("Watcher", func() {
+	var (
+		dir     string
+		a, b    string
+		calls   [][]string
+		failing error
+		handler reload.Handler
+	)
+
+	write := func(path, content string) {
+		Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auditlog-reload")
+		Expect(err).ToNot(HaveOccurred())
+		a, b = filepath.Join(dir, "a"), filepath.Join(dir, "b")
+		write(a, "a1")
+		write(b, "b1")
+
+		calls, failing = nil, nil
+		handler = func(data [][]byte) error {
+			if failing != nil {
+				return failing
+			}
+			call := make([]string, 0, len(data))
+			for _, d := range data {
+				call = append(call, string(d))
+			}
+			calls = append(calls, call)
+			return nil
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("should pass the initial content of the files in the order of their paths", func() {
+		_, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, b, a)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal([][]string{{"b1", "a1"}}))
+	})
+
+	It("should only call the handler if the content of a file changed", func() {
+		w, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, a, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(w.Reload()).To(BeFalse())
+		write(a, "a1")
+		Expect(w.Reload()).To(BeFalse())
+		Expect(calls).To(HaveLen(1))
+
+		write(b, "b2")
+		Expect(w.Reload()).To(BeTrue())
+		Expect(w.Reload()).To(BeFalse())
+		Expect(calls).To(Equal([][]string{{"a1", "b1"}, {"a1", "b2"}}))
+	})
+
+	It("should fail to create a watcher for missing files", func() {
+		_, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, a, filepath.Join(dir, "missing"))
+		Expect(err).To(HaveOccurred())
+		Expect(calls).To(BeEmpty())
+	})
+
+	It("should keep the content while a file is missing and reload it once it reappears", func() {
+		w, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, a, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.Remove(b)).To(Succeed())
+		_, err = w.Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(calls).To(HaveLen(1))
+
+		write(b, "b1")
+		Expect(w.Reload()).To(BeFalse())
+		Expect(os.Remove(b)).To(Succeed())
+		_, err = w.Reload()
+		Expect(err).To(HaveOccurred())
+
+		write(b, "b2")
+		Expect(w.Reload()).To(BeTrue())
+		Expect(calls).To(Equal([][]string{{"a1", "b1"}, {"a1", "b2"}}))
+	})
+
+	It("should not swap the content if the handler fails and retry it with the next reload", func() {
+		w, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, a, b)
+		Expect(err).ToNot(HaveOccurred())
+
+		write(a, "a2")
+		failing = fmt.Errorf("invalid content")
+		changed, err := w.Reload()
+		Expect(err).To(MatchError("invalid content"))
+		Expect(changed).To(BeFalse())
+		Expect(calls).To(Equal([][]string{{"a1", "b1"}}))
+
+		failing = nil
+		Expect(w.Reload()).To(BeTrue())
+		Expect(calls).To(Equal([][]string{{"a1", "b1"}, {"a2", "b1"}}))
+	})
+
+	It("should fail to create a watcher if the handler rejects the initial content", func() {
+		failing = fmt.Errorf("invalid content")
+		_, err := reload.NewWatcher(log.NullLogger{}, time.Hour, handler, a, b)
+		Expect(err).To(MatchError("invalid content"))
+	})
+
+	It("should reload the files periodically until it is stopped", func() {
+		var (
+			mux     sync.Mutex
+			content []string
+		)
+		w, err := reload.NewWatcher(log.NullLogger{}, 10*time.Millisecond, func(data [][]byte) error {
+			mux.Lock()
+			defer mux.Unlock()
+			content = append(content, string(data[0]))
+			return nil
+		}, a)
+		Expect(err).ToNot(HaveOccurred())
+		get := func() []string {
+			mux.Lock()
+			defer mux.Unlock()
+			return append([]string(nil), content...)
+		}
+
+		stop := make(chan struct{})
+		w.Start(stop)
+		write(a, "a2")
+		Eventually(get).Should(Equal([]string{"a1", "a2"}))
+
+		close(stop)
+		time.Sleep(50 * time.Millisecond)
+		write(a, "a3")
+		Consistently(get, 100*time.Millisecond, 10*time.Millisecond).Should(Equal([]string{"a1", "a2"}))
+	})
+})
+
+var _ = Describe("DirectoryWatcher", func() {
+	var (
+		dir   string
+		calls []map[string]string
+	)
+
+	handler := func(data map[string][]byte) error {
+		call := make(map[string]string, len(data))
+		for name, d := range data {
+			call[name] = string(d)
+		}
+		calls = append(calls, call)
+		return nil
+	}
+
+	// mount writes the files like the kubelet updates a mounted secret, the visible files link to
+	// a hidden directory that is atomically swapped by replacing the ..data symlink
+	mount := func(version string, files map[string]string) {
+		data := filepath.Join(dir, "..data_"+version)
+		Expect(os.Mkdir(data, 0700)).To(Succeed())
+		for name, content := range files {
+			Expect(ioutil.WriteFile(filepath.Join(data, name), []byte(content), 0600)).To(Succeed())
+			link := filepath.Join(dir, name)
+			if _, err := os.Lstat(link); os.IsNotExist(err) {
+				Expect(os.Symlink(filepath.Join("..data", name), link)).To(Succeed())
+			}
+		}
+		tmp := filepath.Join(dir, "..data_tmp")
+		Expect(os.Symlink(filepath.Base(data), tmp)).To(Succeed())
+		Expect(os.Rename(tmp, filepath.Join(dir, "..data"))).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auditlog-reload")
+		Expect(err).ToNot(HaveOccurred())
+		calls = nil
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("should pass the visible files of a mounted secret by their names", func() {
+		mount("1", map[string]string{"token": "t1", "ca.crt": "ca1"})
+		Expect(os.Mkdir(filepath.Join(dir, "nested"), 0700)).To(Succeed())
+
+		_, err := reload.NewDirectoryWatcher(log.NullLogger{}, time.Hour, handler, dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(calls).To(Equal([]map[string]string{{"token": "t1", "ca.crt": "ca1"}}))
+	})
+
+	It("should reload the files once the data of the mounted secret is swapped", func() {
+		mount("1", map[string]string{"token": "t1"})
+		w, err := reload.NewDirectoryWatcher(log.NullLogger{}, time.Hour, handler, dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(w.Reload()).To(BeFalse())
+
+		mount("2", map[string]string{"token": "t2"})
+		Expect(w.Reload()).To(BeTrue())
+		Expect(w.Reload()).To(BeFalse())
+		Expect(calls).To(Equal([]map[string]string{{"token": "t1"}, {"token": "t2"}}))
+	})
+
+	It("should detect added and removed files", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600)).To(Succeed())
+		w, err := reload.NewDirectoryWatcher(log.NullLogger{}, time.Hour, handler, dir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(ioutil.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0600)).To(Succeed())
+		Expect(w.Reload()).To(BeTrue())
+		Expect(os.Remove(filepath.Join(dir, "a"))).To(Succeed())
+		Expect(w.Reload()).To(BeTrue())
+		Expect(calls).To(Equal([]map[string]string{{"a": "a"}, {"a": "a", "b": "b"}, {"b": "b"}}))
+	})
+
+	It("should keep the content while the directory is missing and reload it once it reappears", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("t1"), 0600)).To(Succeed())
+		w, err := reload.NewDirectoryWatcher(log.NullLogger{}, time.Hour, handler, dir)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(os.RemoveAll(dir)).To(Succeed())
+		_, err = w.Reload()
+		Expect(err).To(HaveOccurred())
+
+		Expect(os.Mkdir(dir, 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "token"), []byte("t2"), 0600)).To(Succeed())
+		Expect(w.Reload()).To(BeTrue())
+		Expect(calls).To(Equal([]map[string]string{{"token": "t1"}, {"token": "t2"}}))
+	})
+})
@@ -0,0 +1,106 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/filter"
+	"hash/fnv"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"math"
+)
+
+// Observer is called for every event that matches a rule with the decision of the rule
+type Observer func(rule string, action apisconfig.RuleAction, kept bool)
+
+// Engine keeps, drops or samples the audit events by the first rule they match.
+// Events that match no rule are kept.
+type Engine struct {
+	rules   []*rule
+	observe Observer
+}
+
+type rule struct {
+	name        string
+	matcher     *filter.Matcher
+	action      apisconfig.RuleAction
+	sampleRatio float64
+}
+
+// New creates a rule engine from the given rules.
+// The observer is optional.
+func New(config []apisconfig.Rule, observe Observer) *Engine {
+	e := &Engine{observe: observe}
+	for _, r := range config {
+		rule := &rule{name: r.Name, matcher: filter.NewMatcher(r.Match), action: r.Action}
+		if r.SampleRatio != nil {
+			rule.sampleRatio = *r.SampleRatio
+		}
+		e.rules = append(e.rules, rule)
+	}
+	return e
+}
+
+// Apply returns an event list with the events that are kept by the rules.
+// The given event list is returned if no rules are defined.
+func (e *Engine) Apply(events *audit.EventList) *audit.EventList {
+	if len(e.rules) == 0 {
+		return events
+	}
+	kept := &audit.EventList{ListMeta: events.ListMeta, Items: make([]audit.Event, 0, len(events.Items))}
+	for i := range events.Items {
+		if e.Keep(&events.Items[i]) {
+			kept.Items = append(kept.Items, events.Items[i])
+		}
+	}
+	return kept
+}
+
+// Keep returns true if the event is kept by the first rule it matches or if it matches no rule
+func (e *Engine) Keep(event *audit.Event) bool {
+	for _, r := range e.rules {
+		if !r.matcher.Matches(event) {
+			continue
+		}
+		keep := r.keep(event)
+		if e.observe != nil {
+			e.observe(r.name, r.action, keep)
+		}
+		return keep
+	}
+	return true
+}
+
+func (r *rule) keep(event *audit.Event) bool {
+	switch r.action {
+	case apisconfig.RuleActionDrop:
+		return false
+	case apisconfig.RuleActionSample:
+		return sampled(event.AuditID, r.sampleRatio)
+	default:
+		return true
+	}
+}
+
+// sampled selects the ratio of the audit ids by their hash, so that all events of a request get the same decision
+func sampled(auditID types.UID, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(auditID))
+	return float64(h.Sum64())/math.MaxUint64 < ratio
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules_test
+
+import (
+	"fmt"
+
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/rules"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/apis/audit"
+)
+
+func event(id types.UID, user, verb, resource string, level audit.Level) audit.Event {
+	return audit.Event{
+		AuditID:   id,
+		Verb:      verb,
+		Level:     level,
+		Stage:     audit.StageResponseComplete,
+		User:      audit.UserInfo{Username: user},
+		ObjectRef: &audit.ObjectReference{Resource: resource, Namespace: "default"},
+	}
+}
+
+func ids(events *audit.EventList) []types.UID {
+	out := make([]types.UID, 0, len(events.Items))
+	for _, e := range events.Items {
+		out = append(out, e.AuditID)
+	}
+	return out
+}
+
+var _ = Describe("Engine", func() {
+	const serviceAccount = "system:serviceaccount:kube-system:generic-garbage-collector"
+
+	var (
+		ratio    float64
+		config   []apisconfig.Rule
+		observed map[string]int
+		observe  rules.Observer
+	)
+
+	BeforeEach(func() {
+		ratio = 0.01
+		config = []apisconfig.Rule{
+			{
+				Name:   "keep-secrets",
+				Match:  apisconfig.EventMatcher{Resources: []apisconfig.GroupResources{{Resources: []string{"secrets"}}}, Levels: []string{"RequestResponse"}},
+				Action: apisconfig.RuleActionKeep,
+			},
+			{
+				Name:   "drop-controller-reads",
+				Match:  apisconfig.EventMatcher{Users: []string{serviceAccount}, Verbs: []string{"get", "watch"}},
+				Action: apisconfig.RuleActionDrop,
+			},
+			{
+				Name:        "sample-configmap-lists",
+				Match:       apisconfig.EventMatcher{Verbs: []string{"list"}, Resources: []apisconfig.GroupResources{{Resources: []string{"configmaps"}}}},
+				Action:      apisconfig.RuleActionSample,
+				SampleRatio: &ratio,
+			},
+		}
+		observed = map[string]int{}
+		observe = func(rule string, action apisconfig.RuleAction, kept bool) {
+			observed[fmt.Sprintf("%s/%s/%t", rule, action, kept)]++
+		}
+	})
+
+	It("should return the event list if no rules are defined", func() {
+		events := &audit.EventList{Items: []audit.Event{event("1", "admin", "get", "pods", audit.LevelMetadata)}}
+		Expect(rules.New(nil, observe).Apply(events)).To(BeIdenticalTo(events))
+	})
+
+	It("should apply the first matching rule and keep events that match no rule", func() {
+		events := &audit.EventList{Items: []audit.Event{
+			event("1", serviceAccount, "get", "secrets", audit.LevelRequestResponse),
+			event("2", serviceAccount, "get", "secrets", audit.LevelMetadata),
+			event("3", serviceAccount, "watch", "pods", audit.LevelMetadata),
+			event("4", serviceAccount, "delete", "pods", audit.LevelMetadata),
+			event("5", "admin", "get", "pods", audit.LevelMetadata),
+		}}
+		Expect(ids(rules.New(config, observe).Apply(events))).To(Equal([]types.UID{"1", "4", "5"}))
+		Expect(observed).To(Equal(map[string]int{
+			"keep-secrets/Keep/true":           1,
+			"drop-controller-reads/Drop/false": 2,
+		}))
+	})
+
+	It("should sample the ratio of the matching events by their audit id", func() {
+		events := &audit.EventList{}
+		for i := 0; i < 10000; i++ {
+			events.Items = append(events.Items, event(types.UID(fmt.Sprintf("00000000-0000-0000-0000-%012d", i)), "admin", "list", "configmaps", audit.LevelMetadata))
+		}
+		engine := rules.New(config, observe)
+		kept := engine.Apply(events)
+		Expect(len(kept.Items)).To(BeNumerically("~", 100, 50))
+		Expect(observed["sample-configmap-lists/Sample/true"]).To(Equal(len(kept.Items)))
+		Expect(observed["sample-configmap-lists/Sample/false"]).To(Equal(10000 - len(kept.Items)))
+
+		for _, e := range kept.Items {
+			e.Stage = audit.StageRequestReceived
+			Expect(engine.Keep(&e)).To(BeTrue())
+		}
+	})
+
+	It("should keep all or no events with the sample ratios 1 and 0", func() {
+		events := &audit.EventList{Items: []audit.Event{
+			event("1", "admin", "list", "configmaps", audit.LevelMetadata),
+			event("2", "admin", "list", "configmaps", audit.LevelMetadata),
+		}}
+		ratio = 1
+		Expect(rules.New(config, nil).Apply(events).Items).To(HaveLen(2))
+		ratio = 0
+		Expect(rules.New(config, nil).Apply(events).Items).To(BeEmpty())
+	})
+})
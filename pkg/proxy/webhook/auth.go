@@ -0,0 +1,110 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/reload"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// tokenAuthenticator authenticates requests with the bearer tokens of a token file.
+// Multiple tokens can be accepted at the same time so that tokens can be rotated without rejecting requests.
+type tokenAuthenticator struct {
+	log     logr.Logger
+	watcher *reload.Watcher
+
+	mux    sync.RWMutex
+	tokens [][]byte
+}
+
+// newTokenAuthenticator creates a new authenticator that accepts the tokens of the given file.
+// The file contains one token per line and is reloaded whenever it changes.
+func newTokenAuthenticator(log logr.Logger, tokenFile string) (*tokenAuthenticator, error) {
+	a := &tokenAuthenticator{log: log}
+	watcher, err := reload.NewWatcher(log, reload.DefaultInterval, a.setTokens, tokenFile)
+	if err != nil {
+		return nil, err
+	}
+	a.watcher = watcher
+	return a, nil
+}
+
+// Start reloads the token file on changes until the stop channel is closed.
+func (a *tokenAuthenticator) Start(stop <-chan struct{}) {
+	a.watcher.Start(stop)
+}
+
+func (a *tokenAuthenticator) setTokens(data [][]byte) error {
+	tokens := make([][]byte, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data[0]))
+	for scanner.Scan() {
+		if token := strings.TrimSpace(scanner.Text()); token != "" {
+			tokens = append(tokens, []byte(token))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return errors.New("no token defined in token file")
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	a.tokens = tokens
+	a.log.Info("Tokens loaded", "tokens", len(tokens))
+	return nil
+}
+
+// authenticate returns true if the request contains one of the accepted bearer tokens
+func (a *tokenAuthenticator) authenticate(req *http.Request) bool {
+	auth := strings.TrimSpace(req.Header.Get("Authorization"))
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "bearer") {
+		return false
+	}
+	token := []byte(strings.TrimSpace(parts[1]))
+
+	a.mux.RLock()
+	defer a.mux.RUnlock()
+	accepted := false
+	for _, t := range a.tokens {
+		// compare all tokens to not leak which token matched through the response time
+		if subtle.ConstantTimeCompare(t, token) == 1 {
+			accepted = true
+		}
+	}
+	return accepted
+}
+
+// Wrap returns a handler that rejects unauthenticated requests with 401 before they reach the given handler
+func (a *tokenAuthenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !a.authenticate(req) {
+			a.log.V(3).Info("Rejecting unauthenticated request", "remoteAddr", req.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="auditlog-proxy"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
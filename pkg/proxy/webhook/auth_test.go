@@ -0,0 +1,91 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var _ = Describe("tokenAuthenticator", func() {
+	var (
+		dir       string
+		tokenFile string
+		handler   http.Handler
+		authn     *tokenAuthenticator
+	)
+
+	request := func(auth string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auditlog-auth")
+		Expect(err).ToNot(HaveOccurred())
+		tokenFile = filepath.Join(dir, "tokens")
+		Expect(ioutil.WriteFile(tokenFile, []byte("current\nprevious\n"), 0600)).To(Succeed())
+
+		authn, err = newTokenAuthenticator(log.NullLogger{}, tokenFile)
+		Expect(err).ToNot(HaveOccurred())
+		handler = authn.Wrap(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }))
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("should accept all tokens of the token file", func() {
+		Expect(request("Bearer current")).To(Equal(http.StatusOK))
+		Expect(request("bearer previous")).To(Equal(http.StatusOK))
+	})
+
+	It("should reject requests without a valid bearer token", func() {
+		Expect(request("")).To(Equal(http.StatusUnauthorized))
+		Expect(request("Bearer abc")).To(Equal(http.StatusUnauthorized))
+		Expect(request("Basic current")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should accept the rotated tokens after a reload", func() {
+		Expect(ioutil.WriteFile(tokenFile, []byte("next\n"), 0600)).To(Succeed())
+		changed, err := authn.watcher.Reload()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(changed).To(BeTrue())
+
+		Expect(request("Bearer next")).To(Equal(http.StatusOK))
+		Expect(request("Bearer current")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should keep the tokens if the token file is empty", func() {
+		Expect(ioutil.WriteFile(tokenFile, []byte("\n"), 0600)).To(Succeed())
+		_, err := authn.watcher.Reload()
+		Expect(err).To(HaveOccurred())
+
+		Expect(request("Bearer current")).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,205 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/buffer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"time"
+)
+
+const metricsNamespace = "auditlog_proxy"
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "requests_total",
+		Help:      "Number of webhook requests received from the kube-apiserver by status code.",
+	}, []string{"code"})
+
+	requestSizeBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "request_size_bytes",
+		Help:      "Size of the bodies of the webhook requests.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+
+	decodeDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "decode_duration_seconds",
+		Help:      "Time it takes to decode the event list of a webhook request.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	})
+
+	eventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_total",
+		Help:      "Number of decoded audit events by level, verb and stage.",
+	}, []string{"level", "verb", "stage"})
+
+	ruleEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rule_events_total",
+		Help:      "Number of events matched by a rule by rule, action and decision.",
+	}, []string{"rule", "action", "decision"})
+
+	redactedEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redacted_events_total",
+		Help:      "Number of events redacted by a redaction by redaction.",
+	}, []string{"redaction"})
+
+	providerEventsDeliveredTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_events_delivered_total",
+		Help:      "Number of events successfully written by the provider of an output.",
+	}, []string{"output", "provider"})
+
+	providerEventsFailedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_events_failed_total",
+		Help:      "Number of events the provider of an output failed to write. Every failed attempt is counted.",
+	}, []string{"output", "provider"})
+
+	deadLetterFull = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "dead_letter_full",
+		Help:      "Whether the dead-letter file reached its maximum size and undeliverable events are rejected.",
+	})
+
+	providerLogDurationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "provider_log_duration_seconds",
+		Help:      "Time it takes the provider of an output to write an event list.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2.5, 10),
+	}, []string{"output", "provider"})
+)
+
+// newMetricsRegistry creates a registry with the metrics of the proxy and the backlog of the given buffer.
+func newMetricsRegistry(b *buffer.WAL) (*prometheus.Registry, error) {
+	registry := prometheus.NewRegistry()
+	collectors := []prometheus.Collector{
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		requestsTotal,
+		requestSizeBytes,
+		decodeDurationSeconds,
+		eventsTotal,
+		ruleEventsTotal,
+		redactedEventsTotal,
+		providerEventsDeliveredTotal,
+		providerEventsFailedTotal,
+		providerLogDurationSeconds,
+		deadLetterFull,
+	}
+	if b != nil {
+		collectors = append(collectors, bufferCollectors(b)...)
+	}
+
+	for _, c := range collectors {
+		if err := registry.Register(c); err != nil {
+			return nil, errors.Wrap(err, "unable to register metrics")
+		}
+	}
+	return registry, nil
+}
+
+func bufferCollectors(b *buffer.WAL) []prometheus.Collector {
+	gauge := func(name, help string, value func(buffer.Stats) float64) prometheus.Collector {
+		return prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "buffer",
+			Name:      name,
+			Help:      help,
+		}, func() float64 { return value(b.Stats()) })
+	}
+	return []prometheus.Collector{
+		gauge("records", "Number of buffered event lists that are not yet written to all required outputs.",
+			func(s buffer.Stats) float64 { return float64(s.Records) }),
+		gauge("bytes", "Size of the buffered event lists that are not yet written to all required outputs.",
+			func(s buffer.Stats) float64 { return float64(s.Bytes) }),
+		gauge("disk_bytes", "Size of all buffer segments on disk.",
+			func(s buffer.Stats) float64 { return float64(s.DiskBytes) }),
+	}
+}
+
+// observeEvents counts the decoded events by level, verb and stage
+func observeEvents(events *audit.EventList) {
+	for _, event := range events.Items {
+		eventsTotal.WithLabelValues(string(event.Level), event.Verb, string(event.Stage)).Inc()
+	}
+}
+
+// observeRule counts the events that are kept or dropped by a rule
+func observeRule(rule string, action apisconfig.RuleAction, kept bool) {
+	decision := "dropped"
+	if kept {
+		decision = "kept"
+	}
+	ruleEventsTotal.WithLabelValues(rule, string(action), decision).Inc()
+}
+
+// observeRedaction counts the events that are redacted by a redaction
+func observeRedaction(redaction string) {
+	redactedEventsTotal.WithLabelValues(redaction).Inc()
+}
+
+// observeDeadLetterFull records whether the dead-letter file rejects events
+func observeDeadLetterFull(full bool) {
+	if full {
+		deadLetterFull.Set(1)
+		return
+	}
+	deadLetterFull.Set(0)
+}
+
+// instrumentedProvider records the latency and the written and failed events of the provider of an output
+type instrumentedProvider struct {
+	provider.Interface
+
+	delivered prometheus.Counter
+	failed    prometheus.Counter
+	duration  prometheus.Observer
+}
+
+func newInstrumentedProvider(output string, p provider.Interface) *instrumentedProvider {
+	return &instrumentedProvider{
+		Interface: p,
+		delivered: providerEventsDeliveredTotal.WithLabelValues(output, p.Name()),
+		failed:    providerEventsFailedTotal.WithLabelValues(output, p.Name()),
+		duration:  providerLogDurationSeconds.WithLabelValues(output, p.Name()),
+	}
+}
+
+// Log writes the events to the wrapped provider and records the outcome.
+func (p *instrumentedProvider) Log(events *audit.EventList) error {
+	start := time.Now()
+	err := p.Interface.Log(events)
+	p.duration.Observe(time.Since(start).Seconds())
+
+	failed := len(events.Items)
+	if err == nil {
+		failed = 0
+	} else if partialErr, ok := errors.Cause(err).(*provider.PartialError); ok {
+		failed = len(partialErr.Errors)
+	}
+	p.delivered.Add(float64(len(events.Items) - failed))
+	p.failed.Add(float64(failed))
+	return err
+}
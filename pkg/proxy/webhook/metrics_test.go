@@ -0,0 +1,122 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type fakeProvider struct {
+	provider.Interface
+	err error
+}
+
+func (f *fakeProvider) Name() string { return "fake" }
+
+func (f *fakeProvider) Log(_ *audit.EventList) error { return f.err }
+
+// metricValue returns the value of the counter or gauge with the given name and labels
+func metricValue(registry *prometheus.Registry, name string, labels map[string]string) float64 {
+	families, err := registry.Gather()
+	Expect(err).ToNot(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			if metric.GetCounter() != nil {
+				return metric.GetCounter().GetValue()
+			}
+			return metric.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+var _ = Describe("Metrics", func() {
+	var events = &audit.EventList{Items: make([]audit.Event, 3)}
+
+	It("should count the delivered and failed events of a provider", func() {
+		registry, err := newMetricsRegistry(nil)
+		Expect(err).ToNot(HaveOccurred())
+		labels := map[string]string{"output": "instrumented", "provider": "fake"}
+
+		fake := &fakeProvider{}
+		p := newInstrumentedProvider("instrumented", fake)
+		Expect(p.Log(events)).To(Succeed())
+
+		fake.err = &provider.PartialError{Errors: []provider.EventError{{Index: 1, Err: errors.New("rejected")}}}
+		Expect(p.Log(events)).ToNot(Succeed())
+
+		fake.err = errors.New("unavailable")
+		Expect(p.Log(events)).ToNot(Succeed())
+
+		Expect(metricValue(registry, "auditlog_proxy_provider_events_delivered_total", labels)).To(BeNumerically("==", 5))
+		Expect(metricValue(registry, "auditlog_proxy_provider_events_failed_total", labels)).To(BeNumerically("==", 4))
+	})
+
+	It("should count the received events and expose the buffer backlog", func() {
+		dir, err := ioutil.TempDir("", "auditlog-metrics")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		maxSize := resource.MustParse("1Mi")
+		segmentSize := resource.MustParse("64Ki")
+		sink, err := NewSink(log.NullLogger{}, &apisconfig.Configuration{
+			Provider: "standard",
+			Buffer: &apisconfig.BufferConfiguration{
+				Directory:   dir,
+				MaxSize:     &maxSize,
+				SegmentSize: &segmentSize,
+				SyncPolicy:  apisconfig.SyncPolicyNever,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		registry, err := newMetricsRegistry(sink.buffer)
+		Expect(err).ToNot(HaveOccurred())
+		labels := map[string]string{"level": "Metadata", "verb": "get", "stage": ""}
+		before := metricValue(registry, "auditlog_proxy_events_total", labels)
+
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(eventList)))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		Expect(metricValue(registry, "auditlog_proxy_events_total", labels)).To(BeNumerically("==", before+1))
+		Expect(metricValue(registry, "auditlog_proxy_buffer_records", nil)).To(BeNumerically("==", 1))
+	})
+})
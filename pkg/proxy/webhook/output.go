@@ -0,0 +1,151 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/delivery"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/filter"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/reload"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sync"
+)
+
+// output delivers the events selected by its filter to a named provider
+type output struct {
+	name          string
+	provider      provider.Interface
+	failurePolicy apisconfig.FailurePolicy
+	filter        *filter.Filter
+	delivery      *delivery.Deliverer
+	// secretWatcher reloads the mounted secret of the provider, if any
+	secretWatcher *reload.Watcher
+}
+
+// newOutputs creates all configured outputs.
+// The provider of the configuration is added as required output with the default output name.
+func newOutputs(log logr.Logger, config *apisconfig.Configuration) ([]*output, error) {
+	deliveryOpts, err := deliveryOptions(log, config.Delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	outputConfigs := config.Outputs
+	if config.Provider != "" {
+		outputConfigs = append([]apisconfig.Output{{
+			Name:           apisconfig.DefaultOutputName,
+			Provider:       config.Provider,
+			ProviderConfig: config.ProviderConfig,
+			FailurePolicy:  apisconfig.FailurePolicyRequired,
+		}}, outputConfigs...)
+	}
+
+	outputs := make([]*output, 0, len(outputConfigs))
+	for _, outputConfig := range outputConfigs {
+		outputLog := log.WithValues("output", outputConfig.Name)
+		p, err := newProvider(outputLog, outputConfig.Provider, outputConfig.ProviderConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create provider of output %s", outputConfig.Name)
+		}
+		var secretWatcher *reload.Watcher
+		if outputConfig.SecretDir != "" {
+			if secretWatcher, err = newSecretWatcher(outputLog, p, outputConfig.SecretDir); err != nil {
+				return nil, errors.Wrapf(err, "unable to load secret of output %s", outputConfig.Name)
+			}
+		}
+		outputs = append(outputs, &output{
+			name:          outputConfig.Name,
+			provider:      p,
+			failurePolicy: outputConfig.FailurePolicy,
+			filter:        filter.New(outputConfig.Filter),
+			delivery:      delivery.New(outputLog.WithName("delivery"), newInstrumentedProvider(outputConfig.Name, p), deliveryOpts),
+			secretWatcher: secretWatcher,
+		})
+		log.Info("Output successfully loaded", "output", outputConfig.Name, "provider", outputConfig.Provider, "failurePolicy", outputConfig.FailurePolicy)
+	}
+	return outputs, nil
+}
+
+// newSecretWatcher injects the files of the secret directory into the provider and watches them for changes
+// so that rotated credentials are used without a restart.
+func newSecretWatcher(log logr.Logger, p provider.Interface, dir string) (*reload.Watcher, error) {
+	if _, ok := p.(provider.BackendSecret); !ok {
+		return nil, errors.Errorf("provider %s does not support secrets", p.Name())
+	}
+	return reload.NewDirectoryWatcher(log, reload.DefaultInterval, func(data map[string][]byte) error {
+		_, err := provider.BackendSecretInto(data, p)
+		return err
+	}, dir)
+}
+
+// pendingEvents are events that still have to be delivered to an output
+type pendingEvents struct {
+	output *output
+	events *audit.EventList
+}
+
+// dispatch concurrently delivers the events selected by the filters of the given outputs.
+// It returns the events that could not be delivered to required outputs.
+func dispatch(ctx context.Context, log logr.Logger, outputs []*output, events *audit.EventList) ([]pendingEvents, error) {
+	pending := make([]pendingEvents, 0, len(outputs))
+	for _, o := range outputs {
+		selected := o.filter.Filter(events)
+		if len(selected.Items) == 0 {
+			continue
+		}
+		pending = append(pending, pendingEvents{output: o, events: selected})
+	}
+	return deliver(ctx, log, pending)
+}
+
+// deliver concurrently delivers the pending events to their outputs.
+// It returns the events that could not be delivered to required outputs, i.e. only the failed events of partially
+// delivered event lists. Failed deliveries to best-effort outputs are only logged.
+func deliver(ctx context.Context, log logr.Logger, pending []pendingEvents) ([]pendingEvents, error) {
+	var (
+		wg     sync.WaitGroup
+		mux    sync.Mutex
+		failed = make([]pendingEvents, 0)
+		errs   = make([]error, 0)
+	)
+	for _, p := range pending {
+		wg.Add(1)
+		go func(p pendingEvents) {
+			defer wg.Done()
+			o := p.output
+			err := o.delivery.Log(ctx, p.events)
+			if err == nil {
+				return
+			}
+			if o.failurePolicy == apisconfig.FailurePolicyBestEffort {
+				log.Error(err, "unable to log eventList to best-effort output", "output", o.name)
+				return
+			}
+
+			mux.Lock()
+			defer mux.Unlock()
+			failed = append(failed, pendingEvents{output: o, events: delivery.Undelivered(p.events, err)})
+			errs = append(errs, errors.Wrapf(err, "output %s", o.name))
+		}(p)
+	}
+	wg.Wait()
+
+	return failed, utilerrors.NewAggregate(errs)
+}
@@ -16,32 +16,85 @@ package webhook
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
 	"github.com/go-logr/logr"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
-func Run(log logr.Logger, config *apisconfig.Configuration) error {
-	ctx := context.Background()
-	defer ctx.Done()
-
+// Run starts the webhook servers and blocks until the context is done.
+// On shutdown the readiness check fails first so that no new requests are routed to the proxy,
+// then the servers stop accepting requests and the in-flight requests and the buffer are drained
+// within the configured grace period.
+func Run(ctx context.Context, log logr.Logger, config *apisconfig.Configuration) error {
 	sinkHandler, err := NewSink(log.WithName("sink"), config)
 	if err != nil {
 		return err
 	}
+	sinkHandler.Start()
+	defer func() {
+		if err := sinkHandler.Close(); err != nil {
+			log.Error(err, "unable to close sink")
+		}
+	}()
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var handler http.Handler = sinkHandler
+	if authn := config.WebhookConfiguration.Authentication; authn != nil {
+		authenticator, err := newTokenAuthenticator(log.WithName("authentication"), authn.TokenFile)
+		if err != nil {
+			return err
+		}
+		authenticator.Start(stop)
+		handler = authenticator.Wrap(sinkHandler)
+	} else {
+		log.Info("Authentication is disabled, all requests are accepted")
+	}
+
+	handler = promhttp.InstrumentHandlerCounter(requestsTotal, handler)
 
+	var draining int32
 	router := mux.NewRouter()
 	router.Use(getTraceMiddleware(log))
-	router.PathPrefix("/").Handler(sinkHandler).Methods(http.MethodPost)
+	router.PathPrefix("/").Handler(handler).Methods(http.MethodPost)
 	router.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }).Methods(http.MethodGet)
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&draining) != 0 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods(http.MethodGet)
 	router.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) })
 
 	serverHTTP := &http.Server{Addr: fmt.Sprintf(":%d", config.WebhookConfiguration.HTTPPort), Handler: router}
 	serverHTTPS := &http.Server{Addr: fmt.Sprintf(":%d", config.WebhookConfiguration.HTTPSPort), Handler: router}
 
+	var serverMetrics *http.Server
+	if config.WebhookConfiguration.MetricsPort != 0 {
+		registry, err := newMetricsRegistry(sinkHandler.buffer)
+		if err != nil {
+			return err
+		}
+		metricsRouter := http.NewServeMux()
+		metricsRouter.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		serverMetrics = &http.Server{Addr: fmt.Sprintf(":%d", config.WebhookConfiguration.MetricsPort), Handler: metricsRouter}
+
+		go func() {
+			log.Info("starting metrics server", "port", serverMetrics.Addr)
+			if err := serverMetrics.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error(err, "unable to start metrics server")
+			}
+		}()
+	}
+
 	go func() {
 		log.Info("starting webhook http server", "port", serverHTTP.Addr)
 		if err := serverHTTP.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -50,25 +103,62 @@ func Run(log logr.Logger, config *apisconfig.Configuration) error {
 	}()
 
 	if config.WebhookConfiguration.HTTPSPort != 0 {
+		certReloader, err := newCertificateReloader(log.WithName("tls"), config.WebhookConfiguration.TLS.CertFile, config.WebhookConfiguration.TLS.KeyFile)
+		if err != nil {
+			return err
+		}
+		certReloader.Start(stop)
+		serverHTTPS.TLSConfig = &tls.Config{GetCertificate: certReloader.GetCertificate}
+
 		go func() {
 			log.Info("starting webhook https server", "port", serverHTTPS.Addr)
-			if err := serverHTTPS.ListenAndServeTLS(config.WebhookConfiguration.TLS.CertFile, config.WebhookConfiguration.TLS.KeyFile); err != nil && err != http.ErrServerClosed {
+			if err := serverHTTPS.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
 				log.Error(err, "unable to start webhook https server")
 			}
 		}()
 	}
 
 	<-ctx.Done()
-	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	gracePeriod, readinessDelay := shutdownPeriods(config.Shutdown)
+	log.Info("Shutting down webhook servers", "gracePeriod", gracePeriod.String())
+	atomic.StoreInt32(&draining, 1)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
 	defer cancel()
-	if err := serverHTTP.Shutdown(ctx); err != nil {
+
+	// keep accepting requests until the endpoints of the proxy are updated
+	select {
+	case <-time.After(readinessDelay):
+	case <-shutdownCtx.Done():
+	}
+
+	if err := serverHTTP.Shutdown(shutdownCtx); err != nil {
 		log.Error(err, "unable to shut down HTTP server")
 	}
-	if err := serverHTTPS.Shutdown(ctx); err != nil {
+	if err := serverHTTPS.Shutdown(shutdownCtx); err != nil {
 		log.Error(err, "unable to shut down HTTPS server")
 	}
 	log.Info("HTTP(S) servers stopped.")
-	return nil
+
+	err = sinkHandler.Shutdown(shutdownCtx)
+	// the metrics are served until the buffer is drained
+	if serverMetrics != nil {
+		if err := serverMetrics.Close(); err != nil {
+			log.Error(err, "unable to stop metrics server")
+		}
+	}
+	return err
+}
+
+func shutdownPeriods(config *apisconfig.ShutdownConfiguration) (time.Duration, time.Duration) {
+	gracePeriod, readinessDelay := 30*time.Second, 5*time.Second
+	if config != nil && config.GracePeriod != nil {
+		gracePeriod = config.GracePeriod.Duration
+	}
+	if config != nil && config.ReadinessDelay != nil {
+		readinessDelay = config.ReadinessDelay.Duration
+	}
+	return gracePeriod, readinessDelay
 }
 
 func getTraceMiddleware(log logr.Logger) mux.MiddlewareFunc {
@@ -15,53 +15,175 @@
 package webhook
 
 import (
+	"context"
 	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
 	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/providers"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/buffer"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/delivery"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/enrichment"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/redaction"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/rules"
 	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
 	"io/ioutil"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/apis/audit"
 	"k8s.io/apiserver/pkg/apis/audit/install"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
 	"net/http"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sync"
+	"time"
 )
 
-type sink struct {
-	log      logr.Logger
-	decoder  runtime.Decoder
-	provider provider.Interface
+const (
+	// backlogReportInterval is the interval in which the backlog of the buffer is reported
+	backlogReportInterval = time.Minute
+	// drainPollInterval is the interval in which the buffer is checked during shutdown
+	drainPollInterval = 100 * time.Millisecond
+	// maxDrainBackoff is the maximum time to wait before a failed event list is written to the outputs again
+	maxDrainBackoff = time.Minute
+)
+
+// Sink handles kubernetes auditlog events and writes them to the configured outputs
+type Sink struct {
+	log       logr.Logger
+	decoder   runtime.Decoder
+	encoder   runtime.Encoder
+	outputs   []*output
+	rules     *rules.Engine
+	redaction *redaction.Engine
+	enricher  *enrichment.Enricher
+	buffer    *buffer.WAL
+	// requestTimeout bounds the delivery of the events of a request if no buffer is configured
+	requestTimeout time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+	closeErr  error
 }
 
 // NewSink creates a new Sink objects that can handle kubernetes auditlog events
-func NewSink(log logr.Logger, config *apisconfig.Configuration) (http.Handler, error) {
+func NewSink(log logr.Logger, config *apisconfig.Configuration) (*Sink, error) {
 	auditScheme := runtime.NewScheme()
 	install.Install(auditScheme)
 
-	p, err := providers.ProviderFactory.Get(config.Provider)
+	var hashKey []byte
+	if config.HashKeyFile != "" {
+		key, err := ioutil.ReadFile(config.HashKeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read hash key")
+		}
+		hashKey = key
+	}
+
+	redactionEngine, err := redaction.New(config.Redactions, hashKey, observeRedaction)
 	if err != nil {
 		return nil, err
 	}
-	if _, err = provider.BackendConfigInto(config.ProviderConfig, p); err != nil {
+
+	outputs, err := newOutputs(log, config)
+	if err != nil {
 		return nil, err
 	}
-	if _, err = inject.LoggerInto(log, p); err != nil {
-		return nil, err
+
+	codecs := serializer.NewCodecFactory(auditScheme)
+	s := &Sink{
+		log:       log,
+		decoder:   codecs.UniversalDecoder(),
+		encoder:   codecs.LegacyCodec(auditv1.SchemeGroupVersion),
+		outputs:   outputs,
+		rules:     rules.New(config.Rules, observeRule),
+		redaction: redactionEngine,
+		enricher:  enrichment.New(config.Shoot),
+	}
+	if config.Delivery != nil && config.Delivery.RequestTimeout != nil {
+		s.requestTimeout = config.Delivery.RequestTimeout.Duration
 	}
 
-	log.Info("Provider successfully loaded", "provider", config.Provider)
+	if config.Buffer != nil {
+		s.buffer, err = buffer.Open(log.WithName("buffer"), bufferOptions(config.Buffer))
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Buffer successfully opened", "directory", config.Buffer.Directory)
+	}
 
-	return &sink{
-		log:      log,
-		decoder:  serializer.NewCodecFactory(auditScheme).UniversalDecoder(),
-		provider: p,
-	}, nil
+	return s, nil
 }
 
-// HandleAudit is the handler
-func (s *sink) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+// Start starts reloading the secrets of the outputs and draining the buffer to the outputs in the background.
+func (s *Sink) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	for _, o := range s.outputs {
+		if o.secretWatcher != nil {
+			o.secretWatcher.Start(ctx.Done())
+		}
+	}
+
+	if s.buffer == nil {
+		return
+	}
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.drain(ctx)
+	}()
+	go func() {
+		defer s.wg.Done()
+		wait.Until(s.reportBacklog, backlogReportInterval, ctx.Done())
+	}()
+}
 
+// Shutdown waits until all buffered event lists are written to the outputs or the context is done
+// and closes the sink afterwards.
+func (s *Sink) Shutdown(ctx context.Context) error {
+	if s.buffer != nil {
+		s.log.Info("Draining buffer", "records", s.buffer.Stats().Records)
+		drained := func() (bool, error) { return s.buffer.Stats().Records == 0, nil }
+		if err := wait.PollImmediateUntil(drainPollInterval, drained, ctx.Done()); err != nil {
+			s.log.Info("Buffer could not be drained within the grace period, the remaining event lists stay in the buffer directory and are replayed on the next start",
+				"records", s.buffer.Stats().Records)
+		}
+	}
+	return s.Close()
+}
+
+// Close stops reloading the secrets and draining the buffer, aborts all pending retries, closes the buffer and closes the providers
+// that hold pending events.
+// Buffered event lists that are not yet written to all outputs stay in the buffer directory and are replayed on the next start.
+func (s *Sink) Close() error {
+	s.closeOnce.Do(func() {
+		for _, o := range s.outputs {
+			o.delivery.Close()
+		}
+		if s.cancel != nil {
+			s.cancel()
+		}
+		if s.buffer != nil {
+			s.wg.Wait()
+			s.closeErr = s.buffer.Close()
+		}
+		for _, o := range s.outputs {
+			if closer, ok := o.provider.(provider.Closer); ok {
+				if err := closer.Close(); err != nil {
+					s.log.Error(err, "unable to close provider", "output", o.name)
+				}
+			}
+		}
+	})
+	return s.closeErr
+}
+
+// ServeHTTP handles the auditlog events sent by the kube-apiserver.
+func (s *Sink) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	raw, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		s.log.Error(err, "unable to read body of request")
@@ -69,19 +191,194 @@ func (s *sink) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	eventList := &audit.EventList{}
-	if _, _, err := s.decoder.Decode(raw, nil, eventList); err != nil {
+	requestSizeBytes.Observe(float64(len(raw)))
+
+	start := time.Now()
+	eventList, err := s.decode(raw)
+	decodeDurationSeconds.Observe(time.Since(start).Seconds())
+	if err != nil {
 		s.log.Error(err, "unable to decode eventList")
 		http.Error(w, "unable to decode eventList", http.StatusBadRequest)
 		return
 	}
+	observeEvents(eventList)
 
 	s.log.V(8).Info("Parsed event list", "events", eventList)
 
-	if err := s.provider.Log(eventList); err != nil {
+	// the rules and redactions are applied before the event list is buffered so that no unredacted events are persisted
+	eventList = s.process(eventList)
+
+	if s.buffer != nil {
+		processed, err := runtime.Encode(s.encoder, eventList)
+		if err != nil {
+			s.log.Error(err, "unable to encode eventList")
+			http.Error(w, "unable to encode eventList", http.StatusInternalServerError)
+			return
+		}
+		if err := s.buffer.Append(processed); err != nil {
+			s.log.Error(err, "unable to buffer eventList")
+			if err == buffer.ErrFull {
+				http.Error(w, "buffer is full", http.StatusServiceUnavailable)
+				return
+			}
+			http.Error(w, "unable to buffer eventList", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	// the delivery has to finish before the kube-apiserver aborts the request
+	ctx := req.Context()
+	if s.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.requestTimeout)
+		defer cancel()
+	}
+	if _, err := dispatch(ctx, s.log, s.outputs, eventList); err != nil {
 		s.log.Error(err, "unable to log eventList")
 		http.Error(w, "unable log eventList", http.StatusInternalServerError)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
 }
+
+func (s *Sink) decode(raw []byte) (*audit.EventList, error) {
+	eventList := &audit.EventList{}
+	if _, _, err := s.decoder.Decode(raw, nil, eventList); err != nil {
+		return nil, err
+	}
+	return eventList, nil
+}
+
+// process applies the rules and the redactions to the event list and attaches the shoot metadata
+// before it is written to the outputs
+func (s *Sink) process(eventList *audit.EventList) *audit.EventList {
+	return s.enricher.Apply(s.redaction.Apply(s.rules.Apply(eventList)))
+}
+
+// drain writes the buffered event lists to the outputs until the context is done.
+// The buffered event lists are already processed.
+// An event list is only removed from the buffer after it has been successfully written to all required outputs.
+func (s *Sink) drain(ctx context.Context) {
+	for {
+		raw, err := s.buffer.Next(ctx)
+		if err != nil {
+			if err != context.Canceled && err != buffer.ErrClosed {
+				s.log.Error(err, "unable to read from buffer")
+			}
+			return
+		}
+
+		eventList, err := s.decode(raw)
+		if err != nil {
+			// event lists are encoded by the sink before they are buffered so this should never happen
+			s.log.Error(err, "dropping buffered eventList that cannot be decoded", "size", len(raw))
+		} else if err := s.logWithBackoff(ctx, eventList); err != nil {
+			return
+		}
+
+		if err := s.buffer.Ack(); err != nil {
+			s.log.Error(err, "unable to acknowledge buffered eventList")
+			return
+		}
+	}
+}
+
+// logWithBackoff writes the event list to the outputs and retries the events that could not be delivered to required outputs
+// with an exponential backoff until they are delivered. Events that were already accepted by an output are not sent again.
+// It only returns an error if the context is done.
+func (s *Sink) logWithBackoff(ctx context.Context, eventList *audit.EventList) error {
+	pending, err := dispatch(ctx, s.log, s.outputs, eventList)
+	for backoff := time.Second; err != nil; {
+		s.log.Error(err, "unable to log buffered eventList", "retryIn", backoff.String())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxDrainBackoff {
+			backoff = maxDrainBackoff
+		}
+		pending, err = deliver(ctx, s.log, pending)
+	}
+	return nil
+}
+
+func (s *Sink) reportBacklog() {
+	stats := s.buffer.Stats()
+	s.log.Info("Buffer backlog", "records", stats.Records, "bytes", stats.Bytes, "diskBytes", stats.DiskBytes, "segments", stats.Segments)
+}
+
+func bufferOptions(config *apisconfig.BufferConfiguration) buffer.Options {
+	opts := buffer.Options{
+		Directory:  config.Directory,
+		SyncPolicy: buffer.SyncPolicy(config.SyncPolicy),
+	}
+	if config.MaxSize != nil {
+		opts.MaxSize = config.MaxSize.Value()
+	}
+	if config.SegmentSize != nil {
+		opts.SegmentSize = config.SegmentSize.Value()
+	}
+	if config.SyncInterval != nil {
+		opts.SyncInterval = config.SyncInterval.Duration
+	}
+	return opts
+}
+
+func newProvider(log logr.Logger, name string, config []byte) (provider.Interface, error) {
+	p, err := providers.ProviderFactory.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = provider.BackendConfigInto(config, p); err != nil {
+		return nil, err
+	}
+	if _, err = inject.LoggerInto(log, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func deliveryOptions(log logr.Logger, config *apisconfig.DeliveryConfiguration) (delivery.Options, error) {
+	opts := delivery.Options{}
+	if config == nil {
+		return opts, nil
+	}
+	if config.MaxRetries != nil {
+		opts.MaxRetries = int(*config.MaxRetries)
+	}
+	if config.InitialBackoff != nil {
+		opts.InitialBackoff = config.InitialBackoff.Duration
+	}
+	if config.MaxBackoff != nil {
+		opts.MaxBackoff = config.MaxBackoff.Duration
+	}
+
+	if config.DeadLetter != nil {
+		if config.DeadLetter.File != "" {
+			var maxFileSize int64
+			if config.DeadLetter.MaxFileSize != nil {
+				maxFileSize = config.DeadLetter.MaxFileSize.Value()
+			}
+			deadLetter, err := delivery.NewFileDeadLetter(config.DeadLetter.File, maxFileSize, observeDeadLetterFull)
+			if err != nil {
+				return opts, err
+			}
+			opts.DeadLetter = deadLetter
+			log.Info("Dead-letter file successfully opened", "file", config.DeadLetter.File)
+		}
+		if config.DeadLetter.Provider != "" {
+			p, err := newProvider(log.WithName("dead-letter"), config.DeadLetter.Provider, config.DeadLetter.ProviderConfig)
+			if err != nil {
+				return opts, err
+			}
+			opts.DeadLetter = delivery.NewProviderDeadLetter(p)
+			log.Info("Dead-letter provider successfully loaded", "provider", config.DeadLetter.Provider)
+		}
+	}
+	return opts, nil
+}
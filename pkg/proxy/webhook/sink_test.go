@@ -0,0 +1,356 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	apisconfig "github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/apis/proxy"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/provider"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/delivery"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/filter"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/apis/audit"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// closingProvider records whether it was closed by the sink
+type closingProvider struct {
+	fakeProvider
+	closed bool
+}
+
+func (c *closingProvider) Close() error {
+	c.closed = true
+	return nil
+}
+
+// recordingProvider records the audit ids and the serialized logged events
+type recordingProvider struct {
+	fakeProvider
+	mux      sync.Mutex
+	auditIDs []string
+	payloads []string
+}
+
+func (r *recordingProvider) Log(events *audit.EventList) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for i := range events.Items {
+		r.auditIDs = append(r.auditIDs, string(events.Items[i].AuditID))
+		payload, err := provider.MarshalEventV1(&events.Items[i])
+		if err != nil {
+			return err
+		}
+		r.payloads = append(r.payloads, string(payload))
+	}
+	return nil
+}
+
+func (r *recordingProvider) recorded() ([]string, []string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string{}, r.auditIDs...), append([]string{}, r.payloads...)
+}
+
+// partialProvider rejects the second event of the first logged event list and records the logged audit ids
+type partialProvider struct {
+	fakeProvider
+	logged [][]string
+}
+
+func (p *partialProvider) Log(events *audit.EventList) error {
+	auditIDs := make([]string, 0, len(events.Items))
+	for _, event := range events.Items {
+		auditIDs = append(auditIDs, string(event.AuditID))
+	}
+	p.logged = append(p.logged, auditIDs)
+	if len(p.logged) == 1 {
+		return &provider.PartialError{Errors: []provider.EventError{{Index: 1, Err: errors.New("rejected")}}}
+	}
+	return nil
+}
+
+// secretProvider records the injected secret data
+type secretProvider struct {
+	fakeProvider
+	data map[string][]byte
+}
+
+func (s *secretProvider) InjectBackendSecret(data map[string][]byte) error {
+	if len(data["password"]) == 0 {
+		return errors.New("password is missing")
+	}
+	s.data = data
+	return nil
+}
+
+const secretEventList = `{"apiVersion":"audit.k8s.io/v1","kind":"EventList","items":[` +
+	`{"apiVersion":"audit.k8s.io/v1","kind":"Event","level":"RequestResponse","auditID":"1","verb":"update","user":{"username":"admin"},"objectRef":{"resource":"secrets","namespace":"default","name":"s"},` +
+	`"requestObject":{"kind":"Secret","data":{"password":"c2VjcmV0"},"stringData":{"token":"plaintext"}},"responseObject":{"kind":"Secret","data":{"password":"c2VjcmV0","token":"cGxhaW50ZXh0"}}},` +
+	`{"apiVersion":"audit.k8s.io/v1","kind":"Event","level":"RequestResponse","auditID":"2","verb":"list","user":{"username":"admin"},"objectRef":{"resource":"secrets","namespace":"default"},` +
+	`"responseObject":{"kind":"SecretList","items":[{"kind":"Secret","data":{"password":"c2VjcmV0"}}]}}]}`
+
+const eventList = `{"apiVersion":"audit.k8s.io/v1","kind":"EventList","items":[{"apiVersion":"audit.k8s.io/v1","kind":"Event","level":"Metadata","auditID":"1","verb":"get","user":{"username":"admin"},"objectRef":{"resource":"pods"}}]}`
+
+var _ = Describe("Sink", func() {
+	var (
+		dir    string
+		config *apisconfig.Configuration
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "auditlog-sink")
+		Expect(err).ToNot(HaveOccurred())
+
+		maxSize := resource.MustParse("1Mi")
+		segmentSize := resource.MustParse("64Ki")
+		config = &apisconfig.Configuration{
+			Provider: "standard",
+			Buffer: &apisconfig.BufferConfiguration{
+				Directory:   dir,
+				MaxSize:     &maxSize,
+				SegmentSize: &segmentSize,
+				SyncPolicy:  apisconfig.SyncPolicyNever,
+			},
+			Delivery: &apisconfig.DeliveryConfiguration{
+				InitialBackoff: &metav1.Duration{Duration: time.Millisecond},
+				MaxBackoff:     &metav1.Duration{Duration: time.Millisecond},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("should drain the buffer on shutdown", func() {
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+
+		for i := 0; i < 10; i++ {
+			rec := httptest.NewRecorder()
+			sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(eventList)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+		}
+		Expect(sink.buffer.Stats().Records).To(BeNumerically("==", 10))
+
+		sink.Start()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		Expect(sink.Shutdown(ctx)).To(Succeed())
+		Expect(sink.buffer.Stats().Records).To(BeNumerically("==", 0))
+	})
+
+	It("should only buffer redacted events", func() {
+		hashKeyFile := filepath.Join(dir, "hash-key")
+		Expect(ioutil.WriteFile(hashKeyFile, []byte("key"), 0600)).To(Succeed())
+		config.HashKeyFile = hashKeyFile
+		config.Redactions = []apisconfig.Redaction{{Name: "user", Paths: []string{"user.username"}, Action: apisconfig.RedactionActionHash}}
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(secretEventList)))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		buffered := ""
+		Expect(filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || path == hashKeyFile {
+				return err
+			}
+			content, err := ioutil.ReadFile(path)
+			buffered += string(content)
+			return err
+		})).To(Succeed())
+		Expect(buffered).To(ContainSubstring(`"username":"hmac-sha256:`))
+		Expect(buffered).NotTo(ContainSubstring("admin"))
+		Expect(buffered).NotTo(ContainSubstring("c2VjcmV0"))
+		Expect(buffered).NotTo(ContainSubstring("plaintext"))
+	})
+
+	It("should close the providers that hold pending events", func() {
+		p := &closingProvider{}
+		sink := &Sink{
+			log:     log.NullLogger{},
+			outputs: []*output{{name: "closing", provider: p, delivery: delivery.New(log.NullLogger{}, p, delivery.Options{})}},
+		}
+		Expect(sink.Close()).To(Succeed())
+		Expect(p.closed).To(BeTrue())
+	})
+
+	It("should only retry the events a required output did not accept", func() {
+		p := &partialProvider{}
+		sink := &Sink{
+			log:     log.NullLogger{},
+			outputs: []*output{{name: "partial", provider: p, failurePolicy: apisconfig.FailurePolicyRequired, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, p, delivery.Options{})}},
+		}
+		events := &audit.EventList{Items: []audit.Event{{AuditID: "1"}, {AuditID: "2"}, {AuditID: "3"}}}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		Expect(sink.logWithBackoff(ctx, events)).To(Succeed())
+		Expect(p.logged).To(Equal([][]string{{"1", "2", "3"}, {"2"}}))
+	})
+
+	It("should bound the delivery of unbuffered requests by the request timeout", func() {
+		config.Buffer = nil
+		config.Delivery.RequestTimeout = &metav1.Duration{Duration: 100 * time.Millisecond}
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+		p := &fakeProvider{err: provider.NewTransientError(errors.New("unavailable"))}
+		opts := delivery.Options{MaxRetries: 5, InitialBackoff: time.Minute, MaxBackoff: time.Minute}
+		sink.outputs = []*output{{name: "unavailable", provider: p, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, p, opts)}}
+
+		start := time.Now()
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(eventList)))
+		Expect(rec.Code).To(Equal(http.StatusInternalServerError))
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+	})
+
+	It("should inject and reload the mounted secret of an output", func() {
+		secretDir := filepath.Join(dir, "secret")
+		Expect(os.MkdirAll(filepath.Join(secretDir, "..data"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(secretDir, "password"), []byte("first"), 0600)).To(Succeed())
+
+		p := &secretProvider{}
+		watcher, err := newSecretWatcher(log.NullLogger{}, p, secretDir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p.data).To(Equal(map[string][]byte{"password": []byte("first")}))
+
+		Expect(ioutil.WriteFile(filepath.Join(secretDir, "password"), []byte("second"), 0600)).To(Succeed())
+		Expect(watcher.Reload()).To(BeTrue())
+		Expect(p.data).To(Equal(map[string][]byte{"password": []byte("second")}))
+
+		// invalid secrets are not injected and the previous data is kept
+		Expect(ioutil.WriteFile(filepath.Join(secretDir, "password"), nil, 0600)).To(Succeed())
+		_, err = watcher.Reload()
+		Expect(err).To(HaveOccurred())
+		Expect(p.data).To(Equal(map[string][]byte{"password": []byte("second")}))
+	})
+
+	It("should reject secrets for providers that do not support them", func() {
+		_, err := newSecretWatcher(log.NullLogger{}, &fakeProvider{}, dir)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject event lists that cannot be decoded", func() {
+		config.Buffer = nil
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("{")))
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+	It("should apply the rules before the events are written to the outputs", func() {
+		config.Buffer = nil
+		config.Rules = []apisconfig.Rule{
+			{Name: "sink-drop-pod-reads", Match: apisconfig.EventMatcher{Verbs: []string{"get"}, Resources: []apisconfig.GroupResources{{Resources: []string{"pods"}}}}, Action: apisconfig.RuleActionDrop},
+		}
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+		p := &recordingProvider{}
+		sink.outputs = []*output{{name: "recording", provider: p, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, p, delivery.Options{})}}
+
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(eventList)))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(p.auditIDs).To(BeEmpty())
+
+		rec = httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(strings.Replace(eventList, `"verb":"get"`, `"verb":"list"`, 1))))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(p.auditIDs).To(Equal([]string{"1"}))
+
+		registry, err := newMetricsRegistry(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(metricValue(registry, "auditlog_proxy_rule_events_total",
+			map[string]string{"rule": "sink-drop-pod-reads", "action": "Drop", "decision": "dropped"})).To(Equal(float64(1)))
+	})
+
+	It("should attach the shoot metadata to the events", func() {
+		config.Buffer = nil
+		config.Shoot = &apisconfig.ShootMetadata{Name: "bar", Project: "foo", TechnicalID: "shoot--foo--bar"}
+		sink, err := NewSink(log.NullLogger{}, config)
+		Expect(err).ToNot(HaveOccurred())
+		defer sink.Close()
+		p := &recordingProvider{}
+		sink.outputs = []*output{{name: "recording", provider: p, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, p, delivery.Options{})}}
+
+		rec := httptest.NewRecorder()
+		sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(eventList)))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+
+		_, payloads := p.recorded()
+		Expect(payloads).To(HaveLen(1))
+		Expect(payloads[0]).To(ContainSubstring(`"annotations":{"shoot.gardener.cloud/name":"bar","shoot.gardener.cloud/project":"foo","shoot.gardener.cloud/technical-id":"shoot--foo--bar"}`))
+	})
+
+	It("should never write the data of secrets to the outputs", func() {
+		for _, buffered := range []bool{false, true} {
+			if !buffered {
+				config.Buffer = nil
+			}
+			sink, err := NewSink(log.NullLogger{}, config)
+			Expect(err).ToNot(HaveOccurred())
+			required, bestEffort := &recordingProvider{}, &recordingProvider{}
+			sink.outputs = []*output{
+				{name: "required", provider: required, failurePolicy: apisconfig.FailurePolicyRequired, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, required, delivery.Options{})},
+				{name: "best-effort", provider: bestEffort, filter: filter.New(nil), delivery: delivery.New(log.NullLogger{}, bestEffort, delivery.Options{}), failurePolicy: apisconfig.FailurePolicyBestEffort},
+			}
+			sink.Start()
+
+			rec := httptest.NewRecorder()
+			sink.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(secretEventList)))
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			Expect(sink.Shutdown(ctx)).To(Succeed())
+			cancel()
+
+			for _, p := range []*recordingProvider{required, bestEffort} {
+				auditIDs, payloads := p.recorded()
+				Expect(auditIDs).To(Equal([]string{"1", "2"}), "buffered: %t", buffered)
+				for _, payload := range payloads {
+					Expect(payload).To(ContainSubstring(`"password":"******"`))
+					Expect(payload).NotTo(ContainSubstring("c2VjcmV0"))
+					Expect(payload).NotTo(ContainSubstring("cGxhaW50ZXh0"))
+					Expect(payload).NotTo(ContainSubstring("plaintext"))
+				}
+			}
+		}
+	})
+})
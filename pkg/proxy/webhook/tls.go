@@ -0,0 +1,68 @@
+// Copyright 2020 Copyright (c) 2020 SAP SE or an SAP affiliate company. All rights reserved. This file is licensed under the Apache Software License, v. 2 except as noted otherwise in the LICENSE file.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"crypto/tls"
+	"github.com/gardener/gardener-extension-shoot-auditlog-service/pkg/proxy/reload"
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"sync"
+)
+
+// certificateReloader serves the key pair of the configured files and reloads it whenever the files change
+// so that a renewed serving certificate is used without a restart.
+type certificateReloader struct {
+	log     logr.Logger
+	watcher *reload.Watcher
+
+	mux  sync.RWMutex
+	cert *tls.Certificate
+}
+
+// newCertificateReloader creates a new reloader for the given key pair
+func newCertificateReloader(log logr.Logger, certFile, keyFile string) (*certificateReloader, error) {
+	c := &certificateReloader{log: log}
+	watcher, err := reload.NewWatcher(log, reload.DefaultInterval, c.setCertificate, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.watcher = watcher
+	return c, nil
+}
+
+// Start reloads the key pair on changes until the stop channel is closed.
+func (c *certificateReloader) Start(stop <-chan struct{}) {
+	c.watcher.Start(stop)
+}
+
+func (c *certificateReloader) setCertificate(data [][]byte) error {
+	cert, err := tls.X509KeyPair(data[0], data[1])
+	if err != nil {
+		return errors.Wrap(err, "unable to load key pair")
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.cert = &cert
+	return nil
+}
+
+// GetCertificate returns the current serving certificate
+func (c *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.cert, nil
+}